@@ -5,6 +5,7 @@ go 1.23.1
 require (
 	fyne.io/fyne/v2 v2.5.1
 	github.com/dhowden/tag v0.0.0-20240417053706-3d75831295e8
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.23
 )
 
@@ -0,0 +1,103 @@
+package controller
+
+import (
+    "fmt"
+    "path/filepath"
+    "time"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// backupCheckInterval es cada cuánto se revisa si ya toca hacer el respaldo automático.
+const backupCheckInterval = time.Hour
+
+// StartBackupSchedule respalda la base de datos en una gorutina cada vez que pasan las horas configuradas desde el
+// último respaldo, conservando sólo el número de respaldos configurado. La primera revisión se hace de inmediato.
+func (mc *MusicController) StartBackupSchedule() {
+    go func() {
+        for {
+            config := mc.ConfigFile
+            path, err := model.BackupIfDue(mc.DB, config.BackupDir(), config.BackupCount, time.Duration(config.BackupInterval)*time.Hour)
+            if err != nil {
+                fmt.Println("Error al respaldar la base de datos:", err)
+            } else if path != "" {
+                fmt.Println("Respaldo de la base de datos creado en:", path)
+            }
+            time.Sleep(backupCheckInterval)
+        }
+    }()
+}
+
+// BackupNow respalda la base de datos de inmediato y conserva sólo el número de respaldos configurado.
+func (mc *MusicController) BackupNow() (string, error) {
+    path, err := model.BackupDatabase(mc.DB, mc.ConfigFile.BackupDir())
+    if err != nil {
+        return "", err
+    }
+    if mc.ConfigFile.BackupCount > 0 {
+        return path, model.RotateBackups(mc.ConfigFile.BackupDir(), mc.ConfigFile.BackupCount)
+    }
+    return path, nil
+}
+
+// ListBackups regresa los respaldos de la base de datos, del más reciente al más antiguo.
+func (mc *MusicController) ListBackups() ([]model.Backup, error) {
+    return model.ListBackups(mc.ConfigFile.BackupDir())
+}
+
+// RestoreBackup reemplaza la base de datos por un respaldo, después de respaldar la actual.
+func (mc *MusicController) RestoreBackup(backup model.Backup) (string, error) {
+    return model.RestoreBackup(mc.DB, backup.Path, mc.ConfigFile.BackupDir())
+}
+
+// backupOption describe un respaldo en la lista de respaldos que se pueden restaurar.
+func backupOption(backup model.Backup) string {
+    return fmt.Sprintf("%s (%.1f MB)", backup.Created.Format("2006-01-02 15:04:05"), float64(backup.Size)/(1024*1024))
+}
+
+// showRestoreDialog muestra los respaldos para elegir uno y restaurarlo. La función onRestore se llama después de
+// restaurar, para refrescar la tabla principal.
+func (mc *MusicController) showRestoreDialog(parent fyne.Window, onRestore func()) {
+    backups, err := mc.ListBackups()
+    if err != nil {
+        dialog.ShowError(err, parent)
+        return
+    }
+    if len(backups) == 0 {
+        dialog.ShowInformation("Restaurar", "No hay respaldos en "+mc.ConfigFile.BackupDir(), parent)
+        return
+    }
+    options := make([]string, len(backups))
+    byOption := map[string]model.Backup{}
+    for i, backup := range backups {
+        options[i] = backupOption(backup)
+        byOption[options[i]] = backup
+    }
+    backupSelect := widget.NewSelect(options, nil)
+    backupSelect.SetSelected(options[0])
+
+    dialog.ShowCustomConfirm("Restaurar respaldo", "Restaurar", "Cancelar", backupSelect, func(confirmed bool) {
+        backup, ok := byOption[backupSelect.Selected]
+        if !confirmed || !ok {
+            return
+        }
+        message := fmt.Sprintf("¿Reemplazar la base de datos por el respaldo del %s? Antes se respaldará la base de "+
+            "datos actual.", backup.Created.Format("2006-01-02 15:04:05"))
+        dialog.ShowConfirm("Restaurar respaldo", message, func(confirmed bool) {
+            if !confirmed {
+                return
+            }
+            current, err := mc.RestoreBackup(backup)
+            if err != nil {
+                dialog.ShowError(err, parent)
+                return
+            }
+            onRestore()
+            dialog.ShowInformation("Restaurar respaldo", "Respaldo restaurado. La base de datos anterior se guardó en "+
+                filepath.Base(current)+".", parent)
+        }, parent)
+    }, parent)
+}
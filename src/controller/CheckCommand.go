@@ -0,0 +1,89 @@
+package controller
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// RunCheckCommand ejecuta el subcomando "check", que revisa la base de datos desde la terminal sin abrir la interfaz:
+//
+//    MusicDataBase check [-db ruta] [-repair] [-remove-missing]
+//
+// Escribe los problemas encontrados y las reparaciones hechas en stdout y los errores en stderr. Regresa el código de
+// salida: 0 si la base de datos no tiene problemas (o se repararon todos), 1 si quedan problemas y 2 si hubo un error.
+func RunCheckCommand(args []string, stdout, stderr io.Writer) int {
+    flags := flag.NewFlagSet("check", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    dbPath := flags.String("db", "", "ruta de la base de datos (por defecto la del archivo de configuración)")
+    repair := flags.Bool("repair", false, "reparar los problemas que se puedan reparar automáticamente")
+    removeMissing := flags.Bool("remove-missing", false, "con -repair, eliminar las canciones cuyos archivos ya no existen")
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+    if *dbPath == "" {
+        configFile := model.NewConfigurationFile()
+        if configFile == nil {
+            fmt.Fprintln(stderr, "Error al leer la configuración")
+            return 2
+        }
+        *dbPath = configFile.DefaultDBPath
+    }
+    // Abrir una ruta que no existe crearía una base de datos vacía.
+    if _, err := os.Stat(*dbPath); err != nil {
+        fmt.Fprintf(stderr, "Error al abrir la base de datos: %v\n", err)
+        return 2
+    }
+    db, err := model.OpenDB(*dbPath)
+    if err != nil {
+        fmt.Fprintf(stderr, "Error al abrir la base de datos: %v\n", err)
+        return 2
+    }
+    defer db.Close()
+
+    check, err := model.CheckDatabase(db)
+    if err != nil {
+        fmt.Fprintf(stderr, "Error al revisar la base de datos: %v\n", err)
+        return 2
+    }
+    if check.OK() {
+        fmt.Fprintln(stdout, "La base de datos no tiene problemas.")
+        return 0
+    }
+    for _, problem := range check.Problems() {
+        fmt.Fprintln(stdout, problem)
+    }
+    for _, path := range check.MissingFiles {
+        fmt.Fprintf(stdout, "  no existe: %s\n", path)
+    }
+    if !*repair {
+        fmt.Fprintln(stdout, "Ejecuta el comando con -repair para reparar la base de datos.")
+        return 1
+    }
+
+    repairs, err := model.RepairDatabase(db, check, *removeMissing)
+    for _, done := range repairs {
+        fmt.Fprintln(stdout, done)
+    }
+    if err != nil {
+        fmt.Fprintf(stderr, "Error al reparar la base de datos: %v\n", err)
+        return 2
+    }
+    check, err = model.CheckDatabase(db)
+    if err != nil {
+        fmt.Fprintf(stderr, "Error al revisar la base de datos: %v\n", err)
+        return 2
+    }
+    if !check.OK() {
+        fmt.Fprintln(stdout, "Problemas que quedan:")
+        for _, problem := range check.Problems() {
+            fmt.Fprintln(stdout, problem)
+        }
+        return 1
+    }
+    fmt.Fprintln(stdout, "La base de datos quedó sin problemas.")
+    return 0
+}
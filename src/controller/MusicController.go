@@ -3,10 +3,15 @@ package controller
 import (
     "database/sql"
     "fmt"
+    "io"
     "os/exec"
-    "strconv" // Importado para convertir int a string
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
 
     "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
     "fyne.io/fyne/v2/dialog"
     "fyne.io/fyne/v2/widget"
     _ "github.com/mattn/go-sqlite3"
@@ -17,59 +22,75 @@ type MusicController struct {
     ConfigFile    *model.ConfigurationFile
     MP3Miner      *model.MP3Miner
     MusicDatabase *model.MusicDataBase
-    DB            *sql.DB
-    Compiler      *model.Compiler
+    Repository    model.Repository // Canciones, álbumes e intérpretes: la base de datos SQLite o el catálogo compartido.
+    DB            *sql.DB          // Pool de conexiones de la base de datos SQLite, para la edición y los análisis.
+    CurrentSongs  []model.Song     // Canciones mostradas actualmente en la tabla, en el mismo orden que sus filas.
+    Columns       []*SongColumn    // Columnas de la tabla de canciones, visibles u ocultas.
+    KeepBackups   bool             // Indica si al editar las etiquetas se guarda una copia del archivo original (.bak).
 }
 
 // NewMusicController crea una nueva instancia de MusicController.
 // Inicializa los modelos de archivo de configuración, MP3Miner, base de datos y conexión a la base de datos SQLite.
 func NewMusicController() *MusicController {
     configFile := model.NewConfigurationFile()
-    mp3Miner := &model.MP3Miner{}
+    mp3Miner := &model.MP3Miner{
+        CoverDir:            configFile.CoverCacheDir,
+        CheckIntegrity:      configFile.CheckIntegrity,
+        ComputeFingerprints: configFile.ComputeFingerprints,
+        WriteReplayGain:     configFile.WriteReplayGain,
+    }
+    if templates, err := model.ParsePathTemplates(configFile.PathTemplates); err != nil {
+        fmt.Println("Error en las plantillas de rutas:", err)
+    } else {
+        mp3Miner.PathTemplates = templates
+    }
     musicDatabase := model.NewMusicDataBase(configFile.DefaultDBPath)
 
-    db, err := sql.Open("sqlite3", configFile.DefaultDBPath)
+    repository, err := model.OpenSQLiteRepository(configFile.DefaultDBPath)
     if err != nil {
     dialog.ShowError(fmt.Errorf("Error al abrir la base de datos: %v", err), nil)
     return nil
     }
 
+    // Con DB_DSN las canciones se leen y se minan en el catálogo compartido de PostgreSQL; la base de datos local
+    // sigue abierta para los respaldos y la revisión de integridad.
+    var catalog model.Repository = repository
+    if configFile.DatabaseDSN != "" {
+        shared, err := model.OpenPostgresRepository(configFile.DatabaseDSN)
+        if err != nil {
+            dialog.ShowError(fmt.Errorf("Error al abrir el catálogo compartido: %v", err), nil)
+            return nil
+        }
+        catalog = shared
+    }
+
     return &MusicController{
         ConfigFile:    configFile,
         MP3Miner:      mp3Miner,
         MusicDatabase: musicDatabase,
-        DB:            db,
+        Repository:    catalog,
+        DB:            repository.DB(),
+        Columns:       defaultSongColumns(),
+        KeepBackups:   configFile.KeepTagBackups,
     }
 }
 
-// GetAllSongs devuelve todas las canciones almacenadas en la base de datos.
-// Hace una consulta SQL que une las tablas de canciones, intérpretes y álbumes, devolviendo un arreglo de canciones.
-func (mc *MusicController) GetAllSongs() ([]model.Song, error) {
-    rows, err := mc.DB.Query(
-        "SELECT r.id_rola, r.title, p.name, a.name, r.year, r.genre, r.track " +
-            "FROM rolas r " +
-            "JOIN performers p ON r.id_performer = p.id_performer " +
-            "JOIN albums a ON r.id_album = a.id_album")
-    if err != nil {
-        return nil, fmt.Errorf("error al obtener las canciones: %v", err)
-    }
-    defer rows.Close()
-
-    var songs []model.Song
-    for rows.Next() {
-        var song model.Song
-        err := rows.Scan(&song.IDRola, &song.Title, &song.Artist, &song.Album, &song.Year, &song.Genre, &song.Track)
-        if err != nil {
-            return nil, fmt.Errorf("error al escanear canción: %v", err)
-        }
-        songs = append(songs, song)
-    }
+// LocalCatalog indica si las canciones están en la base de datos SQLite local. La edición, los análisis, los
+// duplicados, los géneros, la organización de archivos y el mantenimiento sólo están disponibles con ella, porque
+// trabajan sobre mc.DB y con los IDs de sus canciones; los intérpretes se unen con cualquier Repository.
+func (mc *MusicController) LocalCatalog() bool {
+    _, ok := mc.Repository.(*model.SQLiteRepository)
+    return ok
+}
 
-    if err = rows.Err(); err != nil {
-        return nil, fmt.Errorf("error en la iteración de canciones: %v", err)
-    }
+// errSharedCatalog es el error de las operaciones que no están disponibles con el catálogo compartido.
+func errSharedCatalog() error {
+    return fmt.Errorf("la operación sólo está disponible con la base de datos local, no con el catálogo compartido")
+}
 
-    return songs, nil
+// GetAllSongs devuelve todas las canciones almacenadas en el repositorio, excepto las ocultas.
+func (mc *MusicController) GetAllSongs() ([]model.Song, error) {
+    return mc.Repository.Songs()
 }
 
 // CreateSongTableData crea los datos de la tabla a partir de las canciones en la base de datos.
@@ -80,19 +101,8 @@ func (mc *MusicController) CreateSongTableData() ([][]string, error) {
         return nil, fmt.Errorf("error al obtener canciones: %v", err)
     }
 
-    songData := make([][]string, len(songs))
-    for i, song := range songs {
-        songData[i] = []string{
-            song.Title,
-            song.Artist,
-            song.Album,
-            strconv.Itoa(song.Year),   // Convertir int a string
-            song.Genre,
-            strconv.Itoa(song.Track),  // Convertir int a string
-        }
-    }
-
-    return songData, nil
+    mc.CurrentSongs = songs
+    return mc.songsToTableData(songs), nil
 }
 
 // SearchSongsTableData busca canciones en la base de datos con base en el string de búsqueda proporcionado.
@@ -103,37 +113,156 @@ func (mc *MusicController) SearchSongsTableData(searchString string) ([][]string
         return nil, fmt.Errorf("error al buscar canciones: %v", err)
     }
 
+    mc.CurrentSongs = songs
     if len(songs) == 0 {
         return [][]string{}, nil
     }
 
+    return mc.songsToTableData(songs), nil
+}
+
+// AlbumSongsTableData obtiene las canciones de un álbum ordenadas por disco y pista, y devuelve los datos de la tabla.
+func (mc *MusicController) AlbumSongsTableData(idAlbum int) ([][]string, error) {
+    songs, err := mc.Repository.AlbumSongs(idAlbum)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las canciones del álbum: %v", err)
+    }
+
+    mc.CurrentSongs = songs
+    return mc.songsToTableData(songs), nil
+}
+
+// CurrentTableData vuelve a generar las filas de las canciones mostradas actualmente,
+// por ejemplo después de cambiar las columnas visibles.
+func (mc *MusicController) CurrentTableData() [][]string {
+    return mc.songsToTableData(mc.CurrentSongs)
+}
+
+// songsToTableData convierte un arreglo de canciones en las filas de la tabla de la vista.
+// El orden de las columnas corresponde a VisibleColumns.
+func (mc *MusicController) songsToTableData(songs []model.Song) [][]string {
+    columns := mc.VisibleColumns()
     songData := make([][]string, len(songs))
     for i, song := range songs {
-        songData[i] = []string{
-            song.Title,
-            song.Artist,
-            song.Album,
-            strconv.Itoa(song.Year),   // Convertir int a string
-            song.Genre,
-            strconv.Itoa(song.Track),  // Convertir int a string
+        songData[i] = make([]string, len(columns))
+        for j, column := range columns {
+            songData[i][j] = column.Value(song)
+        }
+    }
+    return songData
+}
+
+// SongAt devuelve la canción que se muestra en la fila indicada de la tabla (sin contar el encabezado).
+func (mc *MusicController) SongAt(row int) (model.Song, bool) {
+    if row < 0 || row >= len(mc.CurrentSongs) {
+        return model.Song{}, false
+    }
+    return mc.CurrentSongs[row], true
+}
+
+// ReloadSong vuelve a leer una canción del repositorio y la reemplaza entre las canciones mostradas,
+// para que la tabla muestre sus datos nuevos sin cambiar el orden ni el filtro actual.
+func (mc *MusicController) ReloadSong(idRola int) (model.Song, error) {
+    song, err := mc.Repository.Song(idRola)
+    if err != nil {
+        return model.Song{}, err
+    }
+    for i := range mc.CurrentSongs {
+        if mc.CurrentSongs[i].IDRola == idRola {
+            mc.CurrentSongs[i] = song
         }
     }
+    return song, nil
+}
 
-    return songData, nil
+// EditSong guarda los datos editados de una canción en la base de datos y en las etiquetas de su archivo.
+func (mc *MusicController) EditSong(song model.Song, edit model.SongEdit) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.UpdateSongTags(mc.DB, song, edit, mc.KeepBackups)
 }
 
-// SearchSongs busca canciones utilizando un compilador de consultas y devuelve los resultados como un arreglo de canciones.
+// SongsAtRows devuelve las canciones de las filas indicadas de la tabla (sin contar el encabezado), en orden de fila.
+func (mc *MusicController) SongsAtRows(rows []int) []model.Song {
+    sorted := append([]int(nil), rows...)
+    sort.Ints(sorted)
+
+    var songs []model.Song
+    for _, row := range sorted {
+        if song, ok := mc.SongAt(row); ok {
+            songs = append(songs, song)
+        }
+    }
+    return songs
+}
+
+// PlanBulkEdit calcula, sin guardar nada, los cambios que haría una operación de edición en lote sobre las canciones.
+func (mc *MusicController) PlanBulkEdit(songs []model.Song, op model.BulkOperation) ([]model.BulkChange, error) {
+    return model.PlanBulkEdit(songs, op)
+}
+
+// ApplyBulkEdit guarda los cambios de una edición en lote en la base de datos y, con writeFiles, en las etiquetas
+// de los archivos MP3. Las canciones que cambiaron se vuelven a leer para que la tabla muestre sus datos nuevos.
+func (mc *MusicController) ApplyBulkEdit(changes []model.BulkChange, writeFiles bool) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    if err := model.ApplyBulkEdit(mc.DB, changes, writeFiles, mc.KeepBackups); err != nil {
+        return err
+    }
+    for _, change := range changes {
+        mc.ReloadSong(change.Song.IDRola)
+    }
+    return nil
+}
+
+// Undo deshace la última operación de la bitácora (ediciones, canciones ocultas...) y regresa su descripción.
+func (mc *MusicController) Undo() (string, error) {
+    if !mc.LocalCatalog() {
+        return "", errSharedCatalog()
+    }
+    return model.Undo(mc.DB)
+}
+
+// Redo vuelve a hacer la última operación deshecha y regresa su descripción.
+func (mc *MusicController) Redo() (string, error) {
+    if !mc.LocalCatalog() {
+        return "", errSharedCatalog()
+    }
+    return model.Redo(mc.DB)
+}
+
+// GetSongLyrics devuelve las letras guardadas de una canción. Con el catálogo compartido no regresa ninguna.
+func (mc *MusicController) GetSongLyrics(idRola int) ([]model.Lyrics, error) {
+    if !mc.LocalCatalog() {
+        return nil, nil
+    }
+    return model.GetLyrics(mc.DB, idRola)
+}
+
+// GetSongTagFrames devuelve todas las tramas de las etiquetas de una canción, tal como se leyeron al minar. Con el
+// catálogo compartido no regresa ninguna.
+func (mc *MusicController) GetSongTagFrames(idRola int) ([]model.TagFrame, error) {
+    if !mc.LocalCatalog() {
+        return nil, nil
+    }
+    return model.GetTagFrames(mc.DB, idRola)
+}
+
+// GetAllAlbums devuelve todos los álbumes del repositorio con la ruta de su portada, ordenados por nombre.
+func (mc *MusicController) GetAllAlbums() ([]model.Album, error) {
+    return mc.Repository.Albums()
+}
+
+// SearchSongs busca canciones en el repositorio y devuelve los resultados como un arreglo de canciones.
 // Si el string de búsqueda está vacío, se devuelve el conjunto completo de canciones.
 func (mc *MusicController) SearchSongs(searchString string) ([]model.Song, error) {
     if searchString == "" {
         return mc.GetAllSongs()
     }
 
-    if mc.Compiler == nil {
-        mc.Compiler = &model.Compiler{}
-    }
-
-    songs, err := mc.Compiler.CompileSearch(searchString, mc.DB)
+    songs, err := mc.Repository.Search(searchString)
     if err != nil {
         return nil, fmt.Errorf("error al buscar canciones: %v", err)
     }
@@ -151,16 +280,314 @@ func (mc *MusicController) StartMiningWithProgress(parent fyne.Window, progressB
         }
     }()
         totalFiles := mc.MP3Miner.GetTotalFiles(mc.ConfigFile.DefaultMusicDir)
-        mc.MP3Miner.MineDirectoryWithProgress(mc.ConfigFile.DefaultMusicDir, mc.ConfigFile.DefaultDBPath, progressBar, totalFiles)
+        mc.MP3Miner.MineDirectoryWithProgress(mc.ConfigFile.DefaultMusicDir, mc.Repository, progressBar, totalFiles)
         onMiningComplete()
         dialog.ShowInformation("Miner", "Minería completada.", parent)
     }()
 }
 
+// StartIntegrityCheckWithProgress revisa en una gorutina la integridad de todos los MP3 de la biblioteca.
+// Muestra el avance en la barra de progreso y, al terminar, cuántas canciones tienen problemas.
+func (mc *MusicController) StartIntegrityCheckWithProgress(parent fyne.Window, progressBar *widget.ProgressBar, onCheckComplete func()) {
+    if !mc.LocalCatalog() {
+        dialog.ShowError(errSharedCatalog(), parent)
+        return
+    }
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                dialog.ShowError(fmt.Errorf("Error inesperado durante la verificación: %v", r), parent)
+            }
+        }()
+        damaged, err := mc.MP3Miner.CheckIntegrityWithProgress(mc.DB, progressBar)
+        if err != nil {
+            dialog.ShowError(err, parent)
+            return
+        }
+        onCheckComplete()
+        dialog.ShowInformation("Verificación", fmt.Sprintf("Verificación completada. Canciones con problemas: %d", damaged), parent)
+    }()
+}
+
+// StartFingerprintingWithProgress calcula en una gorutina las huellas acústicas que faltan.
+// Muestra el avance en la barra de progreso y, al terminar, cuántas huellas se calcularon.
+func (mc *MusicController) StartFingerprintingWithProgress(parent fyne.Window, progressBar *widget.ProgressBar, onComplete func()) {
+    if !mc.LocalCatalog() {
+        dialog.ShowError(errSharedCatalog(), parent)
+        return
+    }
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                dialog.ShowError(fmt.Errorf("Error inesperado al calcular las huellas: %v", r), parent)
+            }
+        }()
+        count, err := mc.MP3Miner.FingerprintWithProgress(mc.DB, progressBar)
+        if err != nil {
+            dialog.ShowError(err, parent)
+            return
+        }
+        onComplete()
+        dialog.ShowInformation("Huellas acústicas", fmt.Sprintf("Huellas calculadas: %d", count), parent)
+    }()
+}
+
+// StartLoudnessAnalysisWithProgress mide en una gorutina la sonoridad EBU R128 de las rolas que faltan.
+// Muestra el avance en la barra de progreso y, al terminar, cuántas rolas se analizaron.
+func (mc *MusicController) StartLoudnessAnalysisWithProgress(parent fyne.Window, progressBar *widget.ProgressBar, onComplete func()) {
+    if !mc.LocalCatalog() {
+        dialog.ShowError(errSharedCatalog(), parent)
+        return
+    }
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                dialog.ShowError(fmt.Errorf("Error inesperado al medir la sonoridad: %v", r), parent)
+            }
+        }()
+        count, err := mc.MP3Miner.AnalyzeLoudnessWithProgress(mc.DB, progressBar)
+        if err != nil {
+            dialog.ShowError(err, parent)
+            return
+        }
+        onComplete()
+        dialog.ShowInformation("Sonoridad", fmt.Sprintf("Rolas analizadas: %d", count), parent)
+    }()
+}
+
+// StartTempoKeyAnalysisWithProgress estima en una gorutina el tempo y la tonalidad de las rolas que no los
+// tienen en sus etiquetas. Muestra el avance en la barra de progreso y, al terminar, cuántas rolas se analizaron.
+func (mc *MusicController) StartTempoKeyAnalysisWithProgress(parent fyne.Window, progressBar *widget.ProgressBar, onComplete func()) {
+    if !mc.LocalCatalog() {
+        dialog.ShowError(errSharedCatalog(), parent)
+        return
+    }
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                dialog.ShowError(fmt.Errorf("Error inesperado al estimar el tempo y la tonalidad: %v", r), parent)
+            }
+        }()
+        count, err := mc.MP3Miner.AnalyzeTempoKeyWithProgress(mc.DB, progressBar)
+        if err != nil {
+            dialog.ShowError(err, parent)
+            return
+        }
+        onComplete()
+        dialog.ShowInformation("Tempo y tonalidad", fmt.Sprintf("Rolas analizadas: %d", count), parent)
+    }()
+}
+
+// PathTemplatePreview es lo que se deduciría de la ruta de un archivo de ejemplo con las plantillas de rutas.
+type PathTemplatePreview struct {
+    Path   string                     // Ruta del archivo, relativa al directorio de música.
+    Fields map[string]model.PathField // Datos deducidos de la ruta, por campo.
+}
+
+// PreviewPathTemplates compila las plantillas (una por línea) y las aplica a una muestra de los archivos del directorio
+// de música, sin guardar nada, para revisar lo que se deduciría de cada ruta antes de usarlas al minar.
+func (mc *MusicController) PreviewPathTemplates(lines []string, sampleSize int) ([]PathTemplatePreview, error) {
+    templates, err := model.ParsePathTemplates(lines)
+    if err != nil {
+        return nil, err
+    }
+
+    musicDir := mc.ConfigFile.DefaultMusicDir
+    var previews []PathTemplatePreview
+    for _, path := range model.SamplePaths(musicDir, sampleSize) {
+        relative, err := filepath.Rel(musicDir, path)
+        if err != nil {
+            relative = path
+        }
+        previews = append(previews, PathTemplatePreview{Path: relative, Fields: model.InferPathFields(path, musicDir, templates)})
+    }
+    return previews, nil
+}
+
+// SetPathTemplates cambia las plantillas de rutas que usa el minero y las guarda en el archivo de configuración.
+func (mc *MusicController) SetPathTemplates(lines []string) error {
+    templates, err := model.ParsePathTemplates(lines)
+    if err != nil {
+        return err
+    }
+
+    mc.MP3Miner.PathTemplates = templates
+    mc.ConfigFile.PathTemplates = nil
+    for _, template := range templates {
+        mc.ConfigFile.PathTemplates = append(mc.ConfigFile.PathTemplates, template.Text)
+    }
+    return mc.ConfigFile.Save()
+}
+
+// OrganizeTemplateText regresa la plantilla del organizador guardada en la configuración, o la plantilla por defecto.
+func (mc *MusicController) OrganizeTemplateText() string {
+    if mc.ConfigFile.OrganizeTemplate != "" {
+        return mc.ConfigFile.OrganizeTemplate
+    }
+    return model.DefaultOrganizeTemplate
+}
+
+// PlanOrganize calcula, sin mover nada, la ruta nueva de los archivos de las canciones mostradas en la tabla según
+// la plantilla, dentro del directorio de música.
+func (mc *MusicController) PlanOrganize(text string) ([]model.OrganizeMove, error) {
+    if !mc.LocalCatalog() {
+        return nil, errSharedCatalog()
+    }
+    template, err := model.ParseOrganizeTemplate(text)
+    if err != nil {
+        return nil, err
+    }
+    return model.PlanOrganize(mc.DB, mc.CurrentSongs, mc.ConfigFile.DefaultMusicDir, template)
+}
+
+// ApplyOrganize mueve los archivos planeados con PlanOrganize y guarda la plantilla en el archivo de configuración.
+func (mc *MusicController) ApplyOrganize(text string, moves []model.OrganizeMove) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    if err := model.ApplyOrganize(mc.DB, moves); err != nil {
+        return err
+    }
+    mc.ConfigFile.OrganizeTemplate = strings.TrimSpace(text)
+    return mc.ConfigFile.Save()
+}
+
+// ExportDamagedSongs escribe en un archivo de texto la lista de canciones dañadas (ruta, estado y detalle
+// separados por tabuladores) para volver a obtenerlas. Regresa el número de canciones exportadas.
+func (mc *MusicController) ExportDamagedSongs(writer io.Writer) (int, error) {
+    if !mc.LocalCatalog() {
+        return 0, errSharedCatalog()
+    }
+    songs, err := model.GetDamagedSongs(mc.DB)
+    if err != nil {
+        return 0, err
+    }
+
+    for _, song := range songs {
+        if _, err := fmt.Fprintf(writer, "%s\t%s\t%s\n", song.Path, song.Status, song.Detail); err != nil {
+            return 0, fmt.Errorf("error al escribir la lista: %v", err)
+        }
+    }
+    return len(songs), nil
+}
+
+// FindDuplicates busca grupos de canciones duplicadas por título, performer y duración y, opcionalmente,
+// por el hash de sus tramas de audio y por sus huellas acústicas.
+func (mc *MusicController) FindDuplicates(byAudioHash, byFingerprint bool) ([]model.DuplicateGroup, error) {
+    if !mc.LocalCatalog() {
+        return nil, errSharedCatalog()
+    }
+    groups, err := model.FindDuplicates(mc.DB, byAudioHash, byFingerprint)
+    if err != nil {
+        return nil, fmt.Errorf("error al buscar duplicados: %v", err)
+    }
+    return groups, nil
+}
+
+// KeepDuplicate conserva la canción elegida de un grupo de duplicados y oculta las demás copias.
+func (mc *MusicController) KeepDuplicate(group model.DuplicateGroup, keepID int) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.KeepDuplicate(mc.DB, group, keepID)
+}
+
+// SetSongHidden oculta o vuelve a mostrar una canción.
+func (mc *MusicController) SetSongHidden(idRola int, hidden bool) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.SetSongHidden(mc.DB, idRola, hidden)
+}
+
+// GetGenres regresa los géneros de la biblioteca con su género principal, sus alias y su número de canciones.
+func (mc *MusicController) GetGenres() ([]model.Genre, error) {
+    if !mc.LocalCatalog() {
+        return nil, errSharedCatalog()
+    }
+    return model.GetGenres(mc.DB)
+}
+
+// SetGenreParent hace de un género un subgénero de otro, o un género principal si parent es 0.
+func (mc *MusicController) SetGenreParent(genre model.Genre, parent int) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.SetGenreParent(mc.DB, genre, parent)
+}
+
+// MergeGenre une un género con otro; su nombre queda como alias del otro.
+func (mc *MusicController) MergeGenre(genre, into model.Genre) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.MergeGenre(mc.DB, genre, into)
+}
+
+// AddGenreAlias agrega otro nombre de un género.
+func (mc *MusicController) AddGenreAlias(alias string, genre model.Genre) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.AddGenreAlias(mc.DB, alias, genre)
+}
+
+// RemoveGenreAlias elimina un alias de un género.
+func (mc *MusicController) RemoveGenreAlias(alias string) error {
+    if !mc.LocalCatalog() {
+        return errSharedCatalog()
+    }
+    return model.RemoveGenreAlias(mc.DB, alias)
+}
+
+// SuggestPerformerMerges agrupa los intérpretes cuyos nombres parecen ser el mismo.
+func (mc *MusicController) SuggestPerformerMerges() ([]model.PerformerCluster, error) {
+    return mc.Repository.SuggestPerformerMerges()
+}
+
+// FindPerformers regresa, como un solo grupo para unirlos, los intérpretes cuyo nombre contiene el texto indicado
+// (sin distinguir mayúsculas, acentos ni puntuación).
+func (mc *MusicController) FindPerformers(text string) (model.PerformerCluster, error) {
+    performers, err := mc.Repository.Performers()
+    if err != nil {
+        return model.PerformerCluster{}, err
+    }
+    var cluster model.PerformerCluster
+    wanted := model.NormalizeText(text)
+    for _, performer := range performers {
+        if strings.Contains(model.NormalizeText(performer.Name), wanted) {
+            cluster.Performers = append(cluster.Performers, performer)
+        }
+    }
+    return cluster, nil
+}
+
+// MergePerformers une varios intérpretes en el intérprete into.
+func (mc *MusicController) MergePerformers(performers []model.Performer, into model.Performer) error {
+    return mc.Repository.MergePerformers(performers, into)
+}
+
+// CheckDatabase revisa la integridad de la base de datos sin modificarla.
+func (mc *MusicController) CheckDatabase() (model.DatabaseCheck, error) {
+    if !mc.LocalCatalog() {
+        return model.DatabaseCheck{}, errSharedCatalog()
+    }
+    return model.CheckDatabase(mc.DB)
+}
+
+// RepairDatabase repara los problemas encontrados por CheckDatabase. Con removeMissing también elimina las canciones
+// cuyos archivos ya no existen.
+func (mc *MusicController) RepairDatabase(check model.DatabaseCheck, removeMissing bool) ([]string, error) {
+    if !mc.LocalCatalog() {
+        return nil, errSharedCatalog()
+    }
+    return model.RepairDatabase(mc.DB, check, removeMissing)
+}
+
 // CheckConfigAndDB verifica si existen la base de datos y el archivo de configuración.
 // Si no existen, los crea utilizando los métodos apropiados de los modelos.
 func (mc *MusicController) CheckConfigAndDB() error {
-    if err := mc.MusicDatabase.InitializeDatabase(); err != nil {
+    if err := mc.MusicDatabase.InitializeDatabase(mc.DB); err != nil {
         return fmt.Errorf("error al inicializar la base de datos: %v", err)
     }
 
@@ -173,18 +600,74 @@ func (mc *MusicController) CheckConfigAndDB() error {
 
 // ShowSettingsDialog muestra un diálogo para actualizar las rutas de la música y la base de datos.
 // Permite al usuario cambiar estas configuraciones y las guarda en el archivo de configuración.
-func (mc *MusicController) ShowSettingsDialog(parent fyne.Window) {
+// También permite respaldar la base de datos y restaurar un respaldo; la función onRestore se llama después de
+// restaurar, para refrescar la tabla principal.
+func (mc *MusicController) ShowSettingsDialog(parent fyne.Window, onRestore func()) {
     musicDirEntry := widget.NewEntry()
     musicDirEntry.SetText(mc.ConfigFile.DefaultMusicDir)
 
     dbPathEntry := widget.NewEntry()
     dbPathEntry.SetText(mc.ConfigFile.DefaultDBPath)
 
+    integrityCheck := widget.NewCheck("", nil)
+    integrityCheck.SetChecked(mc.MP3Miner.CheckIntegrity)
+
+    fingerprintCheck := widget.NewCheck("", nil)
+    fingerprintCheck.SetChecked(mc.MP3Miner.ComputeFingerprints)
+
+    replayGainCheck := widget.NewCheck("", nil)
+    replayGainCheck.SetChecked(mc.MP3Miner.WriteReplayGain)
+
+    backupCheck := widget.NewCheck("", nil)
+    backupCheck.SetChecked(mc.KeepBackups)
+
+    backupCountEntry := widget.NewEntry()
+    backupCountEntry.SetText(strconv.Itoa(mc.ConfigFile.BackupCount))
+
+    backupIntervalEntry := widget.NewEntry()
+    backupIntervalEntry.SetText(strconv.Itoa(mc.ConfigFile.BackupInterval))
+
+    backupNowButton := widget.NewButton("Respaldar ahora", func() {
+        path, err := mc.BackupNow()
+        if err != nil {
+            dialog.ShowError(err, parent)
+            return
+        }
+        dialog.ShowInformation("Respaldo", "Base de datos respaldada en "+path, parent)
+    })
+    restoreButton := widget.NewButton("Restaurar...", func() {
+        mc.showRestoreDialog(parent, onRestore)
+    })
+
     dialog.ShowForm("Settings", "Guardar", "Cancelar", []*widget.FormItem{
         {Text: "Ruta de Música", Widget: musicDirEntry},
         {Text: "Ruta de Base de Datos", Widget: dbPathEntry},
+        {Text: "Verificar integridad al minar", Widget: integrityCheck},
+        {Text: "Calcular huellas acústicas al minar", Widget: fingerprintCheck},
+        {Text: "Escribir ReplayGain en los archivos", Widget: replayGainCheck},
+        {Text: "Respaldar archivos al editar etiquetas", Widget: backupCheck},
+        {Text: "Respaldos de la base de datos que se conservan", Widget: backupCountEntry},
+        {Text: "Horas entre respaldos (0 los desactiva)", Widget: backupIntervalEntry},
+        {Text: "Respaldos", Widget: container.NewHBox(backupNowButton, restoreButton)},
     }, func(response bool) {
         if response {
+            count, countErr := strconv.Atoi(strings.TrimSpace(backupCountEntry.Text))
+            hours, hoursErr := strconv.Atoi(strings.TrimSpace(backupIntervalEntry.Text))
+            if countErr != nil || hoursErr != nil || count < 0 || hours < 0 {
+                dialog.ShowError(fmt.Errorf("el número de respaldos y las horas entre respaldos deben ser números enteros no negativos"), parent)
+                return
+            }
+            mc.ConfigFile.BackupCount = count
+            mc.ConfigFile.BackupInterval = hours
+            mc.MP3Miner.CheckIntegrity = integrityCheck.Checked
+            mc.MP3Miner.ComputeFingerprints = fingerprintCheck.Checked
+            mc.MP3Miner.WriteReplayGain = replayGainCheck.Checked
+            mc.KeepBackups = backupCheck.Checked
+            mc.ConfigFile.CheckIntegrity = integrityCheck.Checked
+            mc.ConfigFile.ComputeFingerprints = fingerprintCheck.Checked
+            mc.ConfigFile.WriteReplayGain = replayGainCheck.Checked
+            mc.ConfigFile.KeepTagBackups = backupCheck.Checked
+            // Las rutas se actualizan al final porque cada una guarda el archivo de configuración completo.
             mc.UpdateMusicDirectory(musicDirEntry.Text)
             mc.UpdateDatabasePath(dbPathEntry.Text)
             dialog.ShowInformation("Configuración", "Rutas actualizadas con éxito.", parent)
@@ -195,13 +678,13 @@ func (mc *MusicController) ShowSettingsDialog(parent fyne.Window) {
 // UpdateMusicDirectory actualiza la ruta del directorio de música y guarda el cambio en el archivo de configuración.
 func (mc *MusicController) UpdateMusicDirectory(newDir string) {
     mc.ConfigFile.DefaultMusicDir = newDir
-    mc.ConfigFile.CreateDefaultConfig()
+    mc.ConfigFile.Save()
 }
 
 // UpdateDatabasePath actualiza la ruta de la base de datos y guarda el cambio en el archivo de configuración.
 func (mc *MusicController) UpdateDatabasePath(newDBPath string) {
     mc.ConfigFile.DefaultDBPath = newDBPath
-    mc.ConfigFile.CreateDefaultConfig()
+    mc.ConfigFile.Save()
 }
 
 // OpenHelp abre el navegador del sistema en la URL de ayuda del proyecto.
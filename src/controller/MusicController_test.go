@@ -0,0 +1,147 @@
+package controller
+
+import (
+    "reflect"
+    "testing"
+
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// newTestController crea un controlador con un MemoryRepository con canciones de dos álbumes y un intérprete escrito
+// de dos formas.
+func newTestController(t *testing.T) *MusicController {
+    t.Helper()
+    repo := model.NewMemoryRepository()
+    songs := []model.MinedSong{
+        {Path: "/música/Abbey Road/01.mp3", Title: "Come Together", Artist: "The Beatles", Album: "Abbey Road", Year: 1969, Track: 1, Genre: "Rock"},
+        {Path: "/música/Abbey Road/02.mp3", Title: "Something", Artist: "The Beatles", Album: "Abbey Road", Year: 1969, Track: 2, Genre: "Rock"},
+        {Path: "/música/Abbey Road/03.mp3", Title: "Oh! Darling", Artist: "Beatles", Album: "Abbey Road", Year: 1969, Genre: "Blues"},
+        {Path: "/música/Paranoid/01.mp3", Title: "War Pigs", Artist: "Black Sabbath", Album: "Paranoid", Year: 1970, Track: 1, Genre: "Hard Rock"},
+    }
+    for _, song := range songs {
+        if err := repo.AddSong(song); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return &MusicController{Repository: repo, Columns: defaultSongColumns()}
+}
+
+func TestSearchSongsTableData(t *testing.T) {
+    mc := newTestController(t)
+
+    data, err := mc.SearchSongsTableData("p: beatles, y: 1969")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(data) != 3 || len(mc.CurrentSongs) != 3 {
+        t.Fatalf("se encontraron %d canciones, se esperaban 3", len(data))
+    }
+    // Sin número de pista la celda queda vacía en lugar de mostrar la pista 0.
+    want := []string{"Oh! Darling", "Beatles", "Abbey Road", "1969", "Blues", ""}
+    for i, song := range mc.CurrentSongs {
+        if song.Title == "Oh! Darling" && !reflect.DeepEqual(data[i][:len(want)], want) {
+            t.Errorf("fila = %q, se esperaba %q", data[i][:len(want)], want)
+        }
+    }
+
+    if _, err := mc.SearchSongsTableData("p: queen"); err == nil {
+        t.Error("una búsqueda sin resultados debería regresar un error")
+    }
+
+    all, err := mc.SearchSongs("")
+    if err != nil || len(all) != 4 {
+        t.Errorf("una búsqueda vacía regresó %d canciones: %v", len(all), err)
+    }
+}
+
+func TestAlbumSongsTableData(t *testing.T) {
+    mc := newTestController(t)
+    albums, err := mc.GetAllAlbums()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(albums) != 2 || albums[0].Name != "Abbey Road" {
+        t.Fatalf("álbumes = %+v", albums)
+    }
+
+    data, err := mc.AlbumSongsTableData(albums[0].IDAlbum)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Las canciones sin número de pista quedan al final del álbum.
+    var titles []string
+    for _, row := range data {
+        titles = append(titles, row[0])
+    }
+    if want := []string{"Come Together", "Something", "Oh! Darling"}; !reflect.DeepEqual(titles, want) {
+        t.Errorf("canciones del álbum = %q, se esperaba %q", titles, want)
+    }
+}
+
+func TestMergePerformers(t *testing.T) {
+    mc := newTestController(t)
+
+    clusters, err := mc.SuggestPerformerMerges()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(clusters) != 1 || len(clusters[0].Performers) != 2 {
+        t.Fatalf("sugerencias = %+v", clusters)
+    }
+
+    cluster, err := mc.FindPerformers("beatles")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(cluster.Performers) != 2 {
+        t.Fatalf("intérpretes encontrados = %+v", cluster.Performers)
+    }
+    into := clusters[0].Performers[clusters[0].Suggested]
+    if err := mc.MergePerformers(cluster.Performers, into); err != nil {
+        t.Fatal(err)
+    }
+
+    songs, err := mc.SearchSongs("p: " + into.Name)
+    if err != nil || len(songs) != 3 {
+        t.Errorf("canciones de %s después de unir: %d, %v", into.Name, len(songs), err)
+    }
+    if cluster, _ := mc.FindPerformers("beatles"); len(cluster.Performers) != 1 {
+        t.Errorf("quedaron %d intérpretes de los Beatles", len(cluster.Performers))
+    }
+    if clusters, _ := mc.SuggestPerformerMerges(); len(clusters) != 0 {
+        t.Errorf("sugerencias después de unir = %+v", clusters)
+    }
+}
+
+// TestSharedCatalogGuards revisa que las operaciones sobre la base de datos local fallen sin tocar mc.DB cuando las
+// canciones no están en ella, porque sus IDs no corresponderían.
+func TestSharedCatalogGuards(t *testing.T) {
+    mc := newTestController(t)
+    want := errSharedCatalog().Error()
+    check := func(name string, err error) {
+        t.Helper()
+        if err == nil || err.Error() != want {
+            t.Errorf("%s: %v, se esperaba %q", name, err, want)
+        }
+    }
+
+    _, err := mc.PlanOrganize(model.DefaultOrganizeTemplate)
+    check("PlanOrganize", err)
+    _, err = mc.FindDuplicates(true, true)
+    check("FindDuplicates", err)
+    _, err = mc.ExportDamagedSongs(nil)
+    check("ExportDamagedSongs", err)
+    _, err = mc.GetGenres()
+    check("GetGenres", err)
+    check("SetGenreParent", mc.SetGenreParent(model.Genre{}, 0))
+    check("MergeGenre", mc.MergeGenre(model.Genre{}, model.Genre{}))
+    check("AddGenreAlias", mc.AddGenreAlias("rock and roll", model.Genre{}))
+    check("RemoveGenreAlias", mc.RemoveGenreAlias("rock and roll"))
+    _, err = mc.CheckDatabase()
+    check("CheckDatabase", err)
+    _, err = mc.RepairDatabase(model.DatabaseCheck{}, true)
+    check("RepairDatabase", err)
+    check("SetSongHidden", mc.SetSongHidden(1, true))
+    _, err = mc.Undo()
+    check("Undo", err)
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+    "fmt"
+    "math"
+    "strconv" // Importado para convertir int a string
+
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// SongColumn describe una columna de la tabla de canciones.
+type SongColumn struct {
+    Header   string                       // Encabezado de la columna.
+    Width    float32                      // Ancho de la columna en pixeles.
+    Optional bool                         // Las columnas opcionales se pueden ocultar desde el diálogo "Columnas".
+    Visible  bool                         // Indica si la columna se muestra en la tabla.
+    Value    func(song model.Song) string // Texto de la celda para una canción.
+    Field    string                       // Campo de la rola que muestra (model.FieldTitle...), vacío si no se registra su origen.
+}
+
+// defaultSongColumns regresa las columnas de la tabla. Las propiedades de audio son opcionales y
+// empiezan ocultas para conservar el aspecto original de la tabla.
+func defaultSongColumns() []*SongColumn {
+    return []*SongColumn{
+        {Header: "Canción", Width: 500, Visible: true, Field: model.FieldTitle, Value: func(s model.Song) string { return s.Title }},
+        {Header: "Performer", Width: 400, Visible: true, Field: model.FieldArtist, Value: func(s model.Song) string { return s.Artist }},
+        {Header: "Álbum", Width: 400, Visible: true, Field: model.FieldAlbum, Value: func(s model.Song) string { return s.Album }},
+        {Header: "Año", Width: 100, Visible: true, Field: model.FieldYear, Value: func(s model.Song) string { return formatYear(s.Year) }},
+        {Header: "Genero", Width: 200, Visible: true, Field: model.FieldGenre, Value: func(s model.Song) string { return s.Genre }},
+        {Header: "No. de pista", Width: 100, Visible: true, Field: model.FieldTrack, Value: FormatTrackNumber},
+        {Header: "Formato", Width: 100, Visible: true, Optional: true, Value: func(s model.Song) string { return s.Codec }},
+        {Header: "Duración", Width: 100, Optional: true, Value: func(s model.Song) string { return FormatDuration(s.Duration) }},
+        {Header: "Bitrate", Width: 140, Optional: true, Value: formatBitrate},
+        {Header: "Frecuencia", Width: 110, Optional: true, Value: func(s model.Song) string { return formatSampleRate(s.SampleRate) }},
+        {Header: "Canales", Width: 130, Optional: true, Value: func(s model.Song) string { return s.ChannelMode }},
+        {Header: "Codificador", Width: 150, Optional: true, Value: func(s model.Song) string { return s.Encoder }},
+        {Header: "Estado", Width: 170, Optional: true, Value: func(s model.Song) string { return model.HealthLabel(s.Health) }},
+        {Header: "Sonoridad", Width: 120, Optional: true, Value: func(s model.Song) string { return formatLoudness(s.Loudness) }},
+        {Header: "Pico", Width: 110, Optional: true, Value: func(s model.Song) string { return formatPeak(s.Peak) }},
+        {Header: "ReplayGain", Width: 120, Optional: true, Value: func(s model.Song) string { return formatGain(s.Loudness) }},
+        {Header: "Sonoridad del álbum", Width: 170, Optional: true, Value: func(s model.Song) string { return formatLoudness(s.AlbumLoudness) }},
+        {Header: "Pico del álbum", Width: 130, Optional: true, Value: func(s model.Song) string { return formatPeak(s.AlbumPeak) }},
+        {Header: "BPM", Width: 80, Optional: true, Value: func(s model.Song) string { return formatBPM(s.BPM) }},
+        {Header: "Tonalidad", Width: 100, Optional: true, Value: func(s model.Song) string { return s.Key }},
+        {Header: "Compositor", Width: 250, Optional: true, Value: func(s model.Song) string { return s.Composer }},
+        {Header: "Disco", Width: 80, Optional: true, Value: func(s model.Song) string { return formatDisc(s.Disc) }},
+        {Header: "Comentario", Width: 300, Optional: true, Value: func(s model.Song) string { return s.Comment }},
+    }
+}
+
+// VisibleColumns regresa las columnas que se muestran actualmente en la tabla.
+func (mc *MusicController) VisibleColumns() []*SongColumn {
+    var columns []*SongColumn
+    for _, column := range mc.Columns {
+        if column.Visible {
+            columns = append(columns, column)
+        }
+    }
+    return columns
+}
+
+// TableHeader regresa los encabezados de las columnas visibles.
+func (mc *MusicController) TableHeader() []string {
+    var header []string
+    for _, column := range mc.VisibleColumns() {
+        header = append(header, column.Header)
+    }
+    return header
+}
+
+// CellProvenance indica el origen del valor de una celda de la tabla (sin contar el encabezado) y si el dato falta.
+// Las columnas sin campo asociado, como las propiedades de audio, no tienen origen.
+func (mc *MusicController) CellProvenance(row, col int) (source string, missing bool) {
+    columns := mc.VisibleColumns()
+    song, ok := mc.SongAt(row)
+    if !ok || col < 0 || col >= len(columns) || columns[col].Field == "" {
+        return "", false
+    }
+    return song.Source(columns[col].Field), columns[col].Value(song) == ""
+}
+
+// formatYear muestra el año, vacío si se desconoce.
+func formatYear(year int) string {
+    if year == 0 {
+        return ""
+    }
+    return strconv.Itoa(year)
+}
+
+// FormatDuration convierte una duración en segundos al formato m:ss (o h:mm:ss). Regresa una cadena vacía si se desconoce.
+func FormatDuration(seconds float64) string {
+    if seconds <= 0 {
+        return ""
+    }
+    total := int(seconds + 0.5)
+    if total >= 3600 {
+        return fmt.Sprintf("%d:%02d:%02d", total/3600, total%3600/60, total%60)
+    }
+    return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// formatBitrate muestra la tasa de bits en kbps, indicando si es variable.
+func formatBitrate(song model.Song) string {
+    if song.Bitrate == 0 {
+        return ""
+    }
+    if song.VBR {
+        return fmt.Sprintf("%d kbps (VBR)", song.Bitrate)
+    }
+    return fmt.Sprintf("%d kbps", song.Bitrate)
+}
+
+// formatSampleRate muestra la frecuencia de muestreo en kHz.
+func formatSampleRate(sampleRate int) string {
+    if sampleRate == 0 {
+        return ""
+    }
+    return strconv.FormatFloat(float64(sampleRate)/1000, 'f', -1, 64) + " kHz"
+}
+
+// formatLoudness muestra la sonoridad integrada en LUFS.
+func formatLoudness(lufs float64) string {
+    if lufs == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%.1f LUFS", lufs)
+}
+
+// formatPeak muestra el pico verdadero en dBTP (decibeles respecto a la escala completa).
+func formatPeak(peak float64) string {
+    if peak == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%.1f dBTP", 20*math.Log10(peak))
+}
+
+// formatGain muestra la ganancia de ReplayGain 2.0 que corresponde a una sonoridad.
+func formatGain(lufs float64) string {
+    if lufs == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%+.2f dB", model.ReplayGain(lufs))
+}
+
+// formatBPM muestra el tempo sin decimales innecesarios (e.g., "128" o "127.5").
+func formatBPM(bpm float64) string {
+    if bpm == 0 {
+        return ""
+    }
+    return strconv.FormatFloat(bpm, 'f', -1, 64)
+}
+
+// formatDisc muestra el número de disco, vacío si se desconoce.
+func formatDisc(disc int) string {
+    if disc == 0 {
+        return ""
+    }
+    return strconv.Itoa(disc)
+}
+
+// FormatTrackNumber muestra el número de pista con ceros a la izquierda según el total de pistas y, en los álbumes
+// de varios discos, precedido del número de disco (e.g., "1-03"). Regresa una cadena vacía si se desconoce la pista.
+func FormatTrackNumber(song model.Song) string {
+    if song.Track == 0 {
+        return ""
+    }
+    digits := max(2, len(strconv.Itoa(song.TrackTotal)))
+    if song.Disc > 0 && song.DiscTotal != 1 {
+        return fmt.Sprintf("%d-%0*d", song.Disc, digits, song.Track)
+    }
+    return fmt.Sprintf("%0*d", digits, song.Track)
+}
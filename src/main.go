@@ -1,10 +1,16 @@
 package main
 
 import (
+    "os"
+
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
     "github.com/IsaacEscobar09/MusicDataBase/src/view"
 )
 
 func main() {
+    // "check" revisa (y con -repair repara) la base de datos desde la terminal, sin abrir la interfaz.
+    if len(os.Args) > 1 && os.Args[1] == "check" {
+        os.Exit(controller.RunCheckCommand(os.Args[2:], os.Stdout, os.Stderr))
+    }
     view.NewMusicView()
 }
-
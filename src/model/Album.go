@@ -0,0 +1,10 @@
+package model
+
+// Album representa un álbum dentro de la base de datos de música, junto con la ruta de su portada en caché.
+type Album struct {
+    IDAlbum   int    // ID único del álbum (correspondiente al campo id_album en la base de datos)
+    Name      string // Nombre del álbum
+    Year      int    // Año del álbum (0 si se desconoce)
+    Path      string // Directorio donde se encuentran las canciones del álbum
+    CoverPath string // Ruta de la portada en la caché, vacía si el álbum no tiene portada
+}
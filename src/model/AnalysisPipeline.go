@@ -0,0 +1,52 @@
+package model
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "runtime"
+
+    "fyne.io/fyne/v2/widget" // Para manejar la barra de progreso
+)
+
+// analysisResult es el resultado de analizar el archivo de una rola en uno de los trabajadores.
+type analysisResult struct {
+    path  string      // Ruta del archivo analizado.
+    value interface{} // Resultado del análisis; su tipo depende del análisis. Es nil si hubo un error.
+    err   error       // Error al abrir o analizar el archivo.
+}
+
+// runAnalysisPipeline reparte los archivos entre un trabajador por CPU, que los abre y ejecuta analyze sobre
+// ellos, y entrega cada resultado a store en la gorutina que llama. Como sólo esa gorutina llama a store, es la
+// única que escribe en la base de datos. La barra de progreso avanza con cada resultado.
+func runAnalysisPipeline(label string, paths []string, progressBar *widget.ProgressBar,
+    analyze func(r io.ReadSeeker) (interface{}, error), store func(result analysisResult)) {
+    jobs := make(chan string)
+    results := make(chan analysisResult)
+    for i := 0; i < runtime.NumCPU(); i++ {
+        go func() {
+            for path := range jobs {
+                fmt.Printf("%s: %s\n", label, path)
+                file, err := os.Open(path)
+                if err != nil {
+                    results <- analysisResult{path: path, err: err}
+                    continue
+                }
+                value, err := analyze(file)
+                file.Close()
+                results <- analysisResult{path: path, value: value, err: err}
+            }
+        }()
+    }
+    go func() {
+        for _, path := range paths {
+            jobs <- path
+        }
+        close(jobs)
+    }()
+
+    for i := range paths {
+        store(<-results)
+        progressBar.SetValue(float64(i+1) / float64(len(paths)))
+    }
+}
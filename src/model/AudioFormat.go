@@ -0,0 +1,182 @@
+package model
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strings"
+)
+
+// headerSize es el número de bytes que se leen del inicio del archivo para detectar su formato.
+const headerSize = 4096
+
+// AudioFormat describe un formato de audio soportado por el minero: su contenedor, su códec,
+// las extensiones con las que suele aparecer y una función que reconoce sus "magic bytes".
+type AudioFormat struct {
+    Container  string                   // Contenedor del archivo (e.g., MPEG, Ogg, MP4).
+    Codec      string                   // Códec del audio (e.g., MP3, Vorbis, Opus, AAC).
+    Extensions []string                 // Extensiones asociadas al formato, en minúsculas y con punto.
+    Matches    func(header []byte) bool // Indica si el encabezado del archivo corresponde al formato.
+}
+
+// audioFormats contiene los formatos registrados, en el orden en que se prueban al detectar un archivo.
+var audioFormats []*AudioFormat
+
+// init registra los formatos que dhowden/tag es capaz de leer.
+// MP3 se registra al final porque su detección (buscar una palabra de sincronía) es la menos estricta.
+func init() {
+    RegisterAudioFormat(&AudioFormat{Container: "FLAC", Codec: "FLAC", Extensions: []string{".flac"}, Matches: isFLAC})
+    RegisterAudioFormat(&AudioFormat{Container: "Ogg", Codec: "Vorbis", Extensions: []string{".ogg", ".oga"}, Matches: isOggVorbis})
+    RegisterAudioFormat(&AudioFormat{Container: "Ogg", Codec: "Opus", Extensions: []string{".opus", ".ogg"}, Matches: isOggOpus})
+    RegisterAudioFormat(&AudioFormat{Container: "MP4", Codec: "ALAC", Extensions: []string{".m4a"}, Matches: isMP4ALAC})
+    RegisterAudioFormat(&AudioFormat{Container: "MP4", Codec: "AAC", Extensions: []string{".m4a", ".m4b", ".mp4", ".aac"}, Matches: isMP4})
+    RegisterAudioFormat(&AudioFormat{Container: "MPEG", Codec: "MP3", Extensions: []string{".mp3"}, Matches: isMP3})
+}
+
+// RegisterAudioFormat agrega un formato a la lista de formatos que el minero reconoce.
+func RegisterAudioFormat(format *AudioFormat) {
+    audioFormats = append(audioFormats, format)
+}
+
+// IsSupportedAudioFile indica si la extensión del archivo (sin distinguir mayúsculas) pertenece a algún formato registrado.
+func IsSupportedAudioFile(filePath string) bool {
+    ext := strings.ToLower(filepath.Ext(filePath))
+    for _, format := range audioFormats {
+        if format.hasExtension(ext) {
+            return true
+        }
+    }
+    return false
+}
+
+// DetectAudioFormat identifica el formato de un archivo leyendo sus primeros bytes.
+// Primero prueba los formatos asociados a la extensión del archivo y después el resto,
+// de modo que un archivo con la extensión equivocada también se reconoce.
+// Al terminar, el lector queda posicionado nuevamente al inicio del archivo.
+func DetectAudioFormat(r io.ReadSeeker, filePath string) (*AudioFormat, error) {
+    header, err := readAudioHeader(r)
+    if err != nil {
+        return nil, fmt.Errorf("error leyendo el encabezado de %s: %v", filePath, err)
+    }
+
+    ext := strings.ToLower(filepath.Ext(filePath))
+    for _, format := range audioFormats {
+        if format.hasExtension(ext) && format.Matches(header) {
+            return format, nil
+        }
+    }
+    for _, format := range audioFormats {
+        if !format.hasExtension(ext) && format.Matches(header) {
+            return format, nil
+        }
+    }
+
+    return nil, fmt.Errorf("formato de audio no reconocido: %s", filePath)
+}
+
+// hasExtension indica si la extensión (en minúsculas) pertenece al formato.
+func (f *AudioFormat) hasExtension(ext string) bool {
+    for _, e := range f.Extensions {
+        if e == ext {
+            return true
+        }
+    }
+    return false
+}
+
+// readAudioHeader lee los primeros bytes del audio, omitiendo una etiqueta ID3v2 si la hay,
+// y regresa el lector al inicio del archivo.
+func readAudioHeader(r io.ReadSeeker) ([]byte, error) {
+    if _, err := r.Seek(0, io.SeekStart); err != nil {
+        return nil, err
+    }
+    defer r.Seek(0, io.SeekStart)
+
+    id3 := make([]byte, 10)
+    n, err := io.ReadFull(r, id3)
+    if err != nil && err != io.ErrUnexpectedEOF {
+        return nil, err
+    }
+
+    offset := int64(0)
+    if n == 10 && bytes.HasPrefix(id3, []byte("ID3")) {
+        offset = id3v2TagSize(id3)
+    }
+    if _, err := r.Seek(offset, io.SeekStart); err != nil {
+        return nil, err
+    }
+
+    header := make([]byte, headerSize)
+    n, err = io.ReadFull(r, header)
+    if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+        return nil, err
+    }
+    return header[:n], nil
+}
+
+// id3v2TagSize calcula el tamaño total de una etiqueta ID3v2 (encabezado, cuerpo y pie opcional)
+// a partir de sus primeros 10 bytes. El tamaño está codificado como un entero "syncsafe".
+func id3v2TagSize(header []byte) int64 {
+    size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+    size += 10
+    if header[5]&0x10 != 0 {
+        size += 10 // La etiqueta tiene pie de página.
+    }
+    return size
+}
+
+// isFLAC reconoce el marcador "fLaC" al inicio del flujo.
+func isFLAC(header []byte) bool {
+    return bytes.HasPrefix(header, []byte("fLaC"))
+}
+
+// oggFirstPacket regresa el inicio del primer paquete de un flujo Ogg, o nil si el encabezado no es Ogg.
+func oggFirstPacket(header []byte) []byte {
+    if !bytes.HasPrefix(header, []byte("OggS")) || len(header) < 27 {
+        return nil
+    }
+    start := 27 + int(header[26]) // Encabezado de la página más su tabla de segmentos.
+    if start > len(header) {
+        return nil
+    }
+    return header[start:]
+}
+
+// isOggVorbis reconoce un flujo Ogg cuyo primer paquete es el encabezado de identificación de Vorbis.
+func isOggVorbis(header []byte) bool {
+    return bytes.HasPrefix(oggFirstPacket(header), []byte("\x01vorbis"))
+}
+
+// isOggOpus reconoce un flujo Ogg cuyo primer paquete es el encabezado "OpusHead".
+func isOggOpus(header []byte) bool {
+    return bytes.HasPrefix(oggFirstPacket(header), []byte("OpusHead"))
+}
+
+// isMP4 reconoce la caja "ftyp" con la que inician los archivos MP4/M4A.
+func isMP4(header []byte) bool {
+    return len(header) >= 8 && string(header[4:8]) == "ftyp"
+}
+
+// isMP4ALAC reconoce un MP4 cuya descripción de muestras (visible en el encabezado) usa el códec Apple Lossless.
+func isMP4ALAC(header []byte) bool {
+    return isMP4(header) && bytes.Contains(header, []byte("alac"))
+}
+
+// isMP3 busca dentro del encabezado una palabra de sincronía MPEG seguida de campos válidos
+// (versión, capa, tasa de bits y frecuencia de muestreo).
+func isMP3(header []byte) bool {
+    for i := 0; i+4 <= len(header); i++ {
+        if header[i] != 0xff || header[i+1]&0xe0 != 0xe0 {
+            continue
+        }
+        version := (header[i+1] >> 3) & 0x03
+        layer := (header[i+1] >> 1) & 0x03
+        bitrate := header[i+2] >> 4
+        sampleRate := (header[i+2] >> 2) & 0x03
+        if version != 1 && layer != 0 && bitrate != 0x0f && sampleRate != 0x03 {
+            return true
+        }
+    }
+    return false
+}
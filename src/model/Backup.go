@@ -0,0 +1,231 @@
+package model
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/mattn/go-sqlite3"
+)
+
+const (
+    backupPrefix     = "MusicDataBase-"  // Prefijo del nombre de los respaldos.
+    backupExtension  = ".db"             // Extensión de los respaldos.
+    backupTimeLayout = "20060102-150405" // Fecha y hora de cada respaldo en su nombre.
+)
+
+// Backup es un respaldo de la base de datos.
+type Backup struct {
+    Path    string    // Ruta del archivo del respaldo.
+    Created time.Time // Fecha y hora en que se hizo el respaldo.
+    Size    int64     // Tamaño del archivo en bytes.
+}
+
+// copyDatabase copia completa la base de datos src en dest con la API de respaldos de SQLite, que copia las páginas
+// de forma consistente aunque otras conexiones estén usando src.
+func copyDatabase(dest, src *sql.DB) error {
+    ctx := context.Background()
+    destConn, err := dest.Conn(ctx)
+    if err != nil {
+        return fmt.Errorf("error al obtener una conexión: %v", err)
+    }
+    defer destConn.Close()
+    srcConn, err := src.Conn(ctx)
+    if err != nil {
+        return fmt.Errorf("error al obtener una conexión: %v", err)
+    }
+    defer srcConn.Close()
+
+    return destConn.Raw(func(destDriver interface{}) error {
+        return srcConn.Raw(func(srcDriver interface{}) error {
+            backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+            if err != nil {
+                return fmt.Errorf("error al iniciar la copia de la base de datos: %v", err)
+            }
+            // Con -1 se copian todas las páginas en un solo paso.
+            if _, err := backup.Step(-1); err != nil {
+                backup.Finish()
+                return fmt.Errorf("error al copiar la base de datos: %v", err)
+            }
+            if err := backup.Finish(); err != nil {
+                return fmt.Errorf("error al terminar la copia de la base de datos: %v", err)
+            }
+            return nil
+        })
+    })
+}
+
+// BackupDatabase respalda la base de datos en un archivo nuevo del directorio dir, con la fecha y hora en su nombre.
+// Se puede hacer mientras la aplicación usa la base de datos. El respaldo se escribe primero en un archivo temporal,
+// así que nunca queda un respaldo a medias. Regresa la ruta del respaldo.
+func BackupDatabase(db *sql.DB, dir string) (string, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return "", fmt.Errorf("error al crear el directorio de respaldos: %v", err)
+    }
+    path := filepath.Join(dir, backupPrefix+time.Now().Format(backupTimeLayout)+backupExtension)
+    if _, err := os.Stat(path); err == nil {
+        return "", fmt.Errorf("ya existe un respaldo de este momento: %s", path)
+    }
+    temporary := path + ".tmp"
+    os.Remove(temporary)
+
+    dest, err := sql.Open("sqlite3", temporary)
+    if err != nil {
+        return "", fmt.Errorf("error al crear el respaldo: %v", err)
+    }
+    if err := copyDatabase(dest, db); err != nil {
+        dest.Close()
+        os.Remove(temporary)
+        return "", err
+    }
+    // La copia conserva el modo WAL de la base de datos; un respaldo es un solo archivo que no se modifica, así que se
+    // cambia al diario normal para que al abrirlo no se creen los archivos -wal y -shm junto a él.
+    if _, err := dest.Exec("PRAGMA journal_mode = DELETE"); err != nil {
+        dest.Close()
+        os.Remove(temporary)
+        return "", fmt.Errorf("error al crear el respaldo: %v", err)
+    }
+    if err := dest.Close(); err != nil {
+        os.Remove(temporary)
+        return "", fmt.Errorf("error al cerrar el respaldo: %v", err)
+    }
+    if err := os.Rename(temporary, path); err != nil {
+        os.Remove(temporary)
+        return "", fmt.Errorf("error al guardar el respaldo: %v", err)
+    }
+    return path, nil
+}
+
+// ListBackups regresa los respaldos del directorio dir, del más reciente al más antiguo. Si el directorio no existe
+// no hay respaldos.
+func ListBackups(dir string) ([]Backup, error) {
+    entries, err := os.ReadDir(dir)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error al leer el directorio de respaldos: %v", err)
+    }
+    var backups []Backup
+    for _, entry := range entries {
+        name := entry.Name()
+        if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupExtension) {
+            continue
+        }
+        created, err := time.ParseInLocation(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupExtension), time.Local)
+        if err != nil {
+            continue
+        }
+        info, err := entry.Info()
+        if err != nil {
+            continue
+        }
+        backups = append(backups, Backup{Path: filepath.Join(dir, name), Created: created, Size: info.Size()})
+    }
+    sort.Slice(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+    return backups, nil
+}
+
+// RotateBackups elimina los respaldos más antiguos del directorio dir para conservar sólo los keep más recientes.
+func RotateBackups(dir string, keep int) error {
+    backups, err := ListBackups(dir)
+    if err != nil {
+        return err
+    }
+    for i := max(keep, 0); i < len(backups); i++ {
+        if err := os.Remove(backups[i].Path); err != nil {
+            return fmt.Errorf("error al eliminar el respaldo %s: %v", backups[i].Path, err)
+        }
+    }
+    return nil
+}
+
+// BackupIfDue hace un respaldo en dir si el más reciente tiene más de interval (o si no hay ninguno) y después
+// conserva sólo los keep más recientes. Con interval o keep menores o iguales a cero no hace nada. Regresa la ruta
+// del respaldo nuevo, o "" si no hizo ninguno.
+func BackupIfDue(db *sql.DB, dir string, keep int, interval time.Duration) (string, error) {
+    if keep <= 0 || interval <= 0 {
+        return "", nil
+    }
+    backups, err := ListBackups(dir)
+    if err != nil {
+        return "", err
+    }
+    if len(backups) > 0 && time.Since(backups[0].Created) < interval {
+        return "", nil
+    }
+    path, err := BackupDatabase(db, dir)
+    if err != nil {
+        return "", err
+    }
+    return path, RotateBackups(dir, keep)
+}
+
+// ValidateBackup revisa que un respaldo se pueda restaurar: que sea una base de datos íntegra, con las tablas del
+// esquema base y con una versión del esquema que esta aplicación conozca. Los respaldos de versiones anteriores se
+// actualizan al restaurarlos. Regresa la versión del esquema del respaldo.
+func ValidateBackup(path string) (int, error) {
+    // Abrir una ruta que no existe crearía una base de datos vacía.
+    if _, err := os.Stat(path); err != nil {
+        return 0, fmt.Errorf("error al abrir el respaldo: %v", err)
+    }
+    db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+    if err != nil {
+        return 0, fmt.Errorf("error al abrir el respaldo: %v", err)
+    }
+    defer db.Close()
+
+    var result string
+    if err := db.QueryRow("PRAGMA integrity_check(1)").Scan(&result); err != nil {
+        return 0, fmt.Errorf("el respaldo no es una base de datos válida: %v", err)
+    }
+    if result != "ok" {
+        return 0, fmt.Errorf("el respaldo está dañado: %s", result)
+    }
+    for _, table := range coreTables {
+        var name string
+        if err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name); err != nil {
+            return 0, fmt.Errorf("el respaldo no tiene la tabla %s", table)
+        }
+    }
+    version, err := schemaVersion(db)
+    if err != nil {
+        return 0, err
+    }
+    if latest := latestSchemaVersion(); version > latest {
+        return 0, fmt.Errorf("el respaldo es de una versión más nueva de la aplicación (esquema %d; esta versión llega al %d)", version, latest)
+    }
+    return version, nil
+}
+
+// RestoreBackup reemplaza el contenido de la base de datos por el de un respaldo, después de validarlo (ver
+// ValidateBackup) y de respaldar en dir la base de datos actual, por si hay que regresar a ella. La copia se hace con
+// la API de respaldos de SQLite, así que la aplicación puede seguir abierta. Si el respaldo es de una versión
+// anterior del esquema, se actualiza. Regresa la ruta del respaldo de la base de datos actual.
+func RestoreBackup(db *sql.DB, backupPath, dir string) (string, error) {
+    if _, err := ValidateBackup(backupPath); err != nil {
+        return "", err
+    }
+    current, err := BackupDatabase(db, dir)
+    if err != nil {
+        return "", fmt.Errorf("error al respaldar la base de datos actual: %v", err)
+    }
+
+    src, err := sql.Open("sqlite3", "file:"+backupPath+"?mode=ro")
+    if err != nil {
+        return current, fmt.Errorf("error al abrir el respaldo: %v", err)
+    }
+    defer src.Close()
+    if err := copyDatabase(db, src); err != nil {
+        return current, err
+    }
+    if err := migrateSchema(db); err != nil {
+        return current, fmt.Errorf("error al migrar el esquema del respaldo: %v", err)
+    }
+    return current, nil
+}
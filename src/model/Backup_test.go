@@ -0,0 +1,173 @@
+package model
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+// allTitles regresa los títulos ordenados de todas las canciones del repositorio.
+func allTitles(t *testing.T, repo Repository) []string {
+    t.Helper()
+    songs, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return songTitles(songs)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    mineTestSongs(t, repo)
+    before := allTitles(t, repo)
+
+    backup, err := BackupDatabase(repo.DB(), t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if version, err := ValidateBackup(backup); err != nil || version != latestSchemaVersion() {
+        t.Fatalf("ValidateBackup = %d, %v", version, err)
+    }
+
+    execAll(t, repo.DB(), "DELETE FROM rolas WHERE title = 'War Pigs'", "UPDATE rolas SET title = 'Algo' WHERE title = 'Something'")
+    changed := allTitles(t, repo)
+
+    // La base de datos actual se respalda en otro directorio, porque los respaldos se nombran por segundo.
+    current, err := RestoreBackup(repo.DB(), backup, t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := allTitles(t, repo); !reflect.DeepEqual(got, before) {
+        t.Errorf("después de restaurar: %v, se esperaba %v", got, before)
+    }
+    assertForeignKeys(t, repo.DB())
+
+    // El respaldo de la base de datos actual tiene los cambios que se reemplazaron.
+    saved, err := OpenSQLiteRepository(current)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer saved.DB().Close()
+    if got := allTitles(t, saved); !reflect.DeepEqual(got, changed) {
+        t.Errorf("respaldo de la base de datos actual: %v, se esperaba %v", got, changed)
+    }
+}
+
+// TestRestoreOlderBackup restaura el respaldo de una versión anterior del esquema, que se debe actualizar.
+func TestRestoreOlderBackup(t *testing.T) {
+    path, old := openTestDatabaseAt(t, 14)
+    execAll(t, old,
+        "INSERT INTO performers (id_performer, id_type, name) VALUES (1, 2, 'Queen'), (2, 2, 'Queen')",
+        "INSERT INTO albums (id_album, name, path) VALUES (1, 'Jazz', '/música/Jazz')",
+        "INSERT INTO rolas (id_rola, id_performer, id_album, path, title) VALUES (1, 2, 1, '/música/Jazz/01.mp3', 'Mustapha')",
+    )
+    old.Close()
+    if version, err := ValidateBackup(path); err != nil || version != 14 {
+        t.Fatalf("ValidateBackup = %d, %v", version, err)
+    }
+
+    repo := openTestSQLiteRepository(t)
+    if _, err := RestoreBackup(repo.DB(), path, t.TempDir()); err != nil {
+        t.Fatal(err)
+    }
+    if version, err := schemaVersion(repo.DB()); err != nil || version != latestSchemaVersion() {
+        t.Errorf("versión del esquema restaurado = %d, %v; se esperaba %d", version, err, latestSchemaVersion())
+    }
+    song := minedSong(t, repo, "mustapha")
+    if song.Artist != "Queen" || song.Album != "Jazz" {
+        t.Errorf("canción restaurada: %+v", song)
+    }
+    if got := queryInts(t, repo.DB(), "SELECT COUNT(*) FROM performers"); got[0] != 1 {
+        t.Errorf("quedaron %d intérpretes, las migraciones debían unir los repetidos", got[0])
+    }
+    assertForeignKeys(t, repo.DB())
+}
+
+// TestRestoreInvalidBackup revisa que no se restauren respaldos de una versión más nueva ni archivos dañados, y que
+// la base de datos no cambie.
+func TestRestoreInvalidBackup(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    mineTestSongs(t, repo)
+    before := allTitles(t, repo)
+
+    newer, err := BackupDatabase(repo.DB(), t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    db, err := OpenDB(newer)
+    if err != nil {
+        t.Fatal(err)
+    }
+    execAll(t, db, fmt.Sprintf("PRAGMA user_version = %d", latestSchemaVersion()+1))
+    db.Close()
+
+    corrupt := filepath.Join(t.TempDir(), "dañado.db")
+    if err := os.WriteFile(corrupt, []byte("esto no es una base de datos SQLite, sólo texto"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    truncated := filepath.Join(t.TempDir(), "incompleto.db")
+    data := readFile(t, newer)
+    if err := os.WriteFile(truncated, data[:len(data)/2], 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    for name, path := range map[string]string{"más nuevo": newer, "dañado": corrupt, "incompleto": truncated, "inexistente": corrupt + ".no"} {
+        if _, err := ValidateBackup(path); err == nil {
+            t.Errorf("%s: ValidateBackup aceptó el respaldo", name)
+        }
+        dir := t.TempDir()
+        if _, err := RestoreBackup(repo.DB(), path, dir); err == nil {
+            t.Errorf("%s: se restauró el respaldo", name)
+        }
+        if backups, _ := ListBackups(dir); len(backups) != 0 {
+            t.Errorf("%s: se respaldó la base de datos actual aunque el respaldo no era válido", name)
+        }
+        if got := allTitles(t, repo); !reflect.DeepEqual(got, before) {
+            t.Errorf("%s: la base de datos cambió: %v", name, got)
+        }
+    }
+    if _, err := os.Stat(corrupt + ".no"); !os.IsNotExist(err) {
+        t.Error("validar una ruta que no existe creó una base de datos")
+    }
+}
+
+func TestRotateBackups(t *testing.T) {
+    dir := t.TempDir()
+    start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+    var names []string
+    for i := 0; i < 6; i++ {
+        name := backupPrefix + start.Add(time.Duration(i)*time.Hour).Format(backupTimeLayout) + backupExtension
+        names = append(names, name)
+        if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // Los archivos que no son respaldos no se eliminan.
+    if err := os.WriteFile(filepath.Join(dir, "notas.txt"), nil, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, keep := range []int{4, 4, 1, 0} {
+        if err := RotateBackups(dir, keep); err != nil {
+            t.Fatal(err)
+        }
+        backups, err := ListBackups(dir)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(backups) != keep {
+            t.Fatalf("keep=%d: quedaron %d respaldos", keep, len(backups))
+        }
+        for i, backup := range backups {
+            if want := names[len(names)-1-i]; filepath.Base(backup.Path) != want {
+                t.Errorf("keep=%d: respaldo %d = %s, se esperaba %s", keep, i, filepath.Base(backup.Path), want)
+            }
+        }
+    }
+    if _, err := os.Stat(filepath.Join(dir, "notas.txt")); err != nil {
+        t.Errorf("se eliminó un archivo que no es un respaldo: %v", err)
+    }
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// Operaciones de la edición en lote.
+const (
+    BulkSet      = "set"      // Asigna el mismo valor al campo de todas las canciones.
+    BulkReplace  = "replace"  // Busca una expresión regular en el campo y la reemplaza.
+    BulkCase     = "case"     // Cambia las mayúsculas y minúsculas del campo.
+    BulkRenumber = "renumber" // Numera las pistas en el orden de la selección.
+)
+
+// Conversiones de mayúsculas y minúsculas de BulkCase.
+const (
+    CaseUpper = "upper" // TODO EN MAYÚSCULAS.
+    CaseLower = "lower" // todo en minúsculas.
+    CaseTitle = "title" // Cada Palabra Con Mayúscula Inicial.
+)
+
+// BulkOperation describe un cambio que se aplica a varias canciones a la vez.
+type BulkOperation struct {
+    Kind    string // Operación (BulkSet, BulkReplace, BulkCase o BulkRenumber).
+    Field   string // Campo que se cambia (FieldTitle, FieldArtist...); BulkRenumber siempre cambia la pista.
+    Value   string // Valor de BulkSet o texto de reemplazo de BulkReplace (admite $1, $2...).
+    Pattern string // Expresión regular que busca BulkReplace.
+    Case    string // Conversión de BulkCase (CaseUpper, CaseLower o CaseTitle).
+    Start   int    // Primer número de pista de BulkRenumber.
+}
+
+// BulkChange es el cambio planeado para una canción: sus datos antes y después de la operación.
+type BulkChange struct {
+    Song   Song     // Canción que se cambia.
+    Before SongEdit // Datos actuales.
+    After  SongEdit // Datos después del cambio.
+}
+
+// FieldDiff es un campo que cambia en una canción, para la vista previa de la edición en lote.
+type FieldDiff struct {
+    Field  string // Campo (FieldTitle, FieldArtist...).
+    Before string // Valor actual.
+    After  string // Valor nuevo.
+}
+
+// field regresa un apuntador al valor del campo indicado, o nil si el campo no existe.
+func (e *SongEdit) field(name string) *string {
+    switch name {
+    case FieldTitle:
+        return &e.Title
+    case FieldArtist:
+        return &e.Artist
+    case FieldAlbum:
+        return &e.Album
+    case FieldYear:
+        return &e.Year
+    case FieldGenre:
+        return &e.Genre
+    case FieldTrack:
+        return &e.Track
+    }
+    return nil
+}
+
+// Diff regresa los campos que cambian, en el orden de las columnas de la tabla.
+func (c BulkChange) Diff() []FieldDiff {
+    var diffs []FieldDiff
+    for _, field := range []string{FieldTitle, FieldArtist, FieldAlbum, FieldYear, FieldGenre, FieldTrack} {
+        before, after := c.Before, c.After
+        if *before.field(field) != *after.field(field) {
+            diffs = append(diffs, FieldDiff{Field: field, Before: *before.field(field), After: *after.field(field)})
+        }
+    }
+    return diffs
+}
+
+// PlanBulkEdit calcula el resultado de aplicar la operación a las canciones, en el orden dado, sin guardar nada.
+// Sólo se regresan las canciones que cambian. Un resultado inválido (por ejemplo, un año que no es un número)
+// se reporta como error antes de aplicar cualquier cambio.
+func PlanBulkEdit(songs []Song, op BulkOperation) ([]BulkChange, error) {
+    field := op.Field
+    if op.Kind == BulkRenumber {
+        field = FieldTrack
+    }
+    if (&SongEdit{}).field(field) == nil {
+        return nil, fmt.Errorf("campo desconocido '%s'", field)
+    }
+
+    var pattern *regexp.Regexp
+    if op.Kind == BulkReplace {
+        var err error
+        if pattern, err = regexp.Compile(op.Pattern); err != nil {
+            return nil, fmt.Errorf("expresión regular inválida: %v", err)
+        }
+    }
+
+    var changes []BulkChange
+    for i, song := range songs {
+        before := EditOf(song)
+        after := before
+        value := after.field(field)
+        switch op.Kind {
+        case BulkSet:
+            *value = strings.TrimSpace(op.Value)
+        case BulkReplace:
+            *value = strings.TrimSpace(pattern.ReplaceAllString(*value, op.Value))
+        case BulkCase:
+            *value = convertCase(*value, op.Case)
+        case BulkRenumber:
+            *value = strconv.Itoa(op.Start + i)
+        default:
+            return nil, fmt.Errorf("operación desconocida '%s'", op.Kind)
+        }
+
+        if after == before {
+            continue
+        }
+        if _, _, err := after.numbers(); err != nil {
+            return nil, fmt.Errorf("%s: %v", song.Path, err)
+        }
+        changes = append(changes, BulkChange{Song: song, Before: before, After: after})
+    }
+    return changes, nil
+}
+
+// convertCase cambia las mayúsculas y minúsculas de un texto.
+func convertCase(text, conversion string) string {
+    switch conversion {
+    case CaseUpper:
+        return strings.ToUpper(text)
+    case CaseLower:
+        return strings.ToLower(text)
+    case CaseTitle:
+        runes := []rune(strings.ToLower(text))
+        for i, r := range runes {
+            if i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == '(' || runes[i-1] == '-' || runes[i-1] == '"' {
+                runes[i] = unicode.ToUpper(r)
+            }
+        }
+        return string(runes)
+    }
+    return text
+}
+
+// ApplyBulkEdit guarda los cambios planeados con PlanBulkEdit como una sola operación de la bitácora, que se puede
+// deshacer completa. Con writeFiles también se escriben las etiquetas de los MP3 (ver UpdateSongTags); las demás
+// canciones, o todas sin writeFiles, sólo se cambian en la base de datos y el origen de sus datos queda como editado
+// a mano. Si falla alguna canción no se guarda ningún cambio.
+func ApplyBulkEdit(db *sql.DB, changes []BulkChange, writeFiles, backup bool) error {
+    if len(changes) == 0 {
+        return nil
+    }
+    description := fmt.Sprintf("Editar %d canciones", len(changes))
+    if len(changes) == 1 {
+        description = fmt.Sprintf("Editar \"%s\"", songLabel(changes[0].Song))
+    }
+    return applySongEdits(db, description, changes, writeFiles, backup)
+}
@@ -3,7 +3,9 @@ package model
 import (
     "database/sql"
     "fmt"
+    "strconv"
     "strings"
+    "time"
 
     _ "github.com/mattn/go-sqlite3"
 )
@@ -11,77 +13,212 @@ import (
 // Compiler es una estructura vacía que contiene el método CompileSearch para compilar búsquedas en la base de datos.
 type Compiler struct{}
 
+// searchFilter es un filtro "clave: valor" de una búsqueda.
+type searchFilter struct {
+    key   string // Clave del filtro en minúsculas (e.g., "p", "a", "br").
+    value string // Valor del filtro (e.g., nombre del artista o álbum).
+    text  string // Filtro completo como se escribió, para los mensajes de error.
+}
+
+// searchKeys son las claves de los filtros que entiende una búsqueda.
+var searchKeys = map[string]bool{
+    "p": true, "a": true, "c": true, "g": true, "g+": true, "y": true, "f": true, "br": true, "dur": true,
+    "sr": true, "bpm": true, "ch": true, "enc": true, "h": true, "comp": true, "lyr": true, "key": true, "vbr": true,
+}
+
+// parseSearch divide el string de búsqueda en sus filtros, separados por comas. Se ignoran los filtros sin valor o
+// con una clave desconocida; si no queda ninguno, la búsqueda es general (ver CompileSearch).
+func parseSearch(searchString string) []searchFilter {
+    var filters []searchFilter
+    for _, filter := range strings.Split(searchString, ",") {
+        // Elimina espacios en blanco innecesarios y divide la clave y el valor en cada filtro.
+        filter = strings.TrimSpace(filter)
+        parts := strings.SplitN(filter, ":", 2)
+        if len(parts) != 2 {
+            continue
+        }
+        key := strings.TrimSpace(strings.ToLower(parts[0]))
+        value := strings.TrimSpace(parts[1])
+        if value == "" || !searchKeys[key] {
+            continue
+        }
+        filters = append(filters, searchFilter{key: key, value: value, text: filter})
+    }
+    return filters
+}
+
+// noResultsError es el error de una búsqueda sin resultados.
+func noResultsError() error {
+    return fmt.Errorf("No se encontraron canciones que coincidan con los filtros")
+}
+
+// searchDialect traduce las partes de las condiciones de búsqueda que cambian según la base de datos.
+type searchDialect interface {
+    // like regresa la condición que indica si la expresión column contiene el patrón de un parámetro.
+    like(column string) string
+    // genreIDs regresa los IDs de los géneros que busca el filtro "g:" o, con subgenres, "g+:".
+    genreIDs(value string, subgenres bool) ([]int, error)
+    // number regresa la expresión column como un número de punto flotante, para compararla con los valores de los
+    // filtros numéricos, que pueden tener decimales (e.g., "br:<192.5").
+    number(column string) string
+}
+
+// sqliteSearch es el dialecto de las búsquedas en SQLite, donde LIKE no distingue mayúsculas (sólo de ASCII).
+type sqliteSearch struct {
+    db *sql.DB
+}
+
+func (d sqliteSearch) like(column string) string {
+    return column + " LIKE ?"
+}
+
+func (d sqliteSearch) genreIDs(value string, subgenres bool) ([]int, error) {
+    return searchGenreIDs(d.db, value, subgenres)
+}
+
+// number regresa la columna sin cambios: SQLite compara los enteros con los números de punto flotante.
+func (d sqliteSearch) number(column string) string {
+    return column
+}
+
 // CompileSearch analiza el string de búsqueda y genera una consulta SQL para filtrar canciones en la base de datos.
 // Recibe como parámetros el string de búsqueda, la conexión a la base de datos y devuelve un arreglo de canciones.
-func (c *Compiler) CompileSearch(searchString string, db *sql.DB) ([]Song, error) { 
+func (c *Compiler) CompileSearch(searchString string, db *sql.DB) ([]Song, error) {
+    where, args, err := compileSearchConditions(searchString, sqliteSearch{db})
+    if err != nil {
+        return nil, err
+    }
+    return runSearch(db, SongQuery+where, args)
+}
+
+// compileSearchConditions traduce el string de búsqueda a la cláusula WHERE (y, al filtrar por álbum, ORDER BY) que
+// se agrega a la consulta de canciones, con sus argumentos. Los parámetros se escriben con "?".
+func compileSearchConditions(searchString string, dialect searchDialect) (string, []interface{}, error) {
     // Divide la cadena de búsqueda en pares clave-valor, separados por comas.
-    filters := strings.Split(searchString, ",")
+    filters := parseSearch(searchString)
     queryConditions := []string{}
     args := []interface{}{}
 
-    // Variable para verificar si existen filtros específicos en la búsqueda.
-    hasSpecificFilters := false
+    // Al filtrar por álbum, los resultados se ordenan por disco y pista.
+    byAlbum := false
 
     // Recorremos los filtros para construir la condición de la consulta SQL.
     for _, filter := range filters {
-        filter = strings.TrimSpace(filter) // Elimina espacios en blanco innecesarios.
-        if filter == "" {
-            continue
-        }
-
-        parts := strings.SplitN(filter, ":", 2) // Divide la clave y el valor en cada filtro.
-        if len(parts) != 2 {
-            continue
-        }
-
-        key := strings.TrimSpace(strings.ToLower(parts[0])) // Clave del filtro (e.g., performer, album).
-        value := strings.TrimSpace(parts[1]) // Valor del filtro (e.g., nombre del artista o álbum).
-
-        if value == "" {
-            continue // Ignora los filtros sin valores.
-        }
+        key, value := filter.key, filter.value
 
         // Construcción de condiciones SQL según el tipo de filtro.
         switch key {
         case "p":
-            queryConditions = append(queryConditions, "performers.name LIKE ?")
+            queryConditions = append(queryConditions, dialect.like("performers.name"))
             args = append(args, "%"+value+"%")
-            hasSpecificFilters = true
         case "a":
-            queryConditions = append(queryConditions, "albums.name LIKE ?")
+            queryConditions = append(queryConditions, dialect.like("albums.name"))
             args = append(args, "%"+value+"%")
-            hasSpecificFilters = true
+            byAlbum = true
         case "c":
-            queryConditions = append(queryConditions, "rolas.title LIKE ?")
-            args = append(args, "%"+value+"%")
-            hasSpecificFilters = true
-        case "g":
-            queryConditions = append(queryConditions, "rolas.genre LIKE ?")
+            queryConditions = append(queryConditions, dialect.like("rolas.title"))
             args = append(args, "%"+value+"%")
-            hasSpecificFilters = true
+        case "g", "g+":
+            // "g: Rock" busca el género Rock (por su nombre o un alias); "g+: Rock" también sus subgéneros, como
+            // Hard Rock. Si ningún género se llama así se buscan los que contienen el texto.
+            ids, err := dialect.genreIDs(value, key == "g+")
+            if err != nil {
+                return "", nil, err
+            }
+            if len(ids) == 0 {
+                return "", nil, noResultsError()
+            }
+            placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+            queryConditions = append(queryConditions, "EXISTS (SELECT 1 FROM rola_genres WHERE rola_genres.id_rola = rolas.id_rola "+
+                "AND rola_genres.id_genre IN ("+placeholders+"))")
+            for _, id := range ids {
+                args = append(args, id)
+            }
         case "y":
+            // Un año que no es un número no coincide con ninguna canción.
+            year, err := strconv.Atoi(value)
+            if err != nil {
+                return "", nil, noResultsError()
+            }
             queryConditions = append(queryConditions, "rolas.year = ?")
-            args = append(args, value)
-            hasSpecificFilters = true
+            args = append(args, year)
+        case "f":
+            queryConditions = append(queryConditions, "("+dialect.like("rolas.container")+" OR "+dialect.like("rolas.codec")+")")
+            args = append(args, "%"+value+"%", "%"+value+"%")
+        case "br", "dur", "sr", "bpm":
+            numeric, err := parseNumericFilter(value, numericParsers[key])
+            if err != nil {
+                return "", nil, fmt.Errorf("Filtro inválido '%s': %v", filter.text, err)
+            }
+            condition, conditionArgs := numeric.condition(dialect.number(numericColumns[key]))
+            queryConditions = append(queryConditions, condition)
+            args = append(args, conditionArgs...)
+        case "ch":
+            queryConditions = append(queryConditions, dialect.like("rolas.channel_mode"))
+            args = append(args, "%"+value+"%")
+        case "enc":
+            queryConditions = append(queryConditions, dialect.like("rolas.encoder"))
+            args = append(args, "%"+value+"%")
+        case "h":
+            // "dañado" agrupa todos los estados distintos de "ok".
+            if strings.ToLower(value) == "dañado" || strings.ToLower(value) == "danado" {
+                queryConditions = append(queryConditions, "(rolas.health IS NOT NULL AND rolas.health != ?)")
+                args = append(args, HealthOK)
+            } else {
+                queryConditions = append(queryConditions, dialect.like("rolas.health"))
+                args = append(args, value+"%")
+            }
+        case "comp":
+            queryConditions = append(queryConditions, dialect.like("rolas.composer"))
+            args = append(args, "%"+value+"%")
+        case "lyr":
+            queryConditions = append(queryConditions, "EXISTS (SELECT 1 FROM lyrics WHERE lyrics.id_rola = rolas.id_rola AND "+dialect.like("lyrics.text")+")")
+            args = append(args, "%"+value+"%")
+        case "key":
+            // La tonalidad se normaliza igual que al minar, así "key: 8A" y "key: A minor" encuentran "Am".
+            musicalKey := NormalizeKey(value)
+            if musicalKey == "" {
+                return "", nil, fmt.Errorf("Filtro inválido '%s': '%s' no es una tonalidad", filter.text, value)
+            }
+            queryConditions = append(queryConditions, "rolas.musical_key = ?")
+            args = append(args, musicalKey)
+        case "vbr":
+            // La columna guarda 0 o 1; el valor se pasa como número porque PostgreSQL no compara enteros con booleanos.
+            vbr := 0
+            if isAffirmative(value) {
+                vbr = 1
+            }
+            queryConditions = append(queryConditions, "COALESCE(rolas.vbr, 0) = ?")
+            args = append(args, vbr)
         }
     }
 
-    // Si no se pasan filtros específicos, realizar una búsqueda general en los campos principales.
-    if !hasSpecificFilters {
-        generalCondition := "(rolas.title LIKE ? OR rolas.year LIKE ? OR rolas.genre LIKE ? OR rolas.track LIKE ? OR performers.name LIKE ? OR albums.name LIKE ?)"
-        queryConditions = append(queryConditions, generalCondition)
-        searchTerm := "%" + searchString + "%"
-        args = append(args, searchTerm, searchTerm, searchTerm, searchTerm, searchTerm, searchTerm)
+    // Si no se pasan filtros específicos, realizar una búsqueda general en los campos principales. El año y la pista
+    // se convierten a texto para compararlos con el patrón.
+    if len(filters) == 0 {
+        columns := []string{"rolas.title", "CAST(rolas.year AS TEXT)", "rolas.genre", "CAST(rolas.track AS TEXT)", "performers.name", "albums.name", "rolas.codec"}
+        var generalConditions []string
+        for _, column := range columns {
+            generalConditions = append(generalConditions, dialect.like(column))
+            args = append(args, "%"+searchString+"%")
+        }
+        queryConditions = append(queryConditions, "("+strings.Join(generalConditions, " OR ")+")")
     }
 
+    // Las canciones ocultas no aparecen en los resultados.
+    queryConditions = append(queryConditions, VisibleSongCondition)
+
     // Construcción final de la consulta SQL.
-    query := `
-    SELECT rolas.id_rola, rolas.title, performers.name AS artist, albums.name AS album, rolas.year, rolas.genre, rolas.track
-    FROM rolas
-    JOIN performers ON rolas.id_performer = performers.id_performer
-    JOIN albums ON rolas.id_album = albums.id_album
+    where := `
     WHERE ` + strings.Join(queryConditions, " AND ")
+    if byAlbum {
+        where += AlbumSongOrder
+    }
+    return where, args, nil
+}
 
+// runSearch ejecuta la consulta de una búsqueda y regresa sus canciones, o un error si no hay ninguna.
+func runSearch(db *sql.DB, query string, args []interface{}) ([]Song, error) {
     // Ejecución de la consulta SQL.
     rows, err := db.Query(query, args...)
     if err != nil {
@@ -92,8 +229,7 @@ func (c *Compiler) CompileSearch(searchString string, db *sql.DB) ([]Song, error
     // Recorremos los resultados y los agregamos al arreglo de canciones.
     var songs []Song
     for rows.Next() {
-        var song Song
-        err := rows.Scan(&song.IDRola, &song.Title, &song.Artist, &song.Album, &song.Year, &song.Genre, &song.Track)
+        song, err := ScanSong(rows)
         if err != nil {
             return nil, fmt.Errorf("Error leyendo los resultados: %v", err)
         }
@@ -102,9 +238,135 @@ func (c *Compiler) CompileSearch(searchString string, db *sql.DB) ([]Song, error
 
     // Si no se encontraron resultados, devolver un error.
     if len(songs) == 0 {
-        return nil, fmt.Errorf("No se encontraron canciones que coincidan con los filtros")
+        return nil, noResultsError()
     }
 
     return songs, nil
 }
 
+
+// numericColumns asocia cada filtro numérico con la expresión SQL que compara.
+// La duración se redondea a segundos para que "dur:3:30" encuentre canciones de 210.4 segundos.
+var numericColumns = map[string]string{
+    "br":  "rolas.bitrate",
+    "dur": "ROUND(rolas.duration)",
+    "sr":  "rolas.sample_rate",
+    "bpm": "ROUND(rolas.bpm)",
+}
+
+// numericParsers asocia cada filtro numérico con la función que interpreta su valor.
+var numericParsers = map[string]func(string) (float64, error){
+    "br":  parseNumber,
+    "dur": parseDurationSeconds,
+    "sr":  parseNumber,
+    "bpm": parseNumber,
+}
+
+// numericFilter es la comparación de un filtro numérico: un operador con un valor, o un rango inclusivo.
+type numericFilter struct {
+    operator  string  // "=", "<", "<=", ">", ">=" o "BETWEEN" para los rangos.
+    low, high float64 // Valor de la comparación en low; en los rangos, sus límites.
+}
+
+// parseNumericFilter interpreta el valor de un filtro numérico. El valor puede iniciar con un operador de
+// comparación (<, <=, >, >=, =) o ser un rango inclusivo como "120-128"; sin operador se busca el valor exacto.
+func parseNumericFilter(value string, parse func(string) (float64, error)) (numericFilter, error) {
+    if dash := strings.Index(value, "-"); dash > 0 {
+        low, err := parse(strings.TrimSpace(value[:dash]))
+        if err != nil {
+            return numericFilter{}, err
+        }
+        high, err := parse(strings.TrimSpace(value[dash+1:]))
+        if err != nil {
+            return numericFilter{}, err
+        }
+        return numericFilter{operator: "BETWEEN", low: min(low, high), high: max(low, high)}, nil
+    }
+
+    operator := "="
+    for _, op := range []string{"<=", ">=", "<", ">", "="} {
+        if strings.HasPrefix(value, op) {
+            operator = op
+            value = strings.TrimSpace(strings.TrimPrefix(value, op))
+            break
+        }
+    }
+
+    number, err := parse(value)
+    if err != nil {
+        return numericFilter{}, err
+    }
+    return numericFilter{operator: operator, low: number}, nil
+}
+
+// condition construye la condición SQL del filtro sobre la expresión column.
+func (f numericFilter) condition(column string) (string, []interface{}) {
+    if f.operator == "BETWEEN" {
+        return column + " BETWEEN ? AND ?", []interface{}{f.low, f.high}
+    }
+    return column + " " + f.operator + " ?", []interface{}{f.low}
+}
+
+// matches indica si un valor cumple el filtro.
+func (f numericFilter) matches(value float64) bool {
+    switch f.operator {
+    case "BETWEEN":
+        return value >= f.low && value <= f.high
+    case "<":
+        return value < f.low
+    case "<=":
+        return value <= f.low
+    case ">":
+        return value > f.low
+    case ">=":
+        return value >= f.low
+    }
+    return value == f.low
+}
+
+// parseNumber interpreta un número, aceptando el sufijo "k" (e.g., 44.1k para la frecuencia de muestreo).
+func parseNumber(value string) (float64, error) {
+    value = strings.ToLower(value)
+    multiplier := 1.0
+    if strings.HasSuffix(value, "k") {
+        multiplier = 1000
+        value = strings.TrimSuffix(value, "k")
+    }
+    number, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0, fmt.Errorf("'%s' no es un número", value)
+    }
+    return number * multiplier, nil
+}
+
+// parseDurationSeconds interpreta una duración como "10m", "3m30s", "3:30" o "210" (segundos).
+func parseDurationSeconds(value string) (float64, error) {
+    if parts := strings.Split(value, ":"); len(parts) > 1 {
+        seconds := 0.0
+        for _, part := range parts {
+            number, err := strconv.ParseFloat(part, 64)
+            if err != nil {
+                return 0, fmt.Errorf("'%s' no es una duración", value)
+            }
+            seconds = seconds*60 + number
+        }
+        return seconds, nil
+    }
+    if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+        return seconds, nil
+    }
+    duration, err := time.ParseDuration(value)
+    if err != nil {
+        return 0, fmt.Errorf("'%s' no es una duración", value)
+    }
+    return duration.Seconds(), nil
+}
+
+// isAffirmative interpreta valores como "si", "sí", "yes", "true" o "1".
+func isAffirmative(value string) bool {
+    switch strings.ToLower(value) {
+    case "si", "sí", "yes", "true", "1":
+        return true
+    }
+    return false
+}
@@ -5,15 +5,33 @@ import (
     "os"
     "os/user"
     "path/filepath"
+    "strconv"
+    "strings"
 )
 
 // ConfigurationFile define las rutas de configuración, la base de datos por defecto y el directorio de música por defecto.
 type ConfigurationFile struct {
-    ConfigPath      string // Ruta del archivo de configuración.
-    DefaultDBPath   string // Ruta por defecto de la base de datos.
-    DefaultMusicDir string // Ruta por defecto del directorio de música.
+    ConfigPath       string   // Ruta del archivo de configuración.
+    DefaultDBPath    string   // Ruta por defecto de la base de datos.
+    DefaultMusicDir  string   // Ruta por defecto del directorio de música.
+    CoverCacheDir    string   // Directorio donde se guardan las portadas extraídas.
+    PathTemplates    []string // Plantillas de rutas para deducir los datos que faltan en las etiquetas.
+    OrganizeTemplate string   // Plantilla con la que el organizador renombra y mueve los archivos.
+    BackupCount      int      // Número de respaldos de la base de datos que se conservan (0 los desactiva).
+    BackupInterval   int      // Horas entre respaldos automáticos de la base de datos (0 los desactiva).
+    DatabaseDSN      string   // DSN de un catálogo compartido en PostgreSQL; si está vacío se usa la base de datos local.
+
+    CheckIntegrity      bool // Indica si al minar se revisan todas las tramas de cada MP3 en busca de daños.
+    ComputeFingerprints bool // Indica si al minar se calcula la huella acústica de cada MP3.
+    WriteReplayGain     bool // Indica si el análisis de sonoridad escribe las tramas REPLAYGAIN_* en los archivos.
+    KeepTagBackups      bool // Indica si al editar las etiquetas se guarda una copia del archivo original (.bak).
 }
 
+const (
+    defaultBackupCount    = 7  // Respaldos que se conservan por defecto: una semana con un respaldo diario.
+    defaultBackupInterval = 24 // Horas entre respaldos por defecto.
+)
+
 // NewConfigurationFile es el constructor para ConfigurationFile. Establece las rutas por defecto de configuración y base de datos.
 func NewConfigurationFile() *ConfigurationFile {
     usr, err := user.Current() // Obtiene el usuario actual del sistema.
@@ -30,6 +48,9 @@ func NewConfigurationFile() *ConfigurationFile {
     dbDir := filepath.Join(usr.HomeDir, ".local", "share", "DataBase")
     defaultDBPath := filepath.Join(dbDir, "MusicDataBase.db")
 
+    // Las portadas se guardan en $HOME/.cache/MusicDataBase/covers
+    coverCacheDir := filepath.Join(usr.HomeDir, ".cache", "MusicDataBase", "covers")
+
     // Establece el directorio de música. Si no existe "Música", busca "Music".
     musicDir := filepath.Join(usr.HomeDir, "Música")
     if _, err := os.Stat(musicDir); os.IsNotExist(err) {
@@ -37,13 +58,118 @@ func NewConfigurationFile() *ConfigurationFile {
     }
 
     // Retorna una nueva instancia de ConfigurationFile con las rutas configuradas.
-    return &ConfigurationFile{
+    cf := &ConfigurationFile{
         ConfigPath:      configFilePath,
         DefaultDBPath:   defaultDBPath,
         DefaultMusicDir: musicDir,
+        CoverCacheDir:   coverCacheDir,
+        BackupCount:     defaultBackupCount,
+        BackupInterval:  defaultBackupInterval,
+    }
+
+    // Los valores guardados en el archivo de configuración reemplazan a los valores por defecto.
+    if err := cf.Load(); err != nil && !os.IsNotExist(err) {
+        fmt.Println("Error leyendo el archivo de configuración:", err)
+    }
+    return cf
+}
+
+// Load lee el archivo de configuración, con una línea CLAVE=valor por opción. PATH_TEMPLATE puede aparecer varias veces.
+// Los números y los valores booleanos que no son válidos se ignoran.
+func (cf *ConfigurationFile) Load() error {
+    data, err := os.ReadFile(cf.ConfigPath)
+    if err != nil {
+        return err
+    }
+
+    var templates []string
+    for _, line := range strings.Split(string(data), "\n") {
+        key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+        if !ok {
+            continue
+        }
+        switch key {
+        case "DB_PATH":
+            cf.DefaultDBPath = value
+        case "MUSIC_DIR":
+            cf.DefaultMusicDir = value
+        case "PATH_TEMPLATE":
+            templates = append(templates, value)
+        case "ORGANIZE_TEMPLATE":
+            cf.OrganizeTemplate = value
+        case "BACKUP_COUNT":
+            if count, err := strconv.Atoi(value); err == nil && count >= 0 {
+                cf.BackupCount = count
+            }
+        case "BACKUP_INTERVAL_HOURS":
+            if hours, err := strconv.Atoi(value); err == nil && hours >= 0 {
+                cf.BackupInterval = hours
+            }
+        case "DB_DSN":
+            cf.DatabaseDSN = value
+        case "CHECK_INTEGRITY":
+            parseBoolOption(value, &cf.CheckIntegrity)
+        case "COMPUTE_FINGERPRINTS":
+            parseBoolOption(value, &cf.ComputeFingerprints)
+        case "WRITE_REPLAYGAIN":
+            parseBoolOption(value, &cf.WriteReplayGain)
+        case "KEEP_TAG_BACKUPS":
+            parseBoolOption(value, &cf.KeepTagBackups)
+        }
+    }
+    cf.PathTemplates = templates
+    return nil
+}
+
+// parseBoolOption guarda en option el valor booleano de value, si es válido.
+func parseBoolOption(value string, option *bool) {
+    if b, err := strconv.ParseBool(value); err == nil {
+        *option = b
     }
 }
 
+// Save escribe la configuración actual en el archivo de configuración, reemplazando su contenido. Con un DSN del
+// catálogo compartido, que puede tener una contraseña, sólo el usuario puede leer el archivo.
+func (cf *ConfigurationFile) Save() error {
+    if err := os.MkdirAll(filepath.Dir(cf.ConfigPath), 0755); err != nil {
+        return fmt.Errorf("error creando el directorio de configuración: %v", err)
+    }
+
+    var config strings.Builder
+    fmt.Fprintf(&config, "DB_PATH=%s\nMUSIC_DIR=%s\n", cf.DefaultDBPath, cf.DefaultMusicDir)
+    for _, template := range cf.PathTemplates {
+        fmt.Fprintf(&config, "PATH_TEMPLATE=%s\n", template)
+    }
+    if cf.OrganizeTemplate != "" {
+        fmt.Fprintf(&config, "ORGANIZE_TEMPLATE=%s\n", cf.OrganizeTemplate)
+    }
+    fmt.Fprintf(&config, "BACKUP_COUNT=%d\nBACKUP_INTERVAL_HOURS=%d\n", cf.BackupCount, cf.BackupInterval)
+    fmt.Fprintf(&config, "CHECK_INTEGRITY=%t\nCOMPUTE_FINGERPRINTS=%t\nWRITE_REPLAYGAIN=%t\nKEEP_TAG_BACKUPS=%t\n",
+        cf.CheckIntegrity, cf.ComputeFingerprints, cf.WriteReplayGain, cf.KeepTagBackups)
+    if cf.DatabaseDSN != "" {
+        fmt.Fprintf(&config, "DB_DSN=%s\n", cf.DatabaseDSN)
+    }
+    mode := os.FileMode(0644)
+    if cf.DatabaseDSN != "" {
+        mode = 0600
+    }
+    if err := os.WriteFile(cf.ConfigPath, []byte(config.String()), mode); err != nil {
+        return fmt.Errorf("error escribiendo en el archivo de configuración: %v", err)
+    }
+    // WriteFile sólo aplica los permisos al crear el archivo.
+    if cf.DatabaseDSN != "" {
+        if err := os.Chmod(cf.ConfigPath, mode); err != nil {
+            return fmt.Errorf("error cambiando los permisos del archivo de configuración: %v", err)
+        }
+    }
+    return nil
+}
+
+// BackupDir regresa el directorio donde se guardan los respaldos de la base de datos, junto a la base de datos.
+func (cf *ConfigurationFile) BackupDir() string {
+    return filepath.Join(filepath.Dir(cf.DefaultDBPath), "backups")
+}
+
 // CreateDefaultConfig crea un archivo de configuración con las rutas por defecto de la base de datos y música.
 func (cf *ConfigurationFile) CreateDefaultConfig() error {
     // Crear el directorio .config/MusicDataBase si no existe.
@@ -0,0 +1,154 @@
+package model
+
+import (
+    "crypto/sha1"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/dhowden/tag"
+)
+
+// folderCoverNames son los nombres de archivo (sin extensión, en minúsculas) que se buscan en el directorio
+// del álbum cuando el archivo de audio no trae una portada incrustada.
+var folderCoverNames = []string{"folder", "cover", "front", "albumart"}
+
+// coverImage contiene los bytes de una portada y la extensión con la que se guardará en la caché.
+type coverImage struct {
+    data []byte
+    ext  string
+}
+
+// findCoverArt obtiene la portada de una canción: primero la imagen incrustada (APIC, METADATA_BLOCK_PICTURE
+// o covr) y, si no existe, una imagen como folder.jpg o cover.png en el directorio del álbum.
+func findCoverArt(metadata tag.Metadata, filePath string) *coverImage {
+    if picture := metadata.Picture(); picture != nil && len(picture.Data) > 0 {
+        ext := strings.ToLower(picture.Ext)
+        if ext == "" {
+            ext = extensionFromMIME(picture.MIMEType)
+        }
+        return &coverImage{data: picture.Data, ext: ext}
+    }
+
+    entries, err := os.ReadDir(filepath.Dir(filePath))
+    if err != nil {
+        return nil
+    }
+    for _, name := range folderCoverNames {
+        for _, entry := range entries {
+            fileName := strings.ToLower(entry.Name())
+            ext := filepath.Ext(fileName)
+            if entry.IsDir() || strings.TrimSuffix(fileName, ext) != name || (ext != ".jpg" && ext != ".jpeg" && ext != ".png") {
+                continue
+            }
+            data, err := os.ReadFile(filepath.Join(filepath.Dir(filePath), entry.Name()))
+            if err != nil {
+                continue
+            }
+            return &coverImage{data: data, ext: strings.TrimPrefix(ext, ".")}
+        }
+    }
+    return nil
+}
+
+// extensionFromMIME deduce la extensión de una imagen a partir de su tipo MIME.
+func extensionFromMIME(mimeType string) string {
+    if strings.Contains(strings.ToLower(mimeType), "png") {
+        return "png"
+    }
+    return "jpg"
+}
+
+// storeCoverArt registra la portada, ya guardada en la caché del disco en coverPath con su hash como nombre, de modo
+// que la misma imagen incrustada en varias canciones se almacena una sola vez, y devuelve su id_cover.
+func storeCoverArt(tx *sql.Tx, cover *coverImage, coverPath string) (int64, error) {
+    hash := cover.hash()
+
+    var idCover int64
+    err := tx.QueryRow("SELECT id_cover FROM covers WHERE hash = ?", hash).Scan(&idCover)
+    if err == nil {
+        return idCover, nil
+    }
+    if err != sql.ErrNoRows {
+        return 0, fmt.Errorf("error buscando la portada: %v", err)
+    }
+
+    result, err := tx.Exec("INSERT INTO covers (hash, path) VALUES (?, ?)", hash, coverPath)
+    if err != nil {
+        return 0, fmt.Errorf("error insertando la portada: %v", err)
+    }
+    return result.LastInsertId()
+}
+
+// hash regresa el hash de la imagen, con el que se guarda en la caché.
+func (c *coverImage) hash() string {
+    sum := sha1.Sum(c.data)
+    return hex.EncodeToString(sum[:])
+}
+
+// cacheCover escribe la portada en la caché del disco, si no estaba ya, y regresa su ruta.
+func cacheCover(cover *coverImage, cacheDir string) (string, error) {
+    if err := os.MkdirAll(cacheDir, 0755); err != nil {
+        return "", fmt.Errorf("error creando el directorio de portadas: %v", err)
+    }
+    coverPath := filepath.Join(cacheDir, cover.hash()+"."+cover.ext)
+    if _, err := os.Stat(coverPath); os.IsNotExist(err) {
+        if err := os.WriteFile(coverPath, cover.data, 0644); err != nil {
+            return "", fmt.Errorf("error guardando la portada: %v", err)
+        }
+    }
+    return coverPath, nil
+}
+
+// albumHasCover verifica si el álbum ya tiene una portada asociada.
+func albumHasCover(q queryer, album, albumPath string) bool {
+    var hasCover bool
+    err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM albums WHERE name = ? AND path = ? AND id_cover IS NOT NULL)",
+        album, albumPath).Scan(&hasCover)
+    if err != nil {
+        return false
+    }
+    return hasCover
+}
+
+// minedCover busca la portada de una canción minada y la guarda en la caché, si su álbum aún no tiene una. La portada
+// se busca sólo cuando hace falta, porque puede requerir leer el directorio del álbum. Regresa nil si no hay portada;
+// si no se pudo guardar en la caché sólo se registra en el log, porque la canción se guarda igual.
+func minedCover(q queryer, song MinedSong) (*coverImage, string) {
+    if song.coverDir == "" || song.cover == nil || albumHasCover(q, song.Album, song.AlbumPath) {
+        return nil, ""
+    }
+
+    cover := song.cover()
+    if cover == nil {
+        return nil, ""
+    }
+
+    coverPath, err := cacheCover(cover, song.coverDir)
+    if err != nil {
+        log.Printf("Error al guardar la portada de %s: %v\n", song.Path, err)
+        return nil, ""
+    }
+    return cover, coverPath
+}
+
+// linkAlbumCover asocia una portada ya guardada en la caché (ver minedCover) con el álbum, si aún no tiene una.
+func linkAlbumCover(tx *sql.Tx, cover *coverImage, coverPath, album, albumPath string) error {
+    if cover == nil {
+        return nil
+    }
+
+    idCover, err := storeCoverArt(tx, cover, coverPath)
+    if err != nil {
+        return err
+    }
+
+    if _, err := tx.Exec("UPDATE albums SET id_cover = ? WHERE name = ? AND path = ? AND id_cover IS NULL", idCover, album, albumPath); err != nil {
+        return fmt.Errorf("error al asociar la portada con el álbum: %v", err)
+    }
+    return nil
+}
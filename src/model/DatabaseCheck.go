@@ -0,0 +1,208 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+)
+
+// DatabaseCheck es el resultado de revisar la base de datos, por ejemplo después de que una falla interrumpió la
+// creación del esquema o el minado.
+type DatabaseCheck struct {
+    MissingTables    []string // Tablas del esquema base que no existen.
+    SchemaVersion    int      // Versión del esquema guardada en la base de datos.
+    LatestVersion    int      // Versión del esquema que espera la aplicación.
+    Integrity        []string // Problemas que encontró PRAGMA integrity_check.
+    BrokenReferences int      // Filas (sin contar rolas) que hacen referencia a filas que no existen.
+    OrphanSongs      int      // Rolas cuyo álbum o intérprete no existe.
+    EmptyAlbums      int      // Álbumes sin canciones.
+    EmptyPerformers  int      // Intérpretes sin canciones.
+    MissingFiles     []string // Rutas de las rolas cuyo archivo ya no existe.
+}
+
+// OK indica si la revisión no encontró ningún problema.
+func (c DatabaseCheck) OK() bool {
+    return len(c.Problems()) == 0
+}
+
+// Problems describe cada problema encontrado, en el orden en que se reparan.
+func (c DatabaseCheck) Problems() []string {
+    var problems []string
+    if len(c.MissingTables) > 0 {
+        problems = append(problems, fmt.Sprintf("Faltan %d tablas del esquema: %v", len(c.MissingTables), c.MissingTables))
+    }
+    if c.SchemaVersion < c.LatestVersion {
+        problems = append(problems, fmt.Sprintf("El esquema está en la versión %d de %d", c.SchemaVersion, c.LatestVersion))
+    }
+    for _, message := range c.Integrity {
+        problems = append(problems, "Integridad: "+message)
+    }
+    if c.BrokenReferences > 0 {
+        problems = append(problems, fmt.Sprintf("%d filas hacen referencia a filas que no existen", c.BrokenReferences))
+    }
+    if c.OrphanSongs > 0 {
+        problems = append(problems, fmt.Sprintf("%d canciones tienen un álbum o un intérprete que no existe", c.OrphanSongs))
+    }
+    if c.EmptyAlbums > 0 || c.EmptyPerformers > 0 {
+        problems = append(problems, fmt.Sprintf("%d álbumes y %d intérpretes no tienen canciones", c.EmptyAlbums, c.EmptyPerformers))
+    }
+    if len(c.MissingFiles) > 0 {
+        problems = append(problems, fmt.Sprintf("%d canciones tienen un archivo que ya no existe", len(c.MissingFiles)))
+    }
+    return problems
+}
+
+// maxIntegrityMessages es el número máximo de problemas que se piden a PRAGMA integrity_check.
+const maxIntegrityMessages = 100
+
+// CheckDatabase revisa la base de datos sin modificarla: que el esquema esté completo y actualizado, la integridad
+// del archivo (PRAGMA integrity_check), las referencias entre tablas, las canciones con álbumes o intérpretes que no
+// existen, los álbumes e intérpretes sin canciones y las canciones cuyos archivos ya no existen.
+func CheckDatabase(db *sql.DB) (DatabaseCheck, error) {
+    check := DatabaseCheck{LatestVersion: latestSchemaVersion()}
+    for _, table := range coreTables {
+        if !tableExists(db, table) {
+            check.MissingTables = append(check.MissingTables, table)
+        }
+    }
+    version, err := schemaVersion(db)
+    if err != nil {
+        return check, err
+    }
+    check.SchemaVersion = version
+
+    rows, err := db.Query(fmt.Sprintf("PRAGMA integrity_check(%d)", maxIntegrityMessages))
+    if err != nil {
+        return check, fmt.Errorf("error al revisar la integridad de la base de datos: %v", err)
+    }
+    for rows.Next() {
+        var message string
+        if err := rows.Scan(&message); err != nil {
+            rows.Close()
+            return check, fmt.Errorf("error al revisar la integridad de la base de datos: %v", err)
+        }
+        if message != "ok" {
+            check.Integrity = append(check.Integrity, message)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return check, fmt.Errorf("error al revisar la integridad de la base de datos: %v", err)
+    }
+
+    if err := db.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check WHERE [table] <> 'rolas'").Scan(&check.BrokenReferences); err != nil {
+        return check, fmt.Errorf("error al revisar las llaves foráneas: %v", err)
+    }
+    // Las demás revisiones necesitan las tablas del esquema base.
+    if len(check.MissingTables) > 0 {
+        return check, nil
+    }
+
+    counts := []struct {
+        query string
+        count *int
+    }{
+        {`SELECT COUNT(*) FROM rolas
+            WHERE (id_album IS NOT NULL AND NOT EXISTS (SELECT 1 FROM albums WHERE albums.id_album = rolas.id_album))
+               OR (id_performer IS NOT NULL AND NOT EXISTS (SELECT 1 FROM performers WHERE performers.id_performer = rolas.id_performer))`, &check.OrphanSongs},
+        {"SELECT COUNT(*) FROM albums WHERE NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_album = albums.id_album)", &check.EmptyAlbums},
+        {"SELECT COUNT(*) FROM performers WHERE NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_performer = performers.id_performer)", &check.EmptyPerformers},
+    }
+    for _, c := range counts {
+        if err := db.QueryRow(c.query).Scan(c.count); err != nil {
+            return check, fmt.Errorf("error al revisar la base de datos: %v", err)
+        }
+    }
+
+    paths, err := db.Query("SELECT path FROM rolas WHERE path IS NOT NULL ORDER BY path")
+    if err != nil {
+        return check, fmt.Errorf("error al obtener las rolas: %v", err)
+    }
+    defer paths.Close()
+    for paths.Next() {
+        var path string
+        if err := paths.Scan(&path); err != nil {
+            return check, fmt.Errorf("error al obtener las rolas: %v", err)
+        }
+        // Sólo cuentan los archivos que no existen; un disco desconectado o sin permisos no es motivo para borrarlos.
+        if _, err := os.Stat(path); os.IsNotExist(err) {
+            check.MissingFiles = append(check.MissingFiles, path)
+        }
+    }
+    return check, paths.Err()
+}
+
+// RepairDatabase corrige los problemas de check que se pueden reparar automáticamente: completa y actualiza el
+// esquema, reconstruye los índices si la revisión de integridad falló, repara las referencias rotas y elimina los
+// álbumes e intérpretes sin canciones. Con removeMissing también elimina las canciones cuyos archivos ya no existen.
+// Estos cambios no se registran en la bitácora. Regresa la descripción de cada reparación hecha.
+func RepairDatabase(db *sql.DB, check DatabaseCheck, removeMissing bool) ([]string, error) {
+    var repairs []string
+    if len(check.MissingTables) > 0 || check.SchemaVersion < check.LatestVersion {
+        if err := createSchema(db); err != nil {
+            return repairs, err
+        }
+        if err := migrateSchema(db); err != nil {
+            return repairs, fmt.Errorf("error al migrar el esquema: %v", err)
+        }
+        repairs = append(repairs, fmt.Sprintf("Se completó el esquema en la versión %d", check.LatestVersion))
+    }
+
+    // Los índices se pueden reconstruir a partir de las tablas; si las tablas mismas están dañadas hay que restaurar
+    // un respaldo.
+    if len(check.Integrity) > 0 {
+        if _, err := db.Exec("REINDEX"); err != nil {
+            return repairs, fmt.Errorf("error al reconstruir los índices: %v", err)
+        }
+        var result string
+        if err := db.QueryRow("PRAGMA integrity_check(1)").Scan(&result); err != nil {
+            return repairs, fmt.Errorf("error al revisar la integridad de la base de datos: %v", err)
+        }
+        if result != "ok" {
+            return repairs, fmt.Errorf("la base de datos sigue dañada después de reconstruir los índices: %s", result)
+        }
+        repairs = append(repairs, "Se reconstruyeron los índices")
+    }
+
+    if check.BrokenReferences > 0 || check.OrphanSongs > 0 {
+        tx, err := db.Begin()
+        if err != nil {
+            return repairs, fmt.Errorf("error al iniciar la transacción: %v", err)
+        }
+        defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+        if err := repairForeignKeys(tx); err != nil {
+            return repairs, err
+        }
+        if err := tx.Commit(); err != nil {
+            return repairs, fmt.Errorf("error al guardar los cambios: %v", err)
+        }
+        repairs = append(repairs, fmt.Sprintf("Se repararon %d referencias rotas", check.BrokenReferences+check.OrphanSongs))
+    }
+
+    if removeMissing && len(check.MissingFiles) > 0 {
+        tx, err := db.Begin()
+        if err != nil {
+            return repairs, fmt.Errorf("error al iniciar la transacción: %v", err)
+        }
+        defer tx.Rollback()
+        // Las letras, tramas, orígenes y géneros de cada rola se eliminan con ella (ON DELETE CASCADE).
+        for _, path := range check.MissingFiles {
+            if _, err := tx.Exec("DELETE FROM rolas WHERE path = ?", path); err != nil {
+                return repairs, fmt.Errorf("error al eliminar la rola %s: %v", path, err)
+            }
+        }
+        if err := tx.Commit(); err != nil {
+            return repairs, fmt.Errorf("error al guardar los cambios: %v", err)
+        }
+        repairs = append(repairs, fmt.Sprintf("Se eliminaron %d canciones cuyos archivos ya no existen", len(check.MissingFiles)))
+    }
+
+    albums, performers, err := CollectGarbage(db)
+    if err != nil {
+        return repairs, err
+    }
+    if albums > 0 || performers > 0 {
+        repairs = append(repairs, fmt.Sprintf("Se eliminaron %d álbumes y %d intérpretes sin canciones", albums, performers))
+    }
+    return repairs, nil
+}
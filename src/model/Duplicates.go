@@ -0,0 +1,284 @@
+package model
+
+import (
+    "crypto/sha1"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "os"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// durationTolerance es la diferencia máxima (en segundos) entre dos copias de la misma canción.
+const durationTolerance = 2.0
+
+// DuplicateGroup es un conjunto de rolas que parecen ser la misma canción.
+type DuplicateGroup struct {
+    Key   string // Descripción de lo que tienen en común (título y performer, o hash del audio).
+    Songs []Song // Copias de la canción, incluidas las que ya están ocultas.
+}
+
+// accentReplacer quita los acentos más comunes para comparar títulos y nombres.
+var accentReplacer = strings.NewReplacer(
+    "á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+    "à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u",
+    "â", "a", "ê", "e", "î", "i", "ô", "o", "û", "u",
+    "ä", "a", "ë", "e", "ï", "i", "ö", "o", "ç", "c",
+)
+
+// NormalizeText convierte un texto a minúsculas, sin acentos, sin puntuación y con espacios simples,
+// de modo que "Juan  Gabriel" y "JUAN GABRIEL!" se comparan como iguales.
+func NormalizeText(text string) string {
+    text = accentReplacer.Replace(strings.ToLower(text))
+    text = strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return ' '
+    }, text)
+    return strings.Join(strings.Fields(text), " ")
+}
+
+// FindDuplicates agrupa las rolas que tienen el mismo título y performer normalizados y una duración
+// parecida. Si byAudioHash es verdadero, también agrupa los MP3 cuyas tramas de audio son idénticas
+// aunque sus etiquetas difieran (el hash se calcula y guarda la primera vez que se necesita).
+// Si byFingerprint es verdadero, agrupa además las rolas con huellas acústicas parecidas, lo que
+// encuentra la misma grabación codificada a otra tasa de bits o con etiquetas equivocadas.
+func FindDuplicates(db *sql.DB, byAudioHash, byFingerprint bool) ([]DuplicateGroup, error) {
+    songs, err := allSongsIncludingHidden(db)
+    if err != nil {
+        return nil, err
+    }
+
+    groups := groupByTags(songs)
+
+    if byAudioHash {
+        hashes, err := audioHashes(db)
+        if err != nil {
+            return nil, err
+        }
+        groups = append(groups, groupByAudioHash(songs, hashes, groups)...)
+    }
+
+    if byFingerprint {
+        fingerprints, err := songFingerprints(db)
+        if err != nil {
+            return nil, err
+        }
+        groups = append(groups, groupByFingerprint(songs, fingerprints, groups)...)
+    }
+    return groups, nil
+}
+
+// allSongsIncludingHidden obtiene todas las rolas, incluidas las ocultas.
+func allSongsIncludingHidden(db *sql.DB) ([]Song, error) {
+    rows, err := db.Query(SongQuery)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las canciones: %v", err)
+    }
+    defer rows.Close()
+
+    var songs []Song
+    for rows.Next() {
+        song, err := ScanSong(rows)
+        if err != nil {
+            return nil, fmt.Errorf("error al leer las canciones: %v", err)
+        }
+        songs = append(songs, song)
+    }
+    return songs, rows.Err()
+}
+
+// groupByTags agrupa por título y performer normalizados y, dentro de cada grupo, separa las
+// canciones cuya duración difiere más de durationTolerance segundos.
+func groupByTags(songs []Song) []DuplicateGroup {
+    byKey := map[string][]Song{}
+    var keys []string
+    for _, song := range songs {
+        key := NormalizeText(song.Title) + " - " + NormalizeText(song.Artist)
+        if _, ok := byKey[key]; !ok {
+            keys = append(keys, key)
+        }
+        byKey[key] = append(byKey[key], song)
+    }
+    sort.Strings(keys)
+
+    var groups []DuplicateGroup
+    for _, key := range keys {
+        candidates := byKey[key]
+        if len(candidates) < 2 {
+            continue
+        }
+        sort.Slice(candidates, func(i, j int) bool { return candidates[i].Duration < candidates[j].Duration })
+
+        current := []Song{candidates[0]}
+        for _, song := range candidates[1:] {
+            previous := current[len(current)-1]
+            if math.Abs(song.Duration-previous.Duration) <= durationTolerance {
+                current = append(current, song)
+                continue
+            }
+            if len(current) > 1 {
+                groups = append(groups, DuplicateGroup{Key: key, Songs: current})
+            }
+            current = []Song{song}
+        }
+        if len(current) > 1 {
+            groups = append(groups, DuplicateGroup{Key: key, Songs: current})
+        }
+    }
+    return groups
+}
+
+// groupByAudioHash agrupa las rolas con el mismo hash de audio, omitiendo los grupos que ya se
+// encontraron por etiquetas con exactamente las mismas rolas.
+func groupByAudioHash(songs []Song, hashes map[int]string, existing []DuplicateGroup) []DuplicateGroup {
+    found := map[string]bool{}
+    for _, group := range existing {
+        found[groupSignature(group.Songs)] = true
+    }
+
+    byHash := map[string][]Song{}
+    var keys []string
+    for _, song := range songs {
+        hash, ok := hashes[song.IDRola]
+        if !ok {
+            continue
+        }
+        if _, ok := byHash[hash]; !ok {
+            keys = append(keys, hash)
+        }
+        byHash[hash] = append(byHash[hash], song)
+    }
+    sort.Strings(keys)
+
+    var groups []DuplicateGroup
+    for _, hash := range keys {
+        if len(byHash[hash]) < 2 || found[groupSignature(byHash[hash])] {
+            continue
+        }
+        groups = append(groups, DuplicateGroup{Key: "audio idéntico " + hash[:12], Songs: byHash[hash]})
+    }
+    return groups
+}
+
+// groupSignature identifica un grupo por los IDs de sus rolas, sin importar el orden.
+func groupSignature(songs []Song) string {
+    ids := make([]int, len(songs))
+    for i, song := range songs {
+        ids[i] = song.IDRola
+    }
+    sort.Ints(ids)
+    return fmt.Sprint(ids)
+}
+
+// audioHashes regresa el hash de audio de cada rola MP3, calculando y guardando los que faltan.
+func audioHashes(db *sql.DB) (map[int]string, error) {
+    rows, err := db.Query("SELECT id_rola, path, COALESCE(audio_hash, '') FROM rolas WHERE codec = 'MP3'")
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener los hashes de audio: %v", err)
+    }
+    hashes := map[int]string{}
+    missing := map[int]string{}
+    for rows.Next() {
+        var id int
+        var path, hash string
+        if err := rows.Scan(&id, &path, &hash); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("error al leer los hashes de audio: %v", err)
+        }
+        if hash == "" {
+            missing[id] = path
+        } else {
+            hashes[id] = hash
+        }
+    }
+    rows.Close()
+
+    for id, path := range missing {
+        hash, err := audioHashFile(path)
+        if err != nil {
+            log.Printf("Error al calcular el hash de audio de %s: %v\n", path, err)
+            continue
+        }
+        if _, err := db.Exec("UPDATE rolas SET audio_hash = ? WHERE id_rola = ?", hash, id); err != nil {
+            log.Printf("Error al guardar el hash de audio: %v\n", err)
+        }
+        hashes[id] = hash
+    }
+    return hashes, nil
+}
+
+// audioHashFile abre un archivo MP3 y calcula el hash de sus tramas.
+func audioHashFile(filePath string) (string, error) {
+    file, err := os.Open(filePath)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+    return AudioFramesHash(file)
+}
+
+// AudioFramesHash calcula un SHA-1 sobre las tramas MPEG de un archivo, ignorando las etiquetas
+// ID3v2, ID3v1 y APE, de modo que dos copias que sólo difieren en sus etiquetas tienen el mismo hash.
+func AudioFramesHash(r io.ReadSeeker) (string, error) {
+    start, err := audioStart(r)
+    if err != nil {
+        return "", err
+    }
+    if _, err := r.Seek(start, io.SeekStart); err != nil {
+        return "", err
+    }
+
+    hasher := sha1.New()
+    fr := newMP3FrameReader(r)
+    for {
+        _, frame, err := fr.next()
+        if len(frame) > 0 {
+            hasher.Write(frame)
+        }
+        if err != nil {
+            break
+        }
+    }
+    if fr.frames == 0 {
+        return "", fmt.Errorf("no se encontró ninguna trama MPEG")
+    }
+    return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// SetSongHidden oculta o vuelve a mostrar una rola en la tabla y en las búsquedas. El cambio se registra en la
+// bitácora para poder deshacerlo.
+func SetSongHidden(db *sql.DB, idRola int, hidden bool) error {
+    description := "Mostrar una canción"
+    if hidden {
+        description = "Ocultar una canción"
+    }
+    return withJournal(db, description, func(j *journal, _ *fileChanges) error {
+        return j.update("rolas", int64(idRola), []string{"hidden"}, hidden)
+    })
+}
+
+// KeepDuplicate conserva visible la rola elegida de un grupo de duplicados y oculta las demás, en una sola
+// operación de la bitácora.
+func KeepDuplicate(db *sql.DB, group DuplicateGroup, keepID int) error {
+    description := "Conservar una copia"
+    for _, song := range group.Songs {
+        if song.IDRola == keepID {
+            description = fmt.Sprintf("Conservar una copia de \"%s\"", songLabel(song))
+        }
+    }
+    return withJournal(db, description, func(j *journal, _ *fileChanges) error {
+        for _, song := range group.Songs {
+            if err := j.update("rolas", int64(song.IDRola), []string{"hidden"}, song.IDRola != keepID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
@@ -0,0 +1,192 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/dhowden/tag"
+)
+
+// Lyrics es la letra de una canción, tomada de una trama USLT (o de la etiqueta de letra en otros formatos).
+// Un archivo puede traer varias letras, por ejemplo en distintos idiomas.
+type Lyrics struct {
+    Language    string // Código de idioma ISO 639-2 (e.g., "eng", "spa"), vacío si se desconoce.
+    Description string // Descripción del contenido.
+    Text        string // Letra completa.
+}
+
+// TagFrame es una trama (o campo) de las etiquetas del archivo tal como se leyó, convertida a texto.
+type TagFrame struct {
+    Name  string // Identificador de la trama (e.g., TIT2, COMM, TXXX_0) o nombre del campo.
+    Value string // Contenido de la trama como texto.
+}
+
+// extendedTags son los datos de las etiquetas que se guardan además de los campos principales de la rola.
+type extendedTags struct {
+    composer   string
+    comment    string
+    disc       int
+    discTotal  int
+    trackTotal int
+    lyrics     []Lyrics
+    frames     []TagFrame
+}
+
+// readExtendedTags obtiene el compositor, el comentario, el número y total de discos, el total de pistas, las letras
+// y todas las tramas de las etiquetas. En ID3v2 se recorren las tramas COMM y USLT directamente, porque puede haber varias.
+func readExtendedTags(metadata tag.Metadata) extendedTags {
+    tags := extendedTags{composer: strings.TrimSpace(metadata.Composer())}
+    tags.disc, tags.discTotal = metadata.Disc()
+    _, tags.trackTotal = metadata.Track()
+
+    raw := metadata.Raw()
+    names := make([]string, 0, len(raw))
+    for name := range raw {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        frameID := strings.SplitN(name, "_", 2)[0]
+        if comm, ok := raw[name].(*tag.Comm); ok {
+            language, description, text := cleanFrameText(comm.Language), cleanFrameText(comm.Description), cleanFrameText(comm.Text)
+            switch frameID {
+            case "USLT", "ULT":
+                if text != "" {
+                    tags.lyrics = append(tags.lyrics, Lyrics{Language: language, Description: description, Text: text})
+                }
+            case "COMM", "COM":
+                // iTunes guarda datos técnicos (iTunNORM, iTunSMPB...) como comentarios.
+                if tags.comment == "" && !strings.HasPrefix(description, "iTun") {
+                    tags.comment = text
+                }
+            }
+        }
+        if value := rawFrameText(raw[name]); value != "" {
+            tags.frames = append(tags.frames, TagFrame{Name: name, Value: value})
+        }
+    }
+
+    if metadata.Format() != tag.ID3v2_2 && metadata.Format() != tag.ID3v2_3 && metadata.Format() != tag.ID3v2_4 {
+        tags.comment = cleanFrameText(metadata.Comment())
+        if lyrics := cleanFrameText(metadata.Lyrics()); lyrics != "" {
+            tags.lyrics = append(tags.lyrics, Lyrics{Text: lyrics})
+        }
+    }
+    return tags
+}
+
+// rawFrameText convierte el contenido de una trama sin procesar a texto. Las imágenes y los datos binarios
+// sólo se describen, para no guardar su contenido dos veces.
+func rawFrameText(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case string:
+        return cleanFrameText(v)
+    case *tag.Comm:
+        text := cleanFrameText(v.Text)
+        if description := cleanFrameText(v.Description); description != "" {
+            text = description + ": " + text
+        }
+        if language := cleanFrameText(v.Language); language != "" {
+            text = "[" + language + "] " + text
+        }
+        return text
+    case *tag.Picture:
+        return fmt.Sprintf("imagen %s (%d bytes)", v.MIMEType, len(v.Data))
+    case []byte:
+        return fmt.Sprintf("%d bytes", len(v))
+    default:
+        return fmt.Sprint(v)
+    }
+}
+
+// cleanFrameText quita los espacios de los extremos y los caracteres nulos que algunas etiquetas dejan como
+// relleno o separador (por ejemplo, un idioma "\x00\x00\x00" en una trama COMM).
+func cleanFrameText(text string) string {
+    return strings.TrimSpace(strings.ReplaceAll(text, "\x00", ""))
+}
+
+// nullableString regresa nil (NULL) si la cadena está vacía.
+func nullableString(value string) interface{} {
+    if value == "" {
+        return nil
+    }
+    return value
+}
+
+// nullableInt regresa nil (NULL) si el número es 0.
+func nullableInt(value int) interface{} {
+    if value == 0 {
+        return nil
+    }
+    return value
+}
+
+// storeExtendedTags guarda el compositor, el comentario y la numeración de disco y pistas de la rola con la ruta
+// indicada, junto con sus letras y todas las tramas de sus etiquetas.
+func storeExtendedTags(tx *sql.Tx, filePath string, tags extendedTags) error {
+    _, err := tx.Exec("UPDATE rolas SET composer = ?, comment = ?, disc = ?, disc_total = ?, track_total = ? WHERE path = ?",
+        nullableString(tags.composer), nullableString(tags.comment), nullableInt(tags.disc),
+        nullableInt(tags.discTotal), nullableInt(tags.trackTotal), filePath)
+    for _, lyrics := range tags.lyrics {
+        if err != nil {
+            break
+        }
+        _, err = tx.Exec("INSERT INTO lyrics (id_rola, language, description, text) SELECT id_rola, ?, ?, ? FROM rolas WHERE path = ?",
+            lyrics.Language, lyrics.Description, lyrics.Text, filePath)
+    }
+    for _, frame := range tags.frames {
+        if err != nil {
+            break
+        }
+        _, err = tx.Exec("INSERT INTO tag_frames (id_rola, name, value) SELECT id_rola, ?, ? FROM rolas WHERE path = ?",
+            frame.Name, frame.Value, filePath)
+    }
+
+    if err != nil {
+        return fmt.Errorf("error al guardar las etiquetas adicionales de %s: %v", filePath, err)
+    }
+    return nil
+}
+
+// GetLyrics obtiene las letras guardadas de una rola.
+func GetLyrics(db *sql.DB, idRola int) ([]Lyrics, error) {
+    rows, err := db.Query("SELECT COALESCE(language, ''), COALESCE(description, ''), text FROM lyrics WHERE id_rola = ? ORDER BY id_lyrics", idRola)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las letras: %v", err)
+    }
+    defer rows.Close()
+
+    var lyrics []Lyrics
+    for rows.Next() {
+        var l Lyrics
+        if err := rows.Scan(&l.Language, &l.Description, &l.Text); err != nil {
+            return nil, fmt.Errorf("error al leer las letras: %v", err)
+        }
+        lyrics = append(lyrics, l)
+    }
+    return lyrics, rows.Err()
+}
+
+// GetTagFrames obtiene las tramas de las etiquetas de una rola, ordenadas por nombre.
+func GetTagFrames(db *sql.DB, idRola int) ([]TagFrame, error) {
+    rows, err := db.Query("SELECT name, value FROM tag_frames WHERE id_rola = ? ORDER BY name", idRola)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las tramas de las etiquetas: %v", err)
+    }
+    defer rows.Close()
+
+    var frames []TagFrame
+    for rows.Next() {
+        var frame TagFrame
+        if err := rows.Scan(&frame.Name, &frame.Value); err != nil {
+            return nil, fmt.Errorf("error al leer las tramas de las etiquetas: %v", err)
+        }
+        frames = append(frames, frame)
+    }
+    return frames, rows.Err()
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Campos de la rola cuyo origen se registra en la tabla field_sources.
+const (
+    FieldTitle  = "title"
+    FieldArtist = "artist"
+    FieldAlbum  = "album"
+    FieldYear   = "year"
+    FieldGenre  = "genre"
+    FieldTrack  = "track"
+)
+
+// Orígenes posibles del valor de un campo. Los campos sin valor no tienen origen y se guardan como NULL.
+const (
+    SourceTag      = "tag"      // Se leyó de las etiquetas del archivo.
+    SourceFilename = "filename" // Se obtuvo del nombre del archivo (e.g., "03 - Título.mp3").
+    SourceFolder   = "folder"   // Se tomó del nombre del directorio del archivo.
+    SourceGuessed  = "guessed"  // Se supuso a partir de otros datos (e.g., un año en el nombre del directorio).
+    SourceUser     = "user"     // Se editó a mano sólo en la base de datos, sin escribirlo en el archivo.
+)
+
+// SourceLabel regresa una descripción legible del origen de un campo.
+func SourceLabel(source string) string {
+    switch source {
+    case SourceTag:
+        return "etiqueta"
+    case SourceFilename:
+        return "nombre del archivo"
+    case SourceFolder:
+        return "directorio"
+    case SourceGuessed:
+        return "supuesto"
+    case SourceUser:
+        return "editado a mano"
+    }
+    return ""
+}
+
+// Source regresa el origen del valor de un campo de la canción, vacío si el campo no tiene valor
+// o si la canción se minó antes de que se registraran los orígenes.
+func (s Song) Source(field string) string {
+    return s.Sources[field]
+}
+
+// parseSources interpreta la lista "campo=origen,..." que obtiene SongQuery de la tabla field_sources.
+func parseSources(list string) map[string]string {
+    sources := map[string]string{}
+    for _, pair := range strings.Split(list, ",") {
+        if field, source, ok := strings.Cut(pair, "="); ok {
+            sources[field] = source
+        }
+    }
+    return sources
+}
+
+// fileNameTrack reconoce un número de pista al inicio del nombre del archivo seguido de un separador (e.g., "03 - ",
+// "03. ", "3) "). Un número seguido sólo de espacios no es una pista: "99 Luftballons" es un título.
+var fileNameTrack = regexp.MustCompile(`^(\d{1,3})\s*[-.)]\s+(.+)$`)
+
+// folderYear reconoce un año en el nombre de un directorio (e.g., "1997 - OK Computer", "Kid A (2000)").
+var folderYear = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)[0-9]{2})(?:[^0-9]|$)`)
+
+// fileNameFields obtiene la pista y el título del nombre de un archivo con la forma "[pista - ]título". Sin una
+// plantilla de rutas no se sabe si " - " separa al intérprete del título ("Canción - Versión en vivo"), así que el
+// resto del nombre es el título. La pista es 0 si el nombre no empieza con ella.
+func fileNameFields(filePath string) (track int, title string) {
+    name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+    name = strings.TrimSpace(strings.ReplaceAll(name, "_", " "))
+
+    if match := fileNameTrack.FindStringSubmatch(name); match != nil {
+        track, _ = strconv.Atoi(match[1])
+        name = match[2]
+    }
+    return track, strings.TrimSpace(name)
+}
+
+// folderYearGuess busca un año en el nombre del directorio del archivo. Regresa 0 si no hay ninguno.
+func folderYearGuess(filePath string) int {
+    match := folderYear.FindStringSubmatch(filepath.Base(filepath.Dir(filePath)))
+    if match == nil {
+        return 0
+    }
+    year, _ := strconv.Atoi(match[1])
+    return year
+}
+
+// storeFieldSources guarda el origen de cada campo con valor de la rola con la ruta indicada.
+func storeFieldSources(tx *sql.Tx, filePath string, sources map[string]string) error {
+    for field, source := range sources {
+        _, err := tx.Exec("INSERT OR REPLACE INTO field_sources (id_rola, field, source) SELECT id_rola, ?, ? FROM rolas WHERE path = ?",
+            field, source, filePath)
+        if err != nil {
+            return fmt.Errorf("error al guardar el origen de %s de %s: %v", field, filePath, err)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,53 @@
+package model
+
+import "testing"
+
+func TestFileNameFields(t *testing.T) {
+    tests := []struct {
+        path  string
+        track int
+        title string
+    }{
+        {"/música/03 - Karma Police.mp3", 3, "Karma Police"},
+        {"/música/03. Karma Police.mp3", 3, "Karma Police"},
+        {"/música/3) Karma Police.mp3", 3, "Karma Police"},
+        {"/música/03_-_Karma_Police.mp3", 3, "Karma Police"},
+        {"/música/99 Luftballons.mp3", 0, "99 Luftballons"},
+        {"/música/1979.mp3", 0, "1979"},
+        {"/música/Song - Live Version.mp3", 0, "Song - Live Version"},
+        {"/música/03 - Radiohead - Karma Police.mp3", 3, "Radiohead - Karma Police"},
+    }
+    for _, tt := range tests {
+        track, title := fileNameFields(tt.path)
+        if track != tt.track || title != tt.title {
+            t.Errorf("%s: pista %d, título %q; se esperaba %d, %q", tt.path, track, title, tt.track, tt.title)
+        }
+    }
+}
+
+// TestInferPathFieldsArtist revisa que el intérprete sólo se tome de la ruta cuando una plantilla lo pide.
+func TestInferPathFieldsArtist(t *testing.T) {
+    const path = "/música/Radiohead/OK Computer/Radiohead - Karma Police.mp3"
+    fields := InferPathFields(path, "/música", nil)
+    if artist, ok := fields[FieldArtist]; ok {
+        t.Errorf("sin plantilla se dedujo el intérprete %q", artist.Value)
+    }
+    if fields[FieldTitle].Value != "Radiohead - Karma Police" || fields[FieldAlbum].Value != "OK Computer" {
+        t.Errorf("datos deducidos sin plantilla: %+v", fields)
+    }
+
+    template, err := ParsePathTemplate("{album}/{artist} - {title}")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fields = InferPathFields(path, "/música", []*PathTemplate{template})
+    want := map[string]PathField{
+        FieldArtist: {Field: FieldArtist, Value: "Radiohead", Source: SourceFilename},
+        FieldTitle:  {Field: FieldTitle, Value: "Karma Police", Source: SourceFilename},
+    }
+    for field, value := range want {
+        if fields[field] != value {
+            t.Errorf("%s = %+v, se esperaba %+v", field, fields[field], value)
+        }
+    }
+}
@@ -0,0 +1,492 @@
+package model
+
+import (
+    "database/sql"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "math/bits"
+    "math/cmplx"
+    "os"
+    "sort"
+
+    "fyne.io/fyne/v2/widget" // Para manejar la barra de progreso
+)
+
+// Parámetros de la huella acústica, parecidos a los de Chromaprint.
+const (
+    fingerprintSampleRate = 11025 // Frecuencia a la que se remuestrea el audio antes de analizarlo.
+    fingerprintSeconds    = 120   // Segundos del inicio de la canción que se analizan.
+    fingerprintFrameSize  = 4096  // Muestras de cada ventana de la FFT.
+    fingerprintHop        = 1365  // Avance entre ventanas (traslape de 2/3).
+    chromaMinFrequency    = 28.0  // Frecuencias (Hz) que se toman en cuenta para el cromagrama.
+    chromaMaxFrequency    = 3520.0
+)
+
+// fingerprintOffsetRange es el desplazamiento máximo (en subhuellas, ~0.12 s cada una) que se prueba al
+// comparar dos huellas, para tolerar silencios iniciales o retrasos distintos entre codificadores.
+const fingerprintOffsetRange = 24
+
+// DefaultFingerprintSimilarity es la similitud mínima para considerar que dos huellas son la misma grabación.
+// Dos grabaciones distintas coinciden en alrededor de la mitad de los bits (similitud 0.5).
+const DefaultFingerprintSimilarity = 0.85
+
+// chromaFilter suaviza cada banda del cromagrama en el tiempo.
+var chromaFilter = []float64{0.25, 0.75, 1.0, 0.75, 0.25}
+
+// fingerprintClassifier es un filtro rectangular sobre el cromagrama (estilo Haar) cuya respuesta se
+// cuantiza en 2 bits. kind indica la forma del filtro, band y height las bandas de croma que abarca
+// (de forma circular) y width el número de ventanas en el tiempo.
+type fingerprintClassifier struct {
+    kind, band, height, width int
+    threshold                 float64
+}
+
+// fingerprintClassifiers son los 16 filtros que forman cada subhuella de 32 bits.
+var fingerprintClassifiers = [16]fingerprintClassifier{
+    {0, 0, 3, 15, 0.03}, {4, 4, 6, 15, 0.14}, {1, 0, 4, 16, 0.18}, {3, 8, 2, 12, 0.14},
+    {3, 4, 4, 8, 0.22}, {4, 0, 3, 5, 0.10}, {1, 2, 2, 9, 0.10}, {2, 7, 3, 4, 0.06},
+    {2, 6, 2, 16, 0.14}, {2, 1, 3, 2, 0.03}, {5, 10, 1, 15, 0.10}, {1, 3, 6, 2, 0.25},
+    {5, 0, 12, 9, 0.13}, {0, 6, 6, 4, 0.03}, {1, 9, 4, 6, 0.22}, {3, 1, 6, 10, 0.20},
+}
+
+// ComputeFingerprint decodifica los primeros minutos de un MP3 y calcula su huella acústica: una
+// subhuella de 32 bits por cada ~0.12 s de audio, obtenida a partir del cromagrama (energía de las
+// 12 notas de la escala). La huella no depende de las etiquetas ni de la tasa de bits del archivo.
+func ComputeFingerprint(r io.ReadSeeker) ([]uint32, error) {
+    pcm, sampleRate, err := DecodeMP3Mono(r, fingerprintSeconds)
+    if err != nil {
+        return nil, err
+    }
+    return fingerprintPCM(pcm, sampleRate)
+}
+
+// fingerprintPCM calcula la huella acústica de muestras PCM en mono.
+func fingerprintPCM(pcm []float32, sampleRate int) ([]uint32, error) {
+    samples := resample(pcm, sampleRate, fingerprintSampleRate)
+    chroma := chromagram(samples)
+    if len(chroma) < fingerprintFrameWidth() {
+        return nil, fmt.Errorf("el audio es demasiado corto para calcular la huella")
+    }
+    return classifyChroma(chroma), nil
+}
+
+// resample convierte las muestras a otra frecuencia aplicando antes un filtro paso bajas.
+func resample(samples []float32, from, to int) []float64 {
+    const taps = 31
+    cutoff := 0.45 * float64(to) / float64(from)
+    filter := make([]float64, taps)
+    for i := range filter {
+        m := float64(i - taps/2)
+        sinc := 2 * cutoff
+        if m != 0 {
+            sinc = math.Sin(2*math.Pi*cutoff*m) / (math.Pi * m)
+        }
+        filter[i] = sinc * (0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/(taps-1)))
+    }
+
+    step := float64(from) / float64(to)
+    out := make([]float64, int(float64(len(samples))/step))
+    for i := range out {
+        center := int(float64(i) * step)
+        sum := 0.0
+        for j, coefficient := range filter {
+            k := center + j - taps/2
+            if k >= 0 && k < len(samples) {
+                sum += float64(samples[k]) * coefficient
+            }
+        }
+        out[i] = sum
+    }
+    return out
+}
+
+// chromagram calcula la energía normalizada de las 12 notas en cada ventana del audio, suavizada en el tiempo.
+func chromagram(samples []float64) [][12]float64 {
+    window := make([]float64, fingerprintFrameSize)
+    for i := range window {
+        window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(fingerprintFrameSize-1))
+    }
+
+    // Nota (0-11) de cada coeficiente de la FFT dentro del rango de frecuencias, o -1 si está fuera.
+    notes := make([]int, fingerprintFrameSize/2)
+    for k := range notes {
+        notes[k] = -1
+        frequency := float64(k) * fingerprintSampleRate / fingerprintFrameSize
+        if frequency >= chromaMinFrequency && frequency <= chromaMaxFrequency {
+            octave := math.Log2(frequency / (440.0 / 16))
+            notes[k] = int(12*(octave-math.Floor(octave))) % 12
+        }
+    }
+
+    var raw [][12]float64
+    buffer := make([]complex128, fingerprintFrameSize)
+    for start := 0; start+fingerprintFrameSize <= len(samples); start += fingerprintHop {
+        for i := range buffer {
+            buffer[i] = complex(samples[start+i]*window[i], 0)
+        }
+        fft(buffer)
+        var frame [12]float64
+        for k, note := range notes {
+            if note >= 0 {
+                magnitude := cmplx.Abs(buffer[k])
+                frame[note] += magnitude * magnitude
+            }
+        }
+        raw = append(raw, frame)
+    }
+
+    // Suaviza en el tiempo y normaliza cada ventana para que el volumen no afecte la huella.
+    offset := len(chromaFilter) / 2
+    var chroma [][12]float64
+    for t := offset; t+offset < len(raw); t++ {
+        var frame [12]float64
+        for i, coefficient := range chromaFilter {
+            for note := range frame {
+                frame[note] += raw[t-offset+i][note] * coefficient
+            }
+        }
+        norm := 0.0
+        for _, value := range frame {
+            norm += value * value
+        }
+        norm = math.Sqrt(norm)
+        for note := range frame {
+            if norm > 1e-9 {
+                frame[note] /= norm
+            } else {
+                frame[note] = 0
+            }
+        }
+        chroma = append(chroma, frame)
+    }
+    return chroma
+}
+
+// fingerprintFrameWidth regresa el número de ventanas que necesita el filtro más ancho.
+func fingerprintFrameWidth() int {
+    width := 0
+    for _, classifier := range fingerprintClassifiers {
+        width = max(width, classifier.width)
+    }
+    return width
+}
+
+// classifyChroma aplica los 16 filtros a cada posición del cromagrama y forma las subhuellas.
+func classifyChroma(chroma [][12]float64) []uint32 {
+    // Imagen integral sobre el logaritmo del cromagrama, para evaluar cada rectángulo en tiempo constante.
+    integral := make([][13]float64, len(chroma)+1)
+    for t, frame := range chroma {
+        for note := 0; note < 12; note++ {
+            integral[t+1][note+1] = math.Log1p(frame[note]) + integral[t][note+1] + integral[t+1][note] - integral[t][note]
+        }
+    }
+    area := func(t, width, band, height int) float64 {
+        // Las bandas de croma son circulares: un rectángulo puede continuar desde la nota 0.
+        sum := 0.0
+        for height > 0 {
+            end := min(band+height, 12)
+            sum += integral[t+width][end] - integral[t][end] - integral[t+width][band] + integral[t][band]
+            height -= end - band
+            band = 0
+        }
+        return sum / float64(width)
+    }
+
+    frames := len(chroma) - fingerprintFrameWidth() + 1
+    fingerprint := make([]uint32, frames)
+    for t := 0; t < frames; t++ {
+        var word uint32
+        for _, c := range fingerprintClassifiers {
+            var value float64
+            half, third := c.width/2, c.width/3
+            bandHalf, bandThird := c.height/2, c.height/3
+            switch c.kind {
+            case 0: // Energía promedio de las bandas respecto a la de todas las notas.
+                value = area(t, c.width, c.band, c.height)/float64(c.height) - area(t, c.width, 0, 12)/12
+            case 1: // Bandas superiores contra inferiores.
+                value = area(t, c.width, c.band, bandHalf) - area(t, c.width, c.band+bandHalf, c.height-bandHalf)
+            case 2: // Primera mitad del tiempo contra la segunda.
+                value = area(t, max(half, 1), c.band, c.height) - area(t+half, c.width-half, c.band, c.height)
+            case 3: // Tablero de ajedrez de cuatro cuadrantes.
+                value = area(t, max(half, 1), c.band, bandHalf) + area(t+half, c.width-half, (c.band+bandHalf)%12, c.height-bandHalf) -
+                    area(t, max(half, 1), (c.band+bandHalf)%12, c.height-bandHalf) - area(t+half, c.width-half, c.band, bandHalf)
+            case 4: // Franja central de bandas contra las exteriores.
+                value = area(t, c.width, (c.band+bandThird)%12, max(bandThird, 1)) -
+                    (area(t, c.width, c.band, max(bandThird, 1))+area(t, c.width, (c.band+2*bandThird)%12, max(bandThird, 1)))/2
+            case 5: // Franja central de tiempo contra las exteriores.
+                value = area(t+third, max(third, 1), c.band, c.height) -
+                    (area(t, max(third, 1), c.band, c.height)+area(t+2*third, max(third, 1), c.band, c.height))/2
+            }
+            word = word<<2 | grayQuantize(value, c.threshold)
+        }
+        fingerprint[t] = word
+    }
+    return fingerprint
+}
+
+// grayQuantize cuantiza un valor en 4 niveles con código Gray, de modo que niveles vecinos difieran en un bit.
+func grayQuantize(value, threshold float64) uint32 {
+    switch {
+    case value < -threshold:
+        return 0
+    case value < 0:
+        return 1
+    case value < threshold:
+        return 3
+    default:
+        return 2
+    }
+}
+
+// fft calcula en su lugar la transformada rápida de Fourier de un arreglo cuya longitud es potencia de 2.
+func fft(data []complex128) {
+    n := len(data)
+    for i, j := 1, 0; i < n; i++ {
+        bit := n >> 1
+        for ; j&bit != 0; bit >>= 1 {
+            j ^= bit
+        }
+        j ^= bit
+        if i < j {
+            data[i], data[j] = data[j], data[i]
+        }
+    }
+    for size := 2; size <= n; size <<= 1 {
+        step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+        for start := 0; start < n; start += size {
+            w := complex(1, 0)
+            for k := 0; k < size/2; k++ {
+                even, odd := data[start+k], data[start+k+size/2]*w
+                data[start+k] = even + odd
+                data[start+k+size/2] = even - odd
+                w *= step
+            }
+        }
+    }
+}
+
+// FingerprintSimilarity compara dos huellas y regresa la fracción de bits iguales (entre 0 y 1) en el
+// mejor desplazamiento de una respecto a la otra. Las huellas de grabaciones distintas dan alrededor de 0.5.
+func FingerprintSimilarity(a, b []uint32) float64 {
+    best := 0.0
+    for offset := -fingerprintOffsetRange; offset <= fingerprintOffsetRange; offset++ {
+        start := max(0, -offset)
+        end := min(len(a), len(b)-offset)
+        overlap := end - start
+        // Se exige que coincida al menos la mitad de la huella más corta.
+        if overlap <= 0 || overlap*2 < min(len(a), len(b)) {
+            continue
+        }
+        differentBits := 0
+        for i := start; i < end; i++ {
+            differentBits += bits.OnesCount32(a[i] ^ b[i+offset])
+        }
+        best = math.Max(best, 1-float64(differentBits)/float64(32*overlap))
+    }
+    return best
+}
+
+// encodeFingerprint convierte una huella en bytes para guardarla en la base de datos.
+func encodeFingerprint(fingerprint []uint32) []byte {
+    data := make([]byte, 4*len(fingerprint))
+    for i, word := range fingerprint {
+        binary.LittleEndian.PutUint32(data[4*i:], word)
+    }
+    return data
+}
+
+// decodeFingerprint convierte los bytes guardados en la base de datos en una huella.
+func decodeFingerprint(data []byte) []uint32 {
+    fingerprint := make([]uint32, len(data)/4)
+    for i := range fingerprint {
+        fingerprint[i] = binary.LittleEndian.Uint32(data[4*i:])
+    }
+    return fingerprint
+}
+
+// updateRolaFingerprint calcula y guarda la huella de la rola con la ruta indicada. Si no se puede
+// calcular se guarda una huella vacía, para no volver a intentarlo en cada pasada.
+func updateRolaFingerprint(db *sql.DB, filePath string, r io.ReadSeeker) {
+    if err := storeRolaFingerprint(db, filePath, computeRolaFingerprint(filePath, r)); err != nil {
+        log.Println(err)
+    }
+}
+
+// computeRolaFingerprint calcula la huella de la rola con la ruta indicada. Si no se puede calcular regresa una
+// huella vacía.
+func computeRolaFingerprint(filePath string, r io.ReadSeeker) []uint32 {
+    fingerprint, err := ComputeFingerprint(r)
+    if err != nil {
+        log.Printf("Error al calcular la huella acústica de %s: %v\n", filePath, err)
+    }
+    return fingerprint
+}
+
+// storeRolaFingerprint guarda la huella de la rola con la ruta indicada.
+func storeRolaFingerprint(e execer, filePath string, fingerprint []uint32) error {
+    if _, err := e.Exec("UPDATE rolas SET fingerprint = ? WHERE path = ?", encodeFingerprint(fingerprint), filePath); err != nil {
+        return fmt.Errorf("error al guardar la huella acústica: %v", err)
+    }
+    return nil
+}
+
+// FingerprintWithProgress calcula la huella acústica de las rolas MP3 que todavía no la tienen,
+// actualizando una barra de progreso. Como sólo procesa las pendientes, se puede interrumpir y
+// continuar después. Regresa cuántas huellas se calcularon.
+func (m *MP3Miner) FingerprintWithProgress(db *sql.DB, progressBar *widget.ProgressBar) (int, error) {
+    rows, err := db.Query("SELECT path FROM rolas WHERE codec = 'MP3' AND fingerprint IS NULL")
+    if err != nil {
+        return 0, fmt.Errorf("error al obtener las rolas: %v", err)
+    }
+    var paths []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            rows.Close()
+            return 0, fmt.Errorf("error al leer las rolas: %v", err)
+        }
+        paths = append(paths, path)
+    }
+    rows.Close()
+
+    for i, path := range paths {
+        fmt.Printf("Calculando huella: %s\n", path)
+        file, err := os.Open(path)
+        if err != nil {
+            log.Printf("Error al abrir el archivo: %s\n", err)
+        } else {
+            updateRolaFingerprint(db, path, file)
+            file.Close()
+        }
+        progressBar.SetValue(float64(i+1) / float64(len(paths)))
+    }
+    return len(paths), nil
+}
+
+// songFingerprints regresa las huellas guardadas (no vacías) indexadas por el ID de la rola.
+func songFingerprints(db *sql.DB) (map[int][]uint32, error) {
+    rows, err := db.Query("SELECT id_rola, fingerprint FROM rolas WHERE length(fingerprint) > 0")
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las huellas acústicas: %v", err)
+    }
+    defer rows.Close()
+
+    fingerprints := map[int][]uint32{}
+    for rows.Next() {
+        var id int
+        var data []byte
+        if err := rows.Scan(&id, &data); err != nil {
+            return nil, fmt.Errorf("error al leer las huellas acústicas: %v", err)
+        }
+        fingerprints[id] = decodeFingerprint(data)
+    }
+    return fingerprints, rows.Err()
+}
+
+// SimilarRecording es una rola cuya huella acústica se parece a la de otra.
+type SimilarRecording struct {
+    Song       Song    // Rola encontrada.
+    Similarity float64 // Fracción de bits iguales entre las huellas (1 es idéntica).
+}
+
+// FindSimilarRecordings busca las rolas cuya huella se parece a la de la rola indicada al menos
+// minSimilarity, sin importar sus etiquetas ni su codificación. Regresa las más parecidas primero.
+func FindSimilarRecordings(db *sql.DB, idRola int, minSimilarity float64) ([]SimilarRecording, error) {
+    fingerprints, err := songFingerprints(db)
+    if err != nil {
+        return nil, err
+    }
+    target, ok := fingerprints[idRola]
+    if !ok {
+        return nil, fmt.Errorf("la canción no tiene huella acústica; calcúlala primero")
+    }
+    songs, err := allSongsIncludingHidden(db)
+    if err != nil {
+        return nil, err
+    }
+
+    var similar []SimilarRecording
+    for _, song := range songs {
+        fingerprint, ok := fingerprints[song.IDRola]
+        if !ok || song.IDRola == idRola {
+            continue
+        }
+        if similarity := FingerprintSimilarity(target, fingerprint); similarity >= minSimilarity {
+            similar = append(similar, SimilarRecording{Song: song, Similarity: similarity})
+        }
+    }
+    sort.Slice(similar, func(i, j int) bool { return similar[i].Similarity > similar[j].Similarity })
+    return similar, nil
+}
+
+// groupByFingerprint agrupa las rolas con huellas acústicas parecidas, omitiendo los grupos que ya se
+// encontraron con exactamente las mismas rolas. Sólo se comparan canciones de duración parecida.
+func groupByFingerprint(songs []Song, fingerprints map[int][]uint32, existing []DuplicateGroup) []DuplicateGroup {
+    found := map[string]bool{}
+    for _, group := range existing {
+        found[groupSignature(group.Songs)] = true
+    }
+
+    var candidates []Song
+    for _, song := range songs {
+        if _, ok := fingerprints[song.IDRola]; ok {
+            candidates = append(candidates, song)
+        }
+    }
+    sort.Slice(candidates, func(i, j int) bool { return candidates[i].Duration < candidates[j].Duration })
+
+    // Une las canciones parecidas con union-find para formar grupos transitivos.
+    parent := make([]int, len(candidates))
+    for i := range parent {
+        parent[i] = i
+    }
+    var root func(int) int
+    root = func(i int) int {
+        if parent[i] != i {
+            parent[i] = root(parent[i])
+        }
+        return parent[i]
+    }
+    best := make([]float64, len(candidates))
+    for i := range candidates {
+        for j := i + 1; j < len(candidates) && candidates[j].Duration-candidates[i].Duration <= durationTolerance; j++ {
+            similarity := FingerprintSimilarity(fingerprints[candidates[i].IDRola], fingerprints[candidates[j].IDRola])
+            if similarity >= DefaultFingerprintSimilarity {
+                parent[root(j)] = root(i)
+                best[i] = math.Max(best[i], similarity)
+                best[j] = math.Max(best[j], similarity)
+            }
+        }
+    }
+
+    members := map[int][]int{}
+    var roots []int
+    for i := range candidates {
+        r := root(i)
+        if _, ok := members[r]; !ok {
+            roots = append(roots, r)
+        }
+        members[r] = append(members[r], i)
+    }
+
+    var groups []DuplicateGroup
+    for _, r := range roots {
+        if len(members[r]) < 2 {
+            continue
+        }
+        var group []Song
+        similarity := 1.0
+        for _, i := range members[r] {
+            group = append(group, candidates[i])
+            similarity = math.Min(similarity, best[i])
+        }
+        if found[groupSignature(group)] {
+            continue
+        }
+        groups = append(groups, DuplicateGroup{Key: fmt.Sprintf("misma grabación (huella %.0f%%)", similarity*100), Songs: group})
+    }
+    return groups
+}
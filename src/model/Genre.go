@@ -0,0 +1,665 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// GenreSeparator separa los géneros de una rola en el texto que se guarda en rolas.genre y en la trama TCON.
+const GenreSeparator = "; "
+
+// id3v1Genres son los géneros de la especificación de ID3v1, con las extensiones de Winamp (0-191). Las etiquetas
+// ID3v1 y las ID3v2 antiguas guardan el género como su número (e.g., "17" o "(17)" es "Rock").
+var id3v1Genres = []string{
+    "Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+    "Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+    "Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+    "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+    "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+    "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel",
+    "Noise", "Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative",
+    "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic",
+    "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk",
+    "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta",
+    "Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American",
+    "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer",
+    "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro",
+    "Musical", "Rock & Roll", "Hard Rock", "Folk", "Folk-Rock",
+    "National Folk", "Swing", "Fast Fusion", "Bebop", "Latin", "Revival",
+    "Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock",
+    "Psychedelic Rock", "Symphonic Rock", "Slow Rock", "Big Band",
+    "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson",
+    "Opera", "Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus",
+    "Porn Groove", "Satire", "Slow Jam", "Club", "Tango", "Samba",
+    "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+    "Duet", "Punk Rock", "Drum Solo", "A Cappella", "Euro-House", "Dance Hall",
+    "Goa", "Drum & Bass", "Club-House", "Hardcore", "Terror", "Indie",
+    "Britpop", "Negerpunk", "Polsk Punk", "Beat", "Christian Gangsta Rap",
+    "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian",
+    "Christian Rock", "Merengue", "Salsa", "Thrash Metal", "Anime", "J-Pop",
+    "Synthpop", "Christmas", "Art Rock", "Baroque", "Bhangra", "Big Beat",
+    "Breakbeat", "Chillout", "Downtempo", "Dub", "EBM", "Eclectic", "Electro",
+    "Electroclash", "Emo", "Experimental", "Garage", "Global", "IDM",
+    "Illbient", "Industro-Goth", "Jam Band", "Krautrock", "Leftfield", "Lounge",
+    "Math Rock", "New Romantic", "Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance",
+    "Shoegaze", "Space Rock", "Trop Rock", "World Music", "Neoclassical", "Audiobook",
+    "Audio Theatre", "Neue Deutsche Welle", "Podcast", "Indie Rock", "G-Funk", "Dubstep",
+    "Garage Rock", "Psybient",
+}
+
+// defaultGenreAliases son las grafías comunes de algunos géneros (en minúsculas) y su nombre canónico. Los alias
+// que agrega el usuario (tabla genre_aliases) tienen prioridad sobre éstos.
+var defaultGenreAliases = map[string]string{
+    "alternativo":      "Alternative",
+    "alternrock":       "Alternative Rock",
+    "rock alternativo": "Alternative Rock",
+    "hip hop":          "Hip-Hop",
+    "hiphop":           "Hip-Hop",
+    "rap/hip hop":      "Hip-Hop",
+    "r and b":          "R&B",
+    "rnb":              "R&B",
+    "r'n'b":            "R&B",
+    "rock and roll":    "Rock & Roll",
+    "rock 'n' roll":    "Rock & Roll",
+    "rock'n'roll":      "Rock & Roll",
+    "rock n roll":      "Rock & Roll",
+    "drum and bass":    "Drum & Bass",
+    "drum'n'bass":      "Drum & Bass",
+    "drum n bass":      "Drum & Bass",
+    "dnb":              "Drum & Bass",
+    "electronica":      "Electronic",
+    "electrónica":      "Electronic",
+    "clásica":          "Classical",
+    "clasica":          "Classical",
+    "música clásica":   "Classical",
+    "psychadelic":      "Psychedelic",
+    "bebob":            "Bebop",
+    "acapella":         "A Cappella",
+    "a capella":        "A Cappella",
+    "synth-pop":        "Synthpop",
+    "synth pop":        "Synthpop",
+    "jpop":             "J-Pop",
+    "banda sonora":     "Soundtrack",
+    "soundtracks":      "Soundtrack",
+    "ost":              "Soundtrack",
+    "post punk":        "Post-Punk",
+    "post rock":        "Post-Rock",
+    "lo fi":            "Lo-Fi",
+    "lofi":             "Lo-Fi",
+    "trip hop":         "Trip-Hop",
+}
+
+// id3v2GenreRefinements son las referencias de texto que ID3v2.3 admite entre paréntesis, además de los números.
+var id3v2GenreRefinements = map[string]string{
+    "RX": "Remix",
+    "CR": "Cover",
+}
+
+// queryer es una conexión o una transacción de la base de datos, para las consultas que se hacen con ambas.
+type queryer interface {
+    QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// execer es una conexión o una transacción de la base de datos, para las sentencias que se ejecutan con ambas.
+type execer interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// splitGenreText separa el texto de un género tal como lo guarda una etiqueta en sus partes: los valores múltiples
+// de ID3v2.4 (separados por NUL), los separados por ';' o '|' y las referencias numéricas de ID3v1 y ID3v2.3
+// ("17", "(17)", "(17)(18)" o "(17)Rock"), que se cambian por su nombre.
+func splitGenreText(text string) []string {
+    var parts []string
+    for _, part := range strings.FieldsFunc(text, func(r rune) bool { return r == 0 || r == ';' || r == '|' }) {
+        part = strings.TrimSpace(part)
+        for strings.HasPrefix(part, "(") && !strings.HasPrefix(part, "((") {
+            end := strings.Index(part, ")")
+            if end < 0 {
+                break
+            }
+            name, ok := genreReference(part[1:end])
+            if !ok {
+                break
+            }
+            parts = append(parts, name)
+            part = strings.TrimSpace(part[end+1:])
+        }
+        // "((" escapa un paréntesis al principio de un género que no es una referencia.
+        if strings.HasPrefix(part, "((") {
+            part = part[1:]
+        }
+        if name, ok := genreReference(part); ok {
+            part = name
+        }
+        if part != "" {
+            parts = append(parts, part)
+        }
+    }
+    return parts
+}
+
+// genreReference regresa el género de una referencia de ID3v1 o ID3v2.3 (un número o "RX" o "CR").
+func genreReference(reference string) (string, bool) {
+    if name, ok := id3v2GenreRefinements[reference]; ok {
+        return name, true
+    }
+    number, err := strconv.Atoi(reference)
+    if err != nil || number < 0 || number >= len(id3v1Genres) {
+        return "", false
+    }
+    return id3v1Genres[number], true
+}
+
+// knownGenre regresa el nombre canónico de un género si ya se conoce: un alias del usuario, un género de la base
+// de datos, un alias predeterminado o un género de ID3v1, en ese orden. Las comparaciones no distinguen mayúsculas.
+// Si q es nil sólo se buscan los alias predeterminados y los géneros de ID3v1.
+func knownGenre(q queryer, name string) (string, bool, error) {
+    if q != nil {
+        var canonical string
+        // Las comparaciones usan lower() en lugar de COLLATE NOCASE para que valgan igual en PostgreSQL.
+        err := q.QueryRow("SELECT genres.name FROM genre_aliases JOIN genres ON genres.id_genre = genre_aliases.id_genre "+
+            "WHERE lower(genre_aliases.alias) = lower(?)", name).Scan(&canonical)
+        if err == nil {
+            return canonical, true, nil
+        }
+        if err != sql.ErrNoRows {
+            return "", false, fmt.Errorf("error al leer los alias de los géneros: %v", err)
+        }
+        err = q.QueryRow("SELECT name FROM genres WHERE lower(name) = lower(?)", name).Scan(&canonical)
+        if err == nil {
+            return canonical, true, nil
+        }
+        if err != sql.ErrNoRows {
+            return "", false, fmt.Errorf("error al leer los géneros: %v", err)
+        }
+    }
+
+    if canonical, ok := defaultGenreAliases[strings.ToLower(name)]; ok {
+        return canonical, true, nil
+    }
+    for _, genre := range id3v1Genres {
+        if strings.EqualFold(genre, name) {
+            return genre, true, nil
+        }
+    }
+    return "", false, nil
+}
+
+// cleanGenreName quita los espacios repetidos de un género nuevo y, si está todo en minúsculas o en mayúsculas
+// (salvo las siglas cortas, como "EDM"), lo escribe con mayúscula inicial en cada palabra.
+func cleanGenreName(name string) string {
+    name = strings.Join(strings.Fields(name), " ")
+    hasLetters := strings.IndexFunc(name, unicode.IsLetter) >= 0
+    switch {
+    case hasLetters && name == strings.ToLower(name):
+        return convertCase(name, CaseTitle)
+    case hasLetters && name == strings.ToUpper(name) && len([]rune(name)) > 4:
+        return convertCase(name, CaseTitle)
+    }
+    return name
+}
+
+// genreNames interpreta el texto del género de una rola y regresa los nombres canónicos de sus géneros, en orden y
+// sin repetir. Las partes que no son un género conocido se separan también por '/' y ',' (e.g., "Rock/Pop"), salvo
+// que la parte completa sí lo sea (e.g., "Pop/Funk").
+func genreNames(q queryer, text string) ([]string, error) {
+    var names []string
+    seen := map[string]bool{}
+    add := func(name string) {
+        if key := strings.ToLower(name); name != "" && !seen[key] {
+            seen[key] = true
+            names = append(names, name)
+        }
+    }
+
+    for _, part := range splitGenreText(text) {
+        canonical, ok, err := knownGenre(q, part)
+        if err != nil {
+            return nil, err
+        }
+        if ok {
+            add(canonical)
+            continue
+        }
+        for _, piece := range strings.FieldsFunc(part, func(r rune) bool { return r == '/' || r == ',' }) {
+            piece = strings.TrimSpace(piece)
+            canonical, ok, err := knownGenre(q, piece)
+            if err != nil {
+                return nil, err
+            }
+            if !ok {
+                canonical = cleanGenreName(piece)
+            }
+            add(canonical)
+        }
+    }
+    return names, nil
+}
+
+// NormalizeGenre regresa el texto normalizado del género de una rola, como se guarda en la base de datos y en las
+// etiquetas: los nombres canónicos de sus géneros separados por GenreSeparator.
+func NormalizeGenre(db *sql.DB, text string) (string, error) {
+    names, err := genreNames(db, text)
+    if err != nil {
+        return "", err
+    }
+    return strings.Join(names, GenreSeparator), nil
+}
+
+// genreID regresa el ID del género con el nombre canónico indicado, creándolo si no existe. Un género nuevo queda
+// como subgénero del género más largo con el que termina su nombre (e.g., "Hard Rock" de "Rock", "Post-Punk" de
+// "Punk"), si ese género ya existe o es un género de ID3v1.
+func genreID(j *journal, name string) (int64, error) {
+    var id int64
+    err := j.tx.QueryRow("SELECT id_genre FROM genres WHERE name = ?", name).Scan(&id)
+    if err == nil {
+        return id, nil
+    }
+    if err != sql.ErrNoRows {
+        return 0, fmt.Errorf("error al obtener el ID del género: %v", err)
+    }
+
+    var idParent interface{}
+    parent, ok, err := genreParent(j.tx, name)
+    if err != nil {
+        return 0, err
+    }
+    if ok {
+        if idParent, err = genreID(j, parent); err != nil {
+            return 0, err
+        }
+    }
+
+    id, err = j.insert("genres", []string{"name", "id_parent"}, name, idParent)
+    if err != nil {
+        return 0, fmt.Errorf("error al insertar el género: %v", err)
+    }
+    return id, nil
+}
+
+// genreParent regresa el género del que un género nuevo queda como subgénero: el género más largo con el que termina
+// su nombre, si ya existe o es un género de ID3v1 (ver genreID).
+func genreParent(q queryer, name string) (string, bool, error) {
+    for i, r := range name {
+        if r != ' ' && r != '-' {
+            continue
+        }
+        parent, ok, err := knownGenre(q, strings.TrimSpace(name[i+1:]))
+        if err != nil {
+            return "", false, err
+        }
+        if ok && !strings.EqualFold(parent, name) {
+            return parent, true, nil
+        }
+    }
+    return "", false, nil
+}
+
+// setRolaGenres relaciona una rola con sus géneros, en el orden indicado, creando los géneros que no existan.
+func setRolaGenres(j *journal, idRola int, names []string) error {
+    ids := make([]int64, len(names))
+    for i, name := range names {
+        id, err := genreID(j, name)
+        if err != nil {
+            return err
+        }
+        ids[i] = id
+    }
+
+    rows, err := j.tx.Query("SELECT rowid, id_genre FROM rola_genres WHERE id_rola = ? ORDER BY position", idRola)
+    if err != nil {
+        return fmt.Errorf("error al leer los géneros de la rola: %v", err)
+    }
+    var rowIDs, current []int64
+    for rows.Next() {
+        var rowID, id int64
+        if err := rows.Scan(&rowID, &id); err != nil {
+            rows.Close()
+            return fmt.Errorf("error al leer los géneros de la rola: %v", err)
+        }
+        rowIDs, current = append(rowIDs, rowID), append(current, id)
+    }
+    rows.Close()
+
+    if fmt.Sprint(current) == fmt.Sprint(ids) {
+        return nil
+    }
+    for _, rowID := range rowIDs {
+        if err := j.delete("rola_genres", rowID); err != nil {
+            return err
+        }
+    }
+    for position, id := range ids {
+        if _, err := j.insert("rola_genres", []string{"id_rola", "id_genre", "position"}, idRola, id, position); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// storeRolaGenres relaciona una rola recién minada con sus géneros.
+func storeRolaGenres(tx *sql.Tx, filePath string, names []string) error {
+    var idRola int
+    if err := tx.QueryRow("SELECT id_rola FROM rolas WHERE path = ?", filePath).Scan(&idRola); err != nil {
+        return fmt.Errorf("error al guardar los géneros de %s: %v", filePath, err)
+    }
+    if err := setRolaGenres(untracked(tx), idRola, names); err != nil {
+        return fmt.Errorf("error al guardar los géneros de %s: %v", filePath, err)
+    }
+    return nil
+}
+
+// normalizeStoredGenres normaliza el género de las rolas que ya están en la base de datos y las relaciona con sus
+// géneros. Se usa en la migración que crea las tablas de géneros.
+func normalizeStoredGenres(tx *sql.Tx) error {
+    rows, err := tx.Query("SELECT id_rola, genre FROM rolas WHERE genre IS NOT NULL")
+    if err != nil {
+        return fmt.Errorf("error al leer los géneros: %v", err)
+    }
+    stored := map[int]string{}
+    for rows.Next() {
+        var idRola int
+        var genre string
+        if err := rows.Scan(&idRola, &genre); err != nil {
+            rows.Close()
+            return fmt.Errorf("error al leer los géneros: %v", err)
+        }
+        stored[idRola] = genre
+    }
+    rows.Close()
+
+    j := untracked(tx)
+    for idRola, genre := range stored {
+        names, err := genreNames(tx, genre)
+        if err != nil {
+            return err
+        }
+        if err := setRolaGenres(j, idRola, names); err != nil {
+            return err
+        }
+        if err := j.update("rolas", int64(idRola), []string{"genre"}, nullableString(strings.Join(names, GenreSeparator))); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Genre es un género de la biblioteca.
+type Genre struct {
+    ID      int      // ID del género.
+    Name    string   // Nombre canónico.
+    Parent  string   // Nombre del género del que es subgénero, o vacío.
+    Aliases []string // Otros nombres que se cambian por éste al minar y al editar.
+    Songs   int      // Número de canciones con el género.
+}
+
+// GetGenres regresa los géneros de la biblioteca ordenados por nombre.
+func GetGenres(db *sql.DB) ([]Genre, error) {
+    rows, err := db.Query(`SELECT genres.id_genre, genres.name, COALESCE(parents.name, ''),
+               (SELECT COUNT(*) FROM rola_genres WHERE rola_genres.id_genre = genres.id_genre)
+        FROM genres LEFT JOIN genres AS parents ON parents.id_genre = genres.id_parent
+        ORDER BY genres.name`)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer los géneros: %v", err)
+    }
+    var genres []Genre
+    index := map[int]int{}
+    for rows.Next() {
+        var genre Genre
+        if err := rows.Scan(&genre.ID, &genre.Name, &genre.Parent, &genre.Songs); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("error al leer los géneros: %v", err)
+        }
+        index[genre.ID] = len(genres)
+        genres = append(genres, genre)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error al leer los géneros: %v", err)
+    }
+
+    aliasRows, err := db.Query("SELECT alias, id_genre FROM genre_aliases ORDER BY alias")
+    if err != nil {
+        return nil, fmt.Errorf("error al leer los alias de los géneros: %v", err)
+    }
+    defer aliasRows.Close()
+    for aliasRows.Next() {
+        var alias string
+        var id int
+        if err := aliasRows.Scan(&alias, &id); err != nil {
+            return nil, fmt.Errorf("error al leer los alias de los géneros: %v", err)
+        }
+        if i, ok := index[id]; ok {
+            genres[i].Aliases = append(genres[i].Aliases, alias)
+        }
+    }
+    return genres, aliasRows.Err()
+}
+
+// genreDescendants regresa los IDs de los géneros indicados junto con los de todos sus subgéneros.
+func genreDescendants(db *sql.DB, ids []int) ([]int, error) {
+    rows, err := db.Query("SELECT id_genre, id_parent FROM genres WHERE id_parent IS NOT NULL")
+    if err != nil {
+        return nil, fmt.Errorf("error al leer los géneros: %v", err)
+    }
+    defer rows.Close()
+    children := map[int][]int{}
+    for rows.Next() {
+        var id, idParent int
+        if err := rows.Scan(&id, &idParent); err != nil {
+            return nil, fmt.Errorf("error al leer los géneros: %v", err)
+        }
+        children[idParent] = append(children[idParent], id)
+    }
+
+    seen := map[int]bool{}
+    var result []int
+    for pending := ids; len(pending) > 0; {
+        id := pending[len(pending)-1]
+        pending = pending[:len(pending)-1]
+        if seen[id] {
+            continue
+        }
+        seen[id] = true
+        result = append(result, id)
+        pending = append(pending, children[id]...)
+    }
+    sort.Ints(result)
+    return result, rows.Err()
+}
+
+// searchGenreIDs regresa los IDs de los géneros que busca el filtro de género: el género con ese nombre o alias o,
+// si no hay ninguno, los que contienen el texto en su nombre. Con subgenres también se incluyen sus subgéneros.
+func searchGenreIDs(db *sql.DB, value string, subgenres bool) ([]int, error) {
+    query, arg := "SELECT id_genre FROM genres WHERE name LIKE ?", "%"+value+"%"
+    canonical, ok, err := knownGenre(db, value)
+    if err != nil {
+        return nil, err
+    }
+    if ok {
+        query, arg = "SELECT id_genre FROM genres WHERE name = ?", canonical
+    }
+
+    rows, err := db.Query(query, arg)
+    if err != nil {
+        return nil, fmt.Errorf("error al buscar el género: %v", err)
+    }
+    defer rows.Close()
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("error al buscar el género: %v", err)
+        }
+        ids = append(ids, id)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error al buscar el género: %v", err)
+    }
+    if subgenres {
+        return genreDescendants(db, ids)
+    }
+    return ids, nil
+}
+
+// SetGenreParent hace de un género un subgénero de otro, o un género principal si parent es 0. No admite ciclos
+// (que un género quede como subgénero de uno de sus subgéneros). El cambio se registra en la bitácora.
+func SetGenreParent(db *sql.DB, genre Genre, parent int) error {
+    if parent != 0 {
+        var exists bool
+        if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM genres WHERE id_genre = ?)", parent).Scan(&exists); err != nil {
+            return fmt.Errorf("error al leer los géneros: %v", err)
+        }
+        if !exists {
+            return fmt.Errorf("el género principal ya no existe")
+        }
+        descendants, err := genreDescendants(db, []int{genre.ID})
+        if err != nil {
+            return err
+        }
+        for _, id := range descendants {
+            if id == parent {
+                return fmt.Errorf("un género no puede ser subgénero de sí mismo ni de uno de sus subgéneros")
+            }
+        }
+    }
+    return withJournal(db, fmt.Sprintf("Cambiar el género principal de \"%s\"", genre.Name), func(j *journal, files *fileChanges) error {
+        return j.update("genres", int64(genre.ID), []string{"id_parent"}, nullableID(parent))
+    })
+}
+
+// nullableID regresa nil (NULL en la base de datos) para el ID 0, que no corresponde a ninguna fila.
+func nullableID(id int) interface{} {
+    if id == 0 {
+        return nil
+    }
+    return id
+}
+
+// MergeGenre une un género con otro: las canciones del género pasan a tener el otro, su nombre y sus alias quedan
+// como alias del otro y sus subgéneros pasan a serlo del otro. El texto del género de las canciones se actualiza
+// sólo en la base de datos, no en sus etiquetas. El cambio se registra en la bitácora.
+func MergeGenre(db *sql.DB, genre, into Genre) error {
+    if genre.ID == into.ID {
+        return fmt.Errorf("no se puede unir un género consigo mismo")
+    }
+    description := fmt.Sprintf("Unir \"%s\" con \"%s\"", genre.Name, into.Name)
+    return withJournal(db, description, func(j *journal, files *fileChanges) error {
+        // Si el otro género es un subgénero del que se une, queda en su lugar.
+        var idParent interface{}
+        if err := j.tx.QueryRow("SELECT id_parent FROM genres WHERE id_genre = ?", genre.ID).Scan(&idParent); err != nil {
+            return fmt.Errorf("error al leer el género: %v", err)
+        }
+        children, err := queryIDs(j.tx, "SELECT id_genre FROM genres WHERE id_parent = ?", genre.ID)
+        if err != nil {
+            return err
+        }
+        for _, child := range children {
+            parent := interface{}(into.ID)
+            if child == int64(into.ID) {
+                parent = idParent
+            }
+            if err := j.update("genres", child, []string{"id_parent"}, parent); err != nil {
+                return err
+            }
+        }
+
+        aliases, err := queryIDs(j.tx, "SELECT rowid FROM genre_aliases WHERE id_genre = ?", genre.ID)
+        if err != nil {
+            return err
+        }
+        for _, rowID := range aliases {
+            if err := j.update("genre_aliases", rowID, []string{"id_genre"}, into.ID); err != nil {
+                return err
+            }
+        }
+
+        rolas, err := queryIDs(j.tx, "SELECT id_rola FROM rola_genres WHERE id_genre = ?", genre.ID)
+        if err != nil {
+            return err
+        }
+        for _, idRola := range rolas {
+            if err := replaceRolaGenre(j, int(idRola), genre.Name, into.Name); err != nil {
+                return err
+            }
+        }
+
+        if err := j.delete("genres", int64(genre.ID)); err != nil {
+            return err
+        }
+        _, err = j.insert("genre_aliases", []string{"alias", "id_genre"}, genre.Name, into.ID)
+        return err
+    })
+}
+
+// replaceRolaGenre cambia uno de los géneros de una rola por otro, sin repetir géneros, y actualiza su texto.
+func replaceRolaGenre(j *journal, idRola int, from, to string) error {
+    rows, err := j.tx.Query("SELECT genres.name FROM rola_genres JOIN genres ON genres.id_genre = rola_genres.id_genre "+
+        "WHERE rola_genres.id_rola = ? ORDER BY rola_genres.position", idRola)
+    if err != nil {
+        return fmt.Errorf("error al leer los géneros de la rola: %v", err)
+    }
+    var names []string
+    seen := map[string]bool{}
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            rows.Close()
+            return fmt.Errorf("error al leer los géneros de la rola: %v", err)
+        }
+        if strings.EqualFold(name, from) {
+            name = to
+        }
+        if !seen[strings.ToLower(name)] {
+            seen[strings.ToLower(name)] = true
+            names = append(names, name)
+        }
+    }
+    rows.Close()
+
+    if err := setRolaGenres(j, idRola, names); err != nil {
+        return err
+    }
+    return j.update("rolas", int64(idRola), []string{"genre"}, nullableString(strings.Join(names, GenreSeparator)))
+}
+
+// AddGenreAlias agrega otro nombre de un género, que se cambia por el género al minar y al editar. No puede ser el
+// nombre de otro género (para eso está MergeGenre). El cambio se registra en la bitácora.
+func AddGenreAlias(db *sql.DB, alias string, genre Genre) error {
+    alias = strings.Join(strings.Fields(alias), " ")
+    if alias == "" {
+        return fmt.Errorf("el alias está vacío")
+    }
+    var exists bool
+    err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM genres WHERE name = ?1) OR EXISTS(SELECT 1 FROM genre_aliases WHERE alias = ?1)", alias).Scan(&exists)
+    if err != nil {
+        return fmt.Errorf("error al leer los géneros: %v", err)
+    }
+    if exists {
+        return fmt.Errorf("'%s' ya es un género o un alias", alias)
+    }
+    return withJournal(db, fmt.Sprintf("Agregar el alias \"%s\" de \"%s\"", alias, genre.Name), func(j *journal, files *fileChanges) error {
+        _, err := j.insert("genre_aliases", []string{"alias", "id_genre"}, alias, genre.ID)
+        return err
+    })
+}
+
+// RemoveGenreAlias elimina un alias de un género. El cambio se registra en la bitácora.
+func RemoveGenreAlias(db *sql.DB, alias string) error {
+    return withJournal(db, fmt.Sprintf("Eliminar el alias \"%s\"", alias), func(j *journal, files *fileChanges) error {
+        rowIDs, err := queryIDs(j.tx, "SELECT rowid FROM genre_aliases WHERE alias = ?", alias)
+        if err != nil {
+            return err
+        }
+        for _, rowID := range rowIDs {
+            if err := j.delete("genre_aliases", rowID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
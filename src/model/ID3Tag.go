@@ -0,0 +1,397 @@
+package model
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "unicode/utf16"
+)
+
+// id3Padding es el relleno que se deja al agrandar una etiqueta, para que los siguientes cambios quepan en el mismo espacio.
+const id3Padding = 1024
+
+// id3Frame es una trama de una etiqueta ID3v2: su identificador, sus banderas y su contenido tal como está en el archivo.
+type id3Frame struct {
+    ID    string  // Identificador de cuatro letras (e.g., TIT2, TXXX, APIC).
+    Flags [2]byte // Banderas de la trama, se conservan sin cambios.
+    Data  []byte  // Contenido de la trama sin su encabezado.
+}
+
+// id3Tag es una etiqueta ID3v2.3 o ID3v2.4 leída del inicio de un archivo MP3.
+type id3Tag struct {
+    Version byte       // Versión mayor de la etiqueta (3 o 4).
+    Frames  []id3Frame // Tramas en el orden en que aparecen.
+    Size    int64      // Bytes que ocupa la etiqueta en el archivo, incluido el relleno (0 si no tiene).
+}
+
+// readID3Tag lee la etiqueta ID3v2 al inicio de un archivo. Si el archivo no tiene etiqueta se regresa una
+// etiqueta ID3v2.3 vacía. Las etiquetas ID3v2.2 y las desincronizadas no se pueden editar.
+func readID3Tag(r io.ReadSeeker) (*id3Tag, error) {
+    if _, err := r.Seek(0, io.SeekStart); err != nil {
+        return nil, err
+    }
+    header := make([]byte, 10)
+    if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte("ID3")) {
+        return &id3Tag{Version: 3}, nil
+    }
+
+    tag := &id3Tag{Version: header[3], Size: id3v2TagSize(header)}
+    if tag.Version != 3 && tag.Version != 4 {
+        return nil, fmt.Errorf("no se admite la etiqueta ID3v2.%d", tag.Version)
+    }
+    if header[5]&0x80 != 0 {
+        return nil, fmt.Errorf("no se admiten etiquetas ID3v2 desincronizadas")
+    }
+
+    body := make([]byte, tag.Size-10)
+    if _, err := io.ReadFull(r, body); err != nil {
+        return nil, fmt.Errorf("etiqueta ID3v2 incompleta: %v", err)
+    }
+    if header[5]&0x10 != 0 {
+        if len(body) < 10 {
+            return nil, fmt.Errorf("etiqueta ID3v2 incompleta: falta el pie de página")
+        }
+        body = body[:len(body)-10] // Se descarta el pie de página.
+    }
+
+    pos := 0
+    if header[5]&0x40 != 0 && len(body) >= 4 {
+        // El encabezado extendido no se conserva; en ID3v2.3 su tamaño no incluye los 4 bytes del tamaño.
+        if tag.Version == 3 {
+            pos = 4 + int(binary.BigEndian.Uint32(body))
+        } else {
+            pos = syncsafeInt(body)
+        }
+        if pos < 0 || pos > len(body) {
+            return nil, fmt.Errorf("el encabezado extendido de la etiqueta ID3v2 mide más que la etiqueta")
+        }
+    }
+
+    for pos+10 <= len(body) && body[pos] != 0 {
+        size := int(binary.BigEndian.Uint32(body[pos+4:]))
+        if tag.Version == 4 {
+            size = syncsafeInt(body[pos+4:])
+        }
+        if size < 0 || pos+10+size > len(body) {
+            // Reescribir la etiqueta borraría las tramas que siguen a la dañada.
+            return nil, fmt.Errorf("la trama %q de la etiqueta ID3v2 mide más que la etiqueta", body[pos:pos+4])
+        }
+        tag.Frames = append(tag.Frames, id3Frame{
+            ID:    string(body[pos : pos+4]),
+            Flags: [2]byte{body[pos+8], body[pos+9]},
+            Data:  body[pos+10 : pos+10+size],
+        })
+        pos += 10 + size
+    }
+    return tag, nil
+}
+
+// syncsafeInt lee un entero "syncsafe" de 4 bytes (7 bits útiles por byte).
+func syncsafeInt(data []byte) int {
+    return int(data[0]&0x7f)<<21 | int(data[1]&0x7f)<<14 | int(data[2]&0x7f)<<7 | int(data[3]&0x7f)
+}
+
+// putSyncsafeInt escribe un entero "syncsafe" de 4 bytes.
+func putSyncsafeInt(data []byte, value int) {
+    data[0] = byte(value>>21) & 0x7f
+    data[1] = byte(value>>14) & 0x7f
+    data[2] = byte(value>>7) & 0x7f
+    data[3] = byte(value) & 0x7f
+}
+
+// encode serializa las tramas de la etiqueta, sin encabezado ni relleno.
+func (t *id3Tag) encode() []byte {
+    var buf bytes.Buffer
+    for _, frame := range t.Frames {
+        header := make([]byte, 10)
+        copy(header, frame.ID)
+        if t.Version == 4 {
+            putSyncsafeInt(header[4:], len(frame.Data))
+        } else {
+            binary.BigEndian.PutUint32(header[4:], uint32(len(frame.Data)))
+        }
+        header[8], header[9] = frame.Flags[0], frame.Flags[1]
+        buf.Write(header)
+        buf.Write(frame.Data)
+    }
+    return buf.Bytes()
+}
+
+// header genera el encabezado de la etiqueta para un cuerpo (tramas más relleno) del tamaño indicado.
+func (t *id3Tag) header(bodySize int) []byte {
+    header := []byte{'I', 'D', '3', t.Version, 0, 0, 0, 0, 0, 0}
+    putSyncsafeInt(header[6:], bodySize)
+    return header
+}
+
+// userTextDescription regresa la descripción de una trama TXXX.
+func userTextDescription(data []byte) string {
+    if len(data) == 0 {
+        return ""
+    }
+    encoding, text := data[0], data[1:]
+    if encoding == 1 || encoding == 2 {
+        // UTF-16: la descripción termina en dos bytes nulos alineados.
+        var units []uint16
+        bigEndian := encoding == 2
+        if len(text) >= 2 && (text[0] == 0xfe && text[1] == 0xff || text[0] == 0xff && text[1] == 0xfe) {
+            bigEndian = text[0] == 0xfe
+            text = text[2:]
+        }
+        for i := 0; i+1 < len(text); i += 2 {
+            unit := binary.LittleEndian.Uint16(text[i:])
+            if bigEndian {
+                unit = binary.BigEndian.Uint16(text[i:])
+            }
+            if unit == 0 {
+                break
+            }
+            units = append(units, unit)
+        }
+        return string(utf16.Decode(units))
+    }
+    if end := bytes.IndexByte(text, 0); end >= 0 {
+        text = text[:end]
+    }
+    return string(text)
+}
+
+// SetUserText reemplaza (o agrega) la trama TXXX con la descripción indicada, sin importar mayúsculas.
+// El texto se guarda en ISO-8859-1, suficiente para los valores numéricos de ReplayGain.
+func (t *id3Tag) SetUserText(description, value string) {
+    data := append([]byte{0}, description...)
+    data = append(data, 0)
+    data = append(data, value...)
+    frame := id3Frame{ID: "TXXX", Data: data}
+
+    for i, existing := range t.Frames {
+        if existing.ID == "TXXX" && strings.EqualFold(userTextDescription(existing.Data), description) {
+            t.Frames[i] = frame
+            return
+        }
+    }
+    t.Frames = append(t.Frames, frame)
+}
+
+// SetText reemplaza la trama de texto indicada (e.g., TIT2) o la elimina si el valor está vacío. El texto se guarda
+// en ISO-8859-1 cuando es posible; si no, en UTF-8 (ID3v2.4) o UTF-16 (ID3v2.3).
+func (t *id3Tag) SetText(id, value string) {
+    var data []byte
+    if value != "" {
+        data = encodeID3Text(t.Version, value)
+    }
+    t.setFrame(id, data)
+}
+
+// setFrame reemplaza el contenido de la trama indicada, en la posición de la primera trama con ese identificador,
+// o la elimina si el contenido está vacío.
+func (t *id3Tag) setFrame(id string, data []byte) {
+    position := -1
+    frames := make([]id3Frame, 0, len(t.Frames)+1)
+    for _, frame := range t.Frames {
+        if frame.ID == id {
+            if position < 0 {
+                position = len(frames)
+            }
+            continue
+        }
+        frames = append(frames, frame)
+    }
+
+    if len(data) > 0 {
+        frame := id3Frame{ID: id, Data: data}
+        if position < 0 {
+            frames = append(frames, frame)
+        } else {
+            frames = append(frames[:position], append([]id3Frame{frame}, frames[position:]...)...)
+        }
+    }
+    t.Frames = frames
+}
+
+// frameData regresa el contenido de la primera trama con el identificador indicado, o nil si no existe.
+func (t *id3Tag) frameData(id string) []byte {
+    for _, frame := range t.Frames {
+        if frame.ID == id {
+            return frame.Data
+        }
+    }
+    return nil
+}
+
+// clone regresa una copia de la etiqueta que no cambia al editar las tramas de la original.
+func (t *id3Tag) clone() *id3Tag {
+    return &id3Tag{Version: t.Version, Frames: append([]id3Frame(nil), t.Frames...), Size: t.Size}
+}
+
+// encodeID3Text codifica el contenido de una trama de texto, empezando por el byte de codificación.
+func encodeID3Text(version byte, value string) []byte {
+    latin1 := []byte{0}
+    for _, r := range value {
+        if r > 0xff {
+            latin1 = nil
+            break
+        }
+        latin1 = append(latin1, byte(r))
+    }
+    if latin1 != nil {
+        return latin1
+    }
+
+    if version == 4 {
+        return append([]byte{3}, value...)
+    }
+    data := []byte{1, 0xff, 0xfe} // UTF-16 con marca de orden de bytes (little endian).
+    for _, unit := range utf16.Encode([]rune(value)) {
+        data = binary.LittleEndian.AppendUint16(data, unit)
+    }
+    return data
+}
+
+// writeID3Tag guarda la etiqueta en el archivo de forma atómica: copia el archivo con la nueva etiqueta a un archivo
+// temporal en el mismo directorio, lo sincroniza con el disco y lo renombra sobre el original, de modo que una falla
+// nunca deja el archivo a medias (ver prepareID3Tag y preparedTag.replace). Con backup se guarda antes una copia del
+// archivo original como <archivo>.bak, sin reemplazar una copia que ya exista.
+func writeID3Tag(filePath string, tag *id3Tag, backup bool) error {
+    prepared, err := prepareID3Tag(filePath, tag)
+    if err != nil {
+        return err
+    }
+    defer prepared.discard()
+    return prepared.replace(backup)
+}
+
+// preparedTag es la copia de un archivo MP3 con su etiqueta nueva, ya sincronizada con el disco, lista para
+// reemplazar al original. Copiar el audio es lo que tarda al escribir una etiqueta; reemplazar el archivo sólo es
+// renombrarlo, así que las ediciones preparan las copias antes de su transacción y las renombran dentro de ella.
+type preparedTag struct {
+    path     string      // Archivo original.
+    temp     string      // Archivo temporal con la etiqueta nueva y el audio del original.
+    original os.FileInfo // Estado del original al copiarlo, para saber si cambió antes de reemplazarlo.
+}
+
+// prepareID3Tag copia el archivo con la nueva etiqueta a un archivo temporal en el mismo directorio y lo sincroniza
+// con el disco. Si la etiqueta cabe en el espacio de la anterior se conserva su tamaño.
+func prepareID3Tag(filePath string, tag *id3Tag) (*preparedTag, error) {
+    frames := tag.encode()
+    bodySize := len(frames) + id3Padding
+    if tag.Size > 0 && int64(len(frames)) <= tag.Size-10 {
+        bodySize = int(tag.Size - 10)
+    }
+
+    original, err := os.Open(filePath)
+    if err != nil {
+        return nil, fmt.Errorf("error al abrir el archivo: %v", err)
+    }
+    defer original.Close()
+    info, err := original.Stat()
+    if err != nil {
+        return nil, fmt.Errorf("error al leer el archivo: %v", err)
+    }
+    if _, err := original.Seek(tag.Size, io.SeekStart); err != nil {
+        return nil, fmt.Errorf("error al leer el audio: %v", err)
+    }
+
+    temp, err := os.CreateTemp(filepath.Dir(filePath), ".musicdatabase-*.mp3")
+    if err != nil {
+        return nil, fmt.Errorf("error al crear el archivo temporal: %v", err)
+    }
+    prepared := &preparedTag{path: filePath, temp: temp.Name(), original: info}
+
+    body := make([]byte, bodySize)
+    copy(body, frames)
+    if _, err := temp.Write(append(tag.header(len(body)), body...)); err != nil {
+        temp.Close()
+        prepared.discard()
+        return nil, fmt.Errorf("error al escribir la etiqueta: %v", err)
+    }
+    if _, err := io.Copy(temp, original); err != nil {
+        temp.Close()
+        prepared.discard()
+        return nil, fmt.Errorf("error al copiar el audio: %v", err)
+    }
+    if err := temp.Sync(); err != nil {
+        temp.Close()
+        prepared.discard()
+        return nil, fmt.Errorf("error al guardar el archivo temporal: %v", err)
+    }
+    if err := temp.Close(); err != nil {
+        prepared.discard()
+        return nil, fmt.Errorf("error al guardar el archivo temporal: %v", err)
+    }
+    os.Chmod(temp.Name(), info.Mode().Perm())
+    return prepared, nil
+}
+
+// replace renombra la copia sobre el archivo original, si el original no cambió desde que se copió. Con backup se
+// guarda antes una copia del original como <archivo>.bak.
+func (p *preparedTag) replace(backup bool) error {
+    info, err := os.Stat(p.path)
+    if err != nil {
+        return fmt.Errorf("error al leer el archivo: %v", err)
+    }
+    if info.Size() != p.original.Size() || !info.ModTime().Equal(p.original.ModTime()) {
+        return fmt.Errorf("el archivo %s cambió mientras se escribía su etiqueta", p.path)
+    }
+
+    if backup {
+        if err := backupFile(p.path); err != nil {
+            return err
+        }
+    }
+    if err := os.Rename(p.temp, p.path); err != nil {
+        return fmt.Errorf("error al reemplazar el archivo: %v", err)
+    }
+    syncDir(filepath.Dir(p.path))
+    return nil
+}
+
+// discard elimina la copia si no se usó. No hace nada si ya reemplazó al original.
+func (p *preparedTag) discard() {
+    os.Remove(p.temp)
+}
+
+// backupFile guarda una copia del archivo como <archivo>.bak si todavía no existe. Se intenta primero un enlace
+// duro, que no ocupa espacio adicional porque el original se reemplaza en lugar de modificarse.
+func backupFile(filePath string) error {
+    backupPath := filePath + ".bak"
+    if _, err := os.Stat(backupPath); err == nil {
+        return nil
+    }
+    if err := os.Link(filePath, backupPath); err == nil {
+        return nil
+    }
+
+    source, err := os.Open(filePath)
+    if err != nil {
+        return fmt.Errorf("error al respaldar el archivo: %v", err)
+    }
+    defer source.Close()
+    backup, err := os.Create(backupPath)
+    if err != nil {
+        return fmt.Errorf("error al respaldar el archivo: %v", err)
+    }
+    if _, err := io.Copy(backup, source); err != nil {
+        backup.Close()
+        os.Remove(backupPath)
+        return fmt.Errorf("error al respaldar el archivo: %v", err)
+    }
+    if err := backup.Sync(); err != nil {
+        backup.Close()
+        return fmt.Errorf("error al respaldar el archivo: %v", err)
+    }
+    return backup.Close()
+}
+
+// syncDir sincroniza un directorio con el disco para que un renombrado sobreviva a un corte de energía.
+// Algunos sistemas no permiten sincronizar directorios, por lo que los errores se ignoran.
+func syncDir(dir string) {
+    if d, err := os.Open(dir); err == nil {
+        d.Sync()
+        d.Close()
+    }
+}
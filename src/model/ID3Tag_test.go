@@ -0,0 +1,64 @@
+package model
+
+import (
+    "bytes"
+    "encoding/binary"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestReadID3Tag(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "01.mp3")
+    writeTestMP3(t, path, map[string]string{"TALB": "Abbey Road", "TIT2": "Come Together", "TPE1": "The Beatles"})
+    file, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+
+    tag, err := readID3Tag(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(tag.Frames) != 3 || tag.Frames[0].ID != "TALB" || tag.Frames[2].ID != "TPE1" {
+        t.Errorf("tramas = %+v", tag.Frames)
+    }
+}
+
+// TestReadID3TagDamagedFrame revisa que una trama cuyo tamaño pasa del final de la etiqueta sea un error, y que
+// por eso no se reescriba la etiqueta sin las tramas que la siguen.
+func TestReadID3TagDamagedFrame(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "01.mp3")
+    writeTestMP3(t, path, map[string]string{"TALB": "Abbey Road", "TIT2": "Come Together", "TPE1": "The Beatles"})
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // La primera trama (TALB) empieza justo después del encabezado de la etiqueta.
+    binary.BigEndian.PutUint32(data[10+4:], 1<<20)
+    if err := os.WriteFile(path, data, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = readID3Tag(file)
+    file.Close()
+    if err == nil {
+        t.Error("se leyó una etiqueta con una trama más grande que la etiqueta")
+    }
+
+    if err := WriteReplayGainTags(path, -6.5, 0.9, -7, 0.95); err == nil {
+        t.Error("se reescribió una etiqueta dañada")
+    }
+    after, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(after, data) {
+        t.Error("el archivo cambió aunque su etiqueta estaba dañada")
+    }
+}
@@ -0,0 +1,227 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+
+    "fyne.io/fyne/v2/widget" // Para manejar la barra de progreso
+)
+
+// Estados de salud que se guardan en rolas.health, ordenados de menor a mayor gravedad.
+const (
+    HealthOK         = "ok"       // Todas las tramas son válidas.
+    HealthJunk       = "basura"   // Hay bytes que no pertenecen a ninguna trama ni etiqueta.
+    HealthCRC        = "crc"      // Al menos una trama protegida no coincide con su CRC.
+    HealthTruncated  = "truncado" // El archivo termina a la mitad de una trama o tiene menos tramas de las declaradas.
+    HealthUnreadable = "ilegible" // No se encontró ninguna trama o el archivo no se pudo abrir.
+)
+
+// healthSeverity ordena los estados para conservar el más grave cuando un archivo tiene varios problemas.
+var healthSeverity = map[string]int{HealthOK: 0, HealthJunk: 1, HealthCRC: 2, HealthTruncated: 3, HealthUnreadable: 4}
+
+// HealthReport es el resultado de revisar todas las tramas de un archivo MP3.
+type HealthReport struct {
+    Status    string // Estado más grave encontrado.
+    Frames    int    // Número de tramas leídas.
+    JunkBytes int64  // Bytes de basura entre o alrededor de las tramas.
+    CRCErrors int    // Tramas cuyo CRC no coincide.
+    Detail    string // Descripción legible de los problemas encontrados.
+}
+
+// addProblem registra un problema y actualiza el estado si es más grave que el actual.
+func (hr *HealthReport) addProblem(status, detail string) {
+    if healthSeverity[status] > healthSeverity[hr.Status] {
+        hr.Status = status
+    }
+    if hr.Detail != "" {
+        hr.Detail += "; "
+    }
+    hr.Detail += detail
+}
+
+// CheckMP3Integrity recorre todas las tramas de un archivo MP3 verificando las palabras de sincronía,
+// el CRC de las tramas protegidas de capa III, la presencia de basura y si el archivo está truncado.
+func CheckMP3Integrity(r io.ReadSeeker) *HealthReport {
+    report := &HealthReport{Status: HealthOK}
+
+    start, err := audioStart(r)
+    if err == nil {
+        _, err = r.Seek(start, io.SeekStart)
+    }
+    if err != nil {
+        report.addProblem(HealthUnreadable, fmt.Sprintf("no se pudo leer el archivo: %v", err))
+        return report
+    }
+
+    fr := newMP3FrameReader(r)
+    var declaredFrames int64
+    truncated := false
+    for {
+        header, frame, err := fr.next()
+        if err == io.ErrUnexpectedEOF {
+            truncated = true
+            break
+        }
+        if err != nil {
+            break
+        }
+
+        if fr.frames == 1 {
+            if vbr := parseVBRHeader(header, frame); vbr != nil {
+                declaredFrames = vbr.frames
+            }
+        }
+        if header.Protected && header.Layer == 3 && !validFrameCRC(header, frame) {
+            report.CRCErrors++
+        }
+    }
+    report.Frames = fr.frames
+    report.JunkBytes = fr.skipped
+
+    if report.Frames == 0 {
+        report.addProblem(HealthUnreadable, "no se encontró ninguna trama MPEG válida")
+        return report
+    }
+    if truncated {
+        report.addProblem(HealthTruncated, "el archivo termina a la mitad de una trama")
+    }
+    // La trama con el encabezado Xing/Info no cuenta como audio; se tolera una trama de diferencia.
+    if declaredFrames > 0 && int64(report.Frames-1)+1 < declaredFrames {
+        report.addProblem(HealthTruncated, fmt.Sprintf("tiene %d de %d tramas declaradas", report.Frames-1, declaredFrames))
+    }
+    if report.CRCErrors > 0 {
+        report.addProblem(HealthCRC, fmt.Sprintf("%d tramas con CRC inválido", report.CRCErrors))
+    }
+    if report.JunkBytes > 0 {
+        report.addProblem(HealthJunk, fmt.Sprintf("%d bytes de basura entre tramas", report.JunkBytes))
+    }
+    return report
+}
+
+// validFrameCRC compara el CRC-16 guardado después del encabezado con el calculado sobre los últimos
+// 16 bits del encabezado y la información lateral de la trama (capa III).
+func validFrameCRC(h MP3FrameHeader, frame []byte) bool {
+    end := 6 + h.SideInfoSize()
+    if len(frame) < end {
+        return false
+    }
+    crc := crc16MPEG(0xffff, frame[2:4])
+    crc = crc16MPEG(crc, frame[6:end])
+    return crc == uint16(frame[4])<<8|uint16(frame[5])
+}
+
+// crc16MPEG calcula el CRC-16 (polinomio 0x8005, bit más significativo primero) que usa MPEG audio.
+func crc16MPEG(crc uint16, data []byte) uint16 {
+    for _, b := range data {
+        for i := 7; i >= 0; i-- {
+            bit := uint16(b>>uint(i)) & 1
+            msb := crc >> 15
+            crc <<= 1
+            if bit^msb == 1 {
+                crc ^= 0x8005
+            }
+        }
+    }
+    return crc
+}
+
+// updateRolaHealth guarda el estado de salud de la rola con la ruta indicada.
+func updateRolaHealth(e execer, filePath string, report *HealthReport) error {
+    _, err := e.Exec("UPDATE rolas SET health = ?, health_detail = ? WHERE path = ?", report.Status, report.Detail, filePath)
+    if err != nil {
+        return fmt.Errorf("error al guardar el estado de la rola: %v", err)
+    }
+    return nil
+}
+
+// checkFileIntegrity abre el archivo y revisa sus tramas.
+func checkFileIntegrity(filePath string) *HealthReport {
+    file, err := os.Open(filePath)
+    if err != nil {
+        report := &HealthReport{Status: HealthOK}
+        report.addProblem(HealthUnreadable, fmt.Sprintf("no se pudo abrir el archivo: %v", err))
+        return report
+    }
+    defer file.Close()
+    return CheckMP3Integrity(file)
+}
+
+// CheckIntegrityWithProgress revisa la integridad de todas las rolas MP3 de la base de datos,
+// actualizando su estado de salud y una barra de progreso. Regresa cuántas rolas tienen problemas.
+func (m *MP3Miner) CheckIntegrityWithProgress(db *sql.DB, progressBar *widget.ProgressBar) (int, error) {
+    rows, err := db.Query("SELECT path FROM rolas WHERE codec = 'MP3'")
+    if err != nil {
+        return 0, fmt.Errorf("error al obtener las rolas: %v", err)
+    }
+    var paths []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            rows.Close()
+            return 0, fmt.Errorf("error al leer las rolas: %v", err)
+        }
+        paths = append(paths, path)
+    }
+    rows.Close()
+
+    damaged := 0
+    for i, path := range paths {
+        fmt.Printf("Verificando archivo: %s\n", path)
+        report := checkFileIntegrity(path)
+        if report.Status != HealthOK {
+            damaged++
+        }
+        if err := updateRolaHealth(db, path, report); err != nil {
+            log.Println(err)
+        }
+        progressBar.SetValue(float64(i+1) / float64(len(paths)))
+    }
+    return damaged, nil
+}
+
+// DamagedSong es una rola con problemas de integridad, lista para exportarse.
+type DamagedSong struct {
+    Path   string // Ruta del archivo.
+    Status string // Estado de salud.
+    Detail string // Descripción de los problemas.
+}
+
+// GetDamagedSongs devuelve las rolas cuyo estado de salud no es "ok", ordenadas por ruta.
+func GetDamagedSongs(db *sql.DB) ([]DamagedSong, error) {
+    rows, err := db.Query("SELECT path, health, COALESCE(health_detail, '') FROM rolas WHERE health IS NOT NULL AND health != ? ORDER BY path", HealthOK)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las rolas dañadas: %v", err)
+    }
+    defer rows.Close()
+
+    var songs []DamagedSong
+    for rows.Next() {
+        var song DamagedSong
+        if err := rows.Scan(&song.Path, &song.Status, &song.Detail); err != nil {
+            return nil, fmt.Errorf("error al leer las rolas dañadas: %v", err)
+        }
+        songs = append(songs, song)
+    }
+    return songs, rows.Err()
+}
+
+// HealthLabel regresa una descripción en español de un estado de salud.
+func HealthLabel(status string) string {
+    switch strings.ToLower(status) {
+    case HealthOK:
+        return "OK"
+    case HealthJunk:
+        return "Basura entre tramas"
+    case HealthCRC:
+        return "Error de CRC"
+    case HealthTruncated:
+        return "Truncado"
+    case HealthUnreadable:
+        return "Ilegible"
+    }
+    return ""
+}
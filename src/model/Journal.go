@@ -0,0 +1,745 @@
+package model
+
+import (
+    "bytes"
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// Tipos de cambio que se registran en la bitácora.
+const (
+    journalUpdate = "update" // Se cambiaron columnas de una fila.
+    journalInsert = "insert" // Se insertó una fila.
+    journalDelete = "delete" // Se eliminó una fila.
+    journalTag    = "tag"    // Se cambiaron tramas de la etiqueta ID3v2 del archivo de una rola.
+    journalMove   = "move"   // Se movió o renombró el archivo de una rola.
+)
+
+const journalLimit = 200 // Número de operaciones que se conservan en la bitácora para deshacerlas.
+
+// journal registra en la bitácora (tablas journal_entries y journal_changes) los cambios de una operación, dentro
+// de la transacción que los hace. Cada paso es un cambio a una fila (o a la etiqueta de un archivo) y guarda el valor
+// anterior y el nuevo de cada columna; los valores se copian con SQL para conservar su tipo. Los pasos se deshacen
+// en orden inverso y se rehacen en el orden original.
+type journal struct {
+    tx   *sql.Tx // Transacción en la que se hacen los cambios.
+    id   int64   // ID de la operación en journal_entries, o 0 si los cambios no se registran (ver untracked).
+    step int     // Último paso registrado.
+}
+
+// untracked regresa un journal que hace los cambios en la transacción sin registrarlos en la bitácora, para los
+// cambios que no se deshacen, como los del minero y los de las migraciones.
+func untracked(tx *sql.Tx) *journal {
+    return &journal{tx: tx}
+}
+
+// beginJournal registra una operación nueva en la bitácora. Las operaciones deshechas se descartan, porque ya no
+// se pueden rehacer después de un cambio nuevo, y también las más antiguas que exceden journalLimit.
+func beginJournal(tx *sql.Tx, description string) (*journal, error) {
+    statements := []string{
+        "DELETE FROM journal_changes WHERE id_entry IN (SELECT id_entry FROM journal_entries WHERE undone = 1)",
+        "DELETE FROM journal_entries WHERE undone = 1",
+    }
+    for _, statement := range statements {
+        if _, err := tx.Exec(statement); err != nil {
+            return nil, fmt.Errorf("error al actualizar la bitácora: %v", err)
+        }
+    }
+
+    result, err := tx.Exec("INSERT INTO journal_entries (description, created, undone) VALUES (?, ?, 0)", description, time.Now().Unix())
+    if err != nil {
+        return nil, fmt.Errorf("error al actualizar la bitácora: %v", err)
+    }
+    id, _ := result.LastInsertId()
+    for _, table := range []string{"journal_changes", "journal_entries"} {
+        if _, err := tx.Exec("DELETE FROM "+table+" WHERE id_entry <= ?", id-journalLimit); err != nil {
+            return nil, fmt.Errorf("error al actualizar la bitácora: %v", err)
+        }
+    }
+    return &journal{tx: tx, id: id}, nil
+}
+
+// withJournal hace los cambios de change en una transacción registrada en la bitácora como una operación.
+// Si change regresa un error, o la transacción no se confirma, no se guarda nada y se deshacen los cambios a
+// archivos registrados en files.
+func withJournal(db *sql.DB, description string, change func(j *journal, files *fileChanges) error) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+
+    j, err := beginJournal(tx, description)
+    if err != nil {
+        return err
+    }
+    files := &fileChanges{}
+    if err := change(j, files); err != nil {
+        return files.rollback(err)
+    }
+    if err := j.finish(); err != nil {
+        return files.rollback(err)
+    }
+    if err := tx.Commit(); err != nil {
+        return files.rollback(fmt.Errorf("error al guardar los cambios: %v", err))
+    }
+    files.committed()
+    return nil
+}
+
+// fileChanges son los cambios a archivos (etiquetas escritas y archivos movidos) hechos dentro de una transacción
+// que todavía no se confirma, para deshacerlos si no se confirma.
+type fileChanges struct {
+    undo  []func() error // Acciones que deshacen cada cambio, en el orden en que se hicieron.
+    moved [][2]string    // Rutas anterior y nueva de cada archivo movido.
+}
+
+// wroteTag registra que se escribió la etiqueta de un archivo, para volver a escribir la anterior si hace falta.
+func (c *fileChanges) wroteTag(path string, previous *id3Tag) {
+    c.undo = append(c.undo, func() error {
+        if err := writeID3Tag(path, previous, false); err != nil {
+            return fmt.Errorf("tampoco se pudo restaurar la etiqueta de %s: %v", path, err)
+        }
+        return nil
+    })
+}
+
+// move mueve un archivo, creando los directorios que falten, y lo registra para regresarlo si hace falta.
+// Nunca reemplaza un archivo existente.
+func (c *fileChanges) move(from, to string) error {
+    if info, err := os.Lstat(to); err == nil {
+        // En sistemas de archivos que no distinguen mayúsculas la ruta nueva puede ser el mismo archivo.
+        if fromInfo, fromErr := os.Lstat(from); fromErr != nil || !os.SameFile(info, fromInfo) {
+            return fmt.Errorf("ya existe %s", to)
+        }
+    }
+
+    created, err := makeDirs(filepath.Dir(to))
+    if err != nil {
+        return err
+    }
+    if err := os.Rename(from, to); err != nil {
+        removeDirs(created)
+        return fmt.Errorf("error al mover %s: %v", from, err)
+    }
+    c.moved = append(c.moved, [2]string{from, to})
+    c.undo = append(c.undo, func() error {
+        if err := os.Rename(to, from); err != nil {
+            return fmt.Errorf("tampoco se pudo regresar %s a %s: %v", to, from, err)
+        }
+        removeDirs(created)
+        return nil
+    })
+    return nil
+}
+
+// rollback deshace los cambios a archivos, del último al primero, y regresa err junto con los errores de los
+// cambios que no se pudieron deshacer.
+func (c *fileChanges) rollback(err error) error {
+    for i := len(c.undo) - 1; i >= 0; i-- {
+        if undoErr := c.undo[i](); undoErr != nil {
+            err = fmt.Errorf("%v (%v)", err, undoErr)
+        }
+    }
+    return err
+}
+
+// committed elimina, una vez confirmada la transacción, los directorios que quedaron vacíos al mover archivos.
+func (c *fileChanges) committed() {
+    for _, move := range c.moved {
+        removeEmptyDirs(move[0], move[1])
+    }
+}
+
+// makeDirs crea un directorio y los padres que le falten. Regresa los directorios creados, del más profundo
+// al menos profundo.
+func makeDirs(dir string) ([]string, error) {
+    var created []string
+    for missing := dir; ; missing = filepath.Dir(missing) {
+        if _, err := os.Stat(missing); err == nil || missing == filepath.Dir(missing) {
+            break
+        }
+        created = append(created, missing)
+    }
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("error al crear el directorio %s: %v", dir, err)
+    }
+    return created, nil
+}
+
+// removeDirs elimina los directorios indicados que estén vacíos, en orden.
+func removeDirs(dirs []string) {
+    for _, dir := range dirs {
+        os.Remove(dir) // Falla, sin hacer nada, si el directorio no está vacío.
+    }
+}
+
+// removeEmptyDirs elimina el directorio de un archivo que se movió y sus padres mientras queden vacíos, sin llegar
+// a los directorios que contienen la ruta nueva del archivo.
+func removeEmptyDirs(from, to string) {
+    for dir := filepath.Dir(from); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+        if rel, err := filepath.Rel(dir, to); err == nil && !strings.HasPrefix(rel, "..") {
+            return
+        }
+        if os.Remove(dir) != nil {
+            return
+        }
+    }
+}
+
+// finish elimina la operación de la bitácora si no cambió nada, para que deshacer no se detenga en ella.
+func (j *journal) finish() error {
+    _, err := j.tx.Exec("DELETE FROM journal_entries WHERE id_entry = ? AND NOT EXISTS (SELECT 1 FROM journal_changes WHERE id_entry = ?)", j.id, j.id)
+    if err != nil {
+        return fmt.Errorf("error al actualizar la bitácora: %v", err)
+    }
+    return nil
+}
+
+// quoteIdentifier escribe el nombre de una tabla o columna entre comillas para usarlo en una sentencia SQL.
+func quoteIdentifier(name string) string {
+    return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// tableColumns regresa los nombres de las columnas de una tabla.
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+    rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer las columnas de %s: %v", table, err)
+    }
+    defer rows.Close()
+
+    var columns []string
+    for rows.Next() {
+        var column string
+        if err := rows.Scan(&column); err != nil {
+            return nil, fmt.Errorf("error al leer las columnas de %s: %v", table, err)
+        }
+        columns = append(columns, column)
+    }
+    return columns, rows.Err()
+}
+
+// queryIDs regresa la primera columna, numérica, de las filas de una consulta.
+func queryIDs(tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+    rows, err := tx.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("error al consultar la base de datos: %v", err)
+    }
+    defer rows.Close()
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("error al consultar la base de datos: %v", err)
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// record guarda en el paso actual el valor de las columnas de una fila, como valor anterior o nuevo.
+func (j *journal) record(kind, table string, rowID int64, columns []string, target string) error {
+    if j.id == 0 {
+        return nil
+    }
+    for _, column := range columns {
+        query := fmt.Sprintf("INSERT INTO journal_changes (id_entry, step, kind, table_name, row_id, column_name, %s) "+
+            "SELECT ?, ?, ?, ?, rowid, ?, %s FROM %s WHERE rowid = ?", target, quoteIdentifier(column), quoteIdentifier(table))
+        if _, err := j.tx.Exec(query, j.id, j.step, kind, table, column, rowID); err != nil {
+            return fmt.Errorf("error al actualizar la bitácora: %v", err)
+        }
+    }
+    return nil
+}
+
+// update cambia columnas de una fila y registra sus valores anteriores y nuevos. Las columnas que no cambian
+// no se registran.
+func (j *journal) update(table string, rowID int64, columns []string, values ...interface{}) error {
+    j.step++
+    if err := j.record(journalUpdate, table, rowID, columns, "old_value"); err != nil {
+        return err
+    }
+
+    assignments := make([]string, len(columns))
+    for i, column := range columns {
+        assignments[i] = quoteIdentifier(column) + " = ?"
+    }
+    query := fmt.Sprintf("UPDATE %s SET %s WHERE rowid = ?", quoteIdentifier(table), strings.Join(assignments, ", "))
+    if _, err := j.tx.Exec(query, append(values, rowID)...); err != nil {
+        return fmt.Errorf("error al actualizar %s: %v", table, err)
+    }
+    if j.id == 0 {
+        return nil
+    }
+
+    for _, column := range columns {
+        query := fmt.Sprintf("UPDATE journal_changes SET new_value = (SELECT %s FROM %s WHERE rowid = ?) "+
+            "WHERE id_entry = ? AND step = ? AND column_name = ?", quoteIdentifier(column), quoteIdentifier(table))
+        if _, err := j.tx.Exec(query, rowID, j.id, j.step, column); err != nil {
+            return fmt.Errorf("error al actualizar la bitácora: %v", err)
+        }
+    }
+    if _, err := j.tx.Exec("DELETE FROM journal_changes WHERE id_entry = ? AND step = ? AND old_value IS new_value", j.id, j.step); err != nil {
+        return fmt.Errorf("error al actualizar la bitácora: %v", err)
+    }
+    return nil
+}
+
+// insert inserta una fila y la registra completa. Regresa el rowid de la fila nueva.
+func (j *journal) insert(table string, columns []string, values ...interface{}) (int64, error) {
+    placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+    quoted := make([]string, len(columns))
+    for i, column := range columns {
+        quoted[i] = quoteIdentifier(column)
+    }
+    query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdentifier(table), strings.Join(quoted, ", "), placeholders)
+    result, err := j.tx.Exec(query, values...)
+    if err != nil {
+        return 0, fmt.Errorf("error al insertar en %s: %v", table, err)
+    }
+    rowID, _ := result.LastInsertId()
+    if j.id == 0 {
+        return rowID, nil
+    }
+
+    all, err := tableColumns(j.tx, table)
+    if err != nil {
+        return 0, err
+    }
+    j.step++
+    return rowID, j.record(journalInsert, table, rowID, all, "new_value")
+}
+
+// delete registra completa una fila y la elimina.
+func (j *journal) delete(table string, rowID int64) error {
+    if j.id == 0 {
+        _, err := j.tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", quoteIdentifier(table)), rowID)
+        if err != nil {
+            return fmt.Errorf("error al eliminar de %s: %v", table, err)
+        }
+        return nil
+    }
+    all, err := tableColumns(j.tx, table)
+    if err != nil {
+        return err
+    }
+    j.step++
+    if err := j.record(journalDelete, table, rowID, all, "old_value"); err != nil {
+        return err
+    }
+    if _, err := j.tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", quoteIdentifier(table)), rowID); err != nil {
+        return fmt.Errorf("error al eliminar de %s: %v", table, err)
+    }
+    return nil
+}
+
+// tag registra el contenido anterior y nuevo de las tramas que cambiaron en la etiqueta del archivo de una rola.
+// Una trama que no existe se registra como NULL.
+func (j *journal) tag(idRola int, before, after map[string][]byte) error {
+    if j.id == 0 {
+        return nil
+    }
+    j.step++
+    for id, data := range after {
+        if bytes.Equal(before[id], data) {
+            continue
+        }
+        _, err := j.tx.Exec("INSERT INTO journal_changes (id_entry, step, kind, table_name, row_id, column_name, old_value, new_value) "+
+            "VALUES (?, ?, ?, 'rolas', ?, ?, ?, ?)", j.id, j.step, journalTag, idRola, id, nullableBytes(before[id]), nullableBytes(data))
+        if err != nil {
+            return fmt.Errorf("error al actualizar la bitácora: %v", err)
+        }
+    }
+    return nil
+}
+
+// move registra que el archivo de una rola se movió de la ruta from a la ruta to.
+func (j *journal) move(idRola int, from, to string) error {
+    if j.id == 0 {
+        return nil
+    }
+    j.step++
+    _, err := j.tx.Exec("INSERT INTO journal_changes (id_entry, step, kind, table_name, row_id, column_name, old_value, new_value) "+
+        "VALUES (?, ?, ?, 'rolas', ?, 'path', ?, ?)", j.id, j.step, journalMove, idRola, from, to)
+    if err != nil {
+        return fmt.Errorf("error al actualizar la bitácora: %v", err)
+    }
+    return nil
+}
+
+// nullableBytes regresa nil (NULL en la base de datos) para un contenido vacío.
+func nullableBytes(data []byte) interface{} {
+    if len(data) == 0 {
+        return nil
+    }
+    return data
+}
+
+// JournalEntry es una operación registrada en la bitácora de cambios.
+type JournalEntry struct {
+    ID          int       // ID de la operación.
+    Description string    // Descripción de la operación (e.g., "Editar 12 canciones").
+    Created     time.Time // Momento en que se hizo la operación.
+    Undone      bool      // Indica si la operación está deshecha.
+}
+
+// GetJournal regresa las operaciones de la bitácora, de la más reciente a la más antigua.
+func GetJournal(db *sql.DB) ([]JournalEntry, error) {
+    rows, err := db.Query("SELECT id_entry, description, created, undone FROM journal_entries ORDER BY id_entry DESC")
+    if err != nil {
+        return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+    defer rows.Close()
+
+    var entries []JournalEntry
+    for rows.Next() {
+        var entry JournalEntry
+        var created int64
+        if err := rows.Scan(&entry.ID, &entry.Description, &created, &entry.Undone); err != nil {
+            return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+        }
+        entry.Created = time.Unix(created, 0)
+        entries = append(entries, entry)
+    }
+    return entries, rows.Err()
+}
+
+// Undo deshace la operación más reciente de la bitácora que no se ha deshecho y regresa su descripción.
+func Undo(db *sql.DB) (string, error) {
+    var id int64
+    var description string
+    err := db.QueryRow("SELECT id_entry, description FROM journal_entries WHERE undone = 0 ORDER BY id_entry DESC LIMIT 1").Scan(&id, &description)
+    if err == sql.ErrNoRows {
+        return "", fmt.Errorf("no hay cambios que deshacer")
+    }
+    if err != nil {
+        return "", fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+    if err := replayJournal(db, id, true); err != nil {
+        return "", fmt.Errorf("no se pudo deshacer \"%s\": %v", description, err)
+    }
+    return description, nil
+}
+
+// Redo vuelve a hacer la operación deshecha más antigua y regresa su descripción. Así, deshacer varias veces y
+// luego rehacer recorre las operaciones en el mismo orden en que se hicieron.
+func Redo(db *sql.DB) (string, error) {
+    var id int64
+    var description string
+    err := db.QueryRow("SELECT id_entry, description FROM journal_entries WHERE undone = 1 ORDER BY id_entry LIMIT 1").Scan(&id, &description)
+    if err == sql.ErrNoRows {
+        return "", fmt.Errorf("no hay cambios que rehacer")
+    }
+    if err != nil {
+        return "", fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+    if err := replayJournal(db, id, false); err != nil {
+        return "", fmt.Errorf("no se pudo rehacer \"%s\": %v", description, err)
+    }
+    return description, nil
+}
+
+// journalChange es el cambio de una columna registrado en la bitácora.
+type journalChange struct {
+    id     int64  // ID del cambio en journal_changes.
+    step   int    // Paso de la operación al que pertenece.
+    kind   string // Tipo de cambio (journalUpdate, journalInsert, journalDelete o journalTag).
+    table  string // Tabla de la fila.
+    rowID  int64  // rowid de la fila (el ID de la rola en los cambios de etiquetas).
+    column string // Columna (el identificador de la trama en los cambios de etiquetas).
+}
+
+// journalSteps lee los cambios de una operación agrupados por paso, en el orden en que se hicieron.
+func journalSteps(tx *sql.Tx, id int64) ([][]journalChange, error) {
+    rows, err := tx.Query("SELECT id_change, step, kind, table_name, row_id, column_name FROM journal_changes WHERE id_entry = ? ORDER BY step, id_change", id)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+    defer rows.Close()
+
+    var steps [][]journalChange
+    for rows.Next() {
+        var change journalChange
+        if err := rows.Scan(&change.id, &change.step, &change.kind, &change.table, &change.rowID, &change.column); err != nil {
+            return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+        }
+        if len(steps) == 0 || steps[len(steps)-1][0].step != change.step {
+            steps = append(steps, nil)
+        }
+        steps[len(steps)-1] = append(steps[len(steps)-1], change)
+    }
+    return steps, rows.Err()
+}
+
+// replayJournal deshace (undo) o rehace una operación en una sola transacción. Antes de cada paso se comprueba que
+// los datos sigan como los dejó la operación (o como estaban antes, al rehacer); si algo cambió después, no se
+// cambia nada. Las etiquetas y los archivos movidos se restauran si la transacción no se puede confirmar.
+// Como al editar (ver applySongEdits), las copias de los archivos con sus etiquetas se preparan antes de la
+// transacción, que sólo las renombra.
+func replayJournal(db *sql.DB, id int64, undo bool) error {
+    from, to := "old_value", "new_value"
+    if undo {
+        from, to = to, from
+    }
+    tags, err := prepareJournalTags(db, id, from, to)
+    defer func() {
+        for _, tag := range tags {
+            tag.prepared.discard()
+        }
+    }()
+    if err != nil {
+        return err
+    }
+
+    tx, err := db.Begin()
+    if err != nil {
+        return fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+
+    steps, err := journalSteps(tx, id)
+    if err != nil {
+        return err
+    }
+    if undo {
+        for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+            steps[i], steps[j] = steps[j], steps[i]
+        }
+    }
+
+    files := &fileChanges{}
+    for _, step := range steps {
+        var err error
+        switch kind := step[0].kind; kind {
+        case journalUpdate:
+            err = replayUpdate(tx, step, from, to)
+        case journalInsert, journalDelete:
+            // Deshacer una inserción o rehacer una eliminación quita la fila; lo contrario la vuelve a crear con
+            // los valores registrados.
+            values := "new_value"
+            if kind == journalDelete {
+                values = "old_value"
+            }
+            if (kind == journalInsert) == undo {
+                err = replayRemove(tx, step, values)
+            } else {
+                err = replayCreate(tx, step, values)
+            }
+        case journalTag:
+            err = replayTag(tx, step, tags[step[0].step], files)
+        case journalMove:
+            err = replayMove(tx, step[0], from, to, files)
+        default:
+            err = fmt.Errorf("cambio desconocido '%s' en la bitácora", kind)
+        }
+        if err != nil {
+            return files.rollback(err)
+        }
+    }
+
+    if _, err := tx.Exec("UPDATE journal_entries SET undone = ? WHERE id_entry = ?", undo, id); err != nil {
+        return files.rollback(fmt.Errorf("error al actualizar la bitácora: %v", err))
+    }
+    if err := tx.Commit(); err != nil {
+        return files.rollback(fmt.Errorf("error al guardar los cambios: %v", err))
+    }
+    files.committed()
+    return nil
+}
+
+// errChangedLater es el error de un paso cuyos datos cambiaron después de la operación.
+func errChangedLater(change journalChange) error {
+    return fmt.Errorf("la fila %d de %s cambió después de la operación", change.rowID, change.table)
+}
+
+// matches indica si la fila del cambio existe y su columna tiene el valor registrado en la columna values.
+func matches(tx *sql.Tx, change journalChange, values string) (bool, error) {
+    var same bool
+    query := fmt.Sprintf("SELECT t.%s IS c.%s FROM %s t, journal_changes c WHERE t.rowid = ? AND c.id_change = ?",
+        quoteIdentifier(change.column), values, quoteIdentifier(change.table))
+    err := tx.QueryRow(query, change.rowID, change.id).Scan(&same)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("error al comparar %s: %v", change.table, err)
+    }
+    return same, nil
+}
+
+// replayUpdate regresa las columnas de un paso journalUpdate del valor from al valor to.
+func replayUpdate(tx *sql.Tx, step []journalChange, from, to string) error {
+    for _, change := range step {
+        same, err := matches(tx, change, from)
+        if err != nil {
+            return err
+        }
+        if !same {
+            return errChangedLater(change)
+        }
+        query := fmt.Sprintf("UPDATE %s SET %s = (SELECT %s FROM journal_changes WHERE id_change = ?) WHERE rowid = ?",
+            quoteIdentifier(change.table), quoteIdentifier(change.column), to)
+        if _, err := tx.Exec(query, change.id, change.rowID); err != nil {
+            return fmt.Errorf("error al actualizar %s: %v", change.table, err)
+        }
+    }
+    return nil
+}
+
+// replayRemove elimina la fila de un paso journalInsert o journalDelete, si sigue con los valores registrados.
+func replayRemove(tx *sql.Tx, step []journalChange, values string) error {
+    for _, change := range step {
+        same, err := matches(tx, change, values)
+        if err != nil {
+            return err
+        }
+        if !same {
+            return errChangedLater(change)
+        }
+    }
+    change := step[0]
+    if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", quoteIdentifier(change.table)), change.rowID); err != nil {
+        return fmt.Errorf("error al eliminar de %s: %v", change.table, err)
+    }
+    return nil
+}
+
+// replayCreate vuelve a crear, con el mismo rowid, la fila de un paso journalInsert o journalDelete.
+func replayCreate(tx *sql.Tx, step []journalChange, values string) error {
+    change := step[0]
+    var exists bool
+    query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE rowid = ?)", quoteIdentifier(change.table))
+    if err := tx.QueryRow(query, change.rowID).Scan(&exists); err != nil {
+        return fmt.Errorf("error al leer %s: %v", change.table, err)
+    }
+    if exists {
+        return errChangedLater(change)
+    }
+
+    columns := []string{"rowid"}
+    selects := []string{"?"}
+    args := []interface{}{change.rowID}
+    for _, change := range step {
+        columns = append(columns, quoteIdentifier(change.column))
+        selects = append(selects, fmt.Sprintf("(SELECT %s FROM journal_changes WHERE id_change = ?)", values))
+        args = append(args, change.id)
+    }
+    query = fmt.Sprintf("INSERT INTO %s (%s) SELECT %s", quoteIdentifier(change.table), strings.Join(columns, ", "), strings.Join(selects, ", "))
+    if _, err := tx.Exec(query, args...); err != nil {
+        return fmt.Errorf("error al insertar en %s: %v", change.table, err)
+    }
+    return nil
+}
+
+// journalTagFile es la etiqueta del archivo de una rola que cambia un paso journalTag, preparada antes de la
+// transacción que deshace o rehace la operación.
+type journalTagFile struct {
+    idRola   int64        // ID de la rola.
+    previous *id3Tag      // Etiqueta actual del archivo, para restaurarla si la transacción falla.
+    prepared *preparedTag // Copia del archivo con las tramas del paso cambiadas.
+}
+
+// prepareJournalTags prepara, para cada paso journalTag de una operación, la copia del archivo de su rola con las
+// tramas cambiadas del contenido from al contenido to. Regresa un error si la etiqueta cambió después de la
+// operación. Las copias ya preparadas se regresan también con el error, para descartarlas.
+func prepareJournalTags(db *sql.DB, id int64, from, to string) (map[int]*journalTagFile, error) {
+    query := fmt.Sprintf("SELECT c.step, c.row_id, c.column_name, c.%s, c.%s, r.path FROM journal_changes c "+
+        "JOIN rolas r ON r.id_rola = c.row_id WHERE c.id_entry = ? AND c.kind = ? ORDER BY c.step, c.id_change", from, to)
+    rows, err := db.Query(query, id, journalTag)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+    type tagChange struct {
+        step           int
+        idRola         int64
+        frame, path    string
+        expected, data []byte
+    }
+    var changes []tagChange
+    for rows.Next() {
+        var change tagChange
+        if err := rows.Scan(&change.step, &change.idRola, &change.frame, &change.expected, &change.data, &change.path); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+        }
+        changes = append(changes, change)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+
+    tags := map[int]*journalTagFile{}
+    for start := 0; start < len(changes); {
+        end := start
+        for end < len(changes) && changes[end].step == changes[start].step {
+            end++
+        }
+        path := changes[start].path
+        for _, tag := range tags {
+            if tag.prepared.path == path {
+                return tags, fmt.Errorf("la operación cambia más de una vez la etiqueta de %s", path)
+            }
+        }
+
+        file, err := os.Open(path)
+        if err != nil {
+            return tags, fmt.Errorf("error al abrir el archivo: %v", err)
+        }
+        tag, err := readID3Tag(file)
+        file.Close()
+        if err != nil {
+            return tags, fmt.Errorf("%s: %v", path, err)
+        }
+        previous := tag.clone()
+        for _, change := range changes[start:end] {
+            if !bytes.Equal(tag.frameData(change.frame), change.expected) {
+                return tags, fmt.Errorf("la etiqueta %s de %s cambió después de la operación", change.frame, path)
+            }
+            tag.setFrame(change.frame, change.data)
+        }
+
+        prepared, err := prepareID3Tag(path, tag)
+        if err != nil {
+            return tags, err
+        }
+        tags[changes[start].step] = &journalTagFile{idRola: changes[start].idRola, previous: previous, prepared: prepared}
+        start = end
+    }
+    return tags, nil
+}
+
+// replayTag reemplaza el archivo de la rola de un paso journalTag por la copia preparada con prepareJournalTags, si
+// la rola sigue en el mismo archivo, y lo registra en files para restaurarlo si algo falla después.
+func replayTag(tx *sql.Tx, step []journalChange, tag *journalTagFile, files *fileChanges) error {
+    var path string
+    if err := tx.QueryRow("SELECT path FROM rolas WHERE id_rola = ?", step[0].rowID).Scan(&path); err != nil {
+        return fmt.Errorf("error al obtener la ruta de la rola %d: %v", step[0].rowID, err)
+    }
+    if tag == nil || tag.idRola != step[0].rowID || tag.prepared.path != path {
+        return fmt.Errorf("el archivo de la rola %d cambió después de la operación", step[0].rowID)
+    }
+    if err := tag.prepared.replace(false); err != nil {
+        return err
+    }
+    files.wroteTag(path, tag.previous)
+    return nil
+}
+
+// replayMove mueve el archivo de un paso journalMove de la ruta registrada en from a la registrada en to.
+func replayMove(tx *sql.Tx, change journalChange, from, to string, files *fileChanges) error {
+    var fromPath, toPath string
+    query := fmt.Sprintf("SELECT %s, %s FROM journal_changes WHERE id_change = ?", from, to)
+    if err := tx.QueryRow(query, change.id).Scan(&fromPath, &toPath); err != nil {
+        return fmt.Errorf("error al leer la bitácora: %v", err)
+    }
+    if _, err := os.Lstat(fromPath); err != nil {
+        return fmt.Errorf("el archivo %s ya no existe", fromPath)
+    }
+    return files.move(fromPath, toPath)
+}
@@ -0,0 +1,197 @@
+package model
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// minedSong regresa la canción minada con el título indicado.
+func minedSong(t *testing.T, repo Repository, title string) Song {
+    t.Helper()
+    songs, err := repo.Search("c: " + title)
+    if err != nil || len(songs) != 1 {
+        t.Fatalf("canción %q: %v, %v", title, songTitles(songs), err)
+    }
+    return songs[0]
+}
+
+// readFile regresa el contenido de un archivo y termina la prueba si no se puede leer.
+func readFile(t *testing.T, path string) []byte {
+    t.Helper()
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return data
+}
+
+// fileTag regresa las tramas codificadas de la etiqueta de un archivo y el audio que la sigue. El relleno de la
+// etiqueta no se incluye: al reescribirla puede crecer, pero no es parte de los datos.
+func fileTag(t *testing.T, path string) (frames, audio []byte) {
+    t.Helper()
+    data := readFile(t, path)
+    tag, err := readID3Tag(bytes.NewReader(data))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tag.encode(), data[tag.Size:]
+}
+
+// TestUndoRedoTagEdit edita una canción, deshace la edición y la vuelve a hacer: la base de datos, las tramas de la
+// etiqueta y el audio deben quedar igual que antes de cada paso.
+func TestUndoRedoTagEdit(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    mineTestSongs(t, repo)
+    song := minedSong(t, repo, "something")
+    original, audio := fileTag(t, song.Path)
+
+    edit := EditOf(song)
+    edit.Title, edit.Year = "Something (Remastered)", "2009"
+    if err := UpdateSongTags(repo.DB(), song, edit, false); err != nil {
+        t.Fatal(err)
+    }
+    edited, _ := fileTag(t, song.Path)
+    if bytes.Equal(edited, original) {
+        t.Fatal("la edición no cambió la etiqueta del archivo")
+    }
+    check := func(step, title string, year int, want []byte) {
+        t.Helper()
+        songs, err := repo.Songs()
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, s := range songs {
+            if s.IDRola == song.IDRola && (s.Title != title || s.Year != year) {
+                t.Errorf("%s: canción %q de %d, se esperaba %q de %d", step, s.Title, s.Year, title, year)
+            }
+        }
+        frames, data := fileTag(t, song.Path)
+        if !bytes.Equal(frames, want) {
+            t.Errorf("%s: la etiqueta no quedó como se esperaba", step)
+        }
+        if !bytes.Equal(data, audio) {
+            t.Errorf("%s: cambió el audio del archivo", step)
+        }
+    }
+    check("editar", "Something (Remastered)", 2009, edited)
+
+    if _, err := Undo(repo.DB()); err != nil {
+        t.Fatal(err)
+    }
+    check("deshacer", "Something", 1969, original)
+
+    if _, err := Redo(repo.DB()); err != nil {
+        t.Fatal(err)
+    }
+    check("rehacer", "Something (Remastered)", 2009, edited)
+}
+
+// TestUndoFailedMove organiza dos archivos y ocupa la ruta original de uno antes de deshacer: deshacer debe fallar
+// sin cambiar la base de datos y regresar a su ruta nueva el archivo que ya había movido.
+func TestUndoFailedMove(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    dir := mineTestSongs(t, repo)
+    template, err := ParseOrganizeTemplate("{artist}/{album}/{track:02} {title}")
+    if err != nil {
+        t.Fatal(err)
+    }
+    songs, err := repo.Search("a: paranoid")
+    if err != nil {
+        t.Fatal(err)
+    }
+    moves, err := PlanOrganize(repo.DB(), songs, dir, template)
+    if err != nil || len(moves) != 2 {
+        t.Fatalf("plan = %+v, %v", moves, err)
+    }
+    if err := ApplyOrganize(repo.DB(), moves); err != nil {
+        t.Fatal(err)
+    }
+
+    // Deshacer regresa primero el último archivo movido; el primero ya no puede regresar.
+    if err := os.MkdirAll(filepath.Dir(moves[0].From), 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(moves[0].From, []byte("otro archivo"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := Undo(repo.DB()); err == nil {
+        t.Fatal("se deshizo la organización aunque la ruta original estaba ocupada")
+    }
+
+    for _, move := range moves {
+        var path string
+        if err := repo.DB().QueryRow("SELECT path FROM rolas WHERE id_rola = ?", move.Song.IDRola).Scan(&path); err != nil {
+            t.Fatal(err)
+        }
+        if path != move.To {
+            t.Errorf("rolas.path = %s, se esperaba %s", path, move.To)
+        }
+        if _, err := os.Stat(move.To); err != nil {
+            t.Errorf("el archivo no está en su ruta nueva: %v", err)
+        }
+    }
+    if data := readFile(t, moves[0].From); string(data) != "otro archivo" {
+        t.Error("se reemplazó el archivo que ocupaba la ruta original")
+    }
+    if _, err := os.Stat(moves[1].From); !os.IsNotExist(err) {
+        t.Errorf("el archivo que sí se pudo regresar quedó en %s", moves[1].From)
+    }
+    var undone bool
+    if err := repo.DB().QueryRow("SELECT undone FROM journal_entries ORDER BY id_entry DESC LIMIT 1").Scan(&undone); err != nil || undone {
+        t.Errorf("la operación quedó marcada como deshecha: %v", err)
+    }
+
+    // Al liberar la ruta original ya se puede deshacer.
+    if err := os.Remove(moves[0].From); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := Undo(repo.DB()); err != nil {
+        t.Fatal(err)
+    }
+    for _, move := range moves {
+        if _, err := os.Stat(move.From); err != nil {
+            t.Errorf("después de deshacer: %v", err)
+        }
+    }
+    if _, err := os.Stat(filepath.Join(dir, "Black Sabbath")); !os.IsNotExist(err) {
+        t.Error("no se eliminó el directorio que quedó vacío")
+    }
+}
+
+// TestNewEditClearsRedo revisa que después de deshacer, una operación nueva descarte la deshecha.
+func TestNewEditClearsRedo(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    mineTestSongs(t, repo)
+
+    song := minedSong(t, repo, "war pigs")
+    edit := EditOf(song)
+    edit.Title = "War Pigs (Live)"
+    if err := UpdateSongTags(repo.DB(), song, edit, false); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := Undo(repo.DB()); err != nil {
+        t.Fatal(err)
+    }
+
+    song = minedSong(t, repo, "darling")
+    edit = EditOf(song)
+    edit.Genre = "Rock"
+    if err := UpdateSongTags(repo.DB(), song, edit, false); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := Redo(repo.DB()); err == nil {
+        t.Error("se rehizo una operación después de hacer otra")
+    }
+    if song := minedSong(t, repo, "war pigs"); song.Title != "War Pigs" {
+        t.Errorf("título = %q después de intentar rehacer", song.Title)
+    }
+    entries, err := GetJournal(repo.DB())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != 1 {
+        t.Errorf("la bitácora tiene %d operaciones, se esperaba sólo la edición nueva", len(entries))
+    }
+}
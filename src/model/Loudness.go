@@ -0,0 +1,433 @@
+package model
+
+import (
+    "database/sql"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "os"
+
+    "fyne.io/fyne/v2/widget"
+)
+
+// Parámetros de la medición de sonoridad de EBU R128 (ITU-R BS.1770-4).
+const (
+    loudnessBlockSteps   = 4     // Un bloque de 400 ms se forma con 4 pasos de 100 ms (75% de traslape).
+    loudnessAbsoluteGate = -70.0 // Los bloques más silenciosos que esto (LUFS) no cuentan.
+    loudnessRelativeGate = -10.0 // Umbral relativo (LU) respecto a la sonoridad de los bloques que pasan el umbral absoluto.
+    loudnessMaxLUFS      = 5.0   // Límite superior del histograma de bloques.
+    loudnessBinsPerLU    = 10    // Resolución del histograma: 0.1 LU.
+    loudnessHistogramLen = int((loudnessMaxLUFS-loudnessAbsoluteGate)*loudnessBinsPerLU) + 1
+)
+
+// ReplayGainReference es la sonoridad de referencia de ReplayGain 2.0, en LUFS.
+const ReplayGainReference = -18.0
+
+// truePeakTaps es el número de coeficientes de cada fase del filtro de sobremuestreo 4x para el pico verdadero.
+const truePeakTaps = 12
+
+// truePeakFilter contiene las 4 fases del filtro interpolador (sinc con ventana de Kaiser).
+var truePeakFilter [4][truePeakTaps]float64
+
+func init() {
+    const beta = 7.0
+    length := 4 * truePeakTaps
+    center := float64(length-1) / 2
+    for i := 0; i < length; i++ {
+        x := (float64(i) - center) / 4
+        sinc := 1.0
+        if x != 0 {
+            sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+        }
+        ratio := (float64(i) - center) / center
+        window := besselI0(beta*math.Sqrt(1-ratio*ratio)) / besselI0(beta)
+        truePeakFilter[i%4][i/4] = sinc * window
+    }
+}
+
+// besselI0 calcula la función de Bessel modificada de orden cero, usada por la ventana de Kaiser.
+func besselI0(x float64) float64 {
+    sum, term := 1.0, 1.0
+    for k := 1; k < 50; k++ {
+        term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+        sum += term
+        if term < 1e-12*sum {
+            break
+        }
+    }
+    return sum
+}
+
+// biquad es un filtro IIR de segundo orden (forma directa I).
+type biquad struct {
+    b0, b1, b2, a1, a2 float64
+    x1, x2, y1, y2     float64
+}
+
+// process filtra una muestra.
+func (f *biquad) process(x float64) float64 {
+    y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+    f.x2, f.x1 = f.x1, x
+    f.y2, f.y1 = f.y1, y
+    return y
+}
+
+// kWeightingFilters regresa los dos filtros de la ponderación K de BS.1770 (estante de agudos y paso altas)
+// calculados para la frecuencia de muestreo indicada.
+func kWeightingFilters(sampleRate int) (biquad, biquad) {
+    rate := float64(sampleRate)
+
+    f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+    k := math.Tan(math.Pi * f0 / rate)
+    vh := math.Pow(10, gain/20)
+    vb := math.Pow(vh, 0.4996667741545416)
+    a0 := 1 + k/q + k*k
+    shelf := biquad{
+        b0: (vh + vb*k/q + k*k) / a0,
+        b1: 2 * (k*k - vh) / a0,
+        b2: (vh - vb*k/q + k*k) / a0,
+        a1: 2 * (k*k - 1) / a0,
+        a2: (1 - k/q + k*k) / a0,
+    }
+
+    f0, q = 38.13547087602444, 0.5003270373238773
+    k = math.Tan(math.Pi * f0 / rate)
+    a0 = 1 + k/q + k*k
+    highPass := biquad{
+        b0: 1,
+        b1: -2,
+        b2: 1,
+        a1: 2 * (k*k - 1) / a0,
+        a2: (1 - k/q + k*k) / a0,
+    }
+    return shelf, highPass
+}
+
+// loudnessMeter mide la sonoridad integrada y el pico verdadero de un flujo de audio.
+type loudnessMeter struct {
+    channels  int
+    stepSize  int         // Muestras por paso de 100 ms.
+    filters   [][2]biquad // Filtros de ponderación K de cada canal.
+    history   [][]float64 // Últimas muestras de cada canal para el sobremuestreo.
+    stepSum   float64     // Energía ponderada acumulada en el paso actual.
+    stepCount int         // Muestras acumuladas en el paso actual.
+    steps     [loudnessBlockSteps]float64
+    stepsSeen int      // Pasos completos vistos, para saber cuándo hay un bloque entero.
+    histogram []uint32 // Número de bloques por cada 0.1 LU, a partir de loudnessAbsoluteGate.
+    peak      float64  // Pico verdadero (lineal).
+}
+
+// newLoudnessMeter crea un medidor para un flujo con la frecuencia y el número de canales indicados.
+func newLoudnessMeter(sampleRate, channels int) *loudnessMeter {
+    lm := &loudnessMeter{
+        channels:  channels,
+        stepSize:  sampleRate / 10,
+        filters:   make([][2]biquad, channels),
+        history:   make([][]float64, channels),
+        histogram: make([]uint32, loudnessHistogramLen),
+    }
+    for ch := range lm.filters {
+        shelf, highPass := kWeightingFilters(sampleRate)
+        lm.filters[ch] = [2]biquad{shelf, highPass}
+        lm.history[ch] = make([]float64, truePeakTaps)
+    }
+    return lm
+}
+
+// add procesa las muestras decodificadas de una trama (una rebanada por canal).
+func (lm *loudnessMeter) add(pcm [][]float32) {
+    if len(pcm) == 0 {
+        return
+    }
+    for i := range pcm[0] {
+        energy := 0.0
+        for ch := 0; ch < lm.channels; ch++ {
+            channel := pcm[min(ch, len(pcm)-1)]
+            x := float64(channel[i])
+            lm.updatePeak(ch, x)
+            y := lm.filters[ch][1].process(lm.filters[ch][0].process(x))
+            energy += y * y
+        }
+        lm.stepSum += energy
+        lm.stepCount++
+        if lm.stepCount == lm.stepSize {
+            lm.finishStep()
+        }
+    }
+}
+
+// updatePeak sobremuestrea 4 veces la señal de un canal y actualiza el pico verdadero.
+func (lm *loudnessMeter) updatePeak(ch int, x float64) {
+    history := lm.history[ch]
+    copy(history[1:], history[:truePeakTaps-1])
+    history[0] = x
+    lm.peak = math.Max(lm.peak, math.Abs(x))
+    for phase := range truePeakFilter {
+        sum := 0.0
+        for k, coefficient := range truePeakFilter[phase] {
+            sum += coefficient * history[k]
+        }
+        lm.peak = math.Max(lm.peak, math.Abs(sum))
+    }
+}
+
+// finishStep cierra un paso de 100 ms y, cuando ya hay 4 pasos, agrega al histograma el bloque de 400 ms que terminan.
+func (lm *loudnessMeter) finishStep() {
+    lm.steps[lm.stepsSeen%loudnessBlockSteps] = lm.stepSum
+    lm.stepsSeen++
+    lm.stepSum, lm.stepCount = 0, 0
+    if lm.stepsSeen < loudnessBlockSteps {
+        return
+    }
+
+    energy := 0.0
+    for _, step := range lm.steps {
+        energy += step
+    }
+    energy /= float64(loudnessBlockSteps * lm.stepSize)
+    if energy <= 0 {
+        return
+    }
+    bin := int(math.Round((energyToLUFS(energy) - loudnessAbsoluteGate) * loudnessBinsPerLU))
+    if bin >= 0 {
+        lm.histogram[min(bin, loudnessHistogramLen-1)]++
+    }
+}
+
+// energyToLUFS convierte una energía media ponderada en sonoridad (LUFS).
+func energyToLUFS(energy float64) float64 {
+    return -0.691 + 10*math.Log10(energy)
+}
+
+// histogramBinEnergy regresa la energía correspondiente al centro de una casilla del histograma.
+// Cada casilla está centrada en un múltiplo de 0.1 LU.
+func histogramBinEnergy(bin int) float64 {
+    lufs := loudnessAbsoluteGate + float64(bin)/loudnessBinsPerLU
+    return math.Pow(10, (lufs+0.691)/10)
+}
+
+// IntegratedLoudness aplica los umbrales absoluto y relativo de EBU R128 a un histograma de bloques y regresa la
+// sonoridad integrada en LUFS. El segundo valor es falso si ningún bloque supera los umbrales (silencio).
+func IntegratedLoudness(histogram []uint32) (float64, bool) {
+    gatedMean := func(from int) (float64, bool) {
+        sum, count := 0.0, 0.0
+        for bin := from; bin < len(histogram); bin++ {
+            sum += float64(histogram[bin]) * histogramBinEnergy(bin)
+            count += float64(histogram[bin])
+        }
+        if count == 0 {
+            return 0, false
+        }
+        return sum / count, true
+    }
+
+    energy, ok := gatedMean(0)
+    if !ok {
+        return 0, false
+    }
+    threshold := energyToLUFS(energy) + loudnessRelativeGate
+    from := max(0, int(math.Ceil((threshold-loudnessAbsoluteGate)*loudnessBinsPerLU)))
+    energy, ok = gatedMean(from)
+    if !ok {
+        return 0, false
+    }
+    return energyToLUFS(energy), true
+}
+
+// LoudnessResult es la medición de una rola: el histograma de bloques (para combinarlo con el de las demás rolas
+// del álbum) y el pico verdadero lineal.
+type LoudnessResult struct {
+    Histogram []uint32
+    Peak      float64
+}
+
+// MeasureLoudness decodifica un MP3 completo y mide su sonoridad según EBU R128.
+func MeasureLoudness(r io.ReadSeeker) (*LoudnessResult, error) {
+    decoder, err := NewMP3Decoder(r, false)
+    if err != nil {
+        return nil, err
+    }
+    meter := newLoudnessMeter(decoder.SampleRate, decoder.Channels)
+    for {
+        pcm, err := decoder.Decode()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        meter.add(pcm)
+    }
+    if meter.stepsSeen == 0 {
+        return nil, fmt.Errorf("el archivo no tiene audio")
+    }
+    return &LoudnessResult{Histogram: meter.histogram, Peak: meter.peak}, nil
+}
+
+// ReplayGain calcula la ganancia de ReplayGain 2.0 (en dB) para una sonoridad en LUFS.
+func ReplayGain(lufs float64) float64 {
+    return ReplayGainReference - lufs
+}
+
+// encodeHistogram convierte un histograma de bloques a bytes (uint32 little endian) para guardarlo en la base de datos.
+func encodeHistogram(histogram []uint32) []byte {
+    data := make([]byte, 4*len(histogram))
+    for i, count := range histogram {
+        binary.LittleEndian.PutUint32(data[4*i:], count)
+    }
+    return data
+}
+
+// decodeHistogram convierte los bytes guardados en la base de datos en un histograma de bloques.
+func decodeHistogram(data []byte) []uint32 {
+    histogram := make([]uint32, loudnessHistogramLen)
+    for i := 0; i < len(histogram) && 4*i+4 <= len(data); i++ {
+        histogram[i] = binary.LittleEndian.Uint32(data[4*i:])
+    }
+    return histogram
+}
+
+// nullableLoudness regresa la sonoridad de un histograma, o nil (NULL) si es silencio.
+func nullableLoudness(histogram []uint32) interface{} {
+    if lufs, ok := IntegratedLoudness(histogram); ok {
+        return lufs
+    }
+    return nil
+}
+
+// AnalyzeLoudnessWithProgress mide la sonoridad y el pico de las rolas MP3 que todavía no se han analizado,
+// actualizando una barra de progreso. Los archivos se decodifican en paralelo (un trabajador por CPU) y cada
+// resultado se guarda en cuanto llega, por lo que el análisis se puede interrumpir y continuar después.
+// Al final se recalculan los álbumes de las rolas analizadas y, si WriteReplayGain está activo, se escriben las
+// tramas REPLAYGAIN_* en los archivos. Regresa cuántas rolas se analizaron.
+func (m *MP3Miner) AnalyzeLoudnessWithProgress(db *sql.DB, progressBar *widget.ProgressBar) (int, error) {
+    rows, err := db.Query("SELECT path, id_album FROM rolas WHERE codec = 'MP3' AND loudness_histogram IS NULL")
+    if err != nil {
+        return 0, fmt.Errorf("error al obtener las rolas: %v", err)
+    }
+    var paths []string
+    albums := map[int]bool{}
+    for rows.Next() {
+        var path string
+        var idAlbum int
+        if err := rows.Scan(&path, &idAlbum); err != nil {
+            rows.Close()
+            return 0, fmt.Errorf("error al leer las rolas: %v", err)
+        }
+        paths = append(paths, path)
+        albums[idAlbum] = true
+    }
+    rows.Close()
+
+    runAnalysisPipeline("Midiendo sonoridad", paths, progressBar, func(r io.ReadSeeker) (interface{}, error) {
+        return MeasureLoudness(r)
+    }, func(result analysisResult) {
+        updateRolaLoudness(db, result)
+    })
+
+    for idAlbum := range albums {
+        if err := updateAlbumLoudness(db, idAlbum, m.WriteReplayGain); err != nil {
+            log.Printf("Error al calcular la sonoridad del álbum %d: %v\n", idAlbum, err)
+        }
+    }
+    return len(paths), nil
+}
+
+// updateRolaLoudness guarda la medición de una rola. Si no se pudo medir se guarda un histograma vacío,
+// para no volver a intentarlo en cada pasada.
+func updateRolaLoudness(db *sql.DB, result analysisResult) {
+    if result.err != nil {
+        log.Printf("Error al medir la sonoridad de %s: %v\n", result.path, result.err)
+        if _, err := db.Exec("UPDATE rolas SET loudness_histogram = x'' WHERE path = ?", result.path); err != nil {
+            log.Printf("Error al guardar la sonoridad: %v\n", err)
+        }
+        return
+    }
+    loudness := result.value.(*LoudnessResult)
+    _, err := db.Exec("UPDATE rolas SET loudness = ?, peak = ?, loudness_histogram = ? WHERE path = ?",
+        nullableLoudness(loudness.Histogram), loudness.Peak, encodeHistogram(loudness.Histogram), result.path)
+    if err != nil {
+        log.Printf("Error al guardar la sonoridad: %v\n", err)
+    }
+}
+
+// updateAlbumLoudness combina los histogramas de las rolas analizadas de un álbum para obtener su sonoridad y su
+// pico, y opcionalmente escribe las etiquetas ReplayGain de pista y de álbum en cada archivo.
+func updateAlbumLoudness(db *sql.DB, idAlbum int, writeTags bool) error {
+    rows, err := db.Query("SELECT path, loudness, peak, loudness_histogram FROM rolas "+
+        "WHERE id_album = ? AND length(loudness_histogram) > 0", idAlbum)
+    if err != nil {
+        return err
+    }
+
+    type trackLoudness struct {
+        path     string
+        loudness sql.NullFloat64
+        peak     float64
+    }
+    var tracks []trackLoudness
+    histogram := make([]uint32, loudnessHistogramLen)
+    albumPeak := 0.0
+    for rows.Next() {
+        var track trackLoudness
+        var data []byte
+        if err := rows.Scan(&track.path, &track.loudness, &track.peak, &data); err != nil {
+            rows.Close()
+            return err
+        }
+        for bin, count := range decodeHistogram(data) {
+            histogram[bin] += count
+        }
+        albumPeak = math.Max(albumPeak, track.peak)
+        tracks = append(tracks, track)
+    }
+    rows.Close()
+    if len(tracks) == 0 {
+        return nil
+    }
+
+    albumLoudness, ok := IntegratedLoudness(histogram)
+    if !ok {
+        _, err := db.Exec("UPDATE albums SET loudness = NULL, peak = ? WHERE id_album = ?", albumPeak, idAlbum)
+        return err
+    }
+    if _, err := db.Exec("UPDATE albums SET loudness = ?, peak = ? WHERE id_album = ?", albumLoudness, albumPeak, idAlbum); err != nil {
+        return err
+    }
+
+    if !writeTags {
+        return nil
+    }
+    for _, track := range tracks {
+        if !track.loudness.Valid {
+            continue
+        }
+        err := WriteReplayGainTags(track.path, ReplayGain(track.loudness.Float64), track.peak, ReplayGain(albumLoudness), albumPeak)
+        if err != nil {
+            log.Printf("Error al escribir ReplayGain en %s: %v\n", track.path, err)
+        }
+    }
+    return nil
+}
+
+// WriteReplayGainTags escribe (o reemplaza) las tramas TXXX REPLAYGAIN_* de un MP3 con las ganancias en dB y los
+// picos lineales de la pista y del álbum, en el formato que usan foobar2000 y rsgain.
+func WriteReplayGainTags(filePath string, trackGain, trackPeak, albumGain, albumPeak float64) error {
+    file, err := os.Open(filePath)
+    if err != nil {
+        return fmt.Errorf("error al abrir el archivo: %v", err)
+    }
+    tag, err := readID3Tag(file)
+    file.Close()
+    if err != nil {
+        return err
+    }
+
+    tag.SetUserText("REPLAYGAIN_TRACK_GAIN", fmt.Sprintf("%.2f dB", trackGain))
+    tag.SetUserText("REPLAYGAIN_TRACK_PEAK", fmt.Sprintf("%.6f", trackPeak))
+    tag.SetUserText("REPLAYGAIN_ALBUM_GAIN", fmt.Sprintf("%.2f dB", albumGain))
+    tag.SetUserText("REPLAYGAIN_ALBUM_PEAK", fmt.Sprintf("%.6f", albumPeak))
+    return writeID3Tag(filePath, tag, false)
+}
@@ -0,0 +1,417 @@
+package model
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Versiones MPEG tal como aparecen en los bits 19-20 del encabezado de una trama.
+const (
+    mpegVersion25 = 0
+    mpegVersion2  = 2
+    mpegVersion1  = 3
+)
+
+// maxFrameSize es mayor que la trama MPEG de audio más grande posible, de modo que cabe en el búfer del lector.
+const maxFrameSize = 8192
+
+// bitrateTables contiene las tasas de bits en kbps indexadas por [MPEG-1 o MPEG-2/2.5][capa - 1][índice].
+var bitrateTables = [2][3][16]int{
+    { // MPEG-1
+        {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // Capa I
+        {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // Capa II
+        {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // Capa III
+    },
+    { // MPEG-2 y MPEG-2.5
+        {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0}, // Capa I
+        {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Capa II
+        {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Capa III
+    },
+}
+
+// sampleRateTable contiene las frecuencias de muestreo indexadas por [versión][índice].
+var sampleRateTable = map[int][3]int{
+    mpegVersion1:  {44100, 48000, 32000},
+    mpegVersion2:  {22050, 24000, 16000},
+    mpegVersion25: {11025, 12000, 8000},
+}
+
+// channelModeNames son los nombres de los modos de canal, indexados por los bits 6-7 del cuarto byte.
+var channelModeNames = [4]string{"Estéreo", "Joint stereo", "Dual channel", "Mono"}
+
+// MP3FrameHeader representa los campos del encabezado de 4 bytes de una trama MPEG de audio.
+type MP3FrameHeader struct {
+    Version     int  // Versión MPEG (mpegVersion1, mpegVersion2 o mpegVersion25).
+    Layer       int  // Capa (1, 2 o 3).
+    Protected   bool // Indica si la trama lleva un CRC de 16 bits después del encabezado.
+    Bitrate     int  // Tasa de bits en kbps.
+    SampleRate  int  // Frecuencia de muestreo en Hz.
+    Padding     bool // Indica si la trama tiene un byte (o palabra, en capa I) de relleno.
+    ChannelMode int  // Modo de canal (0 estéreo, 1 joint stereo, 2 dual channel, 3 mono).
+    ModeExt     int  // Extensión de modo (usada en joint stereo).
+}
+
+// ParseMP3FrameHeader interpreta los primeros 4 bytes de b como el encabezado de una trama.
+// Regresa un error si no hay palabra de sincronía o si algún campo tiene un valor reservado.
+func ParseMP3FrameHeader(b []byte) (MP3FrameHeader, error) {
+    var h MP3FrameHeader
+    if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+        return h, fmt.Errorf("no hay palabra de sincronía")
+    }
+
+    h.Version = int(b[1]>>3) & 0x03
+    if h.Version == 1 {
+        return h, fmt.Errorf("versión MPEG reservada")
+    }
+    h.Layer = 4 - int(b[1]>>1)&0x03
+    if h.Layer == 4 {
+        return h, fmt.Errorf("capa reservada")
+    }
+    h.Protected = b[1]&0x01 == 0
+
+    bitrateIndex := int(b[2] >> 4)
+    table := 0
+    if h.Version != mpegVersion1 {
+        table = 1
+    }
+    h.Bitrate = bitrateTables[table][h.Layer-1][bitrateIndex]
+    if h.Bitrate == 0 {
+        return h, fmt.Errorf("tasa de bits libre o inválida")
+    }
+
+    sampleRateIndex := int(b[2]>>2) & 0x03
+    if sampleRateIndex == 3 {
+        return h, fmt.Errorf("frecuencia de muestreo reservada")
+    }
+    h.SampleRate = sampleRateTable[h.Version][sampleRateIndex]
+
+    h.Padding = b[2]&0x02 != 0
+    h.ChannelMode = int(b[3] >> 6)
+    h.ModeExt = int(b[3]>>4) & 0x03
+    return h, nil
+}
+
+// SamplesPerFrame regresa el número de muestras (por canal) que contiene la trama.
+func (h MP3FrameHeader) SamplesPerFrame() int {
+    switch {
+    case h.Layer == 1:
+        return 384
+    case h.Layer == 3 && h.Version != mpegVersion1:
+        return 576
+    default:
+        return 1152
+    }
+}
+
+// FrameLength regresa el tamaño total de la trama en bytes, incluyendo el encabezado.
+func (h MP3FrameHeader) FrameLength() int {
+    if h.Layer == 1 {
+        length := 12 * h.Bitrate * 1000 / h.SampleRate
+        if h.Padding {
+            length++
+        }
+        return length * 4
+    }
+    length := h.SamplesPerFrame() / 8 * h.Bitrate * 1000 / h.SampleRate
+    if h.Padding {
+        length++
+    }
+    return length
+}
+
+// Channels regresa el número de canales de la trama.
+func (h MP3FrameHeader) Channels() int {
+    if h.ChannelMode == 3 {
+        return 1
+    }
+    return 2
+}
+
+// SideInfoSize regresa el tamaño de la información lateral de una trama de capa III.
+func (h MP3FrameHeader) SideInfoSize() int {
+    if h.Version == mpegVersion1 {
+        if h.Channels() == 1 {
+            return 17
+        }
+        return 32
+    }
+    if h.Channels() == 1 {
+        return 9
+    }
+    return 17
+}
+
+// mp3FrameReader recorre las tramas consecutivas de un flujo MPEG, resincronizando cuando encuentra basura.
+type mp3FrameReader struct {
+    r        *bufio.Reader
+    offset   int64 // Posición actual dentro del flujo de audio.
+    frames   int   // Tramas completas o parciales leídas.
+    skipped  int64 // Bytes que no pertenecen a ninguna trama ni a ninguna etiqueta.
+    padding  int64 // Bytes en cero antes de la primera trama (relleno de la etiqueta ID3v2).
+    tagBytes int64 // Bytes de etiquetas ID3v1 y APE encontradas entre o después de las tramas.
+    junkRun  int64 // Bytes de basura consecutivos desde la última trama o etiqueta.
+    synced   bool  // Indica si la trama anterior terminó justo donde empezó la actual.
+}
+
+// newMP3FrameReader crea un lector de tramas a partir del inicio del audio (después de la etiqueta ID3v2).
+func newMP3FrameReader(r io.Reader) *mp3FrameReader {
+    return &mp3FrameReader{r: bufio.NewReaderSize(r, 2*maxFrameSize)}
+}
+
+// next regresa el encabezado y los bytes de la siguiente trama.
+// Si el flujo termina a la mitad de una trama regresa la parte leída junto con io.ErrUnexpectedEOF.
+func (fr *mp3FrameReader) next() (MP3FrameHeader, []byte, error) {
+    for {
+        peek, err := fr.r.Peek(4)
+        if len(peek) < 4 {
+            if err == nil {
+                err = io.EOF
+            }
+            fr.skipped += int64(len(peek))
+            return MP3FrameHeader{}, nil, err
+        }
+
+        header, err := ParseMP3FrameHeader(peek)
+        if err == nil && (fr.synced || fr.nextHeaderValid(header)) {
+            frame, err := fr.r.Peek(header.FrameLength())
+            frame = append([]byte(nil), frame...)
+            fr.r.Discard(len(frame))
+            fr.offset += int64(len(frame))
+            fr.frames++
+            fr.junkRun = 0
+            if err == io.EOF {
+                return header, frame, io.ErrUnexpectedEOF
+            }
+            fr.synced = true
+            return header, frame, err
+        }
+
+        if fr.skipTag() {
+            continue
+        }
+
+        // No hay una trama válida en esta posición: se avanza un byte y se busca la siguiente.
+        if fr.frames == 0 && peek[0] == 0 {
+            fr.padding++
+        } else {
+            fr.skipped++
+            fr.junkRun++
+        }
+        fr.r.Discard(1)
+        fr.offset++
+        fr.synced = false
+    }
+}
+
+// skipTag omite una etiqueta ID3v1 o APE que empiece en la posición actual.
+// Como el pie de una etiqueta APE está al final, sus campos se leen antes como basura y aquí se reclasifican.
+func (fr *mp3FrameReader) skipTag() bool {
+    peek, _ := fr.r.Peek(32)
+    switch {
+    case bytes.HasPrefix(peek, []byte("TAG")):
+        n, _ := fr.r.Discard(128)
+        fr.offset += int64(n)
+        fr.tagBytes += int64(n)
+    case bytes.HasPrefix(peek, []byte("APETAGEX")) && len(peek) == 32:
+        size := int64(binary.LittleEndian.Uint32(peek[12:16])) // Campos más pie, sin contar el encabezado.
+        flags := binary.LittleEndian.Uint32(peek[20:24])
+        if flags&(1<<29) != 0 {
+            // Es el encabezado: la etiqueta completa está por delante.
+            n, _ := fr.r.Discard(int(32 + size))
+            fr.offset += int64(n)
+            fr.tagBytes += int64(n)
+        } else {
+            // Es el pie: los campos ya se contaron como basura.
+            items := size - 32
+            if items > fr.junkRun {
+                items = fr.junkRun
+            }
+            fr.skipped -= items
+            fr.tagBytes += items
+            n, _ := fr.r.Discard(32)
+            fr.offset += int64(n)
+            fr.tagBytes += int64(n)
+        }
+    default:
+        return false
+    }
+    fr.junkRun = 0
+    fr.synced = false
+    return true
+}
+
+// nextHeaderValid confirma una palabra de sincronía encontrada después de basura comprobando que
+// en la posición donde termina la trama empieza otra (o termina el flujo).
+func (fr *mp3FrameReader) nextHeaderValid(header MP3FrameHeader) bool {
+    length := header.FrameLength()
+    peek, _ := fr.r.Peek(length + 4)
+    if len(peek) <= length {
+        return len(peek) == length
+    }
+    if len(peek) < length+4 {
+        return false
+    }
+    _, err := ParseMP3FrameHeader(peek[length:])
+    return err == nil
+}
+
+// AudioProperties contiene la información técnica de un archivo de audio.
+type AudioProperties struct {
+    Duration    float64 // Duración en segundos.
+    Bitrate     int     // Tasa de bits promedio en kbps.
+    SampleRate  int     // Frecuencia de muestreo en Hz.
+    ChannelMode string  // Modo de canal (Estéreo, Joint stereo, Dual channel o Mono).
+    Encoder     string  // Codificador indicado en la etiqueta LAME o VBRI, si existe.
+    VBR         bool    // Indica si el archivo tiene tasa de bits variable.
+}
+
+// ReadMP3Properties calcula la duración, tasa de bits, frecuencia de muestreo, modo de canal y codificador
+// de un archivo MP3. Si la primera trama contiene un encabezado Xing/Info o VBRI se usan sus totales;
+// en otro caso se recorren todas las tramas del archivo.
+func ReadMP3Properties(r io.ReadSeeker) (*AudioProperties, error) {
+    start, err := audioStart(r)
+    if err != nil {
+        return nil, err
+    }
+    size, err := r.Seek(0, io.SeekEnd)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := r.Seek(start, io.SeekStart); err != nil {
+        return nil, err
+    }
+
+    fr := newMP3FrameReader(r)
+    first, frame, err := fr.next()
+    if err != nil {
+        return nil, fmt.Errorf("no se encontró ninguna trama MPEG: %v", err)
+    }
+
+    props := &AudioProperties{
+        SampleRate:  first.SampleRate,
+        ChannelMode: channelModeNames[first.ChannelMode],
+    }
+    samplesPerFrame := float64(first.SamplesPerFrame())
+
+    // Encabezado de tasa de bits variable escrito por el codificador en la primera trama.
+    if vbr := parseVBRHeader(first, frame); vbr != nil && vbr.frames > 0 {
+        props.Duration = float64(vbr.frames) * samplesPerFrame / float64(first.SampleRate)
+        audioBytes := vbr.bytes
+        if audioBytes == 0 {
+            audioBytes = size - start - int64(len(frame))
+        }
+        props.Bitrate = int(float64(audioBytes) * 8 / props.Duration / 1000)
+        props.VBR = vbr.vbr
+        props.Encoder = vbr.encoder
+        return props, nil
+    }
+
+    // Sin encabezado VBR: se cuentan todas las tramas y se suman sus tasas de bits.
+    frames, bitrateSum := 1, first.Bitrate
+    for {
+        header, _, err := fr.next()
+        if err != nil {
+            break
+        }
+        frames++
+        bitrateSum += header.Bitrate
+        if header.Bitrate != first.Bitrate {
+            props.VBR = true
+        }
+    }
+    props.Duration = float64(frames) * samplesPerFrame / float64(first.SampleRate)
+    props.Bitrate = bitrateSum / frames
+    return props, nil
+}
+
+// audioStart regresa la posición donde empieza el audio, omitiendo la etiqueta ID3v2 si existe.
+func audioStart(r io.ReadSeeker) (int64, error) {
+    if _, err := r.Seek(0, io.SeekStart); err != nil {
+        return 0, err
+    }
+    header := make([]byte, 10)
+    if _, err := io.ReadFull(r, header); err != nil {
+        return 0, nil
+    }
+    if bytes.HasPrefix(header, []byte("ID3")) {
+        return id3v2TagSize(header), nil
+    }
+    return 0, nil
+}
+
+// vbrHeader contiene los datos de un encabezado Xing/Info o VBRI.
+type vbrHeader struct {
+    frames  int64  // Número de tramas de audio.
+    bytes   int64  // Número de bytes de audio.
+    vbr     bool   // "Xing" y "VBRI" indican VBR; "Info" indica CBR.
+    encoder string // Versión del codificador (e.g., LAME3.100).
+}
+
+// parseVBRHeader busca un encabezado Xing/Info (después de la información lateral) o VBRI
+// (32 bytes después del encabezado) dentro de la primera trama.
+func parseVBRHeader(h MP3FrameHeader, frame []byte) *vbrHeader {
+    if h.Layer != 3 {
+        return nil
+    }
+
+    offset := 4 + h.SideInfoSize()
+    if h.Protected {
+        offset += 2
+    }
+    for _, xingOffset := range []int{offset, 4 + h.SideInfoSize()} {
+        if xingOffset+8 > len(frame) {
+            continue
+        }
+        id := string(frame[xingOffset : xingOffset+4])
+        if id != "Xing" && id != "Info" {
+            continue
+        }
+        vbr := &vbrHeader{vbr: id == "Xing"}
+        flags := binary.BigEndian.Uint32(frame[xingOffset+4:])
+        pos := xingOffset + 8
+        if flags&0x01 != 0 && pos+4 <= len(frame) {
+            vbr.frames = int64(binary.BigEndian.Uint32(frame[pos:]))
+            pos += 4
+        }
+        if flags&0x02 != 0 && pos+4 <= len(frame) {
+            vbr.bytes = int64(binary.BigEndian.Uint32(frame[pos:]))
+            pos += 4
+        }
+        if flags&0x04 != 0 {
+            pos += 100 // Tabla de búsqueda (TOC).
+        }
+        if flags&0x08 != 0 {
+            pos += 4 // Indicador de calidad.
+        }
+        if pos+9 <= len(frame) {
+            vbr.encoder = printableString(frame[pos : pos+9])
+        }
+        return vbr
+    }
+
+    // El encabezado VBRI de Fraunhofer siempre está 32 bytes después del encabezado de la trama.
+    if len(frame) >= 4+32+18 && string(frame[36:40]) == "VBRI" {
+        return &vbrHeader{
+            bytes:   int64(binary.BigEndian.Uint32(frame[46:])),
+            frames:  int64(binary.BigEndian.Uint32(frame[50:])),
+            vbr:     true,
+            encoder: "Fraunhofer",
+        }
+    }
+    return nil
+}
+
+// printableString conserva únicamente los caracteres ASCII imprimibles de b.
+func printableString(b []byte) string {
+    var sb strings.Builder
+    for _, c := range b {
+        if c >= 0x20 && c < 0x7f {
+            sb.WriteByte(c)
+        }
+    }
+    return strings.TrimSpace(sb.String())
+}
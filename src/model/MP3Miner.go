@@ -5,46 +5,31 @@ import (
     "log"
     "os"
     "path/filepath"
-    "time"
+    "strconv"
+    "strings"
     "database/sql"
     _ "github.com/mattn/go-sqlite3" // Importa el driver SQLite
-    "github.com/dhowden/tag"        // Para leer metadatos ID3 de archivos MP3
+    "github.com/dhowden/tag"        // Para leer metadatos de archivos MP3, FLAC, Ogg y MP4
     "fyne.io/fyne/v2/widget"        // Para manejar la barra de progreso
 )
 
-// MP3Miner es responsable de extraer metadatos de archivos MP3 y almacenarlos en la base de datos.
+// MP3Miner es responsable de extraer metadatos de archivos de audio (MP3, FLAC, Ogg, M4A) y almacenarlos en la base de datos.
 type MP3Miner struct {
-    FileCount int // Contador de archivos MP3 procesados.
+    FileCount           int             // Contador de archivos de audio procesados.
+    CoverDir            string          // Directorio de la caché de portadas. Si está vacío no se extraen portadas.
+    CheckIntegrity      bool            // Indica si al minar se revisan todas las tramas de cada MP3 en busca de daños.
+    ComputeFingerprints bool            // Indica si al minar se calcula la huella acústica de cada MP3.
+    WriteReplayGain     bool            // Indica si el análisis de sonoridad escribe las tramas REPLAYGAIN_* en los archivos.
+    PathTemplates       []*PathTemplate // Plantillas de rutas para deducir los datos que faltan en las etiquetas.
+    MusicDir            string          // Directorio que se está minando; las plantillas se comparan con las rutas relativas a él.
 }
 
-// findDatabaseFile busca el archivo de base de datos en un directorio especificado.
-func findDatabaseFile(dbDir string) (string, error) {
-    var dbFile string
-    // Recorre el directorio y busca un archivo con extensión .db
-    err := filepath.Walk(dbDir, func(path string, info os.FileInfo, err error) error {
-        if err != nil {
-            return err
-        }
-        if !info.IsDir() && filepath.Ext(path) == ".db" {
-            dbFile = path
-            return filepath.SkipDir // Detiene la búsqueda una vez que se encuentra el archivo.
-        }
-        return nil
-    })
-
-    if dbFile == "" {
-        return "", fmt.Errorf("no se encontró un archivo de base de datos en %s", dbDir)
-    }
-
-    return dbFile, err
-}
-
-// GetTotalFiles cuenta el número de archivos MP3 en un directorio y sus subdirectorios.
+// GetTotalFiles cuenta el número de archivos de audio soportados en un directorio y sus subdirectorios.
 func (m *MP3Miner) GetTotalFiles(path string) int {
     fileCount := 0
-    // Recorre el directorio y cuenta archivos con extensión .mp3
+    // Recorre el directorio y cuenta archivos con alguna extensión de audio soportada.
     filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-        if err == nil && filepath.Ext(filePath) == ".mp3" {
+        if err == nil && !info.IsDir() && IsSupportedAudioFile(filePath) {
             fileCount++
         }
         return nil
@@ -52,30 +37,20 @@ func (m *MP3Miner) GetTotalFiles(path string) int {
     return fileCount
 }
 
-// MineDirectoryWithProgress procesa los archivos MP3 en un directorio, actualizando una barra de progreso.
-func (m *MP3Miner) MineDirectoryWithProgress(path string, dbDir string, progressBar *widget.ProgressBar, totalFiles int) {
-    // Encuentra el archivo de base de datos en el directorio especificado.
-    dbPath, err := findDatabaseFile(dbDir)
-    if err != nil {
-        log.Fatalf("Error al encontrar el archivo de base de datos: %v\n", err)
-    }
-
-    // Abre la conexión a la base de datos.
-    db, err := sql.Open("sqlite3", dbPath)
-    if err != nil {
-        log.Fatalf("Error al abrir la base de datos: %v\n", err)
-    }
-    defer db.Close()
-
+// MineDirectoryWithProgress procesa los archivos de audio en un directorio, actualizando una barra de progreso.
+// Las canciones se guardan en repo; con un SQLiteRepository la interfaz puede seguir leyendo la base de datos
+// mientras se mina, porque ambos usan el mismo pool de conexiones.
+func (m *MP3Miner) MineDirectoryWithProgress(path string, repo Repository, progressBar *widget.ProgressBar, totalFiles int) {
+    m.MusicDir = path
     currentFile := 0
-    // Recorre el directorio y procesa cada archivo MP3.
-    err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+    // Recorre el directorio y procesa cada archivo de audio.
+    err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
         if err != nil {
             return err
         }
-        if filepath.Ext(filePath) == ".mp3" {
+        if !info.IsDir() && IsSupportedAudioFile(filePath) {
             fmt.Printf("Analizando archivo: %s\n", filePath)
-            ExtractMetadata(filePath, db)
+            m.ExtractMetadata(filePath, repo)
 
             // Actualiza la barra de progreso.
             currentFile++
@@ -87,11 +62,20 @@ func (m *MP3Miner) MineDirectoryWithProgress(path string, dbDir string, progress
     if err != nil {
         log.Fatalf("Error al recorrer el directorio: %v\n", err)
     }
+
+    // Elimina los álbumes y los intérpretes que se quedaron sin canciones.
+    albums, performers, err := repo.CollectGarbage()
+    if err != nil {
+        log.Printf("Error al eliminar los álbumes y los intérpretes sin canciones: %v\n", err)
+    } else if albums > 0 || performers > 0 {
+        fmt.Printf("Se eliminaron %d álbumes y %d intérpretes sin canciones\n", albums, performers)
+    }
 }
 
-// ExtractMetadata extrae metadatos de un archivo MP3 y los inserta en la base de datos.
-func ExtractMetadata(filePath string, db *sql.DB) {
-    // Abre el archivo MP3.
+// ExtractMetadata extrae metadatos de un archivo de audio y los guarda en repo,
+// junto con la portada del álbum cuando el archivo la tiene.
+func (m *MP3Miner) ExtractMetadata(filePath string, repo Repository) {
+    // Abre el archivo de audio.
     file, err := os.Open(filePath)
     if err != nil {
         log.Printf("Error al abrir el archivo: %s\n", err)
@@ -99,110 +83,236 @@ func ExtractMetadata(filePath string, db *sql.DB) {
     }
     defer file.Close()
 
-    // Lee los metadatos ID3 del archivo.
+    // Identifica el contenedor y el códec a partir de los primeros bytes del archivo.
+    format, err := DetectAudioFormat(file, filePath)
+    if err != nil {
+        log.Printf("Error al detectar el formato: %s\n", err)
+        return
+    }
+
+    // Lee los metadatos (ID3, Vorbis comments o átomos MP4) del archivo.
+    // Los archivos sin etiquetas también se minan; sus datos se toman del nombre del archivo y de su directorio.
     metadata, err := tag.ReadFrom(file)
+    if err == tag.ErrNoTagsFound {
+        metadata, err = noMetadata{}, nil
+    }
     if err != nil {
         log.Printf("Error al leer los metadatos: %s\n", err)
         return
     }
 
-    currentYear := time.Now().Year()
+    // Calcula duración, tasa de bits y demás propiedades técnicas a partir de las tramas MP3.
+    var props *AudioProperties
+    if format.Codec == "MP3" {
+        props, err = ReadMP3Properties(file)
+        if err != nil {
+            log.Printf("Error al leer las propiedades de audio de %s: %s\n", filePath, err)
+        } else if props.Encoder == "" {
+            props.Encoder = rawTagString(metadata, "TSSE", "TSS")
+        }
+    }
 
-    // Obtiene los metadatos o asigna valores por defecto si faltan.
-    title := metadata.Title()
-    if title == "" {
-        title = "Unknown"
+    // Los datos que faltan en las etiquetas se deducen de la ruta del archivo (con las plantillas de rutas, el nombre
+    // del archivo o su directorio); si no, se guardan como NULL en lugar de inventar un valor. El origen de cada dato
+    // se registra en field_sources.
+    sources := map[string]string{}
+    fromPath := InferPathFields(filePath, m.MusicDir, m.PathTemplates)
+
+    title := tagOrPath(sources, FieldTitle, metadata.Title(), fromPath)
+    artist := tagOrPath(sources, FieldArtist, metadata.Artist(), fromPath)
+    album := tagOrPath(sources, FieldAlbum, metadata.Album(), fromPath)
+    // El género se lee de la trama sin procesar para conservar sus referencias numéricas y sus valores múltiples.
+    genreText := rawTagString(metadata, "TCON", "TCO")
+    if genreText == "" {
+        genreText = metadata.Genre()
     }
+    genre := tagOrPath(sources, FieldGenre, genreText, fromPath)
+    year, _ := strconv.Atoi(tagOrPath(sources, FieldYear, nonZeroText(metadata.Year()), fromPath))
+
+    // Sin número de pista se guarda NULL en lugar de inventar la pista 1; la rola queda al final del álbum.
+    trackNum, _ := metadata.Track()
+    trackNum, _ = strconv.Atoi(tagOrPath(sources, FieldTrack, nonZeroText(trackNum), fromPath))
 
-    artist := metadata.Artist()
-    if artist == "" {
-        artist = "Unknown"
+    // Verifica si la canción ya existe en la base de datos.
+    exists, err := repo.SongExists(filePath)
+    if err != nil {
+        log.Printf("Error al verificar si la canción existe: %v\n", err)
+    }
+    if exists {
+        fmt.Printf("La canción ya existe en la base de datos, omitiendo: %s\n", filePath)
+        return
     }
 
-    album := metadata.Album()
-    if album == "" {
-        album = filepath.Base(filepath.Dir(filePath)) // Usa el nombre del directorio como álbum.
+    // El género se normaliza: se decodifican las referencias de ID3v1, se cambian los alias por su género y se
+    // separan los géneros múltiples. Si falla se guarda tal como está.
+    genres, err := repo.NormalizeGenres(genre)
+    if err != nil {
+        log.Printf("Error al normalizar el género de %s: %v\n", filePath, err)
+    } else {
+        genre = strings.Join(genres, GenreSeparator)
     }
 
-    year := metadata.Year()
-    if year == 0 {
-        year = currentYear
+    // Un nombre que se unió con otro intérprete (ver Repository.MergePerformers) se cambia por el de ese intérprete.
+    if canonical, err := repo.CanonicalPerformer(artist); err != nil {
+        log.Printf("Error al buscar el intérprete de %s: %v\n", filePath, err)
+    } else {
+        artist = canonical
     }
 
-    genre := metadata.Genre()
-    if genre == "" {
-        genre = "Unknown"
+    // El tempo y la tonalidad que falten en las etiquetas se estiman después con el análisis de tempo y tonalidad.
+    song := MinedSong{
+        Path:       filePath,
+        Title:      title,
+        Artist:     artist,
+        Album:      album,
+        AlbumPath:  filepath.Dir(filePath),
+        Year:       year,
+        Track:      trackNum,
+        Genre:      genre,
+        Genres:     genres,
+        Format:     format,
+        Properties: props,
+        Sources:    sources,
+        BPM:        parseBPM(rawTagString(metadata, "TBPM", "TBP", "bpm", "tmpo")),
+        Key:        NormalizeKey(rawTagString(metadata, "TKEY", "TKE", "initialkey", "key")),
+        tags:       readExtendedTags(metadata),
+        cover:      func() *coverImage { return findCoverArt(metadata, filePath) },
+        coverDir:   m.CoverDir,
     }
 
-    trackNum, _ := metadata.Track()
-    if trackNum == 0 {
-        trackNum = 1
+    // En modo de verificación de integridad se revisan todas las tramas del archivo.
+    if m.CheckIntegrity && format.Codec == "MP3" {
+        song.Health = CheckMP3Integrity(file)
     }
 
-    // Verifica si la canción ya existe en la base de datos.
-    if songExists(db, filePath) {
-        fmt.Printf("La canción ya existe en la base de datos, omitiendo: %s\n", filePath)
-        return
+    // La huella acústica requiere decodificar el audio, por lo que también es opcional.
+    if m.ComputeFingerprints && format.Codec == "MP3" {
+        song.Fingerprint, song.Fingerprinted = computeRolaFingerprint(filePath, file), true
     }
 
-    // Inserta los datos en la base de datos.
-    insertAlbum(db, album, year, filepath.Dir(filePath))
-    insertPerformer(db, artist)
-    insertRola(db, artist, album, filePath, title, trackNum, year, genre)
+    if err := repo.AddSong(song); err != nil {
+        log.Printf("Error al guardar la rola %s: %v\n", filePath, err)
+    }
 }
 
-// songExists verifica si una canción ya existe en la base de datos.
-func songExists(db *sql.DB, filePath string) bool {
-    var exists bool
-    query := `SELECT EXISTS(SELECT 1 FROM rolas WHERE path = ? LIMIT 1);`
-    err := db.QueryRow(query, filePath).Scan(&exists)
-    if err != nil {
-        log.Printf("Error al verificar si la canción existe: %v\n", err)
-        return false
+// tagOrPath regresa el valor de la etiqueta o, si está vacío, el que se dedujo de la ruta del archivo, y registra
+// el origen del valor en sources. Regresa una cadena vacía si no hay ninguno.
+func tagOrPath(sources map[string]string, field, tagValue string, fromPath map[string]PathField) string {
+    if tagValue = strings.TrimSpace(tagValue); tagValue != "" {
+        sources[field] = SourceTag
+        return tagValue
+    }
+    if inferred, ok := fromPath[field]; ok {
+        sources[field] = inferred.Source
+        return inferred.Value
     }
-    return exists
+    return ""
 }
 
-// insertAlbum inserta un álbum en la base de datos si no existe.
-func insertAlbum(db *sql.DB, name string, year int, path string) {
-    _, err := db.Exec("INSERT OR IGNORE INTO albums (name, year, path) VALUES (?, ?, ?)", name, year, path)
+// nonZeroText convierte un número a texto, o a una cadena vacía si es 0.
+func nonZeroText(value int) string {
+    if value == 0 {
+        return ""
+    }
+    return strconv.Itoa(value)
+}
+
+// insertAlbum inserta un álbum en la base de datos si no existe (el nombre y el directorio de los álbumes son únicos).
+// Sin año se guarda NULL.
+func insertAlbum(tx *sql.Tx, name string, year int, path string) error {
+    _, err := tx.Exec("INSERT OR IGNORE INTO albums (name, year, path) VALUES (?, ?, ?)", name, nullableInt(year), path)
     if err != nil {
-        log.Printf("Error al insertar el álbum: %v\n", err)
+        return fmt.Errorf("error al insertar el álbum: %v", err)
     }
+    return nil
 }
 
-// insertPerformer inserta un intérprete en la base de datos si no existe.
-func insertPerformer(db *sql.DB, name string) {
-    _, err := db.Exec("INSERT OR IGNORE INTO performers (name, id_type) VALUES (?, ?)", name, 2)
+// insertPerformer inserta un intérprete en la base de datos si no existe (el nombre de los intérpretes es único).
+func insertPerformer(tx *sql.Tx, name string) error {
+    _, err := tx.Exec("INSERT OR IGNORE INTO performers (name, id_type) VALUES (?, ?)", name, 2)
     if err != nil {
-        log.Printf("Error al insertar el intérprete: %v\n", err)
+        return fmt.Errorf("error al insertar el intérprete: %v", err)
     }
+    return nil
 }
 
-// insertRola inserta una canción en la base de datos, asociándola con su intérprete y álbum.
-func insertRola(db *sql.DB, artist, album, filePath, title string, trackNum, year int, genre string) {
-    var id_performer int
+// insertRola inserta una canción en la base de datos, asociándola con su intérprete y con el álbum con el nombre y el
+// directorio indicados. Los datos vacíos (título, intérprete, año, género y pista) se guardan como NULL.
+func insertRola(tx *sql.Tx, artist, album, albumPath, filePath, title string, trackNum, year int, genre string, format *AudioFormat, props *AudioProperties) error {
+    var id_performer interface{}
     var id_album int
 
-    // Obtiene el ID del intérprete.
-    err := db.QueryRow("SELECT id_performer FROM performers WHERE name = ?", artist).Scan(&id_performer)
-    if err != nil {
-        log.Printf("Error al obtener el ID del intérprete: %v\n", err)
-        return
+    // Obtiene el ID del intérprete, si la rola tiene uno.
+    if artist != "" {
+        var id int
+        if err := tx.QueryRow("SELECT id_performer FROM performers WHERE name = ?", artist).Scan(&id); err != nil {
+            return fmt.Errorf("error al obtener el ID del intérprete: %v", err)
+        }
+        id_performer = id
     }
 
     // Obtiene el ID del álbum.
-    err = db.QueryRow("SELECT id_album FROM albums WHERE name = ?", album).Scan(&id_album)
+    err := tx.QueryRow("SELECT id_album FROM albums WHERE name = ? AND path = ?", album, albumPath).Scan(&id_album)
     if err != nil {
-        log.Printf("Error al obtener el ID del álbum: %v\n", err)
-        return
+        return fmt.Errorf("error al obtener el ID del álbum: %v", err)
+    }
+
+    // Las propiedades de audio se guardan como NULL cuando no se pudieron calcular.
+    var duration, bitrate, sampleRate, channelMode, encoder, vbr interface{}
+    if props != nil {
+        duration, bitrate, sampleRate = props.Duration, props.Bitrate, props.SampleRate
+        channelMode, encoder, vbr = props.ChannelMode, props.Encoder, props.VBR
     }
 
     // Inserta la canción (rola) en la base de datos.
-    _, err = db.Exec("INSERT INTO rolas (id_performer, id_album, path, title, track, year, genre) VALUES (?, ?, ?, ?, ?, ?, ?)",
-        id_performer, id_album, filePath, title, trackNum, year, genre)
+    _, err = tx.Exec("INSERT INTO rolas (id_performer, id_album, path, title, track, year, genre, container, codec, duration, bitrate, sample_rate, channel_mode, encoder, vbr) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+        id_performer, id_album, filePath, nullableString(title), nullableInt(trackNum), nullableInt(year), nullableString(genre), format.Container, format.Codec,
+        duration, bitrate, sampleRate, channelMode, encoder, vbr)
     if err != nil {
-        log.Printf("Error al insertar la rola: %v\n", err)
+        return fmt.Errorf("error al insertar la rola: %v", err)
     }
+    return nil
 }
 
+
+// rawTagString busca el primer marco de texto con alguno de los nombres dados entre los marcos sin procesar.
+// También acepta los átomos numéricos y los átomos personalizados ("----") de MP4.
+func rawTagString(metadata tag.Metadata, names ...string) string {
+    raw := metadata.Raw()
+    for _, name := range names {
+        switch value := raw[name].(type) {
+        case string:
+            if value != "" {
+                return value
+            }
+        case int:
+            if value != 0 {
+                return strconv.Itoa(value)
+            }
+        case []string:
+            if len(value) > 0 && value[0] != "" {
+                return value[0]
+            }
+        }
+    }
+    return ""
+}
+
+// noMetadata representa los metadatos vacíos de un archivo que no tiene etiquetas.
+type noMetadata struct{}
+
+func (noMetadata) Format() tag.Format          { return tag.UnknownFormat }
+func (noMetadata) FileType() tag.FileType      { return tag.UnknownFileType }
+func (noMetadata) Title() string               { return "" }
+func (noMetadata) Album() string               { return "" }
+func (noMetadata) Artist() string              { return "" }
+func (noMetadata) AlbumArtist() string         { return "" }
+func (noMetadata) Composer() string            { return "" }
+func (noMetadata) Year() int                   { return 0 }
+func (noMetadata) Genre() string               { return "" }
+func (noMetadata) Track() (int, int)           { return 0, 0 }
+func (noMetadata) Disc() (int, int)            { return 0, 0 }
+func (noMetadata) Picture() *tag.Picture       { return nil }
+func (noMetadata) Lyrics() string              { return "" }
+func (noMetadata) Comment() string             { return "" }
+func (noMetadata) Raw() map[string]interface{} { return map[string]interface{}{} }
@@ -0,0 +1,163 @@
+package model
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "testing"
+
+    "fyne.io/fyne/v2/test"
+    "fyne.io/fyne/v2/widget"
+)
+
+// testSong es una canción de prueba: las tramas de texto de su etiqueta ID3v2.3.
+type testSong struct {
+    file   string // Ruta relativa al directorio de prueba.
+    frames map[string]string
+}
+
+// testSongs son las canciones de prueba: dos álbumes, un intérprete escrito de dos formas y un subgénero.
+var testSongs = []testSong{
+    {"Abbey Road/01.mp3", map[string]string{"TIT2": "Come Together", "TPE1": "The Beatles", "TALB": "Abbey Road", "TYER": "1969", "TRCK": "1", "TCON": "Rock"}},
+    {"Abbey Road/02.mp3", map[string]string{"TIT2": "Something", "TPE1": "The Beatles", "TALB": "Abbey Road", "TYER": "1969", "TRCK": "2", "TCON": "Rock"}},
+    {"Abbey Road/03.mp3", map[string]string{"TIT2": "Oh! Darling", "TPE1": "Beatles", "TALB": "Abbey Road", "TYER": "1969", "TRCK": "4", "TCON": "Blues"}},
+    {"Paranoid/01.mp3", map[string]string{"TIT2": "War Pigs", "TPE1": "Black Sabbath", "TALB": "Paranoid", "TYER": "1970", "TRCK": "1", "TCON": "Hard Rock"}},
+    {"Paranoid/02.mp3", map[string]string{"TIT2": "Canción Ñandú", "TPE1": "Black Sabbath", "TALB": "Paranoid", "TRCK": "2", "TCON": "Heavy Metal"}},
+}
+
+// writeTestMP3 escribe un MP3 de prueba: una etiqueta ID3v2.3 con las tramas indicadas seguida de tramas MPEG-1
+// Layer III de silencio a 128 kbps y 44.1 kHz.
+func writeTestMP3(t *testing.T, path string, frames map[string]string) {
+    t.Helper()
+    tag := &id3Tag{Version: 3}
+    ids := make([]string, 0, len(frames))
+    for id := range frames {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    for _, id := range ids {
+        tag.SetText(id, frames[id])
+    }
+    body := tag.encode()
+    data := append(tag.header(len(body)), body...)
+
+    frame := make([]byte, 417) // 144 * 128000 / 44100 bytes, sin relleno.
+    copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+    for i := 0; i < 40; i++ {
+        data = append(data, frame...)
+    }
+
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(path, data, 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// writeTestSongs escribe las canciones de prueba en un directorio temporal y regresa el directorio.
+func writeTestSongs(t *testing.T) string {
+    t.Helper()
+    dir := t.TempDir()
+    for _, song := range testSongs {
+        writeTestMP3(t, filepath.Join(dir, song.file), song.frames)
+    }
+    return dir
+}
+
+// mineTestSongs mina las canciones de prueba en repo y regresa su directorio.
+func mineTestSongs(t *testing.T, repo Repository) string {
+    t.Helper()
+    test.NewApp()
+    dir := writeTestSongs(t)
+    miner := &MP3Miner{}
+    miner.MineDirectoryWithProgress(dir, repo, widget.NewProgressBar(), miner.GetTotalFiles(dir))
+    return dir
+}
+
+func TestMineDirectoryMemoryRepository(t *testing.T) {
+    repo := NewMemoryRepository()
+    dir := mineTestSongs(t, repo)
+
+    songs, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(songs) != len(testSongs) {
+        t.Fatalf("se minaron %d canciones, se esperaban %d", len(songs), len(testSongs))
+    }
+    byPath := map[string]Song{}
+    for _, song := range songs {
+        byPath[song.Path] = song
+    }
+
+    song := byPath[filepath.Join(dir, "Abbey Road/01.mp3")]
+    if song.Title != "Come Together" || song.Artist != "The Beatles" || song.Album != "Abbey Road" ||
+        song.Year != 1969 || song.Track != 1 || song.Genre != "Rock" {
+        t.Errorf("datos de la etiqueta incorrectos: %+v", song)
+    }
+    if song.Codec != "MP3" || song.Bitrate != 128 || song.SampleRate != 44100 {
+        t.Errorf("propiedades de audio incorrectas: %s %d kbps %d Hz", song.Codec, song.Bitrate, song.SampleRate)
+    }
+    if song.Sources[FieldTitle] != SourceTag {
+        t.Errorf("origen del título = %q, se esperaba %q", song.Sources[FieldTitle], SourceTag)
+    }
+
+    // Sin TYER no se inventa el año.
+    if song := byPath[filepath.Join(dir, "Paranoid/02.mp3")]; song.Year != 0 || song.Title != "Canción Ñandú" {
+        t.Errorf("canción sin año: %+v", song)
+    }
+
+    albums, err := repo.Albums()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(albums) != 2 {
+        t.Errorf("se crearon %d álbumes, se esperaban 2", len(albums))
+    }
+
+    // Minar otra vez no duplica las canciones.
+    miner := &MP3Miner{}
+    miner.MineDirectoryWithProgress(dir, repo, widget.NewProgressBar(), miner.GetTotalFiles(dir))
+    if songs, _ := repo.Songs(); len(songs) != len(testSongs) {
+        t.Errorf("al minar otra vez quedaron %d canciones", len(songs))
+    }
+}
+
+func TestMinePerformerAliasMemoryRepository(t *testing.T) {
+    repo := NewMemoryRepository()
+    mineTestSongs(t, repo)
+
+    performers, err := repo.Performers()
+    if err != nil {
+        t.Fatal(err)
+    }
+    var beatles []Performer
+    var into Performer
+    for _, performer := range performers {
+        if performer.Name == "The Beatles" || performer.Name == "Beatles" {
+            beatles = append(beatles, performer)
+        }
+        if performer.Name == "The Beatles" {
+            into = performer
+        }
+    }
+    if len(beatles) != 2 {
+        t.Fatalf("se esperaban dos intérpretes de los Beatles: %+v", performers)
+    }
+    if err := repo.MergePerformers(beatles, into); err != nil {
+        t.Fatal(err)
+    }
+
+    // Una canción nueva con el nombre unido queda con el intérprete canónico.
+    dir := t.TempDir()
+    writeTestMP3(t, filepath.Join(dir, "Let It Be/01.mp3"), map[string]string{"TIT2": "Two of Us", "TPE1": "Beatles", "TALB": "Let It Be"})
+    (&MP3Miner{}).ExtractMetadata(filepath.Join(dir, "Let It Be/01.mp3"), repo)
+    songs, err := repo.Search("c: two of us")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(songs) != 1 || songs[0].Artist != "The Beatles" {
+        t.Errorf("canción con alias: %+v", songs)
+    }
+}
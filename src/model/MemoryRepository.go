@@ -0,0 +1,530 @@
+package model
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// MemoryRepository es un Repository que guarda las canciones, los álbumes y los intérpretes en memoria, para probar
+// el controlador y el minero sin una base de datos. No guarda portadas ni huellas acústicas, no tiene alias de
+// géneros del usuario y la jerarquía de sus géneros se deduce sólo de sus nombres, con los géneros de ID3v1 (ver
+// genreParent), en lugar de guardarse al crear cada género.
+type MemoryRepository struct {
+    mutex      sync.Mutex
+    songs      []memorySong // Canciones en el orden en que se agregaron.
+    albums     []Album      // Álbumes en el orden en que se agregaron.
+    performers []Performer  // Intérpretes en el orden en que se agregaron.
+    nextID     int          // Último ID asignado a una canción, un álbum o un intérprete.
+}
+
+// memorySong es una canción de MemoryRepository junto con los datos que no están en Song.
+type memorySong struct {
+    song    Song
+    idAlbum int
+    lyrics  []Lyrics
+}
+
+// NewMemoryRepository crea un MemoryRepository vacío.
+func NewMemoryRepository() *MemoryRepository {
+    return &MemoryRepository{}
+}
+
+// Songs regresa todas las canciones, excepto las ocultas, en el orden en que se agregaron.
+func (r *MemoryRepository) Songs() ([]Song, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    return r.filterSongs(func(s memorySong) bool { return !s.song.Hidden }), nil
+}
+
+// Song regresa una canción por su ID, aunque esté oculta.
+func (r *MemoryRepository) Song(idRola int) (Song, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for _, s := range r.songs {
+        if s.song.IDRola == idRola {
+            return copySong(s.song), nil
+        }
+    }
+    return Song{}, fmt.Errorf("no existe la canción %d", idRola)
+}
+
+// AlbumSongs regresa las canciones de un álbum, excepto las ocultas, ordenadas por disco y pista.
+func (r *MemoryRepository) AlbumSongs(idAlbum int) ([]Song, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    songs := r.filterSongs(func(s memorySong) bool { return s.idAlbum == idAlbum && !s.song.Hidden })
+    sortByAlbum(songs)
+    return songs, nil
+}
+
+// Albums regresa los álbumes ordenados por nombre.
+func (r *MemoryRepository) Albums() ([]Album, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    albums := append([]Album(nil), r.albums...)
+    sort.SliceStable(albums, func(i, j int) bool { return albums[i].Name < albums[j].Name })
+    return albums, nil
+}
+
+// Performers regresa los intérpretes con sus alias y su número de canciones, ordenados por nombre.
+func (r *MemoryRepository) Performers() ([]Performer, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    performers := append([]Performer(nil), r.performers...)
+    for i := range performers {
+        performers[i].Aliases = append([]string(nil), performers[i].Aliases...)
+        sort.Strings(performers[i].Aliases)
+        for _, s := range r.songs {
+            if s.song.Artist == performers[i].Name {
+                performers[i].Songs++
+            }
+        }
+    }
+    sort.SliceStable(performers, func(i, j int) bool { return performers[i].Name < performers[j].Name })
+    return performers, nil
+}
+
+// SuggestPerformerMerges agrupa los intérpretes cuyos nombres parecen ser el mismo (ver suggestPerformerMerges).
+func (r *MemoryRepository) SuggestPerformerMerges() ([]PerformerCluster, error) {
+    performers, err := r.Performers()
+    if err != nil {
+        return nil, err
+    }
+    return suggestPerformerMerges(performers), nil
+}
+
+// MergePerformers une varios intérpretes en el intérprete into: sus canciones pasan a into y sus nombres y sus alias
+// quedan como alias de into.
+func (r *MemoryRepository) MergePerformers(performers []Performer, into Performer) error {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    target := r.performerIndex(into.ID)
+    if target < 0 {
+        return fmt.Errorf("no existe el intérprete %d", into.ID)
+    }
+    for _, performer := range performers {
+        i := r.performerIndex(performer.ID)
+        if performer.ID == into.ID || i < 0 {
+            continue
+        }
+        merged, name := r.performers[i], r.performers[target].Name
+        for k := range r.songs {
+            if r.songs[k].song.Artist == merged.Name {
+                r.songs[k].song.Artist = name
+            }
+        }
+        aliases := append(r.performers[target].Aliases, merged.Aliases...)
+        if merged.Name != "" && merged.Name != name && !containsString(aliases, merged.Name) {
+            aliases = append(aliases, merged.Name)
+        }
+        r.performers[target].Aliases = aliases
+        r.performers = append(r.performers[:i], r.performers[i+1:]...)
+        if i < target {
+            target--
+        }
+    }
+    return nil
+}
+
+// performerIndex regresa el índice en r.performers del intérprete con el ID indicado, o -1 si no existe.
+func (r *MemoryRepository) performerIndex(id int) int {
+    for i, performer := range r.performers {
+        if performer.ID == id {
+            return i
+        }
+    }
+    return -1
+}
+
+// Search regresa las canciones que cumplen los filtros de una búsqueda, con las mismas reglas que CompileSearch.
+// Como LIKE en SQLite, las comparaciones de texto no distinguen mayúsculas.
+func (r *MemoryRepository) Search(query string) ([]Song, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    filters := parseSearch(query)
+    var matchers []func(memorySong) bool
+    byAlbum := false
+    for _, filter := range filters {
+        matcher, err := r.filterMatcher(filter)
+        if err != nil {
+            return nil, err
+        }
+        matchers = append(matchers, matcher)
+        byAlbum = byAlbum || filter.key == "a"
+    }
+    // Si no se pasan filtros específicos, se busca el texto completo en los campos principales.
+    if len(filters) == 0 {
+        matchers = append(matchers, func(s memorySong) bool {
+            song := s.song
+            return containsFold(song.Title, query) || containsFold(nonZeroText(song.Year), query) ||
+                containsFold(song.Genre, query) || containsFold(nonZeroText(song.Track), query) ||
+                containsFold(song.Artist, query) || containsFold(song.Album, query) || containsFold(song.Codec, query)
+        })
+    }
+
+    songs := r.filterSongs(func(s memorySong) bool {
+        if s.song.Hidden {
+            return false
+        }
+        for _, matches := range matchers {
+            if !matches(s) {
+                return false
+            }
+        }
+        return true
+    })
+    if byAlbum {
+        sortByAlbum(songs)
+    }
+    if len(songs) == 0 {
+        return nil, noResultsError()
+    }
+    return songs, nil
+}
+
+// filterMatcher regresa la función que indica si una canción cumple un filtro de una búsqueda.
+func (r *MemoryRepository) filterMatcher(filter searchFilter) (func(memorySong) bool, error) {
+    value := filter.value
+    switch filter.key {
+    case "p":
+        return func(s memorySong) bool { return containsFold(s.song.Artist, value) }, nil
+    case "a":
+        return func(s memorySong) bool { return containsFold(s.song.Album, value) }, nil
+    case "c":
+        return func(s memorySong) bool { return containsFold(s.song.Title, value) }, nil
+    case "g", "g+":
+        genres := r.searchGenres(value, filter.key == "g+")
+        if len(genres) == 0 {
+            return nil, noResultsError()
+        }
+        return func(s memorySong) bool {
+            for _, genre := range strings.Split(s.song.Genre, GenreSeparator) {
+                if genres[strings.ToLower(genre)] {
+                    return true
+                }
+            }
+            return false
+        }, nil
+    case "y":
+        year, err := strconv.Atoi(value)
+        return func(s memorySong) bool { return err == nil && s.song.Year != 0 && s.song.Year == year }, nil
+    case "f":
+        return func(s memorySong) bool {
+            return containsFold(s.song.Container, value) || containsFold(s.song.Codec, value)
+        }, nil
+    case "br", "dur", "sr", "bpm":
+        numeric, err := parseNumericFilter(value, numericParsers[filter.key])
+        if err != nil {
+            return nil, fmt.Errorf("Filtro inválido '%s': %v", filter.text, err)
+        }
+        // Los valores desconocidos (0) no cumplen ningún filtro, como NULL en SQL.
+        column := map[string]func(Song) float64{
+            "br":  func(song Song) float64 { return float64(song.Bitrate) },
+            "dur": func(song Song) float64 { return math.Round(song.Duration) },
+            "sr":  func(song Song) float64 { return float64(song.SampleRate) },
+            "bpm": func(song Song) float64 { return math.Round(song.BPM) },
+        }[filter.key]
+        return func(s memorySong) bool {
+            number := column(s.song)
+            return number != 0 && numeric.matches(number)
+        }, nil
+    case "ch":
+        return func(s memorySong) bool { return containsFold(s.song.ChannelMode, value) }, nil
+    case "enc":
+        return func(s memorySong) bool { return containsFold(s.song.Encoder, value) }, nil
+    case "h":
+        // "dañado" agrupa todos los estados distintos de "ok".
+        if strings.ToLower(value) == "dañado" || strings.ToLower(value) == "danado" {
+            return func(s memorySong) bool { return s.song.Health != "" && s.song.Health != HealthOK }, nil
+        }
+        return func(s memorySong) bool {
+            return strings.HasPrefix(strings.ToLower(s.song.Health), strings.ToLower(value))
+        }, nil
+    case "comp":
+        return func(s memorySong) bool { return containsFold(s.song.Composer, value) }, nil
+    case "lyr":
+        return func(s memorySong) bool {
+            for _, lyrics := range s.lyrics {
+                if containsFold(lyrics.Text, value) {
+                    return true
+                }
+            }
+            return false
+        }, nil
+    case "key":
+        musicalKey := NormalizeKey(value)
+        if musicalKey == "" {
+            return nil, fmt.Errorf("Filtro inválido '%s': '%s' no es una tonalidad", filter.text, value)
+        }
+        return func(s memorySong) bool { return s.song.Key == musicalKey }, nil
+    case "vbr":
+        vbr := isAffirmative(value)
+        return func(s memorySong) bool { return s.song.VBR == vbr }, nil
+    }
+    return func(memorySong) bool { return true }, nil
+}
+
+// searchGenres regresa, en minúsculas, los géneros de las canciones que busca el filtro de género, como
+// searchGenreIDs: el género con ese nombre o alias o, si ningún género se llama así, los que contienen el texto.
+// Con subgenres también regresa sus subgéneros.
+func (r *MemoryRepository) searchGenres(value string, subgenres bool) map[string]bool {
+    genres := r.genres()
+    canonical, ok := value, hasGenre(genres, value)
+    if !ok {
+        canonical, ok, _ = knownGenre(nil, value)
+    }
+    matched := map[string]bool{}
+    for name := range genres {
+        if ok && strings.EqualFold(name, canonical) || !ok && containsFold(name, value) {
+            matched[name] = true
+        }
+    }
+    if !subgenres {
+        return matched
+    }
+    withSubgenres := map[string]bool{}
+    for name := range genres {
+        for ancestor := name; ancestor != ""; ancestor = genres[ancestor] {
+            if matched[ancestor] {
+                withSubgenres[name] = true
+                break
+            }
+        }
+    }
+    return withSubgenres
+}
+
+// genres regresa, en minúsculas, los géneros que tendría la tabla de géneros con las canciones guardadas: sus
+// géneros y los géneros de los que éstos son subgéneros (ver genreParent), cada uno con su género principal (vacío
+// si no tiene).
+func (r *MemoryRepository) genres() map[string]string {
+    genres := map[string]string{}
+    for _, s := range r.songs {
+        for _, name := range strings.Split(s.song.Genre, GenreSeparator) {
+            for name != "" && !hasGenre(genres, name) {
+                parent, _, _ := genreParent(nil, name)
+                genres[strings.ToLower(name)] = strings.ToLower(parent)
+                name = parent
+            }
+        }
+    }
+    return genres
+}
+
+// hasGenre indica si el género está en genres, sin distinguir mayúsculas.
+func hasGenre(genres map[string]string, name string) bool {
+    _, ok := genres[strings.ToLower(name)]
+    return ok
+}
+
+// SongExists indica si ya existe una canción con la ruta indicada.
+func (r *MemoryRepository) SongExists(path string) (bool, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for _, s := range r.songs {
+        if s.song.Path == path {
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// CanonicalPerformer regresa el nombre del intérprete del que name es un alias, o el mismo name.
+func (r *MemoryRepository) CanonicalPerformer(name string) (string, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for _, performer := range r.performers {
+        if containsString(performer.Aliases, name) {
+            return performer.Name, nil
+        }
+    }
+    return name, nil
+}
+
+// NormalizeGenres regresa los nombres canónicos de los géneros del texto del género de una canción, con los alias
+// predeterminados, los géneros de ID3v1 y los géneros de las canciones guardadas.
+func (r *MemoryRepository) NormalizeGenres(text string) ([]string, error) {
+    names, err := genreNames(nil, text)
+    if err != nil {
+        return nil, err
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for i, name := range names {
+    search:
+        for _, s := range r.songs {
+            for _, genre := range strings.Split(s.song.Genre, GenreSeparator) {
+                if strings.EqualFold(genre, name) {
+                    names[i] = genre
+                    break search
+                }
+            }
+        }
+    }
+    return names, nil
+}
+
+// AddSong guarda una canción minada, creando su álbum y su intérprete si no existen. Como en la base de datos, no
+// puede haber dos canciones con la misma ruta.
+func (r *MemoryRepository) AddSong(mined MinedSong) error {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for _, s := range r.songs {
+        if s.song.Path == mined.Path {
+            return fmt.Errorf("error al insertar la rola: ya existe la canción %s", mined.Path)
+        }
+    }
+
+    idAlbum := 0
+    for _, album := range r.albums {
+        if album.Name == mined.Album && album.Path == mined.AlbumPath {
+            idAlbum = album.IDAlbum
+        }
+    }
+    if idAlbum == 0 {
+        r.nextID++
+        idAlbum = r.nextID
+        r.albums = append(r.albums, Album{IDAlbum: idAlbum, Name: mined.Album, Year: mined.Year, Path: mined.AlbumPath})
+    }
+    if mined.Artist != "" && !r.hasPerformer(mined.Artist) {
+        r.nextID++
+        r.performers = append(r.performers, Performer{ID: r.nextID, Name: mined.Artist})
+    }
+
+    r.nextID++
+    song := Song{
+        IDRola:     r.nextID,
+        Title:      mined.Title,
+        Artist:     mined.Artist,
+        Album:      mined.Album,
+        Year:       mined.Year,
+        Genre:      mined.Genre,
+        Track:      mined.Track,
+        Path:       mined.Path,
+        BPM:        mined.BPM,
+        Key:        mined.Key,
+        Composer:   mined.tags.composer,
+        Comment:    mined.tags.comment,
+        Disc:       mined.tags.disc,
+        DiscTotal:  mined.tags.discTotal,
+        TrackTotal: mined.tags.trackTotal,
+        Sources:    map[string]string{},
+    }
+    if mined.Format != nil {
+        song.Container, song.Codec = mined.Format.Container, mined.Format.Codec
+    }
+    if props := mined.Properties; props != nil {
+        song.Duration, song.Bitrate, song.SampleRate = props.Duration, props.Bitrate, props.SampleRate
+        song.ChannelMode, song.Encoder, song.VBR = props.ChannelMode, props.Encoder, props.VBR
+    }
+    if mined.Health != nil {
+        song.Health, song.HealthDetail = mined.Health.Status, mined.Health.Detail
+    }
+    for field, source := range mined.Sources {
+        song.Sources[field] = source
+    }
+    r.songs = append(r.songs, memorySong{song: song, idAlbum: idAlbum, lyrics: mined.tags.lyrics})
+    return nil
+}
+
+// hasPerformer indica si ya existe un intérprete con el nombre indicado.
+func (r *MemoryRepository) hasPerformer(name string) bool {
+    for _, performer := range r.performers {
+        if performer.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// CollectGarbage elimina los álbumes y los intérpretes sin canciones y regresa cuántos eliminó.
+func (r *MemoryRepository) CollectGarbage() (int, int, error) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    albums, performers := r.albums[:0], r.performers[:0]
+    for _, album := range r.albums {
+        for _, s := range r.songs {
+            if s.idAlbum == album.IDAlbum {
+                albums = append(albums, album)
+                break
+            }
+        }
+    }
+    for _, performer := range r.performers {
+        for _, s := range r.songs {
+            if s.song.Artist == performer.Name {
+                performers = append(performers, performer)
+                break
+            }
+        }
+    }
+    removedAlbums, removedPerformers := len(r.albums)-len(albums), len(r.performers)-len(performers)
+    r.albums, r.performers = albums, performers
+    return removedAlbums, removedPerformers, nil
+}
+
+// filterSongs regresa copias de las canciones que cumplen keep, en el orden en que se agregaron.
+func (r *MemoryRepository) filterSongs(keep func(memorySong) bool) []Song {
+    var songs []Song
+    for _, s := range r.songs {
+        if keep(s) {
+            songs = append(songs, copySong(s.song))
+        }
+    }
+    return songs
+}
+
+// copySong copia una canción, incluido el mapa de orígenes, para que quien la recibe no modifique la guardada.
+func copySong(song Song) Song {
+    sources := make(map[string]string, len(song.Sources))
+    for field, source := range song.Sources {
+        sources[field] = source
+    }
+    song.Sources = sources
+    return song
+}
+
+// sortByAlbum ordena las canciones como AlbumSongOrder: por álbum, disco y pista. Las canciones sin disco se
+// consideran del disco 1 y las que no tienen número de pista van al final de su disco.
+func sortByAlbum(songs []Song) {
+    disc := func(song Song) int {
+        if song.Disc == 0 {
+            return 1
+        }
+        return song.Disc
+    }
+    sort.SliceStable(songs, func(i, j int) bool {
+        a, b := songs[i], songs[j]
+        switch {
+        case a.Album != b.Album:
+            return a.Album < b.Album
+        case disc(a) != disc(b):
+            return disc(a) < disc(b)
+        case (a.Track == 0) != (b.Track == 0):
+            return b.Track == 0
+        case a.Track != b.Track:
+            return a.Track < b.Track
+        }
+        return a.Title < b.Title
+    })
+}
+
+// containsString indica si values contiene value.
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// containsFold indica si text contiene value sin distinguir mayúsculas.
+func containsFold(text, value string) bool {
+    return strings.Contains(strings.ToLower(text), strings.ToLower(value))
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+    "path/filepath"
+    "reflect"
+    "sort"
+    "testing"
+)
+
+// openTestSQLiteRepository crea una base de datos SQLite con el esquema completo en un directorio temporal.
+func openTestSQLiteRepository(t *testing.T) *SQLiteRepository {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "music.db")
+    repo, err := OpenSQLiteRepository(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { repo.DB().Close() })
+    if err := NewMusicDataBase(path).InitializeDatabase(repo.DB()); err != nil {
+        t.Fatal(err)
+    }
+    return repo
+}
+
+// songTitles regresa los títulos de las canciones ordenados, para comparar resultados sin importar su orden.
+func songTitles(songs []Song) []string {
+    titles := make([]string, len(songs))
+    for i, song := range songs {
+        titles[i] = song.Title
+    }
+    sort.Strings(titles)
+    return titles
+}
+
+// TestSearchRepositories revisa que MemoryRepository y SQLiteRepository den los mismos resultados para las mismas
+// búsquedas sobre las mismas canciones minadas.
+func TestSearchRepositories(t *testing.T) {
+    repos := map[string]Repository{
+        "sqlite":  openTestSQLiteRepository(t),
+        "memoria": NewMemoryRepository(),
+    }
+    for _, repo := range repos {
+        mineTestSongs(t, repo)
+    }
+
+    tests := []struct {
+        query  string
+        titles []string // nil si la búsqueda no tiene resultados.
+    }{
+        {"p: beatles", []string{"Come Together", "Oh! Darling", "Something"}},
+        {"p: the beatles", []string{"Come Together", "Something"}},
+        {"a: paranoid", []string{"Canción Ñandú", "War Pigs"}},
+        {"c: darling", []string{"Oh! Darling"}},
+        {"c: canción", []string{"Canción Ñandú"}},
+        {"y: 1969", []string{"Come Together", "Oh! Darling", "Something"}},
+        {"y: 1971", nil},
+        {"g: rock", []string{"Come Together", "Something"}},
+        {"g+: rock", []string{"Come Together", "Something", "War Pigs"}},
+        {"g: metal", nil},
+        {"g+: metal", []string{"Canción Ñandú"}},
+        {"g: polka", nil},
+        {"f: mp3", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"br: <192", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"br: >192", nil},
+        {"br: <192.5", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"sr: 44.1k-48.05k", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"sr: 44100, a: abbey", []string{"Come Together", "Oh! Darling", "Something"}},
+        {"p: sabbath, c: war", []string{"War Pigs"}},
+        {"something", []string{"Something"}},
+        {"1970", []string{"War Pigs"}},
+    }
+    for _, tt := range tests {
+        for name, repo := range repos {
+            songs, err := repo.Search(tt.query)
+            if tt.titles == nil {
+                if err == nil {
+                    t.Errorf("%s: %q regresó %v, se esperaba un error sin resultados", name, tt.query, songTitles(songs))
+                }
+                continue
+            }
+            if err != nil {
+                t.Errorf("%s: %q: %v", name, tt.query, err)
+                continue
+            }
+            if titles := songTitles(songs); !reflect.DeepEqual(titles, tt.titles) {
+                t.Errorf("%s: %q = %v, se esperaba %v", name, tt.query, titles, tt.titles)
+            }
+        }
+    }
+}
+
+// TestPerformerMergesRepositories revisa que ambas implementaciones sugieran y unan los intérpretes igual.
+func TestPerformerMergesRepositories(t *testing.T) {
+    for name, repo := range map[string]Repository{"sqlite": openTestSQLiteRepository(t), "memoria": NewMemoryRepository()} {
+        mineTestSongs(t, repo)
+
+        clusters, err := repo.SuggestPerformerMerges()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(clusters) != 1 || len(clusters[0].Performers) != 2 {
+            t.Fatalf("%s: sugerencias = %+v, se esperaba un grupo con los dos nombres de los Beatles", name, clusters)
+        }
+        into := clusters[0].Performers[clusters[0].Suggested]
+        if err := repo.MergePerformers(clusters[0].Performers, into); err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+
+        performers, err := repo.Performers()
+        if err != nil {
+            t.Fatal(err)
+        }
+        var merged *Performer
+        for i := range performers {
+            if performers[i].ID == into.ID {
+                merged = &performers[i]
+            }
+        }
+        if len(performers) != 2 || merged == nil || len(merged.Aliases) != 1 {
+            t.Errorf("%s: intérpretes después de unir = %+v", name, performers)
+        }
+
+        if into.Name != "The Beatles" {
+            t.Errorf("%s: se sugirió conservar %s", name, into.Name)
+        }
+        songs, err := repo.Search("p: " + into.Name)
+        if err != nil || len(songs) != 3 {
+            t.Errorf("%s: canciones de %s = %v, %v", name, into.Name, songTitles(songs), err)
+        }
+        if merged == nil || len(merged.Aliases) == 0 {
+            continue
+        }
+        if canonical, _ := repo.CanonicalPerformer(merged.Aliases[0]); canonical != into.Name {
+            t.Errorf("%s: intérprete canónico de %s = %s", name, merged.Aliases[0], canonical)
+        }
+    }
+}
@@ -0,0 +1,573 @@
+package model
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+)
+
+// migration representa un cambio incremental sobre el esquema base creado por createSchema.
+// La versión aplicada se guarda en PRAGMA user_version, por lo que cada migración se ejecuta una sola vez.
+type migration struct {
+    version     int                    // Versión del esquema que se alcanza al aplicar la migración.
+    description string                 // Descripción breve del cambio.
+    statements  []string               // Sentencias SQL que componen la migración.
+    apply       func(tx *sql.Tx) error // Cambios a los datos que no se pueden hacer sólo con SQL (opcional).
+}
+
+// migrations contiene todas las migraciones del esquema, ordenadas por versión.
+var migrations = []migration{
+    {
+        version:     1,
+        description: "contenedor y códec de cada rola",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN container TEXT",
+            "ALTER TABLE rolas ADD COLUMN codec TEXT",
+            "UPDATE rolas SET container = 'MPEG', codec = 'MP3' WHERE container IS NULL",
+        },
+    },
+    {
+        version:     2,
+        description: "caché de portadas y portada de cada álbum",
+        statements: []string{
+            `CREATE TABLE covers (
+                id_cover      INTEGER PRIMARY KEY,
+                hash          TEXT UNIQUE,
+                path          TEXT
+            )`,
+            "ALTER TABLE albums ADD COLUMN id_cover INTEGER REFERENCES covers(id_cover)",
+        },
+    },
+    {
+        version:     3,
+        description: "propiedades de audio de cada rola",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN duration REAL",
+            "ALTER TABLE rolas ADD COLUMN bitrate INTEGER",
+            "ALTER TABLE rolas ADD COLUMN sample_rate INTEGER",
+            "ALTER TABLE rolas ADD COLUMN channel_mode TEXT",
+            "ALTER TABLE rolas ADD COLUMN encoder TEXT",
+            "ALTER TABLE rolas ADD COLUMN vbr INTEGER",
+        },
+    },
+    {
+        version:     4,
+        description: "estado de salud de cada rola",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN health TEXT",
+            "ALTER TABLE rolas ADD COLUMN health_detail TEXT",
+        },
+    },
+    {
+        version:     5,
+        description: "hash del audio y canciones ocultas",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN audio_hash TEXT",
+            "ALTER TABLE rolas ADD COLUMN hidden INTEGER NOT NULL DEFAULT 0",
+        },
+    },
+    {
+        version:     6,
+        description: "huella acústica de cada rola",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN fingerprint BLOB",
+        },
+    },
+    {
+        version:     7,
+        description: "sonoridad EBU R128 y pico de rolas y álbumes",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN loudness REAL",
+            "ALTER TABLE rolas ADD COLUMN peak REAL",
+            "ALTER TABLE rolas ADD COLUMN loudness_histogram BLOB",
+            "ALTER TABLE albums ADD COLUMN loudness REAL",
+            "ALTER TABLE albums ADD COLUMN peak REAL",
+        },
+    },
+    {
+        version:     8,
+        description: "tempo y tonalidad de cada rola",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN bpm REAL",
+            "ALTER TABLE rolas ADD COLUMN musical_key TEXT",
+            "ALTER TABLE rolas ADD COLUMN tempo_key_analyzed INTEGER NOT NULL DEFAULT 0",
+        },
+    },
+    {
+        version:     9,
+        description: "compositor, comentario, disco, letras y tramas de las etiquetas",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN composer TEXT",
+            "ALTER TABLE rolas ADD COLUMN comment TEXT",
+            "ALTER TABLE rolas ADD COLUMN disc INTEGER",
+            `CREATE TABLE lyrics (
+                id_lyrics     INTEGER PRIMARY KEY,
+                id_rola       INTEGER REFERENCES rolas(id_rola),
+                language      TEXT,
+                description   TEXT,
+                text          TEXT
+            )`,
+            "CREATE INDEX lyrics_id_rola ON lyrics(id_rola)",
+            `CREATE TABLE tag_frames (
+                id_rola       INTEGER REFERENCES rolas(id_rola),
+                name          TEXT,
+                value         TEXT
+            )`,
+            "CREATE INDEX tag_frames_id_rola ON tag_frames(id_rola)",
+        },
+    },
+    {
+        version:     10,
+        description: "total de discos y de pistas de cada rola",
+        statements: []string{
+            "ALTER TABLE rolas ADD COLUMN disc_total INTEGER",
+            "ALTER TABLE rolas ADD COLUMN track_total INTEGER",
+        },
+    },
+    {
+        version:     11,
+        description: "origen de cada dato y datos desconocidos como NULL",
+        statements: []string{
+            `CREATE TABLE field_sources (
+                id_rola       INTEGER REFERENCES rolas(id_rola),
+                field         TEXT,
+                source        TEXT,
+                PRIMARY KEY   (id_rola, field)
+            )`,
+            // Antes se inventaban "Unknown" como título, intérprete y género; el año y la pista inventados se corrigen
+            // en la migración 17, con las tramas de las etiquetas.
+            "UPDATE rolas SET title = NULL WHERE title = 'Unknown'",
+            "UPDATE rolas SET genre = NULL WHERE genre = 'Unknown'",
+            "UPDATE rolas SET id_performer = NULL WHERE id_performer IN (SELECT id_performer FROM performers WHERE name = 'Unknown')",
+            "DELETE FROM performers WHERE name = 'Unknown'",
+        },
+    },
+    {
+        version:     12,
+        description: "bitácora de cambios para deshacer y rehacer",
+        statements: []string{
+            `CREATE TABLE journal_entries (
+                id_entry      INTEGER PRIMARY KEY,
+                description   TEXT,
+                created       INTEGER,
+                undone        INTEGER
+            )`,
+            // old_value y new_value no tienen tipo para guardar los valores tal como estaban en su tabla.
+            `CREATE TABLE journal_changes (
+                id_change     INTEGER PRIMARY KEY,
+                id_entry      INTEGER REFERENCES journal_entries(id_entry),
+                step          INTEGER,
+                kind          TEXT,
+                table_name    TEXT,
+                row_id        INTEGER,
+                column_name   TEXT,
+                old_value,
+                new_value
+            )`,
+            "CREATE INDEX journal_changes_id_entry ON journal_changes(id_entry)",
+        },
+    },
+    {
+        version:     13,
+        description: "géneros normalizados, sus alias y su jerarquía",
+        statements: []string{
+            `CREATE TABLE genres (
+                id_genre      INTEGER PRIMARY KEY,
+                name          TEXT UNIQUE COLLATE NOCASE,
+                id_parent     INTEGER REFERENCES genres(id_genre)
+            )`,
+            `CREATE TABLE genre_aliases (
+                alias         TEXT PRIMARY KEY COLLATE NOCASE,
+                id_genre      INTEGER REFERENCES genres(id_genre)
+            )`,
+            `CREATE TABLE rola_genres (
+                id_rola       INTEGER REFERENCES rolas(id_rola),
+                id_genre      INTEGER REFERENCES genres(id_genre),
+                position      INTEGER,
+                PRIMARY KEY (id_rola, id_genre)
+            )`,
+            "CREATE INDEX rola_genres_id_genre ON rola_genres(id_genre)",
+        },
+        apply: normalizeStoredGenres,
+    },
+    {
+        version:     14,
+        description: "alias de los intérpretes",
+        statements: []string{
+            // Los alias distinguen mayúsculas para que "JUAN GABRIEL" pueda ser un alias de "Juan Gabriel".
+            `CREATE TABLE performer_aliases (
+                alias         TEXT PRIMARY KEY,
+                id_performer  INTEGER REFERENCES performers(id_performer)
+            )`,
+        },
+    },
+    {
+        version:     15,
+        description: "índices únicos de rutas, intérpretes y álbumes",
+        statements: []string{
+            "CREATE INDEX rolas_id_performer ON rolas(id_performer)",
+            "CREATE INDEX rolas_id_album ON rolas(id_album)",
+        },
+        // Las filas repetidas se unen antes de crear los índices únicos.
+        apply: func(tx *sql.Tx) error {
+            if err := splitMergedAlbums(tx); err != nil {
+                return err
+            }
+            return dedupeCoreTables(tx)
+        },
+    },
+    {
+        version:     foreignKeysVersion,
+        description: "acciones al eliminar en las llaves foráneas",
+        apply:       applyForeignKeyActions,
+    },
+    {
+        version:     17,
+        description: "años y números de pista inventados como NULL",
+        // Antes de guardar los datos desconocidos como NULL, a las rolas sin año se les ponía el año en que se minaron
+        // (y, antes aún, la pista 1). En las rolas con tramas guardadas se sabe si el archivo tenía esos datos: si no
+        // tiene trama de año o de pista, ni un origen registrado para ese dato, el valor era inventado.
+        statements: []string{
+            `UPDATE rolas SET year = NULL
+                WHERE year IS NOT NULL
+                AND EXISTS (SELECT 1 FROM tag_frames WHERE tag_frames.id_rola = rolas.id_rola)
+                AND NOT EXISTS (SELECT 1 FROM tag_frames WHERE tag_frames.id_rola = rolas.id_rola
+                    AND lower(tag_frames.name) IN ('tyer', 'tdrc', 'tye', 'year', 'date'))
+                AND NOT EXISTS (SELECT 1 FROM field_sources WHERE field_sources.id_rola = rolas.id_rola AND field = 'year')`,
+            `UPDATE rolas SET track = NULL
+                WHERE track IS NOT NULL
+                AND EXISTS (SELECT 1 FROM tag_frames WHERE tag_frames.id_rola = rolas.id_rola)
+                AND NOT EXISTS (SELECT 1 FROM tag_frames WHERE tag_frames.id_rola = rolas.id_rola
+                    AND lower(tag_frames.name) IN ('trck', 'trk', 'track', 'tracknumber'))
+                AND NOT EXISTS (SELECT 1 FROM field_sources WHERE field_sources.id_rola = rolas.id_rola AND field = 'track')`,
+            // El año de un álbum se tomaba de su primera rola; si ya ninguna de sus rolas tiene ese año, era inventado.
+            `UPDATE albums SET year = NULL
+                WHERE year IS NOT NULL
+                AND EXISTS (SELECT 1 FROM rolas WHERE rolas.id_album = albums.id_album)
+                AND NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_album = albums.id_album AND rolas.year = albums.year)`,
+        },
+    },
+}
+
+// foreignKeysVersion es la versión del esquema a partir de la cual las llaves foráneas se respetan.
+const foreignKeysVersion = 16
+
+// latestSchemaVersion regresa la versión del esquema que se alcanza al aplicar todas las migraciones.
+func latestSchemaVersion() int {
+    return migrations[len(migrations)-1].version
+}
+
+// schemaVersion obtiene la versión del esquema guardada en la base de datos.
+func schemaVersion(db *sql.DB) (int, error) {
+    var version int
+    if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+        return 0, fmt.Errorf("error leyendo la versión del esquema: %v", err)
+    }
+    return version, nil
+}
+
+// migrateSchema aplica, dentro de una transacción cada una, las migraciones que aún no se han ejecutado.
+func migrateSchema(db *sql.DB) error {
+    current, err := schemaVersion(db)
+    if err != nil {
+        return err
+    }
+
+    // Las migraciones que reconstruyen tablas necesitan las llaves foráneas desactivadas, pero el PRAGMA no tiene
+    // efecto dentro de una transacción y sólo vale para una conexión; por eso todas se aplican en la misma conexión.
+    ctx := context.Background()
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return fmt.Errorf("error al obtener una conexión: %v", err)
+    }
+    defer conn.Close()
+    if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+        return fmt.Errorf("error al desactivar las llaves foráneas: %v", err)
+    }
+    defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+    for _, m := range migrations {
+        if m.version <= current {
+            continue
+        }
+
+        tx, err := conn.BeginTx(ctx, nil)
+        if err != nil {
+            return fmt.Errorf("error iniciando la migración %d: %v", m.version, err)
+        }
+        for _, statement := range m.statements {
+            if _, err := tx.Exec(statement); err != nil {
+                tx.Rollback()
+                return fmt.Errorf("error en la migración %d (%s): %v", m.version, m.description, err)
+            }
+        }
+        if m.apply != nil {
+            if err := m.apply(tx); err != nil {
+                tx.Rollback()
+                return fmt.Errorf("error en la migración %d (%s): %v", m.version, m.description, err)
+            }
+        }
+        // A partir de la migración que repara las referencias, ninguna migración puede dejar referencias rotas.
+        if m.version >= foreignKeysVersion {
+            if err := checkForeignKeys(tx); err != nil {
+                tx.Rollback()
+                return fmt.Errorf("error en la migración %d (%s): %v", m.version, m.description, err)
+            }
+        }
+        // PRAGMA no admite parámetros, por eso la versión se concatena directamente.
+        if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("error actualizando la versión del esquema: %v", err)
+        }
+        if err := tx.Commit(); err != nil {
+            return fmt.Errorf("error confirmando la migración %d: %v", m.version, err)
+        }
+        fmt.Printf("Migración %d aplicada: %s\n", m.version, m.description)
+    }
+
+    return nil
+}
+
+// duplicateKey describe las filas repetidas de una tabla: las que tienen los mismos valores en las columnas key.
+type duplicateKey struct {
+    table      string      // Tabla con filas repetidas.
+    id         string      // Columna con el ID de cada fila.
+    key        []string    // Columnas cuyos valores, juntos, deben ser únicos.
+    fill       []string    // Columnas que, si están vacías en la fila que se conserva, se toman de una repetida.
+    references [][2]string // Tablas y columnas que hacen referencia al ID; se cambian por el de la fila que se conserva.
+    dependents [][2]string // Tablas y columnas cuyas filas se eliminan junto con las filas repetidas.
+}
+
+// coreDuplicateKeys son las claves únicas del esquema base. Antes no tenían índices únicos, así que INSERT OR IGNORE
+// no ignoraba nada y cada minado repetía intérpretes y álbumes. Los álbumes se identifican por su nombre y su
+// directorio, igual que al minar y al editar: dos álbumes "Greatest Hits" de distintos intérpretes son distintos.
+var coreDuplicateKeys = []duplicateKey{
+    {
+        table:      "performers",
+        id:         "id_performer",
+        key:        []string{"name"},
+        references: [][2]string{{"rolas", "id_performer"}, {"performer_aliases", "id_performer"}},
+    },
+    {
+        table:      "albums",
+        id:         "id_album",
+        key:        []string{"name", "path"},
+        fill:       []string{"year", "id_cover"},
+        references: [][2]string{{"rolas", "id_album"}},
+    },
+    {
+        // Las rolas repetidas son el mismo archivo, así que sus datos dependientes también están repetidos.
+        table:      "rolas",
+        id:         "id_rola",
+        key:        []string{"path"},
+        dependents: [][2]string{{"lyrics", "id_rola"}, {"tag_frames", "id_rola"}, {"field_sources", "id_rola"}, {"rola_genres", "id_rola"}},
+    },
+}
+
+// dedupeCoreTables une las filas repetidas de coreDuplicateKeys en la de menor ID y después crea sus índices únicos.
+func dedupeCoreTables(tx *sql.Tx) error {
+    for _, d := range coreDuplicateKeys {
+        same := make([]string, len(d.key))
+        for i, column := range d.key {
+            same[i] = fmt.Sprintf("keep.%[1]s IS dup.%[1]s", column)
+        }
+        // duplicates relaciona cada fila repetida con la fila que se conserva.
+        statements := []string{
+            "DROP TABLE IF EXISTS temp.duplicates",
+            fmt.Sprintf(`CREATE TEMP TABLE duplicates AS
+                SELECT dup.%[2]s AS id_old, (SELECT MIN(keep.%[2]s) FROM %[1]s AS keep WHERE %[3]s) AS id_new
+                FROM %[1]s AS dup`, d.table, d.id, strings.Join(same, " AND ")),
+            "DELETE FROM temp.duplicates WHERE id_old = id_new",
+        }
+        for _, column := range d.fill {
+            statements = append(statements, fmt.Sprintf(`UPDATE %[1]s SET %[3]s = (SELECT dup.%[3]s FROM %[1]s AS dup
+                JOIN temp.duplicates ON duplicates.id_old = dup.%[2]s
+                WHERE duplicates.id_new = %[1]s.%[2]s AND dup.%[3]s IS NOT NULL ORDER BY dup.%[2]s LIMIT 1)
+                WHERE %[3]s IS NULL AND %[2]s IN (SELECT id_new FROM temp.duplicates)`, d.table, d.id, column))
+        }
+        for _, reference := range d.references {
+            statements = append(statements, fmt.Sprintf(`UPDATE %[1]s SET %[2]s = (SELECT id_new FROM temp.duplicates WHERE id_old = %[1]s.%[2]s)
+                WHERE %[2]s IN (SELECT id_old FROM temp.duplicates)`, reference[0], reference[1]))
+        }
+        for _, dependent := range d.dependents {
+            statements = append(statements, fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT id_old FROM temp.duplicates)", dependent[0], dependent[1]))
+        }
+        statements = append(statements,
+            fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT id_old FROM temp.duplicates)", d.table, d.id),
+            "DROP TABLE temp.duplicates",
+            fmt.Sprintf("CREATE UNIQUE INDEX %s_%s ON %s(%s)", d.table, strings.Join(d.key, "_"), d.table, strings.Join(d.key, ", ")),
+        )
+
+        for _, statement := range statements {
+            if _, err := tx.Exec(statement); err != nil {
+                return fmt.Errorf("error al unir las filas repetidas de %s: %v", d.table, err)
+            }
+        }
+    }
+    return nil
+}
+
+// splitMergedAlbums separa los álbumes con el mismo nombre que se unieron al minar. Como el nombre no era único, cada
+// minado insertaba otra fila del álbum con su directorio, pero las rolas se asociaban con la primera fila con ese
+// nombre, aunque fuera de otro intérprete. Cada rola se asocia ahora con la fila de su mismo nombre cuyo directorio es
+// el de la rola, si existe; así dedupeCoreTables no une álbumes distintos.
+func splitMergedAlbums(tx *sql.Tx) error {
+    // SQLite no tiene una función para el directorio de una ruta: rtrim quita los caracteres del nombre del archivo
+    // (todos los que no son separadores) y después el separador.
+    const rolaDir = `rtrim(rtrim(rolas.path, replace(replace(rolas.path, '/', ''), '\', '')), '/\')`
+    _, err := tx.Exec(`UPDATE rolas SET id_album = (
+            SELECT MIN(own.id_album) FROM albums AS current JOIN albums AS own ON own.name IS current.name
+            WHERE current.id_album = rolas.id_album AND own.path = ` + rolaDir + `)
+        WHERE EXISTS (SELECT 1 FROM albums AS current JOIN albums AS own ON own.name IS current.name
+            WHERE current.id_album = rolas.id_album AND own.path = ` + rolaDir + `)`)
+    if err != nil {
+        return fmt.Errorf("error al separar los álbumes con el mismo nombre: %v", err)
+    }
+    return nil
+}
+
+// foreignKeyAction describe lo que pasa con las filas de una tabla cuando se elimina la fila a la que hacen referencia.
+type foreignKeyAction struct {
+    table     string // Tabla con la referencia.
+    reference string // Referencia tal como aparece en la definición de la tabla.
+    onDelete  string // Acción al eliminar la fila referenciada.
+}
+
+// foreignKeyActions son las acciones de las referencias del esquema. Una canción sin álbum o sin intérprete se
+// conserva; los datos que sólo describen a una canción o a un intérprete se eliminan con él.
+var foreignKeyActions = []foreignKeyAction{
+    {"rolas", "REFERENCES performers(id_performer)", "SET NULL"},
+    {"rolas", "REFERENCES albums(id_album)", "SET NULL"},
+    {"lyrics", "REFERENCES rolas(id_rola)", "CASCADE"},
+    {"tag_frames", "REFERENCES rolas(id_rola)", "CASCADE"},
+    {"field_sources", "REFERENCES rolas(id_rola)", "CASCADE"},
+    {"rola_genres", "REFERENCES rolas(id_rola)", "CASCADE"},
+    {"performer_aliases", "REFERENCES performers(id_performer)", "CASCADE"},
+}
+
+// applyForeignKeyActions repara las referencias rotas que quedaron mientras SQLite no revisaba las llaves foráneas y
+// agrega las acciones de foreignKeyActions. SQLite no permite cambiar las restricciones de una tabla existente, así
+// que cada tabla se vuelve a crear.
+func applyForeignKeyActions(tx *sql.Tx) error {
+    if err := repairForeignKeys(tx); err != nil {
+        return err
+    }
+    var tables []string
+    definitions := map[string][]string{}
+    for _, action := range foreignKeyActions {
+        if _, ok := definitions[action.table]; !ok {
+            tables = append(tables, action.table)
+        }
+        definitions[action.table] = append(definitions[action.table], action.reference, action.reference+" ON DELETE "+action.onDelete)
+    }
+    for _, table := range tables {
+        if err := rebuildTable(tx, table, strings.NewReplacer(definitions[table]...)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// repairForeignKeys corrige las filas que hacen referencia a filas que ya no existen: en rolas y en las tablas que
+// pueden tener referencias vacías (álbumes sin portada, géneros sin género principal) la referencia se vacía; en las
+// demás tablas la fila se elimina, porque no tiene sentido sin la fila a la que pertenece.
+func repairForeignKeys(tx *sql.Tx) error {
+    type brokenReference struct {
+        table  string
+        rowID  int64
+        column string
+    }
+    rows, err := tx.Query(`SELECT fk.[table], fk.rowid, list.[from] FROM pragma_foreign_key_check AS fk
+        JOIN pragma_foreign_key_list(fk.[table]) AS list ON list.id = fk.fkid`)
+    if err != nil {
+        return fmt.Errorf("error al revisar las llaves foráneas: %v", err)
+    }
+    var broken []brokenReference
+    for rows.Next() {
+        var reference brokenReference
+        if err := rows.Scan(&reference.table, &reference.rowID, &reference.column); err != nil {
+            rows.Close()
+            return fmt.Errorf("error al revisar las llaves foráneas: %v", err)
+        }
+        broken = append(broken, reference)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error al revisar las llaves foráneas: %v", err)
+    }
+
+    nullable := map[string]bool{"rolas": true, "albums": true, "genres": true}
+    for _, reference := range broken {
+        statement := fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", quoteIdentifier(reference.table))
+        if nullable[reference.table] {
+            statement = fmt.Sprintf("UPDATE %s SET %s = NULL WHERE rowid = ?", quoteIdentifier(reference.table), quoteIdentifier(reference.column))
+        }
+        if _, err := tx.Exec(statement, reference.rowID); err != nil {
+            return fmt.Errorf("error al reparar las referencias de %s: %v", reference.table, err)
+        }
+    }
+    return nil
+}
+
+// rebuildTable vuelve a crear una tabla con su definición cambiada por replacer, copiando sus filas y sus índices.
+// Debe llamarse con las llaves foráneas desactivadas para que al eliminar la tabla original no se toquen las filas
+// que hacen referencia a ella.
+func rebuildTable(tx *sql.Tx, table string, replacer *strings.Replacer) error {
+    var definition string
+    if err := tx.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&definition); err != nil {
+        return fmt.Errorf("error al leer la definición de %s: %v", table, err)
+    }
+    prefix := "CREATE TABLE " + table
+    if !strings.HasPrefix(definition, prefix) {
+        return fmt.Errorf("definición inesperada de %s: %s", table, definition)
+    }
+    rebuilt := replacer.Replace(definition)
+    if rebuilt == definition {
+        return fmt.Errorf("la definición de %s no tiene las referencias esperadas", table)
+    }
+
+    indexes, err := tx.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+    if err != nil {
+        return fmt.Errorf("error al leer los índices de %s: %v", table, err)
+    }
+    var indexDefinitions []string
+    for indexes.Next() {
+        var index string
+        if err := indexes.Scan(&index); err != nil {
+            indexes.Close()
+            return fmt.Errorf("error al leer los índices de %s: %v", table, err)
+        }
+        indexDefinitions = append(indexDefinitions, index)
+    }
+    indexes.Close()
+    if err := indexes.Err(); err != nil {
+        return fmt.Errorf("error al leer los índices de %s: %v", table, err)
+    }
+
+    statements := []string{
+        prefix + "_rebuilt" + strings.TrimPrefix(rebuilt, prefix),
+        fmt.Sprintf("INSERT INTO %[1]s_rebuilt SELECT * FROM %[1]s", table),
+        "DROP TABLE " + table,
+        fmt.Sprintf("ALTER TABLE %[1]s_rebuilt RENAME TO %[1]s", table),
+    }
+    for _, statement := range append(statements, indexDefinitions...) {
+        if _, err := tx.Exec(statement); err != nil {
+            return fmt.Errorf("error al volver a crear %s: %v", table, err)
+        }
+    }
+    return nil
+}
+
+// checkForeignKeys regresa un error si alguna fila hace referencia a una fila que no existe.
+func checkForeignKeys(q queryer) error {
+    var table, parent string
+    err := q.QueryRow("SELECT [table], parent FROM pragma_foreign_key_check").Scan(&table, &parent)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("error al revisar las llaves foráneas: %v", err)
+    }
+    return fmt.Errorf("hay filas de %s que hacen referencia a filas de %s que no existen", table, parent)
+}
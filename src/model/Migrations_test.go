@@ -0,0 +1,225 @@
+package model
+
+import (
+    "database/sql"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+// openTestDatabaseAt crea una base de datos con el esquema base y las migraciones hasta la versión indicada, como la
+// de una versión anterior del programa. Las llaves foráneas quedan desactivadas para poder sembrar filas repetidas o
+// con referencias rotas; migrateTestDatabase aplica después el resto de las migraciones.
+func openTestDatabaseAt(t *testing.T, version int) (string, *sql.DB) {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "music.db")
+    db, err := sql.Open("sqlite3", path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    db.SetMaxOpenConns(1) // Los PRAGMA sólo valen para una conexión.
+
+    if err := createSchema(db); err != nil {
+        t.Fatal(err)
+    }
+    all := migrations
+    migrations = migrations[:version]
+    err = migrateSchema(db)
+    migrations = all
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := db.Exec("PRAGMA foreign_keys = OFF"); err != nil {
+        t.Fatal(err)
+    }
+    return path, db
+}
+
+// migrateTestDatabase cierra db y aplica las migraciones pendientes a la base de datos de path, como al abrirla con
+// esta versión del programa.
+func migrateTestDatabase(t *testing.T, path string, db *sql.DB) *sql.DB {
+    t.Helper()
+    db.Close()
+    migrated, err := OpenDB(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { migrated.Close() })
+    if err := migrateSchema(migrated); err != nil {
+        t.Fatal(err)
+    }
+    return migrated
+}
+
+// execAll ejecuta las sentencias en orden y termina la prueba con el primer error.
+func execAll(t *testing.T, db *sql.DB, statements ...string) {
+    t.Helper()
+    for _, statement := range statements {
+        if _, err := db.Exec(statement); err != nil {
+            t.Fatalf("%s: %v", statement, err)
+        }
+    }
+}
+
+// queryInts regresa la primera columna de las filas de la consulta.
+func queryInts(t *testing.T, db *sql.DB, query string) []int {
+    t.Helper()
+    rows, err := db.Query(query)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer rows.Close()
+    var values []int
+    for rows.Next() {
+        var value int
+        if err := rows.Scan(&value); err != nil {
+            t.Fatal(err)
+        }
+        values = append(values, value)
+    }
+    if err := rows.Err(); err != nil {
+        t.Fatal(err)
+    }
+    return values
+}
+
+// assertForeignKeys revisa que ninguna fila haga referencia a una fila que no existe.
+func assertForeignKeys(t *testing.T, db *sql.DB) {
+    t.Helper()
+    if err := checkForeignKeys(db); err != nil {
+        t.Error(err)
+    }
+}
+
+// TestDedupeMigration siembra una base de datos de antes de los índices únicos, con intérpretes, álbumes y rolas
+// repetidos por minar dos veces y con dos álbumes "Greatest Hits" de distintos intérpretes que el minero unió.
+func TestDedupeMigration(t *testing.T) {
+    path, db := openTestDatabaseAt(t, 14)
+    execAll(t, db,
+        "INSERT INTO performers (id_performer, id_type, name) VALUES (1, 2, 'Queen'), (2, 2, 'ABBA'), (3, 2, 'Queen')",
+        "INSERT INTO performer_aliases (alias, id_performer) VALUES ('Queen (band)', 3)",
+        `INSERT INTO albums (id_album, name, path, year) VALUES
+            (1, 'Greatest Hits', '/música/Queen/Greatest Hits', NULL),
+            (2, 'Greatest Hits', '/música/ABBA/Greatest Hits', 1992),
+            (3, 'Greatest Hits', '/música/Queen/Greatest Hits', 1981),
+            (4, 'Gold', '/música/ABBA/Gold', 1992)`,
+        // El minero asociaba cada rola con el primer álbum con su nombre, aunque fuera de otro intérprete.
+        `INSERT INTO rolas (id_rola, id_performer, id_album, path, title, year) VALUES
+            (1, 1, 1, '/música/Queen/Greatest Hits/01.mp3', 'Bohemian Rhapsody', 1981),
+            (2, 2, 1, '/música/ABBA/Greatest Hits/01.mp3', 'SOS', 1992),
+            (3, 3, 3, '/música/Queen/Greatest Hits/02.mp3', 'Another One Bites the Dust', 1981),
+            (4, 2, 4, '/música/ABBA/Gold/01.mp3', 'Dancing Queen', 1992),
+            (5, 3, 3, '/música/Queen/Greatest Hits/01.mp3', 'Bohemian Rhapsody', 1981)`,
+        "INSERT INTO tag_frames (id_rola, name, value) VALUES (1, 'TIT2', 'Bohemian Rhapsody'), (5, 'TIT2', 'Bohemian Rhapsody')",
+        "INSERT INTO lyrics (id_rola, text) VALUES (5, 'Is this the real life?')",
+    )
+
+    db = migrateTestDatabase(t, path, db)
+    assertForeignKeys(t, db)
+
+    if got := queryInts(t, db, "SELECT id_album FROM albums ORDER BY id_album"); !reflect.DeepEqual(got, []int{1, 2, 4}) {
+        t.Errorf("álbumes = %v, se esperaba [1 2 4]: los dos Greatest Hits son distintos", got)
+    }
+    if got := queryInts(t, db, "SELECT year FROM albums WHERE id_album = 1"); !reflect.DeepEqual(got, []int{1981}) {
+        t.Errorf("año del álbum que se conservó = %v, se esperaba el de la fila repetida", got)
+    }
+    if got := queryInts(t, db, "SELECT id_rola FROM rolas ORDER BY id_rola"); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+        t.Errorf("rolas = %v, se esperaba [1 2 3 4]", got)
+    }
+    if got := queryInts(t, db, "SELECT id_album FROM rolas ORDER BY id_rola"); !reflect.DeepEqual(got, []int{1, 2, 1, 4}) {
+        t.Errorf("álbumes de las rolas = %v, se esperaba [1 2 1 4]", got)
+    }
+    if got := queryInts(t, db, "SELECT id_performer FROM rolas ORDER BY id_rola"); !reflect.DeepEqual(got, []int{1, 2, 1, 2}) {
+        t.Errorf("intérpretes de las rolas = %v, se esperaba [1 2 1 2]", got)
+    }
+    if got := queryInts(t, db, "SELECT id_performer FROM performers ORDER BY id_performer"); !reflect.DeepEqual(got, []int{1, 2}) {
+        t.Errorf("intérpretes = %v, se esperaba [1 2]", got)
+    }
+    if got := queryInts(t, db, "SELECT id_performer FROM performer_aliases"); !reflect.DeepEqual(got, []int{1}) {
+        t.Errorf("intérprete del alias = %v, se esperaba [1]", got)
+    }
+    if got := queryInts(t, db, "SELECT id_rola FROM tag_frames UNION ALL SELECT id_rola FROM lyrics"); !reflect.DeepEqual(got, []int{1}) {
+        t.Errorf("tramas y letras de = %v, se esperaba sólo las de la rola 1", got)
+    }
+
+    // Los índices únicos rechazan las filas repetidas, pero no un álbum con el mismo nombre en otro directorio.
+    if _, err := db.Exec("INSERT INTO albums (name, path) VALUES ('Greatest Hits', '/música/Queen/Greatest Hits')"); err == nil {
+        t.Error("se insertó un álbum repetido")
+    }
+    if _, err := db.Exec("INSERT INTO albums (name, path) VALUES ('Greatest Hits', '/música/ABBA/Greatest Hits 2')"); err != nil {
+        t.Errorf("no se insertó un álbum con el mismo nombre en otro directorio: %v", err)
+    }
+    if _, err := db.Exec("INSERT INTO rolas (path) VALUES ('/música/ABBA/Gold/01.mp3')"); err == nil {
+        t.Error("se insertó una rola repetida")
+    }
+}
+
+// TestForeignKeyActionsMigration siembra una base de datos de antes de que se respetaran las llaves foráneas, con
+// filas que hacen referencia a filas que ya no existen.
+func TestForeignKeyActionsMigration(t *testing.T) {
+    path, db := openTestDatabaseAt(t, foreignKeysVersion-1)
+    execAll(t, db,
+        "INSERT INTO performers (id_performer, id_type, name) VALUES (1, 2, 'Radiohead')",
+        "INSERT INTO performer_aliases (alias, id_performer) VALUES ('Radio Head', 1), ('On a Friday', 99)",
+        "INSERT INTO albums (id_album, name, path, id_cover) VALUES (1, 'OK Computer', '/música/OK Computer', 99)",
+        "INSERT INTO genres (id_genre, name) VALUES (1, 'Rock')",
+        `INSERT INTO rolas (id_rola, id_performer, id_album, path, title) VALUES
+            (1, 1, 1, '/música/OK Computer/01.mp3', 'Airbag'),
+            (2, 1, 1, '/música/OK Computer/02.mp3', 'Paranoid Android'),
+            (3, 98, 97, '/música/Kid A/01.mp3', 'Everything in Its Right Place')`,
+        "INSERT INTO lyrics (id_rola, text) VALUES (1, 'In the next world war'), (77, 'huérfana')",
+        "INSERT INTO tag_frames (id_rola, name, value) VALUES (1, 'TIT2', 'Airbag'), (2, 'TIT2', 'Paranoid Android'), (77, 'TIT2', 'huérfana')",
+        "INSERT INTO field_sources (id_rola, field, source) VALUES (1, 'title', 'tag'), (77, 'title', 'tag')",
+        "INSERT INTO rola_genres (id_rola, id_genre, position) VALUES (1, 1, 0), (77, 1, 0)",
+    )
+    count := func(db *sql.DB, table string) int {
+        t.Helper()
+        return queryInts(t, db, "SELECT COUNT(*) FROM "+table)[0]
+    }
+    tables := []string{"rolas", "albums", "performers", "lyrics", "tag_frames", "field_sources", "rola_genres", "performer_aliases"}
+    before := map[string]int{}
+    for _, table := range tables {
+        before[table] = count(db, table)
+    }
+
+    db = migrateTestDatabase(t, path, db)
+    assertForeignKeys(t, db)
+
+    // Las filas que sólo describen a una rola o a un intérprete que no existe se eliminan; las demás se conservan.
+    orphans := map[string]int{"lyrics": 1, "tag_frames": 1, "field_sources": 1, "rola_genres": 1, "performer_aliases": 1}
+    for _, table := range tables {
+        if got, want := count(db, table), before[table]-orphans[table]; got != want {
+            t.Errorf("%s: %d filas, se esperaban %d", table, got, want)
+        }
+    }
+    var album, performer, cover sql.NullInt64
+    if err := db.QueryRow("SELECT id_album, id_performer FROM rolas WHERE id_rola = 3").Scan(&album, &performer); err != nil {
+        t.Fatal(err)
+    }
+    if album.Valid || performer.Valid {
+        t.Errorf("la rola sin álbum ni intérprete quedó con %v y %v, se esperaba NULL", album, performer)
+    }
+    if err := db.QueryRow("SELECT id_cover FROM albums WHERE id_album = 1").Scan(&cover); err != nil || cover.Valid {
+        t.Errorf("portada del álbum = %v, %v; se esperaba NULL", cover, err)
+    }
+
+    // Las acciones al eliminar se aplican.
+    execAll(t, db, "DELETE FROM rolas WHERE id_rola = 1")
+    for _, table := range []string{"lyrics", "tag_frames", "field_sources", "rola_genres"} {
+        if got := queryInts(t, db, "SELECT COUNT(*) FROM "+table+" WHERE id_rola = 1")[0]; got != 0 {
+            t.Errorf("%s: quedaron %d filas de la rola eliminada", table, got)
+        }
+    }
+    execAll(t, db, "DELETE FROM albums WHERE id_album = 1", "DELETE FROM performers WHERE id_performer = 1")
+    if err := db.QueryRow("SELECT id_album, id_performer FROM rolas WHERE id_rola = 2").Scan(&album, &performer); err != nil {
+        t.Fatal(err)
+    }
+    if album.Valid || performer.Valid {
+        t.Errorf("la rola del álbum y del intérprete eliminados quedó con %v y %v, se esperaba NULL", album, performer)
+    }
+    if got := count(db, "performer_aliases"); got != 0 {
+        t.Errorf("quedaron %d alias del intérprete eliminado", got)
+    }
+    assertForeignKeys(t, db)
+}
@@ -6,8 +6,6 @@ import (
     "log"
     _ "github.com/mattn/go-sqlite3"
     "os"
-    "os/user"
-    "path/filepath"
 )
 
 // MusicDataBase es una estructura que maneja la base de datos de la aplicación.
@@ -20,57 +18,56 @@ func NewMusicDataBase(dbPath string) *MusicDataBase {
     return &MusicDataBase{dbPath: dbPath}
 }
 
-// InitializeDatabase se encarga de inicializar la base de datos, creando el directorio
-// y el archivo si no existen, y verificando si el esquema está completo.
-func (mdb *MusicDataBase) InitializeDatabase() error {
-    // Obtener el directorio home del usuario actual
-    usr, err := user.Current()
-    if err != nil {
-        return fmt.Errorf("error obteniendo el usuario actual: %s", err)
-    }
-
-    // Definir la ruta para la base de datos dentro de $HOME/.local/share/DataBase
-    dbDir := filepath.Join(usr.HomeDir, ".local", "share", "DataBase")
-    mdb.dbPath = filepath.Join(dbDir, "MusicDataBase.db")
-
-    // Verificar si el directorio de la base de datos existe, si no, se crea
-    if _, err := os.Stat(dbDir); os.IsNotExist(err) {
-        err := os.MkdirAll(dbDir, os.ModePerm)
-        if err != nil {
-            return fmt.Errorf("error al crear el directorio de la base de datos: %s", err)
-        }
-        fmt.Printf("Directorio creado en: %s\n", dbDir)
-    }
+// busyTimeout es el tiempo en milisegundos que una conexión espera a que otra libere la base de datos antes de fallar
+// con "database is locked". Ninguna transacción copia archivos: las ediciones y la bitácora preparan las copias de
+// los MP3 antes de empezar y dentro sólo las renombran (ver applySongEdits), y el minero lee y analiza cada archivo
+// antes de su transacción (ver SQLiteRepository.AddSong). Así una transacción sólo dura lo que sus escrituras en la
+// base de datos y sus renombres, no lo que tarda copiar cada archivo.
+const busyTimeout = 10000
+
+// OpenDB abre la base de datos SQLite de dbPath. Los parámetros se aplican a cada conexión del pool:
+//   - _foreign_keys: SQLite no revisa las llaves foráneas a menos que se active en cada conexión.
+//   - _journal_mode=WAL: las lecturas no esperan a las escrituras ni las escrituras a las lecturas.
+//   - _busy_timeout: las escrituras simultáneas esperan su turno en lugar de fallar.
+//   - _txlock=immediate: las transacciones toman el candado de escritura al empezar; si lo tomaran hasta su primera
+//     escritura, SQLite no podría esperar a otra transacción y fallaría de inmediato.
+func OpenDB(dbPath string) (*sql.DB, error) {
+    return sql.Open("sqlite3", fmt.Sprintf("%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", dbPath, busyTimeout))
+}
 
+// InitializeDatabase se encarga de inicializar la base de datos con el pool de conexiones db (ver
+// SQLiteRepository), verificando si el esquema está completo.
+func (mdb *MusicDataBase) InitializeDatabase(db *sql.DB) error {
     // Verificar si el archivo de la base de datos existe, si no, se crea
     if _, err := os.Stat(mdb.dbPath); os.IsNotExist(err) {
         fmt.Printf("La base de datos no existe, se creará una nueva en: %s\n", mdb.dbPath)
     }
 
-    // Abrir la conexión a la base de datos
-    db, err := sql.Open("sqlite3", mdb.dbPath)
-    if err != nil {
-        return fmt.Errorf("error al abrir la base de datos: %s", err)
-    }
-    defer db.Close()
-
     // Verificar si el esquema de la base de datos está completo
     if !completeSchemaExists(db) {
         fmt.Println("El esquema no está completo o no existe, se procederá a crear/acompletar el esquema...")
-        createSchema(db)
+        if err := createSchema(db); err != nil {
+            return err
+        }
         fmt.Println("Esquema creado exitosamente.")
     } else {
         fmt.Println("El esquema ya está completo.")
     }
 
+    // Aplicar las migraciones pendientes sobre el esquema base
+    if err := migrateSchema(db); err != nil {
+        return fmt.Errorf("error al migrar el esquema: %s", err)
+    }
+
     return nil
 }
 
+// coreTables son las tablas del esquema base que crea createSchema.
+var coreTables = []string{"types", "performers", "persons", "groups", "in_group", "albums", "rolas"}
+
 // completeSchemaExists verifica si todas las tablas necesarias existen en la base de datos.
 func completeSchemaExists(db *sql.DB) bool {
-    requiredTables := []string{"types", "performers", "persons", "groups", "in_group", "albums", "rolas"}
-
-    for _, table := range requiredTables {
+    for _, table := range coreTables {
         if !tableExists(db, table) {
             return false
         }
@@ -92,25 +89,26 @@ func tableExists(db *sql.DB, tableName string) bool {
     return name == tableName
 }
 
-// createSchema crea las tablas necesarias para la base de datos si no existen.
-func createSchema(db *sql.DB) {
+// createSchema crea las tablas necesarias para la base de datos si no existen. Se crean en una sola transacción, y
+// las que ya existen se conservan, para completar los esquemas que una falla dejó a medias.
+func createSchema(db *sql.DB) error {
     schema := `
-        CREATE TABLE types (
+        CREATE TABLE IF NOT EXISTS types (
             id_type       INTEGER PRIMARY KEY,
             description   TEXT
         );
-        INSERT INTO types VALUES(0,'Person');
-        INSERT INTO types VALUES(1,'Group');
-        INSERT INTO types VALUES(2,'Unknown');
+        INSERT OR IGNORE INTO types VALUES(0,'Person');
+        INSERT OR IGNORE INTO types VALUES(1,'Group');
+        INSERT OR IGNORE INTO types VALUES(2,'Unknown');
 
-        CREATE TABLE performers (
+        CREATE TABLE IF NOT EXISTS performers (
             id_performer  INTEGER PRIMARY KEY,
             id_type       INTEGER,
             name          TEXT,
             FOREIGN KEY   (id_type) REFERENCES types(id_type)
         );
 
-        CREATE TABLE persons (
+        CREATE TABLE IF NOT EXISTS persons (
             id_person     INTEGER PRIMARY KEY,
             stage_name    TEXT,
             real_name     TEXT,
@@ -118,14 +116,14 @@ func createSchema(db *sql.DB) {
             death_date    TEXT
         );
 
-        CREATE TABLE groups (
+        CREATE TABLE IF NOT EXISTS groups (
             id_group      INTEGER PRIMARY KEY,
             name          TEXT,
             start_date    TEXT,
             end_date      TEXT
         );
 
-        CREATE TABLE in_group (
+        CREATE TABLE IF NOT EXISTS in_group (
             id_person     INTEGER,
             id_group      INTEGER,
             PRIMARY KEY   (id_person, id_group),
@@ -133,14 +131,14 @@ func createSchema(db *sql.DB) {
             FOREIGN KEY   (id_group) REFERENCES groups(id_group)
         );
 
-        CREATE TABLE albums (
+        CREATE TABLE IF NOT EXISTS albums (
             id_album      INTEGER PRIMARY KEY,
             path          TEXT,
             name          TEXT,
             year          INTEGER
         );
 
-        CREATE TABLE rolas (
+        CREATE TABLE IF NOT EXISTS rolas (
             id_rola       INTEGER PRIMARY KEY,
             id_performer  INTEGER,
             id_album      INTEGER,
@@ -155,9 +153,71 @@ func createSchema(db *sql.DB) {
     `
 
     // Ejecutar el esquema para crear las tablas necesarias
-    _, err := db.Exec(schema)
+    tx, err := db.Begin()
     if err != nil {
-        log.Fatalf("Error al crear el esquema: %s\n", err)
+        return fmt.Errorf("error al iniciar la transacción: %v", err)
     }
+    defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+    if _, err := tx.Exec(schema); err != nil {
+        return fmt.Errorf("error al crear el esquema: %s", err)
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("error al crear el esquema: %s", err)
+    }
+    return nil
 }
 
+
+// collectGarbage elimina los álbumes y los intérpretes que se quedaron sin canciones, junto con los alias de esos
+// intérpretes (que se eliminan uno por uno para que la bitácora pueda restaurarlos). Regresa cuántos álbumes y
+// cuántos intérpretes eliminó.
+func collectGarbage(j *journal) (int, int, error) {
+    albums, err := queryIDs(j.tx, "SELECT id_album FROM albums WHERE NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_album = albums.id_album)")
+    if err != nil {
+        return 0, 0, err
+    }
+    for _, idAlbum := range albums {
+        if err := j.delete("albums", idAlbum); err != nil {
+            return 0, 0, err
+        }
+    }
+
+    performers, err := queryIDs(j.tx, "SELECT id_performer FROM performers WHERE NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_performer = performers.id_performer)")
+    if err != nil {
+        return 0, 0, err
+    }
+    for _, idPerformer := range performers {
+        aliases, err := queryIDs(j.tx, "SELECT rowid FROM performer_aliases WHERE id_performer = ?", idPerformer)
+        if err != nil {
+            return 0, 0, err
+        }
+        for _, rowID := range aliases {
+            if err := j.delete("performer_aliases", rowID); err != nil {
+                return 0, 0, err
+            }
+        }
+        if err := j.delete("performers", idPerformer); err != nil {
+            return 0, 0, err
+        }
+    }
+    return len(albums), len(performers), nil
+}
+
+// CollectGarbage elimina los álbumes y los intérpretes sin canciones, sin registrarlo en la bitácora. Regresa cuántos
+// álbumes y cuántos intérpretes eliminó.
+func CollectGarbage(db *sql.DB) (int, int, error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return 0, 0, fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+
+    albums, performers, err := collectGarbage(untracked(tx))
+    if err != nil {
+        return 0, 0, err
+    }
+    if err := tx.Commit(); err != nil {
+        return 0, 0, fmt.Errorf("error al guardar los cambios: %v", err)
+    }
+    return albums, performers, nil
+}
@@ -0,0 +1,358 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// DefaultOrganizeTemplate es la plantilla que propone el organizador si no se ha guardado otra.
+const DefaultOrganizeTemplate = "{albumartist}/{year} - {album}/{disc}{track:02} {title}"
+
+const (
+    unknownName   = "Desconocido" // Nombre que se usa en la ruta cuando falta el intérprete o el álbum.
+    maxNameLength = 180           // Longitud máxima, en caracteres, de cada directorio y del nombre de los archivos.
+)
+
+// organizeFields son los campos que se pueden usar en una plantilla del organizador; los numéricos admiten un
+// ancho, rellenado con ceros (e.g., {track:02}).
+var organizeFields = map[string]bool{
+    "albumartist": false,
+    FieldArtist:   false,
+    FieldAlbum:    false,
+    FieldTitle:    false,
+    FieldGenre:    false,
+    FieldYear:     true,
+    FieldTrack:    true,
+    "disc":        true,
+}
+
+// organizePlaceholder reconoce los campos de una plantilla del organizador, con su ancho opcional.
+var organizePlaceholder = regexp.MustCompile(`\{([^{}:]*)(?::([0-9]+))?\}`)
+
+// Limpieza de los nombres de la ruta: paréntesis vacíos y separadores repetidos que quedan cuando falta un dato.
+var (
+    emptyBrackets     = regexp.MustCompile(`\(\s*\)|\[\s*\]`)
+    repeatedSeparator = regexp.MustCompile(`\s*-(?:\s*-)+\s*`)
+)
+
+// reservedNames son los nombres de dispositivos que Windows no permite como nombre de archivo, con o sin extensión.
+var reservedNames = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[1-9]|lpt[1-9])(\..*)?$`)
+
+// organizePart es una parte de un directorio o del nombre del archivo de una plantilla del organizador.
+type organizePart struct {
+    literal string // Texto fijo, si la parte no es un campo.
+    field   string // Campo que se sustituye.
+    width   int    // Ancho mínimo de los números, rellenado con ceros.
+}
+
+// OrganizeTemplate es una plantilla con la que el organizador calcula la ruta nueva de cada archivo, relativa al
+// directorio de música (e.g., "{albumartist}/{year} - {album}/{disc}{track:02} {title}"). La extensión del
+// archivo siempre se conserva.
+type OrganizeTemplate struct {
+    Text       string           // Plantilla tal como la escribió el usuario.
+    components [][]organizePart // Partes de cada directorio y, al final, del nombre del archivo.
+}
+
+// ParseOrganizeTemplate compila una plantilla del organizador. Los directorios se separan con "/" en cualquier
+// sistema. Si la plantilla termina con una extensión de audio (e.g., ".mp3") se ignora, porque cada archivo
+// conserva la suya.
+func ParseOrganizeTemplate(text string) (*OrganizeTemplate, error) {
+    text = strings.Trim(strings.TrimSpace(text), "/")
+    if text == "" {
+        return nil, fmt.Errorf("la plantilla está vacía")
+    }
+    template := &OrganizeTemplate{Text: text}
+    if ext := filepath.Ext(text); ext != "" && IsSupportedAudioFile(ext) {
+        text = strings.TrimSuffix(text, ext)
+    }
+
+    for _, component := range strings.Split(text, "/") {
+        if strings.TrimSpace(component) == "" || component == "." || component == ".." {
+            return nil, fmt.Errorf("la plantilla '%s' tiene un directorio vacío o relativo", template.Text)
+        }
+        var parts []organizePart
+        last := 0
+        for _, match := range organizePlaceholder.FindAllStringSubmatchIndex(component, -1) {
+            field := component[match[2]:match[3]]
+            numeric, ok := organizeFields[field]
+            if !ok {
+                return nil, fmt.Errorf("campo desconocido {%s} en la plantilla '%s'", field, template.Text)
+            }
+            part := organizePart{field: field}
+            if match[4] >= 0 {
+                if !numeric {
+                    return nil, fmt.Errorf("el campo {%s} no es un número y no admite ancho", field)
+                }
+                part.width, _ = strconv.Atoi(component[match[4]:match[5]])
+            }
+            if match[0] > last {
+                parts = append(parts, organizePart{literal: component[last:match[0]]})
+            }
+            parts = append(parts, part)
+            last = match[1]
+        }
+        if last < len(component) {
+            parts = append(parts, organizePart{literal: component[last:]})
+        }
+        template.components = append(template.components, parts)
+    }
+
+    for _, part := range template.components[len(template.components)-1] {
+        if part.field != "" {
+            return template, nil
+        }
+    }
+    return nil, fmt.Errorf("el nombre de archivo de la plantilla '%s' no tiene ningún campo", template.Text)
+}
+
+// Render calcula la ruta de una canción según la plantilla, relativa al directorio de música y sin extensión.
+// albumArtist es el intérprete del álbum de sus etiquetas; si no tiene, se usa el de la canción.
+func (t *OrganizeTemplate) Render(song Song, albumArtist string) string {
+    components := make([]string, len(t.components))
+    for i, parts := range t.components {
+        var name strings.Builder
+        for _, part := range parts {
+            if part.field == "" {
+                name.WriteString(part.literal)
+            } else {
+                name.WriteString(sanitizeName(organizeValue(song, albumArtist, part)))
+            }
+        }
+        components[i] = cleanName(name.String())
+        if components[i] == "" {
+            components[i] = unknownName
+        }
+    }
+    return filepath.Join(components...)
+}
+
+// organizeValue regresa el valor de un campo de la plantilla para una canción. El intérprete y el álbum que faltan
+// se escriben como unknownName y el título que falta, con el nombre actual del archivo. {disc} es el número de disco
+// seguido de un guion, sólo en los álbumes de varios discos (e.g., "2-" en "{disc}{track:02}" da "2-05").
+func organizeValue(song Song, albumArtist string, part organizePart) string {
+    number := func(n int) string {
+        if n <= 0 {
+            return ""
+        }
+        return fmt.Sprintf("%0*d", part.width, n)
+    }
+    firstOf := func(values ...string) string {
+        for _, value := range values {
+            if value != "" {
+                return value
+            }
+        }
+        return ""
+    }
+
+    switch part.field {
+    case "albumartist":
+        return firstOf(albumArtist, song.Artist, unknownName)
+    case FieldArtist:
+        return firstOf(song.Artist, unknownName)
+    case FieldAlbum:
+        return firstOf(song.Album, unknownName)
+    case FieldTitle:
+        return firstOf(song.Title, strings.TrimSuffix(filepath.Base(song.Path), filepath.Ext(song.Path)))
+    case FieldGenre:
+        return song.Genre
+    case FieldYear:
+        return number(song.Year)
+    case FieldTrack:
+        return number(song.Track)
+    case "disc":
+        if song.DiscTotal > 1 || song.Disc > 1 {
+            return number(song.Disc) + "-"
+        }
+    }
+    return ""
+}
+
+// sanitizeName reemplaza los caracteres que FAT y exFAT no admiten en los nombres: las comillas dobles se cambian
+// por simples, las diagonales, ":" y "|" por guiones (": " por " - "), se quitan "?", "*", "<" y ">" y los
+// caracteres de control se cambian por espacios.
+func sanitizeName(value string) string {
+    var name strings.Builder
+    for _, r := range strings.ReplaceAll(value, ": ", " - ") {
+        switch {
+        case r < 0x20 || r == 0x7f:
+            name.WriteRune(' ')
+        case r == '"':
+            name.WriteRune('\'')
+        case r == '/' || r == '\\' || r == ':' || r == '|':
+            name.WriteRune('-')
+        case r == '?' || r == '*' || r == '<' || r == '>':
+        default:
+            name.WriteRune(r)
+        }
+    }
+    return name.String()
+}
+
+// cleanName quita lo que sobra en un directorio o nombre de archivo cuando falta algún dato (e.g., " - Álbum" o
+// "Álbum ()"), los espacios repetidos y los puntos y espacios al inicio o al final, que FAT no admite al final.
+// Los nombres de dispositivos de Windows (CON, NUL...) reciben un guion bajo y los nombres muy largos se recortan.
+func cleanName(name string) string {
+    name = emptyBrackets.ReplaceAllString(name, "")
+    name = repeatedSeparator.ReplaceAllString(name, " - ")
+    name = strings.Join(strings.Fields(name), " ")
+    name = strings.Trim(name, " -_.")
+    if reservedNames.MatchString(name) {
+        name += "_"
+    }
+    if runes := []rune(name); len(runes) > maxNameLength {
+        name = strings.TrimRight(string(runes[:maxNameLength]), " -_.")
+    }
+    return name
+}
+
+// albumArtists regresa el intérprete del álbum de cada rola que lo tiene en sus etiquetas (TPE2 en ID3v2,
+// ALBUMARTIST en Vorbis, aART en MP4).
+func albumArtists(db *sql.DB) (map[int]string, error) {
+    rows, err := db.Query(`SELECT id_rola, value FROM tag_frames
+        WHERE lower(name) IN ('tpe2', 'tp2', 'albumartist', 'album artist', 'album_artist', 'aart') AND value != ''
+        ORDER BY id_rola, name`)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener los intérpretes de los álbumes: %v", err)
+    }
+    defer rows.Close()
+
+    artists := map[int]string{}
+    for rows.Next() {
+        var idRola int
+        var artist string
+        if err := rows.Scan(&idRola, &artist); err != nil {
+            return nil, fmt.Errorf("error al obtener los intérpretes de los álbumes: %v", err)
+        }
+        if _, ok := artists[idRola]; !ok {
+            artists[idRola] = strings.TrimSpace(artist)
+        }
+    }
+    return artists, rows.Err()
+}
+
+// OrganizeMove es el cambio de ruta planeado para el archivo de una rola.
+type OrganizeMove struct {
+    Song Song   // Canción cuyo archivo se mueve.
+    From string // Ruta actual del archivo.
+    To   string // Ruta nueva.
+    Note string // Aclaración, por ejemplo si se agregó un número para no reemplazar otro archivo.
+}
+
+// PlanOrganize calcula la ruta nueva del archivo de cada canción según la plantilla, dentro del directorio de
+// música, sin mover nada: es la simulación que se revisa antes de organizar. Las canciones que ya están en su lugar
+// y los archivos que ya no existen no se incluyen. Si la ruta nueva está ocupada, por un archivo existente o por
+// otra canción del plan, se agrega " (2)", " (3)"... al nombre; las mayúsculas no se distinguen, igual que en FAT.
+func PlanOrganize(db *sql.DB, songs []Song, musicDir string, template *OrganizeTemplate) ([]OrganizeMove, error) {
+    if musicDir == "" {
+        return nil, fmt.Errorf("no hay un directorio de música configurado")
+    }
+    artists, err := albumArtists(db)
+    if err != nil {
+        return nil, err
+    }
+
+    taken := map[string]bool{}
+    var moves []OrganizeMove
+    for _, song := range songs {
+        info, err := os.Lstat(song.Path)
+        if err != nil {
+            continue
+        }
+        target := filepath.Join(musicDir, template.Render(song, artists[song.IDRola]))
+        ext := filepath.Ext(song.Path)
+
+        to, note := target+ext, ""
+        for n := 2; to != song.Path; n++ {
+            existing, err := os.Lstat(to)
+            if !taken[strings.ToLower(to)] && (err != nil || os.SameFile(existing, info)) {
+                break
+            }
+            to = fmt.Sprintf("%s (%d)%s", target, n, ext)
+            note = fmt.Sprintf("ya existe %s", filepath.Base(target+ext))
+        }
+        taken[strings.ToLower(to)] = true
+        if to != song.Path {
+            moves = append(moves, OrganizeMove{Song: song, From: song.Path, To: to, Note: note})
+        }
+    }
+    return moves, nil
+}
+
+// ApplyOrganize mueve los archivos del plan y actualiza rolas.path, y albums.path de los álbumes cuyas canciones
+// quedan en un solo directorio, en una sola transacción que se registra en la bitácora para poder deshacerla.
+// Si algo falla, los archivos ya movidos regresan a su lugar y no cambia nada. Al terminar se eliminan los
+// directorios que quedaron vacíos.
+func ApplyOrganize(db *sql.DB, moves []OrganizeMove) error {
+    if len(moves) == 0 {
+        return nil
+    }
+    return withJournal(db, fmt.Sprintf("Organizar %d archivos", len(moves)), func(j *journal, files *fileChanges) error {
+        albums := map[int64]bool{}
+        for _, move := range moves {
+            var current string
+            var idAlbum sql.NullInt64
+            err := j.tx.QueryRow("SELECT path, id_album FROM rolas WHERE id_rola = ?", move.Song.IDRola).Scan(&current, &idAlbum)
+            if err != nil {
+                return fmt.Errorf("error al obtener la rola %d: %v", move.Song.IDRola, err)
+            }
+            if current != move.From {
+                return fmt.Errorf("%s cambió de ruta después de la vista previa", move.From)
+            }
+
+            if err := files.move(move.From, move.To); err != nil {
+                return err
+            }
+            if err := j.move(move.Song.IDRola, move.From, move.To); err != nil {
+                return err
+            }
+            if err := j.update("rolas", int64(move.Song.IDRola), []string{"path"}, move.To); err != nil {
+                return err
+            }
+            if idAlbum.Valid {
+                albums[idAlbum.Int64] = true
+            }
+        }
+
+        for idAlbum := range albums {
+            dirs, err := albumDirs(j.tx, idAlbum)
+            if err != nil {
+                return err
+            }
+            if len(dirs) == 1 {
+                if err := j.update("albums", idAlbum, []string{"path"}, dirs[0]); err != nil {
+                    return err
+                }
+            }
+        }
+        return nil
+    })
+}
+
+// albumDirs regresa los directorios en los que están las canciones de un álbum.
+func albumDirs(tx *sql.Tx, idAlbum int64) ([]string, error) {
+    rows, err := tx.Query("SELECT path FROM rolas WHERE id_album = ?", idAlbum)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las canciones del álbum: %v", err)
+    }
+    defer rows.Close()
+
+    seen := map[string]bool{}
+    var dirs []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            return nil, fmt.Errorf("error al obtener las canciones del álbum: %v", err)
+        }
+        if dir := filepath.Dir(path); !seen[dir] {
+            seen[dir] = true
+            dirs = append(dirs, dir)
+        }
+    }
+    return dirs, rows.Err()
+}
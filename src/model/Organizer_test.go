@@ -0,0 +1,266 @@
+package model
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestOrganizeTemplateRender(t *testing.T) {
+    template, err := ParseOrganizeTemplate(DefaultOrganizeTemplate)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name        string
+        song        Song
+        albumArtist string
+        want        string
+    }{
+        {"completa", Song{Artist: "Queen", Album: "Jazz", Year: 1978, Track: 3, Title: "Mustapha"}, "",
+            "Queen/1978 - Jazz/03 Mustapha"},
+        {"intérprete del álbum", Song{Artist: "Freddie Mercury", Album: "Jazz", Year: 1978, Track: 3, Title: "Mustapha"}, "Queen",
+            "Queen/1978 - Jazz/03 Mustapha"},
+        {"sin año ni pista", Song{Artist: "Queen", Album: "Jazz", Title: "Mustapha"}, "",
+            "Queen/Jazz/Mustapha"},
+        {"varios discos", Song{Artist: "Pink Floyd", Album: "The Wall", Year: 1979, Disc: 2, DiscTotal: 2, Track: 5, Title: "Vera"}, "",
+            "Pink Floyd/1979 - The Wall/2-05 Vera"},
+        {"caracteres no admitidos", Song{Artist: "AC/DC", Album: "Who Made Who?", Track: 1, Title: `"Heroes": en vivo <*>`}, "",
+            "AC-DC/Who Made Who/01 'Heroes' - en vivo"},
+        {"sin datos", Song{Path: "/música/pista 7.mp3"}, "",
+            "Desconocido/Desconocido/pista 7"},
+        {"nombres reservados", Song{Artist: "Aux", Album: "nul", Title: "CON"}, "",
+            "Aux_/nul_/CON_"},
+        {"puntos y espacios", Song{Artist: "...And You Will Know Us", Album: "Source Tags & Codes.", Track: 1, Title: " Invocation "}, "",
+            "And You Will Know Us/Source Tags & Codes/01 Invocation"},
+    }
+    for _, tt := range tests {
+        if got := template.Render(tt.song, tt.albumArtist); got != filepath.FromSlash(tt.want) {
+            t.Errorf("%s: Render = %q, se esperaba %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestCleanName(t *testing.T) {
+    tests := []struct {
+        name string
+        want string
+    }{
+        {"Álbum ()", "Álbum"},
+        {"Álbum [ ]", "Álbum"},
+        {" - Álbum", "Álbum"},
+        {"1978 -  - Jazz", "1978 - Jazz"},
+        {"  muchos   espacios  ", "muchos espacios"},
+        {"Fin...", "Fin"},
+        {"con", "con_"},
+        {"LPT1.mp3", "LPT1.mp3_"},
+        {"COM10", "COM10"},
+        {"Console", "Console"},
+        {"", ""},
+        {strings.Repeat("á", maxNameLength-1) + " bc", strings.Repeat("á", maxNameLength-1)},
+    }
+    for _, tt := range tests {
+        if got := cleanName(tt.name); got != tt.want {
+            t.Errorf("cleanName(%q) = %q, se esperaba %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+// TestPlanOrganizeCollisions revisa que las rutas repetidas en el plan o ya ocupadas reciban un número y que el
+// plan no mueva nada.
+func TestPlanOrganizeCollisions(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    dir := mineTestSongs(t, repo)
+    if err := os.MkdirAll(filepath.Join(dir, "Todo"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "Todo", "Blues.mp3"), nil, 0644); err != nil {
+        t.Fatal(err)
+    }
+    template, err := ParseOrganizeTemplate("Todo/{genre}")
+    if err != nil {
+        t.Fatal(err)
+    }
+    songs, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    moves, err := PlanOrganize(repo.DB(), songs, dir, template)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    targets := map[string]bool{}
+    notes := 0
+    for _, move := range moves {
+        targets[filepath.Base(move.To)] = true
+        if move.Note != "" {
+            notes++
+        }
+        if _, err := os.Stat(move.From); err != nil {
+            t.Errorf("el plan movió %s", move.From)
+        }
+    }
+    for _, want := range []string{"Rock.mp3", "Rock (2).mp3", "Blues (2).mp3", "Hard Rock.mp3", "Heavy Metal.mp3"} {
+        if !targets[want] {
+            t.Errorf("el plan no tiene %s: %+v", want, moves)
+        }
+    }
+    if len(moves) != len(testSongs) || notes != 2 {
+        t.Errorf("%d movimientos con %d aclaraciones, se esperaban %d con 2", len(moves), notes, len(testSongs))
+    }
+}
+
+// organizedPaths regresa la ruta de cada rola y la del álbum de cada rola en la base de datos.
+func organizedPaths(t *testing.T, repo *SQLiteRepository) (rolas, albums map[int]string) {
+    t.Helper()
+    rows, err := repo.DB().Query("SELECT r.id_rola, r.path, a.path FROM rolas r JOIN albums a ON a.id_album = r.id_album")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer rows.Close()
+    rolas, albums = map[int]string{}, map[int]string{}
+    for rows.Next() {
+        var id int
+        var rola, album string
+        if err := rows.Scan(&id, &rola, &album); err != nil {
+            t.Fatal(err)
+        }
+        rolas[id], albums[id] = rola, album
+    }
+    if err := rows.Err(); err != nil {
+        t.Fatal(err)
+    }
+    return rolas, albums
+}
+
+// TestApplyOrganize organiza la biblioteca de prueba, revisa los archivos y las rutas de la base de datos, y después
+// deshace la organización.
+func TestApplyOrganize(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    dir := mineTestSongs(t, repo)
+    template, err := ParseOrganizeTemplate("{artist}/{album}/{track:02} {title}")
+    if err != nil {
+        t.Fatal(err)
+    }
+    songs, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    moves, err := PlanOrganize(repo.DB(), songs, dir, template)
+    if err != nil || len(moves) != len(testSongs) {
+        t.Fatalf("plan = %+v, %v", moves, err)
+    }
+    rolasBefore, albumsBefore := organizedPaths(t, repo)
+
+    if err := ApplyOrganize(repo.DB(), moves); err != nil {
+        t.Fatal(err)
+    }
+    rolas, albums := organizedPaths(t, repo)
+    for _, move := range moves {
+        if _, err := os.Stat(move.To); err != nil {
+            t.Errorf("el archivo no está en su ruta nueva: %v", err)
+        }
+        if _, err := os.Stat(move.From); !os.IsNotExist(err) {
+            t.Errorf("el archivo sigue en %s", move.From)
+        }
+        if rolas[move.Song.IDRola] != move.To {
+            t.Errorf("rolas.path = %s, se esperaba %s", rolas[move.Song.IDRola], move.To)
+        }
+    }
+    // Las canciones de Paranoid quedan en un directorio; las de Abbey Road, con dos intérpretes, en dos.
+    for _, move := range moves {
+        want := albumsBefore[move.Song.IDRola]
+        if move.Song.Album == "Paranoid" {
+            want = filepath.Join(dir, "Black Sabbath", "Paranoid")
+        }
+        if albums[move.Song.IDRola] != want {
+            t.Errorf("albums.path de %s = %s, se esperaba %s", move.Song.Title, albums[move.Song.IDRola], want)
+        }
+    }
+    for _, old := range []string{"Abbey Road", "Paranoid"} {
+        if _, err := os.Stat(filepath.Join(dir, old)); !os.IsNotExist(err) {
+            t.Errorf("no se eliminó el directorio %s que quedó vacío", old)
+        }
+    }
+
+    if _, err := Undo(repo.DB()); err != nil {
+        t.Fatal(err)
+    }
+    rolas, albums = organizedPaths(t, repo)
+    for _, move := range moves {
+        if _, err := os.Stat(move.From); err != nil {
+            t.Errorf("después de deshacer: %v", err)
+        }
+        if rolas[move.Song.IDRola] != rolasBefore[move.Song.IDRola] || albums[move.Song.IDRola] != albumsBefore[move.Song.IDRola] {
+            t.Errorf("después de deshacer: rolas.path = %s, albums.path = %s", rolas[move.Song.IDRola], albums[move.Song.IDRola])
+        }
+    }
+    for _, organized := range []string{"The Beatles", "Beatles", "Black Sabbath"} {
+        if _, err := os.Stat(filepath.Join(dir, organized)); !os.IsNotExist(err) {
+            t.Errorf("después de deshacer quedó el directorio %s", organized)
+        }
+    }
+}
+
+// TestApplyOrganizeRollback ocupa la ruta nueva del último archivo del plan: la organización debe fallar, regresar
+// los archivos que ya había movido y no cambiar la base de datos ni la bitácora.
+func TestApplyOrganizeRollback(t *testing.T) {
+    repo := openTestSQLiteRepository(t)
+    dir := mineTestSongs(t, repo)
+    template, err := ParseOrganizeTemplate("{artist}/{album}/{track:02} {title}")
+    if err != nil {
+        t.Fatal(err)
+    }
+    songs, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    moves, err := PlanOrganize(repo.DB(), songs, dir, template)
+    if err != nil || len(moves) != len(testSongs) {
+        t.Fatalf("plan = %+v, %v", moves, err)
+    }
+    rolasBefore, albumsBefore := organizedPaths(t, repo)
+
+    blocked := moves[len(moves)-1].To
+    if err := os.MkdirAll(filepath.Dir(blocked), 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(blocked, []byte("otro archivo"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := ApplyOrganize(repo.DB(), moves); err == nil {
+        t.Fatal("se organizó aunque una ruta nueva estaba ocupada")
+    }
+
+    rolas, albums := organizedPaths(t, repo)
+    for _, move := range moves {
+        if _, err := os.Stat(move.From); err != nil {
+            t.Errorf("el archivo no regresó a su ruta: %v", err)
+        }
+        if move.To != blocked {
+            if _, err := os.Stat(move.To); !os.IsNotExist(err) {
+                t.Errorf("el archivo sigue en %s", move.To)
+            }
+            if dir := filepath.Dir(move.To); dir != filepath.Dir(blocked) {
+                if _, err := os.Stat(dir); !os.IsNotExist(err) {
+                    t.Errorf("no se eliminó el directorio %s", dir)
+                }
+            }
+        }
+        if rolas[move.Song.IDRola] != rolasBefore[move.Song.IDRola] || albums[move.Song.IDRola] != albumsBefore[move.Song.IDRola] {
+            t.Errorf("la base de datos cambió: rolas.path = %s, albums.path = %s", rolas[move.Song.IDRola], albums[move.Song.IDRola])
+        }
+    }
+    if data := readFile(t, blocked); string(data) != "otro archivo" {
+        t.Error("se reemplazó el archivo que ocupaba la ruta nueva")
+    }
+    entries, err := GetJournal(repo.DB())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != 0 {
+        t.Errorf("la bitácora tiene %d operaciones, no se esperaba ninguna", len(entries))
+    }
+}
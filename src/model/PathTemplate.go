@@ -0,0 +1,167 @@
+package model
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// pathTemplatePlaceholder reconoce los campos de una plantilla de rutas, como {artist} o {track}.
+var pathTemplatePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// pathTemplatePatterns asocia cada campo que se puede usar en una plantilla con la expresión que lo reconoce.
+// Los campos de texto no cruzan directorios; el año y la pista sólo aceptan dígitos.
+var pathTemplatePatterns = map[string]string{
+    FieldTitle:  `[^/]+?`,
+    FieldArtist: `[^/]+?`,
+    FieldAlbum:  `[^/]+?`,
+    FieldGenre:  `[^/]+?`,
+    FieldYear:   `[0-9]{4}`,
+    FieldTrack:  `[0-9]{1,3}`,
+}
+
+// PathTemplate es una plantilla que describe cómo están organizados los archivos, por ejemplo
+// "{artist}/{year} - {album}/{track} - {title}". Se compara con el final de la ruta del archivo, sin la extensión.
+type PathTemplate struct {
+    Text    string         // Plantilla tal como la escribió el usuario.
+    pattern *regexp.Regexp // Expresión regular equivalente a la plantilla.
+    fields  []string       // Campo de cada grupo de la expresión, en orden.
+}
+
+// PathField es un dato de una rola obtenido de la ruta de su archivo.
+type PathField struct {
+    Field  string // Campo de la rola (FieldTitle, FieldArtist...).
+    Value  string // Valor tal como aparece en la ruta.
+    Source string // SourceFilename si viene del nombre del archivo, SourceFolder si viene de un directorio o SourceGuessed.
+}
+
+// ParsePathTemplate compila una plantilla de rutas. Los directorios se separan con "/" en cualquier sistema.
+func ParsePathTemplate(text string) (*PathTemplate, error) {
+    text = strings.Trim(strings.TrimSpace(text), "/")
+    if text == "" {
+        return nil, fmt.Errorf("la plantilla está vacía")
+    }
+
+    template := &PathTemplate{Text: text}
+    var pattern strings.Builder
+    pattern.WriteString(`(?:^|/)`)
+    last := 0
+    for _, match := range pathTemplatePlaceholder.FindAllStringSubmatchIndex(text, -1) {
+        field := text[match[2]:match[3]]
+        fieldPattern, ok := pathTemplatePatterns[field]
+        if !ok {
+            return nil, fmt.Errorf("campo desconocido {%s} en la plantilla '%s'", field, text)
+        }
+        pattern.WriteString(regexp.QuoteMeta(text[last:match[0]]))
+        pattern.WriteString("(" + fieldPattern + ")")
+        template.fields = append(template.fields, field)
+        last = match[1]
+    }
+    pattern.WriteString(regexp.QuoteMeta(text[last:]) + "$")
+
+    if len(template.fields) == 0 {
+        return nil, fmt.Errorf("la plantilla '%s' no tiene ningún campo", text)
+    }
+    template.pattern = regexp.MustCompile(pattern.String())
+    return template, nil
+}
+
+// ParsePathTemplates compila una lista de plantillas, una por línea, ignorando las líneas vacías.
+func ParsePathTemplates(lines []string) ([]*PathTemplate, error) {
+    var templates []*PathTemplate
+    for _, line := range lines {
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+        template, err := ParsePathTemplate(line)
+        if err != nil {
+            return nil, err
+        }
+        templates = append(templates, template)
+    }
+    return templates, nil
+}
+
+// Match compara la plantilla con la ruta de un archivo y regresa los datos que contiene. Los datos del último
+// componente de la ruta se marcan como obtenidos del nombre del archivo y los demás, de su directorio.
+func (t *PathTemplate) Match(filePath string) ([]PathField, bool) {
+    path := filepath.ToSlash(strings.TrimSuffix(filePath, filepath.Ext(filePath)))
+    match := t.pattern.FindStringSubmatchIndex(path)
+    if match == nil {
+        return nil, false
+    }
+
+    fileNameStart := strings.LastIndex(path, "/") + 1
+    var fields []PathField
+    for i, field := range t.fields {
+        value := strings.TrimSpace(path[match[2*i+2]:match[2*i+3]])
+        if value == "" {
+            continue
+        }
+        source := SourceFolder
+        if match[2*i+2] >= fileNameStart {
+            source = SourceFilename
+        }
+        fields = append(fields, PathField{Field: field, Value: value, Source: source})
+    }
+    return fields, true
+}
+
+// InferPathFields obtiene los datos que se pueden deducir de la ruta de un archivo. Se usa la primera plantilla que
+// coincida con la ruta relativa al directorio de música, para que las plantillas nunca tomen datos de los directorios
+// superiores; los datos que ninguna plantilla da se toman del nombre del archivo ("03 - Título"), del nombre de su
+// directorio (el álbum) y de un año en ese nombre. El intérprete sólo se toma de una plantilla con {artist}.
+func InferPathFields(filePath, musicDir string, templates []*PathTemplate) map[string]PathField {
+    relative := filePath
+    if musicDir != "" {
+        if rel, err := filepath.Rel(musicDir, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+            relative = rel
+        }
+    }
+
+    inferred := map[string]PathField{}
+    for _, template := range templates {
+        if fields, ok := template.Match(relative); ok {
+            for _, field := range fields {
+                inferred[field.Field] = field
+            }
+            break
+        }
+    }
+
+    add := func(field, value, source string) {
+        if _, ok := inferred[field]; !ok && value != "" && value != "0" {
+            inferred[field] = PathField{Field: field, Value: value, Source: source}
+        }
+    }
+    track, title := fileNameFields(filePath)
+    add(FieldTitle, title, SourceFilename)
+    add(FieldTrack, strconv.Itoa(track), SourceFilename)
+    add(FieldAlbum, filepath.Base(filepath.Dir(filePath)), SourceFolder)
+    add(FieldYear, strconv.Itoa(folderYearGuess(filePath)), SourceGuessed)
+    return inferred
+}
+
+// SamplePaths regresa hasta n archivos de audio del directorio, repartidos a lo largo de todo el árbol de directorios,
+// para probar las plantillas con distintos artistas y álbumes.
+func SamplePaths(dir string, n int) []string {
+    var paths []string
+    filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err == nil && !info.IsDir() && IsSupportedAudioFile(path) {
+            paths = append(paths, path)
+        }
+        return nil
+    })
+    if len(paths) <= n {
+        return paths
+    }
+
+    sample := make([]string, n)
+    for i := range sample {
+        sample[i] = paths[i*len(paths)/n]
+    }
+    return sample
+}
@@ -0,0 +1,269 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// Performer es un intérprete de la biblioteca.
+type Performer struct {
+    ID      int      // ID del intérprete.
+    Name    string   // Nombre canónico.
+    Aliases []string // Otros nombres que se cambian por éste al minar y al editar.
+    Songs   int      // Número de canciones del intérprete.
+}
+
+// PerformerCluster es un conjunto de intérpretes cuyos nombres parecen ser el mismo.
+type PerformerCluster struct {
+    Performers []Performer // Intérpretes del grupo, del que tiene más canciones al que tiene menos.
+    Suggested  int         // Índice en Performers del nombre que se sugiere conservar.
+}
+
+// canonicalPerformer regresa el nombre canónico de un intérprete: si el nombre es un alias, el nombre del intérprete
+// del alias; si no, el mismo nombre.
+func canonicalPerformer(q queryer, name string) (string, error) {
+    var canonical string
+    err := q.QueryRow("SELECT performers.name FROM performer_aliases "+
+        "JOIN performers ON performers.id_performer = performer_aliases.id_performer "+
+        "WHERE performer_aliases.alias = ?", name).Scan(&canonical)
+    if err == sql.ErrNoRows {
+        return name, nil
+    }
+    if err != nil {
+        return "", fmt.Errorf("error al leer los alias de los intérpretes: %v", err)
+    }
+    return canonical, nil
+}
+
+// GetPerformers regresa los intérpretes de la biblioteca, con sus alias, ordenados por nombre.
+func GetPerformers(db *sql.DB) ([]Performer, error) {
+    rows, err := db.Query(`SELECT performers.id_performer, COALESCE(performers.name, ''),
+               (SELECT COUNT(*) FROM rolas WHERE rolas.id_performer = performers.id_performer)
+        FROM performers ORDER BY performers.name, performers.id_performer`)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer los intérpretes: %v", err)
+    }
+    var performers []Performer
+    index := map[int]int{}
+    for rows.Next() {
+        var performer Performer
+        if err := rows.Scan(&performer.ID, &performer.Name, &performer.Songs); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("error al leer los intérpretes: %v", err)
+        }
+        index[performer.ID] = len(performers)
+        performers = append(performers, performer)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error al leer los intérpretes: %v", err)
+    }
+
+    aliasRows, err := db.Query("SELECT alias, id_performer FROM performer_aliases ORDER BY alias")
+    if err != nil {
+        return nil, fmt.Errorf("error al leer los alias de los intérpretes: %v", err)
+    }
+    defer aliasRows.Close()
+    for aliasRows.Next() {
+        var alias string
+        var id int
+        if err := aliasRows.Scan(&alias, &id); err != nil {
+            return nil, fmt.Errorf("error al leer los alias de los intérpretes: %v", err)
+        }
+        if i, ok := index[id]; ok {
+            performers[i].Aliases = append(performers[i].Aliases, alias)
+        }
+    }
+    return performers, aliasRows.Err()
+}
+
+// performerKey normaliza el nombre de un intérprete para agruparlo con sus variantes: sin mayúsculas, acentos ni
+// puntuación (ver NormalizeText), sin el artículo "the" al principio o al final ("The Beatles", "Beatles, The") y
+// sin las conjunciones que suelen escribirse de varias formas ("Simon & Garfunkel", "Simon and Garfunkel").
+func performerKey(name string) string {
+    words := strings.Fields(NormalizeText(name))
+    if len(words) > 1 && words[0] == "the" {
+        words = words[1:]
+    } else if len(words) > 1 && words[len(words)-1] == "the" {
+        words = words[:len(words)-1]
+    }
+    kept := words[:0]
+    for _, word := range words {
+        if word != "and" && word != "y" {
+            kept = append(kept, word)
+        }
+    }
+    return strings.Join(kept, " ")
+}
+
+// minSimilarKeyLength es la longitud mínima de dos nombres normalizados para agruparlos aunque difieran en una letra;
+// los nombres cortos que difieren en una letra suelen ser intérpretes distintos ("Blur" y "Blue").
+const minSimilarKeyLength = 8
+
+// editDistance calcula la distancia de edición entre dos textos: el número mínimo de letras que hay que insertar,
+// eliminar o cambiar, o de pares de letras vecinas que hay que intercambiar, para convertir uno en el otro.
+func editDistance(a, b string) int {
+    ra, rb := []rune(a), []rune(b)
+    rows := make([][]int, len(ra)+1)
+    for i := range rows {
+        rows[i] = make([]int, len(rb)+1)
+        rows[i][0] = i
+    }
+    for j := range rows[0] {
+        rows[0][j] = j
+    }
+    for i := 1; i <= len(ra); i++ {
+        for j := 1; j <= len(rb); j++ {
+            cost := 1
+            if ra[i-1] == rb[j-1] {
+                cost = 0
+            }
+            rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+            if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+                rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+            }
+        }
+    }
+    return rows[len(ra)][len(rb)]
+}
+
+// wellFormedName indica si el nombre de un intérprete está bien escrito para sugerirlo como el nombre que se
+// conserva: con mayúsculas y minúsculas, espacios simples y sin el artículo al final ("Beatles, The").
+func wellFormedName(name string) bool {
+    return hasMixedCase(name) && name == strings.Join(strings.Fields(name), " ") &&
+        !strings.HasSuffix(strings.ToLower(name), ", the")
+}
+
+// SuggestPerformerMerges agrupa los intérpretes cuyos nombres parecen ser el mismo: los que tienen el mismo nombre
+// normalizado (ver performerKey) y los de nombres largos que difieren en una sola letra ("Juan Gabriel" y
+// "Juan Gabriell"). En cada grupo se sugiere el nombre bien escrito (ver wellFormedName) con más canciones.
+func suggestPerformerMerges(performers []Performer) []PerformerCluster {
+    // Los intérpretes con el mismo nombre normalizado se agrupan directamente; después se unen los grupos con
+    // nombres parecidos.
+    var keys []string
+    byKey := map[string][]Performer{}
+    for _, performer := range performers {
+        key := performerKey(performer.Name)
+        if _, ok := byKey[key]; !ok {
+            keys = append(keys, key)
+        }
+        byKey[key] = append(byKey[key], performer)
+    }
+    sort.Strings(keys)
+
+    parent := make([]int, len(keys))
+    for i := range parent {
+        parent[i] = i
+    }
+    var find func(i int) int
+    find = func(i int) int {
+        if parent[i] != i {
+            parent[i] = find(parent[i])
+        }
+        return parent[i]
+    }
+    // Sólo se comparan los nombres cuyas longitudes difieren a lo más en una letra.
+    byLength := make([]int, len(keys))
+    lengths := make([]int, len(keys))
+    for i, key := range keys {
+        byLength[i], lengths[i] = i, len([]rune(key))
+    }
+    sort.SliceStable(byLength, func(a, b int) bool { return lengths[byLength[a]] < lengths[byLength[b]] })
+    for a, i := range byLength {
+        if lengths[i] < minSimilarKeyLength {
+            continue
+        }
+        for _, j := range byLength[a+1:] {
+            if lengths[j]-lengths[i] > 1 {
+                break
+            }
+            if editDistance(keys[i], keys[j]) <= 1 {
+                parent[find(j)] = find(i)
+            }
+        }
+    }
+
+    grouped := map[int][]Performer{}
+    var roots []int
+    for i, key := range keys {
+        root := find(i)
+        if _, ok := grouped[root]; !ok {
+            roots = append(roots, root)
+        }
+        grouped[root] = append(grouped[root], byKey[key]...)
+    }
+
+    var clusters []PerformerCluster
+    for _, root := range roots {
+        members := grouped[root]
+        if len(members) < 2 {
+            continue
+        }
+        sort.SliceStable(members, func(i, j int) bool { return members[i].Songs > members[j].Songs })
+        suggested := 0
+        for i, performer := range members {
+            if wellFormedName(performer.Name) && !wellFormedName(members[suggested].Name) {
+                suggested = i
+            }
+        }
+        clusters = append(clusters, PerformerCluster{Performers: members, Suggested: suggested})
+    }
+    return clusters
+}
+
+// hasMixedCase indica si un texto tiene letras mayúsculas y minúsculas.
+func hasMixedCase(text string) bool {
+    return strings.IndexFunc(text, unicode.IsUpper) >= 0 && strings.IndexFunc(text, unicode.IsLower) >= 0
+}
+
+// MergePerformers une varios intérpretes en uno: sus canciones pasan al intérprete into, sus nombres y sus alias
+// quedan como alias de into (para que al volver a minar sus archivos se use into) y se eliminan. Sólo cambia la base
+// de datos, no las etiquetas de los archivos. El cambio se registra en la bitácora.
+func mergePerformers(db *sql.DB, performers []Performer, into Performer) error {
+    description := fmt.Sprintf("Unir %d intérpretes en \"%s\"", len(performers), into.Name)
+    return withJournal(db, description, func(j *journal, _ *fileChanges) error {
+        // Los alias distinguen mayúsculas: "JUAN GABRIEL" es un alias de "Juan Gabriel".
+        aliases := map[string]bool{into.Name: true}
+        for _, alias := range into.Aliases {
+            aliases[alias] = true
+        }
+        for _, performer := range performers {
+            if performer.ID == into.ID {
+                continue
+            }
+            rolas, err := queryIDs(j.tx, "SELECT id_rola FROM rolas WHERE id_performer = ?", performer.ID)
+            if err != nil {
+                return err
+            }
+            for _, idRola := range rolas {
+                if err := j.update("rolas", idRola, []string{"id_performer"}, into.ID); err != nil {
+                    return err
+                }
+            }
+
+            // Los alias del intérprete pasan a into; su nombre se agrega como alias si no lo es ya.
+            rowIDs, err := queryIDs(j.tx, "SELECT rowid FROM performer_aliases WHERE id_performer = ?", performer.ID)
+            if err != nil {
+                return err
+            }
+            for _, rowID := range rowIDs {
+                if err := j.update("performer_aliases", rowID, []string{"id_performer"}, into.ID); err != nil {
+                    return err
+                }
+            }
+            if err := j.delete("performers", int64(performer.ID)); err != nil {
+                return err
+            }
+            if !aliases[performer.Name] && performer.Name != "" {
+                aliases[performer.Name] = true
+                if _, err := j.insert("performer_aliases", []string{"alias", "id_performer"}, performer.Name, into.ID); err != nil {
+                    return err
+                }
+            }
+        }
+        return nil
+    })
+}
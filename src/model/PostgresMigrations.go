@@ -0,0 +1,245 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+)
+
+// postgresMigrationLock es la llave del candado de PostgreSQL con el que las estaciones de trabajo que abren el
+// catálogo al mismo tiempo aplican las migraciones una por una.
+const postgresMigrationLock = 7354201
+
+// postgresMigrations contiene las migraciones del esquema del catálogo compartido en PostgreSQL, ordenadas por
+// versión. Las tablas y columnas son las mismas que las de SQLite (sin la bitácora, que es de cada estación), con
+// los tipos de PostgreSQL; las banderas (vbr, hidden...) siguen siendo enteros 0 o 1 para que las consultas de
+// canciones sirvan en ambas bases de datos.
+var postgresMigrations = []migration{
+    {
+        version:     1,
+        description: "esquema base del catálogo compartido",
+        statements: []string{
+            `CREATE TABLE types (
+                id_type       INTEGER PRIMARY KEY,
+                description   TEXT
+            )`,
+            `INSERT INTO types VALUES (0, 'Person'), (1, 'Group'), (2, 'Unknown')`,
+            `CREATE TABLE performers (
+                id_performer  INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                id_type       INTEGER REFERENCES types(id_type),
+                name          TEXT
+            )`,
+            `CREATE UNIQUE INDEX performers_name ON performers(name)`,
+            `CREATE TABLE persons (
+                id_person     INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                stage_name    TEXT,
+                real_name     TEXT,
+                birth_date    TEXT,
+                death_date    TEXT
+            )`,
+            `CREATE TABLE groups (
+                id_group      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                name          TEXT,
+                start_date    TEXT,
+                end_date      TEXT
+            )`,
+            `CREATE TABLE in_group (
+                id_person     INTEGER REFERENCES persons(id_person),
+                id_group      INTEGER REFERENCES groups(id_group),
+                PRIMARY KEY   (id_person, id_group)
+            )`,
+            `CREATE TABLE covers (
+                id_cover      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                hash          TEXT UNIQUE,
+                path          TEXT
+            )`,
+            `CREATE TABLE albums (
+                id_album      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                path          TEXT,
+                name          TEXT,
+                year          INTEGER,
+                id_cover      INTEGER REFERENCES covers(id_cover),
+                loudness      DOUBLE PRECISION,
+                peak          DOUBLE PRECISION
+            )`,
+            `CREATE UNIQUE INDEX albums_name ON albums(name)`,
+            `CREATE TABLE rolas (
+                id_rola            INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                id_performer       INTEGER REFERENCES performers(id_performer) ON DELETE SET NULL,
+                id_album           INTEGER REFERENCES albums(id_album) ON DELETE SET NULL,
+                path               TEXT,
+                title              TEXT,
+                track              INTEGER,
+                year               INTEGER,
+                genre              TEXT,
+                container          TEXT,
+                codec              TEXT,
+                duration           DOUBLE PRECISION,
+                bitrate            INTEGER,
+                sample_rate        INTEGER,
+                channel_mode       TEXT,
+                encoder            TEXT,
+                vbr                INTEGER,
+                health             TEXT,
+                health_detail      TEXT,
+                audio_hash         TEXT,
+                hidden             INTEGER NOT NULL DEFAULT 0,
+                fingerprint        BYTEA,
+                loudness           DOUBLE PRECISION,
+                peak               DOUBLE PRECISION,
+                loudness_histogram BYTEA,
+                bpm                DOUBLE PRECISION,
+                musical_key        TEXT,
+                tempo_key_analyzed INTEGER NOT NULL DEFAULT 0,
+                composer           TEXT,
+                comment            TEXT,
+                disc               INTEGER,
+                disc_total         INTEGER,
+                track_total        INTEGER
+            )`,
+            `CREATE INDEX rolas_id_performer ON rolas(id_performer)`,
+            `CREATE INDEX rolas_id_album ON rolas(id_album)`,
+            `CREATE UNIQUE INDEX rolas_path ON rolas(path)`,
+            `CREATE TABLE lyrics (
+                id_lyrics     INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                id_rola       INTEGER REFERENCES rolas(id_rola) ON DELETE CASCADE,
+                language      TEXT,
+                description   TEXT,
+                text          TEXT
+            )`,
+            `CREATE INDEX lyrics_id_rola ON lyrics(id_rola)`,
+            `CREATE TABLE tag_frames (
+                id_rola       INTEGER REFERENCES rolas(id_rola) ON DELETE CASCADE,
+                name          TEXT,
+                value         TEXT
+            )`,
+            `CREATE INDEX tag_frames_id_rola ON tag_frames(id_rola)`,
+            `CREATE TABLE field_sources (
+                id_rola       INTEGER REFERENCES rolas(id_rola) ON DELETE CASCADE,
+                field         TEXT,
+                source        TEXT,
+                PRIMARY KEY   (id_rola, field)
+            )`,
+            // Los nombres de los géneros y de sus alias no distinguen mayúsculas, como COLLATE NOCASE en SQLite.
+            `CREATE TABLE genres (
+                id_genre      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+                name          TEXT,
+                id_parent     INTEGER REFERENCES genres(id_genre)
+            )`,
+            `CREATE UNIQUE INDEX genres_name ON genres(lower(name))`,
+            `CREATE TABLE genre_aliases (
+                alias         TEXT PRIMARY KEY,
+                id_genre      INTEGER REFERENCES genres(id_genre)
+            )`,
+            `CREATE UNIQUE INDEX genre_aliases_alias ON genre_aliases(lower(alias))`,
+            `CREATE TABLE rola_genres (
+                id_rola       INTEGER REFERENCES rolas(id_rola) ON DELETE CASCADE,
+                id_genre      INTEGER REFERENCES genres(id_genre),
+                position      INTEGER,
+                PRIMARY KEY   (id_rola, id_genre)
+            )`,
+            `CREATE INDEX rola_genres_id_genre ON rola_genres(id_genre)`,
+            `CREATE TABLE performer_aliases (
+                alias         TEXT PRIMARY KEY,
+                id_performer  INTEGER REFERENCES performers(id_performer) ON DELETE CASCADE
+            )`,
+        },
+    },
+    {
+        version:     2,
+        description: "extensión unaccent para buscar sin distinguir acentos",
+        apply:       createUnaccentExtension,
+    },
+    {
+        version:     3,
+        description: "álbumes identificados por su nombre y su directorio",
+        // Dos álbumes con el mismo nombre de distintos intérpretes ("Greatest Hits") están en distintos directorios.
+        statements: []string{
+            "DROP INDEX albums_name",
+            "CREATE UNIQUE INDEX albums_name_path ON albums(name, path)",
+        },
+    },
+}
+
+// createUnaccentExtension instala la extensión unaccent, con la que las búsquedas no distinguen acentos. Si el
+// usuario no tiene permiso para instalarla (o el servidor no la tiene) la migración no falla: las búsquedas sólo
+// dejan de ignorar los acentos hasta que un administrador la instale.
+func createUnaccentExtension(tx *sql.Tx) error {
+    // Un error dentro de una transacción de PostgreSQL la invalida; el punto de guardado permite seguir.
+    if _, err := tx.Exec("SAVEPOINT unaccent"); err != nil {
+        return fmt.Errorf("error al crear el punto de guardado: %v", err)
+    }
+    if _, err := tx.Exec("CREATE EXTENSION IF NOT EXISTS unaccent"); err != nil {
+        fmt.Printf("No se pudo instalar la extensión unaccent, las búsquedas distinguirán acentos: %v\n", err)
+        if _, err := tx.Exec("ROLLBACK TO SAVEPOINT unaccent"); err != nil {
+            return fmt.Errorf("error al regresar al punto de guardado: %v", err)
+        }
+    }
+    return nil
+}
+
+// latestPostgresVersion regresa la versión más reciente del esquema de PostgreSQL.
+func latestPostgresVersion() int {
+    return postgresMigrations[len(postgresMigrations)-1].version
+}
+
+// migratePostgres aplica, dentro de una transacción cada una, las migraciones del catálogo compartido que aún no se
+// han ejecutado. La versión se guarda en la tabla schema_version. Cada migración toma un candado de PostgreSQL y
+// vuelve a leer la versión, así que si varias estaciones abren el catálogo a la vez sólo una la aplica.
+func migratePostgres(db *sql.DB) error {
+    if _, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)"); err != nil {
+        return fmt.Errorf("error al crear la tabla de la versión del esquema: %v", err)
+    }
+    var stored int
+    if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&stored); err != nil {
+        return fmt.Errorf("error leyendo la versión del esquema: %v", err)
+    }
+    if latest := latestPostgresVersion(); stored > latest {
+        return fmt.Errorf("el catálogo es de una versión más nueva de la aplicación (esquema %d; esta versión llega al %d)", stored, latest)
+    }
+
+    for _, m := range postgresMigrations {
+        tx, err := db.Begin()
+        if err != nil {
+            return fmt.Errorf("error iniciando la migración %d: %v", m.version, err)
+        }
+        if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("error al esperar a las otras estaciones: %v", err)
+        }
+        var current int
+        if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("error leyendo la versión del esquema: %v", err)
+        }
+        if m.version <= current {
+            tx.Rollback()
+            continue
+        }
+
+        for _, statement := range m.statements {
+            if _, err := tx.Exec(statement); err != nil {
+                tx.Rollback()
+                return fmt.Errorf("error en la migración %d (%s): %v", m.version, m.description, err)
+            }
+        }
+        if m.apply != nil {
+            if err := m.apply(tx); err != nil {
+                tx.Rollback()
+                return fmt.Errorf("error en la migración %d (%s): %v", m.version, m.description, err)
+            }
+        }
+        if _, err := tx.Exec("DELETE FROM schema_version"); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("error actualizando la versión del esquema: %v", err)
+        }
+        if _, err := tx.Exec("INSERT INTO schema_version (version) VALUES ($1)", m.version); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("error actualizando la versión del esquema: %v", err)
+        }
+        if err := tx.Commit(); err != nil {
+            return fmt.Errorf("error confirmando la migración %d: %v", m.version, err)
+        }
+        fmt.Printf("Migración %d del catálogo compartido aplicada: %s\n", m.version, m.description)
+    }
+    return nil
+}
@@ -0,0 +1,429 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "strconv"
+    "strings"
+
+    _ "github.com/lib/pq" // Importa el driver de PostgreSQL
+)
+
+// PostgresRepository es un Repository sobre una base de datos PostgreSQL, para que varias estaciones de trabajo
+// compartan un solo catálogo. El esquema es el mismo que el de SQLite (ver postgresMigrations) y las consultas de
+// canciones y de búsqueda son las mismas, traducidas: los parámetros "?" se cambian por "$1", "$2"... y las búsquedas
+// usan ILIKE y, si está instalada la extensión, unaccent, así que no distinguen mayúsculas ni acentos.
+type PostgresRepository struct {
+    db       *sql.DB // Pool de conexiones.
+    unaccent bool    // Indica si la extensión unaccent está instalada.
+}
+
+// postgresSongQuery es SongQuery en el dialecto de PostgreSQL.
+var postgresSongQuery = strings.NewReplacer(
+    "group_concat(field || '=' || source)", "string_agg(field || '=' || source, ',')",
+).Replace(SongQuery)
+
+// OpenPostgresRepository se conecta al catálogo compartido con el DSN indicado (e.g.,
+// "postgres://usuario@servidor/musica?sslmode=disable", con la contraseña en ~/.pgpass) y crea o actualiza su esquema.
+func OpenPostgresRepository(dsn string) (*PostgresRepository, error) {
+    db, err := sql.Open("postgres", dsn)
+    if err != nil {
+        return nil, fmt.Errorf("error al abrir el catálogo compartido: %v", err)
+    }
+    if err := db.Ping(); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("error al conectarse al catálogo compartido: %v", err)
+    }
+    if err := migratePostgres(db); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("error al migrar el esquema del catálogo compartido: %v", err)
+    }
+    r := &PostgresRepository{db: db}
+    if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_extension WHERE extname = 'unaccent')").Scan(&r.unaccent); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("error al leer las extensiones del catálogo compartido: %v", err)
+    }
+    return r, nil
+}
+
+// Close cierra el pool de conexiones.
+func (r *PostgresRepository) Close() error {
+    return r.db.Close()
+}
+
+// rebind cambia los parámetros "?" de una consulta por los de PostgreSQL ("$1", "$2"...). Las consultas de la
+// aplicación no tienen signos de interrogación dentro de sus cadenas; los textos siempre se pasan como parámetros.
+func rebind(query string) string {
+    var result strings.Builder
+    n := 0
+    for _, r := range query {
+        if r == '?' {
+            n++
+            result.WriteString("$" + strconv.Itoa(n))
+            continue
+        }
+        result.WriteRune(r)
+    }
+    return result.String()
+}
+
+// postgresQueryer ejecuta en PostgreSQL las consultas escritas para SQLite que comparten ambas bases de datos
+// (como las de knownGenre y canonicalPerformer), cambiando sus parámetros con rebind.
+type postgresQueryer struct {
+    q queryer
+}
+
+func (p postgresQueryer) QueryRow(query string, args ...interface{}) *sql.Row {
+    return p.q.QueryRow(rebind(query), args...)
+}
+
+// Songs regresa todas las canciones, excepto las ocultas.
+func (r *PostgresRepository) Songs() ([]Song, error) {
+    return querySongs(r.db, postgresSongQuery+" WHERE "+VisibleSongCondition+" ORDER BY rolas.id_rola")
+}
+
+// Song regresa una canción por su ID, aunque esté oculta.
+func (r *PostgresRepository) Song(idRola int) (Song, error) {
+    songs, err := querySongs(r.db, rebind(postgresSongQuery+" WHERE rolas.id_rola = ?"), idRola)
+    if err != nil {
+        return Song{}, err
+    }
+    if len(songs) == 0 {
+        return Song{}, fmt.Errorf("no existe la canción %d", idRola)
+    }
+    return songs[0], nil
+}
+
+// AlbumSongs regresa las canciones de un álbum, excepto las ocultas, ordenadas por disco y pista.
+func (r *PostgresRepository) AlbumSongs(idAlbum int) ([]Song, error) {
+    return querySongs(r.db, rebind(postgresSongQuery+" WHERE rolas.id_album = ? AND "+VisibleSongCondition+AlbumSongOrder), idAlbum)
+}
+
+// Albums regresa los álbumes con la ruta de su portada, ordenados por nombre.
+func (r *PostgresRepository) Albums() ([]Album, error) {
+    // La consulta no tiene parámetros ni funciones propias de SQLite.
+    return (&SQLiteRepository{db: r.db}).Albums()
+}
+
+// Performers regresa los intérpretes con sus alias, ordenados por nombre.
+func (r *PostgresRepository) Performers() ([]Performer, error) {
+    return GetPerformers(r.db)
+}
+
+// SuggestPerformerMerges agrupa los intérpretes cuyos nombres parecen ser el mismo (ver suggestPerformerMerges).
+func (r *PostgresRepository) SuggestPerformerMerges() ([]PerformerCluster, error) {
+    performers, err := GetPerformers(r.db)
+    if err != nil {
+        return nil, err
+    }
+    return suggestPerformerMerges(performers), nil
+}
+
+// MergePerformers une varios intérpretes en el intérprete into, como mergePerformers pero en una transacción sin
+// bitácora: en el catálogo compartido la unión no se puede deshacer.
+func (r *PostgresRepository) MergePerformers(performers []Performer, into Performer) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback()
+
+    for _, performer := range performers {
+        if performer.ID == into.ID {
+            continue
+        }
+        for _, statement := range []string{
+            "UPDATE rolas SET id_performer = $1 WHERE id_performer = $2",
+            "UPDATE performer_aliases SET id_performer = $1 WHERE id_performer = $2",
+        } {
+            if _, err := tx.Exec(statement, into.ID, performer.ID); err != nil {
+                return fmt.Errorf("error al unir los intérpretes: %v", err)
+            }
+        }
+        if _, err := tx.Exec("DELETE FROM performers WHERE id_performer = $1", performer.ID); err != nil {
+            return fmt.Errorf("error al unir los intérpretes: %v", err)
+        }
+        // El nombre del intérprete queda como alias de into, salvo que sea el nombre de into.
+        if performer.Name != "" && performer.Name != into.Name {
+            if _, err := tx.Exec("INSERT INTO performer_aliases (alias, id_performer) VALUES ($1, $2) ON CONFLICT (alias) DO NOTHING",
+                performer.Name, into.ID); err != nil {
+                return fmt.Errorf("error al unir los intérpretes: %v", err)
+            }
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("error al guardar los cambios: %v", err)
+    }
+    return nil
+}
+
+// Search regresa las canciones que cumplen los filtros de una búsqueda (ver CompileSearch).
+func (r *PostgresRepository) Search(query string) ([]Song, error) {
+    where, args, err := compileSearchConditions(query, postgresSearch{r})
+    if err != nil {
+        return nil, err
+    }
+    return runSearch(r.db, rebind(postgresSongQuery+where), args)
+}
+
+// postgresSearch es el dialecto de las búsquedas en PostgreSQL.
+type postgresSearch struct {
+    r *PostgresRepository
+}
+
+func (d postgresSearch) like(column string) string {
+    if d.r.unaccent {
+        return "unaccent(" + column + ") ILIKE unaccent(?)"
+    }
+    return column + " ILIKE ?"
+}
+
+// number convierte la columna a DOUBLE PRECISION: los parámetros se envían como texto y, comparados con una columna
+// INTEGER como bitrate o sample_rate, PostgreSQL rechaza los que tienen decimales.
+func (d postgresSearch) number(column string) string {
+    return "CAST(" + column + " AS DOUBLE PRECISION)"
+}
+
+func (d postgresSearch) genreIDs(value string, subgenres bool) ([]int, error) {
+    query, arg := d.like("name"), "%"+value+"%"
+    canonical, ok, err := knownGenre(postgresQueryer{d.r.db}, value)
+    if err != nil {
+        return nil, err
+    }
+    if ok {
+        query, arg = "lower(name) = lower(?)", canonical
+    }
+
+    rows, err := d.r.db.Query(rebind("SELECT id_genre FROM genres WHERE "+query), arg)
+    if err != nil {
+        return nil, fmt.Errorf("error al buscar el género: %v", err)
+    }
+    defer rows.Close()
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("error al buscar el género: %v", err)
+        }
+        ids = append(ids, id)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error al buscar el género: %v", err)
+    }
+    if subgenres {
+        return genreDescendants(d.r.db, ids)
+    }
+    return ids, nil
+}
+
+// SongExists indica si ya existe una canción con la ruta indicada.
+func (r *PostgresRepository) SongExists(path string) (bool, error) {
+    var exists bool
+    if err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM rolas WHERE path = $1)", path).Scan(&exists); err != nil {
+        return false, fmt.Errorf("error al verificar si la canción existe: %v", err)
+    }
+    return exists, nil
+}
+
+// CanonicalPerformer regresa el nombre del intérprete del que name es un alias, o el mismo name.
+func (r *PostgresRepository) CanonicalPerformer(name string) (string, error) {
+    return canonicalPerformer(postgresQueryer{r.db}, name)
+}
+
+// NormalizeGenres regresa los nombres canónicos de los géneros del texto del género de una canción, con los alias
+// y los géneros del catálogo.
+func (r *PostgresRepository) NormalizeGenres(text string) ([]string, error) {
+    return genreNames(postgresQueryer{r.db}, text)
+}
+
+// AddSong guarda una canción minada con su álbum, su portada, su intérprete, sus géneros y los datos adicionales de
+// sus etiquetas, todo en una transacción. Los álbumes, intérpretes y géneros se crean con ON CONFLICT DO NOTHING,
+// así que varias estaciones pueden minar a la vez. La portada se guarda en la caché antes de empezar (ver minedCover);
+// si falla al asociarla con el álbum no se guarda nada, porque en PostgreSQL un error invalida la transacción.
+func (r *PostgresRepository) AddSong(song MinedSong) error {
+    cover, coverPath := minedCover(postgresQueryer{r.db}, song)
+
+    tx, err := r.db.Begin()
+    if err != nil {
+        return fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+
+    idAlbum, err := insertReturningID(tx, "INSERT INTO albums (name, year, path) VALUES ($1, $2, $3) ON CONFLICT (name, path) DO NOTHING",
+        "SELECT id_album FROM albums WHERE name = $1 AND path = $2", []interface{}{song.Album, nullableInt(song.Year), song.AlbumPath},
+        song.Album, song.AlbumPath)
+    if err != nil {
+        return fmt.Errorf("error al insertar el álbum: %v", err)
+    }
+    if err := linkPostgresCover(tx, idAlbum, cover, coverPath); err != nil {
+        return fmt.Errorf("error al asociar la portada con el álbum: %v", err)
+    }
+
+    var idPerformer interface{}
+    if song.Artist != "" {
+        id, err := insertReturningID(tx, "INSERT INTO performers (name, id_type) VALUES ($1, 2) ON CONFLICT (name) DO NOTHING",
+            "SELECT id_performer FROM performers WHERE name = $1", []interface{}{song.Artist}, song.Artist)
+        if err != nil {
+            return fmt.Errorf("error al insertar el intérprete: %v", err)
+        }
+        idPerformer = id
+    }
+
+    // Los datos desconocidos se guardan como NULL, igual que en insertRola.
+    var duration, bitrate, sampleRate, channelMode, encoder, vbr interface{}
+    if props := song.Properties; props != nil {
+        duration, bitrate, sampleRate = props.Duration, props.Bitrate, props.SampleRate
+        channelMode, encoder = props.ChannelMode, props.Encoder
+        vbr = 0
+        if props.VBR {
+            vbr = 1
+        }
+    }
+    var bpm, health, healthDetail, fingerprint interface{}
+    if song.BPM > 0 {
+        bpm = song.BPM
+    }
+    if song.Health != nil {
+        health, healthDetail = song.Health.Status, song.Health.Detail
+    }
+    if song.Fingerprinted {
+        fingerprint = encodeFingerprint(song.Fingerprint)
+    }
+    tags := song.tags
+
+    var idRola int64
+    err = tx.QueryRow(`INSERT INTO rolas (id_performer, id_album, path, title, track, year, genre, container, codec,
+            duration, bitrate, sample_rate, channel_mode, encoder, vbr, health, health_detail, fingerprint, bpm, musical_key,
+            composer, comment, disc, disc_total, track_total)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
+        RETURNING id_rola`,
+        idPerformer, idAlbum, song.Path, nullableString(song.Title), nullableInt(song.Track), nullableInt(song.Year),
+        nullableString(song.Genre), song.Format.Container, song.Format.Codec,
+        duration, bitrate, sampleRate, channelMode, encoder, vbr, health, healthDetail, fingerprint, bpm, nullableString(song.Key),
+        nullableString(tags.composer), nullableString(tags.comment), nullableInt(tags.disc),
+        nullableInt(tags.discTotal), nullableInt(tags.trackTotal)).Scan(&idRola)
+    if err != nil {
+        return fmt.Errorf("error al insertar la rola: %v", err)
+    }
+
+    for field, source := range song.Sources {
+        if _, err := tx.Exec("INSERT INTO field_sources (id_rola, field, source) VALUES ($1, $2, $3)", idRola, field, source); err != nil {
+            return fmt.Errorf("error al guardar el origen de %s: %v", field, err)
+        }
+    }
+    for position, name := range song.Genres {
+        idGenre, err := postgresGenreID(tx, name)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.Exec("INSERT INTO rola_genres (id_rola, id_genre, position) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+            idRola, idGenre, position); err != nil {
+            return fmt.Errorf("error al guardar los géneros: %v", err)
+        }
+    }
+    for _, lyrics := range tags.lyrics {
+        if _, err := tx.Exec("INSERT INTO lyrics (id_rola, language, description, text) VALUES ($1, $2, $3, $4)",
+            idRola, lyrics.Language, lyrics.Description, lyrics.Text); err != nil {
+            return fmt.Errorf("error al guardar las letras: %v", err)
+        }
+    }
+    for _, frame := range tags.frames {
+        if _, err := tx.Exec("INSERT INTO tag_frames (id_rola, name, value) VALUES ($1, $2, $3)", idRola, frame.Name, frame.Value); err != nil {
+            return fmt.Errorf("error al guardar las tramas de las etiquetas: %v", err)
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("error al guardar los cambios: %v", err)
+    }
+    return nil
+}
+
+// insertReturningID ejecuta un INSERT ... ON CONFLICT DO NOTHING y regresa el ID de la fila, sea la nueva o la que
+// ya existía (quizá insertada por otra estación), que se obtiene con la consulta query y sus argumentos key.
+func insertReturningID(tx *sql.Tx, insert, query string, args []interface{}, key ...interface{}) (int64, error) {
+    if _, err := tx.Exec(insert, args...); err != nil {
+        return 0, err
+    }
+    var id int64
+    if err := tx.QueryRow(query, key...).Scan(&id); err != nil {
+        return 0, err
+    }
+    return id, nil
+}
+
+// linkPostgresCover asocia una portada ya guardada en la caché de esta estación (ver minedCover) con el álbum, si
+// aún no tiene una. El catálogo sólo guarda su hash y su ruta.
+func linkPostgresCover(tx *sql.Tx, idAlbum int64, cover *coverImage, coverPath string) error {
+    if cover == nil {
+        return nil
+    }
+    hash := cover.hash()
+    idCover, err := insertReturningID(tx, "INSERT INTO covers (hash, path) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING",
+        "SELECT id_cover FROM covers WHERE hash = $1", []interface{}{hash, coverPath}, hash)
+    if err != nil {
+        return err
+    }
+    _, err = tx.Exec("UPDATE albums SET id_cover = $1 WHERE id_album = $2 AND id_cover IS NULL", idCover, idAlbum)
+    return err
+}
+
+// postgresGenreID regresa el ID del género con el nombre canónico indicado, creándolo si no existe, como subgénero
+// del género con el que termina su nombre (ver genreID).
+func postgresGenreID(tx *sql.Tx, name string) (int64, error) {
+    var id int64
+    err := tx.QueryRow("SELECT id_genre FROM genres WHERE lower(name) = lower($1)", name).Scan(&id)
+    if err == nil {
+        return id, nil
+    }
+    if err != sql.ErrNoRows {
+        return 0, fmt.Errorf("error al obtener el ID del género: %v", err)
+    }
+
+    var idParent interface{}
+    parent, ok, err := genreParent(postgresQueryer{tx}, name)
+    if err != nil {
+        return 0, err
+    }
+    if ok {
+        if idParent, err = postgresGenreID(tx, parent); err != nil {
+            return 0, err
+        }
+    }
+    id, err = insertReturningID(tx, "INSERT INTO genres (name, id_parent) VALUES ($1, $2) ON CONFLICT ((lower(name))) DO NOTHING",
+        "SELECT id_genre FROM genres WHERE lower(name) = lower($1)", []interface{}{name, idParent}, name)
+    if err != nil {
+        return 0, fmt.Errorf("error al insertar el género: %v", err)
+    }
+    return id, nil
+}
+
+// CollectGarbage elimina los álbumes y los intérpretes sin canciones y regresa cuántos eliminó. Los alias de los
+// intérpretes se eliminan con ellos (ON DELETE CASCADE).
+func (r *PostgresRepository) CollectGarbage() (int, int, error) {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return 0, 0, fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback()
+
+    counts := make([]int, 2)
+    for i, statement := range []string{
+        "DELETE FROM albums WHERE NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_album = albums.id_album)",
+        "DELETE FROM performers WHERE NOT EXISTS (SELECT 1 FROM rolas WHERE rolas.id_performer = performers.id_performer)",
+    } {
+        result, err := tx.Exec(statement)
+        if err != nil {
+            return 0, 0, fmt.Errorf("error al eliminar los álbumes y los intérpretes sin canciones: %v", err)
+        }
+        affected, err := result.RowsAffected()
+        if err != nil {
+            return 0, 0, fmt.Errorf("error al eliminar los álbumes y los intérpretes sin canciones: %v", err)
+        }
+        counts[i] = int(affected)
+    }
+    if err := tx.Commit(); err != nil {
+        return 0, 0, fmt.Errorf("error al guardar los cambios: %v", err)
+    }
+    return counts[0], counts[1], nil
+}
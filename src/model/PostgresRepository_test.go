@@ -0,0 +1,234 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+    "reflect"
+    "sync"
+    "testing"
+)
+
+// postgresTestTables son las tablas del catálogo compartido, que se borran antes de cada prueba.
+var postgresTestTables = []string{"schema_version", "performer_aliases", "rola_genres", "genre_aliases", "genres",
+    "field_sources", "tag_frames", "lyrics", "rolas", "albums", "covers", "in_group", "groups", "persons", "performers", "types"}
+
+// openTestPostgresRepository abre el catálogo compartido de MUSICDB_TEST_DSN, que debe ser una base de datos de
+// prueba: sus tablas se borran y el esquema se vuelve a crear. Sin MUSICDB_TEST_DSN la prueba se omite.
+func openTestPostgresRepository(t *testing.T) *PostgresRepository {
+    t.Helper()
+    dsn := os.Getenv("MUSICDB_TEST_DSN")
+    if dsn == "" {
+        t.Skip("MUSICDB_TEST_DSN no está definida")
+    }
+
+    db, err := sql.Open("postgres", dsn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, table := range postgresTestTables {
+        if _, err := db.Exec("DROP TABLE IF EXISTS " + table + " CASCADE"); err != nil {
+            db.Close()
+            t.Fatal(err)
+        }
+    }
+    db.Close()
+
+    repo, err := OpenPostgresRepository(dsn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { repo.Close() })
+    return repo
+}
+
+func TestMigratePostgresTwice(t *testing.T) {
+    repo := openTestPostgresRepository(t)
+
+    // OpenPostgresRepository ya migró el esquema; la segunda vez no debe hacer nada.
+    if err := migratePostgres(repo.db); err != nil {
+        t.Fatalf("segunda migración: %v", err)
+    }
+    var version, rows int
+    if err := repo.db.QueryRow("SELECT MAX(version), COUNT(*) FROM schema_version").Scan(&version, &rows); err != nil {
+        t.Fatal(err)
+    }
+    if version != latestPostgresVersion() || rows != 1 {
+        t.Errorf("schema_version = %d (%d filas), se esperaba %d", version, rows, latestPostgresVersion())
+    }
+}
+
+// TestPostgresConcurrentAddSong guarda desde dos gorutinas, como dos estaciones que minan el mismo directorio
+// compartido, canciones del mismo álbum, el mismo intérprete y el mismo género escrito con otras mayúsculas: los ON
+// CONFLICT deben dejar una sola fila de cada uno.
+func TestPostgresConcurrentAddSong(t *testing.T) {
+    repo := openTestPostgresRepository(t)
+
+    const songs = 20
+    var wg sync.WaitGroup
+    errs := make(chan error, 2*songs)
+    for station, genre := range []string{"Hard Rock", "hard rock"} {
+        wg.Add(1)
+        go func(station int, genre string) {
+            defer wg.Done()
+            for i := 0; i < songs; i++ {
+                errs <- repo.AddSong(MinedSong{
+                    Path:       fmt.Sprintf("/música/Paranoid/%d-%02d.mp3", station, i),
+                    Title:      fmt.Sprintf("Canción %d", i),
+                    Artist:     "Black Sabbath",
+                    Album:      "Paranoid",
+                    AlbumPath:  "/música/Paranoid",
+                    Year:       1970,
+                    Track:      i + 1,
+                    Genre:      genre,
+                    Genres:     []string{genre},
+                    Format:     &AudioFormat{Container: "MPEG", Codec: "MP3"},
+                    Properties: &AudioProperties{Duration: 200, Bitrate: 160, SampleRate: 44100, ChannelMode: "Joint stereo", VBR: true},
+                    Sources:    map[string]string{FieldTitle: SourceTag, FieldYear: SourceTag},
+                })
+            }
+        }(station, genre)
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        if err != nil {
+            t.Error(err)
+        }
+    }
+
+    counts := map[string]string{
+        "albums":     "SELECT COUNT(*) FROM albums",
+        "performers": "SELECT COUNT(*) FROM performers",
+        "genres":     "SELECT COUNT(*) FROM genres WHERE lower(name) = 'hard rock'",
+        "rolas":      "SELECT COUNT(*) FROM rolas",
+    }
+    want := map[string]int{"albums": 1, "performers": 1, "genres": 1, "rolas": 2 * songs}
+    for table, query := range counts {
+        var count int
+        if err := repo.db.QueryRow(query).Scan(&count); err != nil {
+            t.Fatal(err)
+        }
+        if count != want[table] {
+            t.Errorf("%s: %d filas, se esperaban %d", table, count, want[table])
+        }
+    }
+
+    // Las banderas enteras y el origen de los datos (string_agg) se leen con ScanSong.
+    all, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(all) != 2*songs {
+        t.Fatalf("Songs regresó %d canciones", len(all))
+    }
+    song := all[0]
+    if !song.VBR || song.Hidden || song.Bitrate != 160 || song.Artist != "Black Sabbath" || song.Album != "Paranoid" {
+        t.Errorf("canción leída: %+v", song)
+    }
+    if want := map[string]string{FieldTitle: SourceTag, FieldYear: SourceTag}; !reflect.DeepEqual(song.Sources, want) {
+        t.Errorf("origen de los datos = %v, se esperaba %v", song.Sources, want)
+    }
+}
+
+func TestPostgresSearch(t *testing.T) {
+    repo := openTestPostgresRepository(t)
+    mineTestSongs(t, repo)
+
+    tests := []struct {
+        query  string
+        titles []string // nil si la búsqueda no tiene resultados.
+    }{
+        {"g: rock", []string{"Come Together", "Something"}},
+        {"g+: rock", []string{"Come Together", "Something", "War Pigs"}},
+        {"g+: metal", []string{"Canción Ñandú"}},
+        {"br: <192", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"br: >192", nil},
+        {"br: <192.5", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"sr: 44.1k-48.05k", []string{"Canción Ñandú", "Come Together", "Oh! Darling", "Something", "War Pigs"}},
+        {"sr: >44.1k", nil},
+        {"p: BEATLES, y: 1969", []string{"Come Together", "Oh! Darling", "Something"}},
+        {"c: ción", []string{"Canción Ñandú"}},
+    }
+    search := func(query string, titles []string) {
+        t.Helper()
+        songs, err := repo.Search(query)
+        if titles == nil {
+            if err == nil {
+                t.Errorf("%q (unaccent=%v) regresó %v, se esperaba un error sin resultados", query, repo.unaccent, songTitles(songs))
+            }
+            return
+        }
+        if err != nil {
+            t.Errorf("%q (unaccent=%v): %v", query, repo.unaccent, err)
+            return
+        }
+        if got := songTitles(songs); !reflect.DeepEqual(got, titles) {
+            t.Errorf("%q (unaccent=%v) = %v, se esperaba %v", query, repo.unaccent, got, titles)
+        }
+    }
+
+    installed := repo.unaccent
+    for _, unaccent := range []bool{false, true} {
+        if unaccent && !installed {
+            t.Log("el servidor no tiene la extensión unaccent; sólo se prueba la búsqueda que distingue acentos")
+            continue
+        }
+        repo.unaccent = unaccent
+        for _, tt := range tests {
+            search(tt.query, tt.titles)
+        }
+        // Sin unaccent las búsquedas distinguen acentos; con unaccent, no.
+        if unaccent {
+            search("c: cancion nandu", []string{"Canción Ñandú"})
+        } else {
+            search("c: cancion nandu", nil)
+        }
+    }
+    repo.unaccent = installed
+}
+
+func TestPostgresAlbumSongsAndMerges(t *testing.T) {
+    repo := openTestPostgresRepository(t)
+    mineTestSongs(t, repo)
+
+    albums, err := repo.Albums()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(albums) != 2 || albums[0].Name != "Abbey Road" {
+        t.Fatalf("álbumes = %+v", albums)
+    }
+    songs, err := repo.AlbumSongs(albums[0].IDAlbum)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var titles []string
+    for _, song := range songs {
+        titles = append(titles, song.Title)
+        if song.Sources[FieldTitle] != SourceTag || song.VBR || song.Hidden {
+            t.Errorf("canción leída: %+v", song)
+        }
+    }
+    if want := []string{"Come Together", "Something", "Oh! Darling"}; !reflect.DeepEqual(titles, want) {
+        t.Errorf("canciones del álbum = %q, se esperaba %q", titles, want)
+    }
+
+    clusters, err := repo.SuggestPerformerMerges()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(clusters) != 1 {
+        t.Fatalf("sugerencias = %+v", clusters)
+    }
+    into := clusters[0].Performers[clusters[0].Suggested]
+    if err := repo.MergePerformers(clusters[0].Performers, into); err != nil {
+        t.Fatal(err)
+    }
+    if songs, err := repo.Search("p: " + into.Name); err != nil || len(songs) != 3 {
+        t.Errorf("canciones de %s después de unir: %v, %v", into.Name, songTitles(songs), err)
+    }
+    if canonical, err := repo.CanonicalPerformer("Beatles"); err != nil || canonical != "The Beatles" {
+        t.Errorf("intérprete canónico de Beatles = %q, %v", canonical, err)
+    }
+}
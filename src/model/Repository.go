@@ -0,0 +1,281 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+// Repository es el almacenamiento de las canciones, los álbumes y los intérpretes de la biblioteca. El minero sólo
+// usa esta interfaz, y el controlador la usa para leer, buscar y minar canciones y para unir intérpretes.
+// SQLiteRepository es la implementación de la aplicación; MemoryRepository guarda todo en memoria, para las pruebas.
+// La edición de canciones con bitácora, los géneros, los duplicados, la organización de archivos, la revisión de la
+// base de datos y los análisis no están en la interfaz: el controlador los hace sobre la conexión SQLite.
+type Repository interface {
+    // Songs regresa todas las canciones, excepto las ocultas.
+    Songs() ([]Song, error)
+    // Song regresa una canción por su ID, aunque esté oculta.
+    Song(idRola int) (Song, error)
+    // AlbumSongs regresa las canciones de un álbum, excepto las ocultas, ordenadas por disco y pista.
+    AlbumSongs(idAlbum int) ([]Song, error)
+    // Albums regresa los álbumes con la ruta de su portada, ordenados por nombre.
+    Albums() ([]Album, error)
+    // Performers regresa los intérpretes con sus alias, ordenados por nombre.
+    Performers() ([]Performer, error)
+    // SuggestPerformerMerges agrupa los intérpretes cuyos nombres parecen ser el mismo.
+    SuggestPerformerMerges() ([]PerformerCluster, error)
+    // MergePerformers une varios intérpretes en el intérprete into: sus canciones pasan a into y sus nombres quedan
+    // como alias de into.
+    MergePerformers(performers []Performer, into Performer) error
+    // Search regresa las canciones que cumplen los filtros de una búsqueda (ver CompileSearch), o un error si no
+    // hay ninguna.
+    Search(query string) ([]Song, error)
+
+    // SongExists indica si ya existe una canción con la ruta indicada.
+    SongExists(path string) (bool, error)
+    // CanonicalPerformer regresa el nombre del intérprete del que name es un alias, o el mismo name.
+    CanonicalPerformer(name string) (string, error)
+    // NormalizeGenres regresa los nombres canónicos de los géneros del texto del género de una canción.
+    NormalizeGenres(text string) ([]string, error)
+    // AddSong guarda una canción minada, creando su álbum y su intérprete si no existen.
+    AddSong(song MinedSong) error
+    // CollectGarbage elimina los álbumes y los intérpretes sin canciones y regresa cuántos eliminó.
+    CollectGarbage() (int, int, error)
+}
+
+// MinedSong es una canción leída por el minero, lista para guardarse con Repository.AddSong. Los datos vacíos se
+// guardan como desconocidos.
+type MinedSong struct {
+    Path       string            // Ruta del archivo de audio.
+    Title      string            // Título.
+    Artist     string            // Nombre canónico del intérprete.
+    Album      string            // Nombre del álbum.
+    AlbumPath  string            // Directorio del álbum; junto con el nombre identifica al álbum.
+    Year       int               // Año.
+    Track      int               // Número de pista.
+    Genre      string            // Texto normalizado del género.
+    Genres     []string          // Nombres canónicos de los géneros.
+    Format     *AudioFormat      // Contenedor y códec.
+    Properties *AudioProperties  // Propiedades de audio, o nil si no se pudieron calcular.
+    Sources    map[string]string // Origen de cada campo con valor.
+    BPM        float64           // Tempo de las etiquetas.
+    Key        string            // Tonalidad normalizada de las etiquetas.
+    Health     *HealthReport     // Estado de salud, o nil si no se verificó.
+
+    Fingerprint   []uint32 // Huella acústica.
+    Fingerprinted bool     // Indica si se calculó la huella (aunque haya quedado vacía).
+
+    tags     extendedTags       // Compositor, comentario, disco, letras y tramas de las etiquetas.
+    cover    func() *coverImage // Busca la portada del álbum, sólo si hace falta.
+    coverDir string             // Directorio de la caché de portadas; si está vacío no se guardan portadas.
+}
+
+// SQLiteRepository es dueño del único pool de conexiones a la base de datos SQLite, que comparten la interfaz, el
+// minero y los análisis. Con varios pools del mismo archivo, cada uno con sus propias transacciones, las escrituras
+// de uno chocaban con las de otro y fallaban con "database is locked"; con un solo pool en modo WAL (ver OpenDB)
+// las lecturas nunca esperan y las escrituras esperan su turno.
+type SQLiteRepository struct {
+    db   *sql.DB // Pool de conexiones compartido.
+    path string  // Ruta de la base de datos.
+}
+
+// OpenSQLiteRepository abre el pool de conexiones de la base de datos de path, creando su directorio si no existe.
+func OpenSQLiteRepository(path string) (*SQLiteRepository, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return nil, fmt.Errorf("error al crear el directorio de la base de datos: %v", err)
+    }
+    db, err := OpenDB(path)
+    if err != nil {
+        return nil, fmt.Errorf("error al abrir la base de datos: %v", err)
+    }
+    return &SQLiteRepository{db: db, path: path}, nil
+}
+
+// DB regresa el pool de conexiones compartido.
+func (r *SQLiteRepository) DB() *sql.DB {
+    return r.db
+}
+
+// Path regresa la ruta de la base de datos.
+func (r *SQLiteRepository) Path() string {
+    return r.path
+}
+
+// Songs regresa todas las canciones, excepto las ocultas.
+func (r *SQLiteRepository) Songs() ([]Song, error) {
+    return querySongs(r.db, SongQuery+" WHERE "+VisibleSongCondition)
+}
+
+// Song regresa una canción por su ID, aunque esté oculta.
+func (r *SQLiteRepository) Song(idRola int) (Song, error) {
+    return GetSong(r.db, idRola)
+}
+
+// AlbumSongs regresa las canciones de un álbum, excepto las ocultas, ordenadas por disco y pista.
+func (r *SQLiteRepository) AlbumSongs(idAlbum int) ([]Song, error) {
+    return querySongs(r.db, SongQuery+" WHERE rolas.id_album = ? AND "+VisibleSongCondition+AlbumSongOrder, idAlbum)
+}
+
+// Albums regresa los álbumes con la ruta de su portada, ordenados por nombre.
+func (r *SQLiteRepository) Albums() ([]Album, error) {
+    rows, err := r.db.Query(
+        "SELECT a.id_album, a.name, COALESCE(a.year, 0), a.path, COALESCE(c.path, '') " +
+            "FROM albums a " +
+            "LEFT JOIN covers c ON a.id_cover = c.id_cover " +
+            "ORDER BY a.name")
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener los álbumes: %v", err)
+    }
+    defer rows.Close()
+
+    var albums []Album
+    for rows.Next() {
+        var album Album
+        if err := rows.Scan(&album.IDAlbum, &album.Name, &album.Year, &album.Path, &album.CoverPath); err != nil {
+            return nil, fmt.Errorf("error al escanear álbum: %v", err)
+        }
+        albums = append(albums, album)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("error en la iteración de álbumes: %v", err)
+    }
+    return albums, nil
+}
+
+// Performers regresa los intérpretes con sus alias, ordenados por nombre.
+func (r *SQLiteRepository) Performers() ([]Performer, error) {
+    return GetPerformers(r.db)
+}
+
+// SuggestPerformerMerges agrupa los intérpretes cuyos nombres parecen ser el mismo (ver suggestPerformerMerges).
+func (r *SQLiteRepository) SuggestPerformerMerges() ([]PerformerCluster, error) {
+    performers, err := GetPerformers(r.db)
+    if err != nil {
+        return nil, err
+    }
+    return suggestPerformerMerges(performers), nil
+}
+
+// MergePerformers une varios intérpretes en el intérprete into y registra el cambio en la bitácora (ver
+// mergePerformers).
+func (r *SQLiteRepository) MergePerformers(performers []Performer, into Performer) error {
+    return mergePerformers(r.db, performers, into)
+}
+
+// Search regresa las canciones que cumplen los filtros de una búsqueda.
+func (r *SQLiteRepository) Search(query string) ([]Song, error) {
+    return (&Compiler{}).CompileSearch(query, r.db)
+}
+
+// SongExists indica si ya existe una canción con la ruta indicada.
+func (r *SQLiteRepository) SongExists(path string) (bool, error) {
+    var exists bool
+    if err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM rolas WHERE path = ?)", path).Scan(&exists); err != nil {
+        return false, fmt.Errorf("error al verificar si la canción existe: %v", err)
+    }
+    return exists, nil
+}
+
+// CanonicalPerformer regresa el nombre del intérprete del que name es un alias, o el mismo name.
+func (r *SQLiteRepository) CanonicalPerformer(name string) (string, error) {
+    return canonicalPerformer(r.db, name)
+}
+
+// NormalizeGenres regresa los nombres canónicos de los géneros del texto del género de una canción, con los alias
+// y los géneros de la base de datos.
+func (r *SQLiteRepository) NormalizeGenres(text string) ([]string, error) {
+    return genreNames(r.db, text)
+}
+
+// AddSong guarda una canción minada con su álbum, su portada, su intérprete, sus géneros y los datos adicionales de
+// sus etiquetas, todo en una transacción: si algo falla no queda una rola a medias ni un álbum o un intérprete sin
+// ella. La portada se busca y se guarda en la caché antes de empezar, para no bloquear la base de datos mientras se
+// leen y se escriben imágenes.
+func (r *SQLiteRepository) AddSong(song MinedSong) error {
+    cover, coverPath := minedCover(r.db, song)
+
+    tx, err := r.db.Begin()
+    if err != nil {
+        return fmt.Errorf("error al iniciar la transacción: %v", err)
+    }
+    defer tx.Rollback() // No hace nada si la transacción ya se confirmó.
+
+    if err := insertAlbum(tx, song.Album, song.Year, song.AlbumPath); err != nil {
+        return err
+    }
+    if err := linkAlbumCover(tx, cover, coverPath, song.Album, song.AlbumPath); err != nil {
+        return err
+    }
+    if song.Artist != "" {
+        if err := insertPerformer(tx, song.Artist); err != nil {
+            return err
+        }
+    }
+    if err := insertRola(tx, song.Artist, song.Album, song.AlbumPath, song.Path, song.Title, song.Track, song.Year, song.Genre, song.Format, song.Properties); err != nil {
+        return err
+    }
+    if err := storeFieldSources(tx, song.Path, song.Sources); err != nil {
+        return err
+    }
+    if len(song.Genres) > 0 {
+        if err := storeRolaGenres(tx, song.Path, song.Genres); err != nil {
+            return err
+        }
+    }
+    if err := storeExtendedTags(tx, song.Path, song.tags); err != nil {
+        return err
+    }
+    if song.BPM > 0 || song.Key != "" {
+        if err := updateRolaTempoKey(tx, song.Path, song.BPM, song.Key); err != nil {
+            return err
+        }
+    }
+    if song.Health != nil {
+        if err := updateRolaHealth(tx, song.Path, song.Health); err != nil {
+            return err
+        }
+    }
+    if song.Fingerprinted {
+        if err := storeRolaFingerprint(tx, song.Path, song.Fingerprint); err != nil {
+            return err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("error al guardar la canción: %v", err)
+    }
+    return nil
+}
+
+// CollectGarbage elimina los álbumes y los intérpretes sin canciones.
+func (r *SQLiteRepository) CollectGarbage() (int, int, error) {
+    return CollectGarbage(r.db)
+}
+
+// querySongs ejecuta una consulta basada en SongQuery y lee sus canciones.
+func querySongs(db *sql.DB, query string, args ...interface{}) ([]Song, error) {
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("error al obtener las canciones: %v", err)
+    }
+    defer rows.Close()
+
+    var songs []Song
+    for rows.Next() {
+        song, err := ScanSong(rows)
+        if err != nil {
+            return nil, fmt.Errorf("error al escanear canción: %v", err)
+        }
+        songs = append(songs, song)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("error en la iteración de canciones: %v", err)
+    }
+    return songs, nil
+}
+
+// Close cierra el pool de conexiones.
+func (r *SQLiteRepository) Close() error {
+    return r.db.Close()
+}
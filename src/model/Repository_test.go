@@ -0,0 +1,139 @@
+package model
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+
+    "fyne.io/fyne/v2/test"
+    "fyne.io/fyne/v2/widget"
+)
+
+// lockCheckRepository es un SQLiteRepository que registra los errores de las escrituras del minero, que
+// ExtractMetadata sólo muestra en la bitácora del programa.
+type lockCheckRepository struct {
+    *SQLiteRepository
+    errs chan<- error
+}
+
+func (r lockCheckRepository) AddSong(song MinedSong) error {
+    err := r.SQLiteRepository.AddSong(song)
+    if err != nil {
+        r.errs <- fmt.Errorf("minero: %v", err)
+    }
+    return err
+}
+
+func (r lockCheckRepository) CollectGarbage() (int, int, error) {
+    albums, performers, err := r.SQLiteRepository.CollectGarbage()
+    if err != nil {
+        r.errs <- fmt.Errorf("minero: %v", err)
+    }
+    return albums, performers, err
+}
+
+// TestConcurrentMiningAndEditing mina un directorio mientras se leen y se buscan canciones y se editan en lote las
+// etiquetas de otras (y se deshacen las ediciones), como la interfaz durante una minería. Ninguna operación debe
+// fallar con "database is locked".
+func TestConcurrentMiningAndEditing(t *testing.T) {
+    test.NewApp()
+    repo := openTestSQLiteRepository(t)
+    mineTestSongs(t, repo)
+
+    dir := t.TempDir()
+    const mined = 120
+    for i := 0; i < mined; i++ {
+        writeTestMP3(t, filepath.Join(dir, fmt.Sprintf("Disco %d/%02d.mp3", i/10, i%10)), map[string]string{
+            "TIT2": fmt.Sprintf("Canción %d", i),
+            "TPE1": fmt.Sprintf("Intérprete %d", i%7),
+            "TALB": fmt.Sprintf("Disco %d", i/10),
+            "TRCK": fmt.Sprint(i%10 + 1),
+        })
+    }
+
+    errs := make(chan error, 1000)
+    done := make(chan struct{})
+    var wg sync.WaitGroup
+
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        defer close(done)
+        miner := &MP3Miner{}
+        miner.MineDirectoryWithProgress(dir, lockCheckRepository{repo, errs}, widget.NewProgressBar(), mined)
+    }()
+
+    // Lecturas y búsquedas de la interfaz.
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for running(done) {
+            if _, err := repo.Songs(); err != nil {
+                errs <- fmt.Errorf("Songs: %v", err)
+            }
+            if _, err := repo.Search("a: x"); err != nil && err.Error() != noResultsError().Error() {
+                errs <- fmt.Errorf("Search: %v", err)
+            }
+        }
+    }()
+
+    // Ediciones en lote de las etiquetas de los archivos, alternadas con deshacerlas.
+    edits := 0
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for running(done) || edits == 0 {
+            songs, err := repo.Search("a: abbey road")
+            if err != nil {
+                errs <- fmt.Errorf("Search: %v", err)
+                return
+            }
+            changes := make([]BulkChange, len(songs))
+            for i, song := range songs {
+                edit := EditOf(song)
+                edit.Title = fmt.Sprintf("%s (%d)", strings.SplitN(song.Title, " (", 2)[0], edits)
+                changes[i] = BulkChange{Song: song, Before: EditOf(song), After: edit}
+            }
+            if err := ApplyBulkEdit(repo.DB(), changes, true, false); err != nil {
+                errs <- fmt.Errorf("ApplyBulkEdit: %v", err)
+            }
+            if edits%2 == 1 {
+                if _, err := Undo(repo.DB()); err != nil {
+                    errs <- fmt.Errorf("Undo: %v", err)
+                }
+            }
+            edits++
+        }
+    }()
+
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        if strings.Contains(err.Error(), "database is locked") {
+            t.Error(err)
+        } else {
+            t.Errorf("error inesperado: %v", err)
+        }
+    }
+
+    songs, err := repo.Songs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := mined + len(testSongs); len(songs) != want {
+        t.Errorf("hay %d canciones, se esperaban %d", len(songs), want)
+    }
+    t.Logf("%d ediciones en lote durante la minería", edits)
+}
+
+// running indica si todavía no se cierra done.
+func running(done <-chan struct{}) bool {
+    select {
+    case <-done:
+        return false
+    default:
+        return true
+    }
+}
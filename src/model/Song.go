@@ -1,14 +1,106 @@
 package model
 
+import (
+    "database/sql"
+    "fmt"
+)
+
 // Song representa una canción dentro de la base de datos de música.
 // Contiene información como el título, el artista, el álbum, el año, el género y el número de pista.
 type Song struct {
-    IDRola  int    // ID único de la canción (correspondiente al campo id_rola en la base de datos)
-    Title   string // Título de la canción
-    Artist  string // Artista o intérprete de la canción
-    Album   string // Nombre del álbum en el que aparece la canción
-    Year    int    // Año de lanzamiento de la canción
-    Genre   string // Género musical de la canción
-    Track   int    // Número de pista en el álbum
+    IDRola        int               // ID único de la canción (correspondiente al campo id_rola en la base de datos)
+    Title         string            // Título de la canción
+    Artist        string            // Artista o intérprete de la canción
+    Album         string            // Nombre del álbum en el que aparece la canción
+    Year          int               // Año de lanzamiento de la canción (0 si se desconoce)
+    Genre         string            // Género musical de la canción
+    Track         int               // Número de pista en el álbum (0 si se desconoce)
+    Container     string            // Contenedor del archivo (e.g., MPEG, Ogg, MP4, FLAC)
+    Codec         string            // Códec del audio (e.g., MP3, Vorbis, Opus, AAC)
+    CoverPath     string            // Ruta de la portada del álbum en la caché, vacía si no tiene
+    Duration      float64           // Duración en segundos (0 si se desconoce)
+    Bitrate       int               // Tasa de bits promedio en kbps (0 si se desconoce)
+    SampleRate    int               // Frecuencia de muestreo en Hz (0 si se desconoce)
+    ChannelMode   string            // Modo de canal (Estéreo, Joint stereo, Dual channel o Mono)
+    Encoder       string            // Codificador con el que se creó el archivo
+    VBR           bool              // Indica si el archivo tiene tasa de bits variable
+    Health        string            // Estado de salud del archivo (HealthOK, HealthTruncated...), vacío si no se ha verificado
+    HealthDetail  string            // Descripción de los problemas de integridad encontrados
+    Path          string            // Ruta del archivo de audio
+    Hidden        bool              // Indica si la canción se ocultó (por ejemplo, por ser un duplicado)
+    Loudness      float64           // Sonoridad integrada EBU R128 en LUFS (0 si no se ha analizado)
+    Peak          float64           // Pico verdadero lineal (0 si no se ha analizado)
+    AlbumLoudness float64           // Sonoridad integrada del álbum en LUFS (0 si no se ha analizado)
+    AlbumPeak     float64           // Pico verdadero del álbum (0 si no se ha analizado)
+    BPM           float64           // Tempo en pulsos por minuto, de la etiqueta TBPM o estimado (0 si se desconoce)
+    Key           string            // Tonalidad (e.g., "Am", "Eb"), de la etiqueta TKEY o estimada
+    Composer      string            // Compositor (trama TCOM)
+    Comment       string            // Comentario (trama COMM)
+    Disc          int               // Número de disco (trama TPOS, 0 si se desconoce)
+    DiscTotal     int               // Total de discos del álbum (0 si se desconoce)
+    TrackTotal    int               // Total de pistas del disco (0 si se desconoce)
+    Sources       map[string]string // Origen de cada campo con valor (FieldTitle -> SourceTag, SourceFilename...)
+}
+
+// SongQuery es la consulta base para obtener canciones junto con su intérprete, álbum y portada.
+// Los datos desconocidos (NULL) se leen como cadenas vacías o ceros y el origen de cada dato como una lista "campo=origen".
+// Las columnas seleccionadas corresponden, en orden, a los campos que lee ScanSong.
+const SongQuery = `
+    SELECT rolas.id_rola, COALESCE(rolas.title, ''), COALESCE(performers.name, '') AS artist, COALESCE(albums.name, '') AS album,
+           COALESCE(rolas.year, 0), COALESCE(rolas.genre, ''), COALESCE(rolas.track, 0),
+           COALESCE(rolas.container, ''), COALESCE(rolas.codec, ''), COALESCE(covers.path, ''),
+           COALESCE(rolas.duration, 0), COALESCE(rolas.bitrate, 0), COALESCE(rolas.sample_rate, 0),
+           COALESCE(rolas.channel_mode, ''), COALESCE(rolas.encoder, ''), COALESCE(rolas.vbr, 0),
+           COALESCE(rolas.health, ''), COALESCE(rolas.health_detail, ''), rolas.path, COALESCE(rolas.hidden, 0),
+           COALESCE(rolas.loudness, 0), COALESCE(rolas.peak, 0), COALESCE(albums.loudness, 0), COALESCE(albums.peak, 0),
+           COALESCE(rolas.bpm, 0), COALESCE(rolas.musical_key, ''),
+           COALESCE(rolas.composer, ''), COALESCE(rolas.comment, ''), COALESCE(rolas.disc, 0),
+           COALESCE(rolas.disc_total, 0), COALESCE(rolas.track_total, 0),
+           COALESCE((SELECT group_concat(field || '=' || source) FROM field_sources WHERE field_sources.id_rola = rolas.id_rola), '')
+    FROM rolas
+    LEFT JOIN performers ON rolas.id_performer = performers.id_performer
+    LEFT JOIN albums ON rolas.id_album = albums.id_album
+    LEFT JOIN covers ON albums.id_cover = covers.id_cover`
+
+// AlbumSongOrder ordena las canciones como aparecen en sus álbumes: por álbum, disco y pista. Las canciones sin
+// disco se consideran del disco 1 y las que no tienen número de pista van al final de su disco.
+const AlbumSongOrder = " ORDER BY albums.name, albums.id_album, COALESCE(rolas.disc, 1), rolas.track IS NULL, rolas.track, rolas.title"
+
+// VisibleSongCondition es la condición SQL que excluye las canciones ocultas.
+const VisibleSongCondition = "COALESCE(rolas.hidden, 0) = 0"
+
+// ScanSong lee una fila obtenida con SongQuery.
+func ScanSong(rows *sql.Rows) (Song, error) {
+    var song Song
+    var sources string
+    err := rows.Scan(&song.IDRola, &song.Title, &song.Artist, &song.Album, &song.Year, &song.Genre, &song.Track,
+        &song.Container, &song.Codec, &song.CoverPath,
+        &song.Duration, &song.Bitrate, &song.SampleRate, &song.ChannelMode, &song.Encoder, &song.VBR,
+        &song.Health, &song.HealthDetail, &song.Path, &song.Hidden,
+        &song.Loudness, &song.Peak, &song.AlbumLoudness, &song.AlbumPeak,
+        &song.BPM, &song.Key, &song.Composer, &song.Comment, &song.Disc,
+        &song.DiscTotal, &song.TrackTotal, &sources)
+    song.Sources = parseSources(sources)
+    return song, err
 }
 
+// GetSong obtiene una canción por su ID, aunque esté oculta.
+func GetSong(db *sql.DB, idRola int) (Song, error) {
+    rows, err := db.Query(SongQuery+" WHERE rolas.id_rola = ?", idRola)
+    if err != nil {
+        return Song{}, fmt.Errorf("error al obtener la canción: %v", err)
+    }
+    defer rows.Close()
+
+    if !rows.Next() {
+        if err := rows.Err(); err != nil {
+            return Song{}, fmt.Errorf("error al obtener la canción: %v", err)
+        }
+        return Song{}, fmt.Errorf("no existe la canción %d", idRola)
+    }
+    song, err := ScanSong(rows)
+    if err != nil {
+        return Song{}, fmt.Errorf("error al leer la canción: %v", err)
+    }
+    return song, nil
+}
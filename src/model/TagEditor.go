@@ -0,0 +1,395 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// SongEdit son los datos principales de una rola tal como los escribe el usuario al editarla.
+// Un campo vacío elimina el dato de la base de datos y de las etiquetas del archivo.
+type SongEdit struct {
+    Title  string // Título (trama TIT2).
+    Artist string // Intérprete (trama TPE1).
+    Album  string // Álbum (trama TALB).
+    Year   string // Año (trama TDRC en ID3v2.4, TYER en ID3v2.3).
+    Genre  string // Género (trama TCON).
+    Track  string // Número de pista (trama TRCK).
+}
+
+// EditOf regresa los datos editables actuales de una canción.
+func EditOf(song Song) SongEdit {
+    return SongEdit{
+        Title:  song.Title,
+        Artist: song.Artist,
+        Album:  song.Album,
+        Year:   nonZeroText(song.Year),
+        Genre:  song.Genre,
+        Track:  nonZeroText(song.Track),
+    }
+}
+
+// trim quita los espacios de los extremos de todos los campos.
+func (e SongEdit) trim() SongEdit {
+    return SongEdit{
+        Title:  strings.TrimSpace(e.Title),
+        Artist: strings.TrimSpace(e.Artist),
+        Album:  strings.TrimSpace(e.Album),
+        Year:   strings.TrimSpace(e.Year),
+        Genre:  strings.TrimSpace(e.Genre),
+        Track:  strings.TrimSpace(e.Track),
+    }
+}
+
+// normalize quita los espacios de los extremos de todos los campos, cambia el intérprete por su nombre canónico si
+// es un alias y normaliza el género (ver genreNames), que así se guardan en la base de datos y en la etiqueta.
+func (e SongEdit) normalize(q queryer) (SongEdit, error) {
+    e = e.trim()
+    artist, err := canonicalPerformer(q, e.Artist)
+    if err != nil {
+        return e, err
+    }
+    e.Artist = artist
+    genres, err := genreNames(q, e.Genre)
+    if err != nil {
+        return e, err
+    }
+    e.Genre = strings.Join(genres, GenreSeparator)
+    return e, nil
+}
+
+// numbers interpreta el año y la pista. Los campos vacíos se regresan como 0.
+func (e SongEdit) numbers() (year, track int, err error) {
+    if e.Year != "" {
+        if year, err = strconv.Atoi(e.Year); err != nil || year <= 0 || year > 9999 {
+            return 0, 0, fmt.Errorf("'%s' no es un año", e.Year)
+        }
+    }
+    if e.Track != "" {
+        if track, err = strconv.Atoi(e.Track); err != nil || track <= 0 {
+            return 0, 0, fmt.Errorf("'%s' no es un número de pista", e.Track)
+        }
+    }
+    return year, track, nil
+}
+
+// editedFrames regresa el valor de cada trama de texto de la etiqueta para los datos editados.
+func editedFrames(version byte, edit SongEdit, track, trackTotal int) map[string]string {
+    trackText := edit.Track
+    if track > 0 {
+        trackText = strconv.Itoa(track)
+        if trackTotal > 0 {
+            trackText += "/" + strconv.Itoa(trackTotal)
+        }
+    }
+    frames := map[string]string{
+        "TIT2": edit.Title,
+        "TPE1": edit.Artist,
+        "TALB": edit.Album,
+        "TCON": edit.Genre,
+        "TRCK": trackText,
+        "TDRC": "",
+        "TYER": "",
+    }
+    // ID3v2.4 guarda la fecha en TDRC; ID3v2.3 sólo tiene TYER.
+    if version == 4 {
+        frames["TDRC"] = edit.Year
+    } else {
+        frames["TYER"] = edit.Year
+    }
+    return frames
+}
+
+// UpdateSongTags cambia los datos principales de una rola en la base de datos y en las etiquetas ID3v2 de su archivo.
+// La etiqueta se escribe de forma atómica (ver applySongEdits): si no se puede escribir el archivo no se cambia la
+// base de datos, y si la transacción falla se restaura la etiqueta anterior.
+// Con backup se guarda una copia del archivo original como <archivo>.bak. Sólo se pueden editar archivos MP3.
+// El cambio se registra en la bitácora para poder deshacerlo.
+func UpdateSongTags(db *sql.DB, song Song, edit SongEdit, backup bool) error {
+    if song.Codec != "MP3" {
+        return fmt.Errorf("sólo se pueden editar las etiquetas de archivos MP3")
+    }
+    change := BulkChange{Song: song, Before: EditOf(song), After: edit}
+    return applySongEdits(db, fmt.Sprintf("Editar \"%s\"", songLabel(song)), []BulkChange{change}, true, backup)
+}
+
+// songLabel regresa el título de la rola o, si no tiene, el nombre de su archivo, para describir una operación.
+func songLabel(song Song) string {
+    if song.Title != "" {
+        return song.Title
+    }
+    return filepath.Base(song.Path)
+}
+
+// applySongEdits guarda los datos editados de varias rolas en una sola transacción, que se registra en la bitácora
+// como una operación. Con writeFiles las etiquetas de los MP3 se escriben conforme se guardan sus datos; si algo
+// falla se descarta la transacción y se restauran las etiquetas ya escritas, así que se guarda todo o nada.
+// Las rolas que no son MP3, o todas sin writeFiles, sólo se cambian en la base de datos.
+// Las copias de los archivos con sus etiquetas nuevas se preparan antes de empezar la transacción (ver preparedTag),
+// que sólo las renombra: copiar cientos de archivos con la base de datos bloqueada haría esperar al minero y a las
+// demás ediciones más que busyTimeout. Mientras tanto cada archivo ocupa el doble de espacio en el disco.
+func applySongEdits(db *sql.DB, description string, changes []BulkChange, writeFiles, backup bool) error {
+    tags := map[int]*songTagEdit{}
+    defer func() {
+        for _, tag := range tags {
+            tag.prepared.discard()
+        }
+    }()
+    for i, change := range changes {
+        if !writeFiles || change.Song.Codec != "MP3" {
+            continue
+        }
+        tag, err := prepareSongTags(db, change.Song, change.After)
+        if err != nil {
+            return changeError(changes, change, err)
+        }
+        tags[i] = tag
+    }
+
+    return withJournal(db, description, func(j *journal, files *fileChanges) error {
+        for i, change := range changes {
+            var err error
+            if tag, ok := tags[i]; ok {
+                err = editSongTags(j, change.Song, tag, backup, files)
+            } else {
+                err = editSongRow(j, change.Song, change.After)
+            }
+            if err != nil {
+                return changeError(changes, change, err)
+            }
+        }
+        // Los álbumes y los intérpretes que se quedaron sin canciones se eliminan; al deshacer se restauran.
+        _, _, err := collectGarbage(j)
+        return err
+    })
+}
+
+// changeError agrega al error de un cambio la ruta de su archivo, si se aplicaban varios cambios.
+func changeError(changes []BulkChange, change BulkChange, err error) error {
+    if len(changes) > 1 {
+        return fmt.Errorf("%s: %v", change.Song.Path, err)
+    }
+    return err
+}
+
+// songTagEdit son los datos editados de una rola junto con la copia de su archivo con la etiqueta nueva, preparada
+// antes de la transacción que los guarda.
+type songTagEdit struct {
+    edit          SongEdit          // Datos editados y normalizados.
+    year, track   int               // Año y pista de los datos editados.
+    frames        map[string]string // Valor de cada trama de texto editada.
+    before, after map[string][]byte // Contenido de las tramas editadas antes y después, para la bitácora.
+    previous      *id3Tag           // Etiqueta anterior, para restaurarla si la transacción falla.
+    prepared      *preparedTag      // Copia del archivo con la etiqueta nueva.
+}
+
+// prepareSongTags normaliza los datos editados de una rola con la base de datos y prepara la copia de su archivo
+// con la etiqueta nueva.
+func prepareSongTags(db *sql.DB, song Song, edit SongEdit) (*songTagEdit, error) {
+    edit, err := edit.normalize(db)
+    if err != nil {
+        return nil, err
+    }
+    year, track, err := edit.numbers()
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(song.Path)
+    if err != nil {
+        return nil, fmt.Errorf("error al abrir el archivo: %v", err)
+    }
+    tag, err := readID3Tag(file)
+    file.Close()
+    if err != nil {
+        return nil, err
+    }
+    edited := &songTagEdit{
+        edit:     edit,
+        year:     year,
+        track:    track,
+        frames:   editedFrames(tag.Version, edit, track, song.TrackTotal),
+        before:   map[string][]byte{},
+        after:    map[string][]byte{},
+        previous: tag.clone(),
+    }
+    for _, id := range []string{"TIT2", "TPE1", "TALB", "TDRC", "TYER", "TCON", "TRCK"} {
+        edited.before[id] = tag.frameData(id)
+        tag.SetText(id, edited.frames[id])
+        edited.after[id] = tag.frameData(id)
+    }
+
+    if edited.prepared, err = prepareID3Tag(song.Path, tag); err != nil {
+        return nil, err
+    }
+    return edited, nil
+}
+
+// editSongTags guarda los datos editados de una rola en la base de datos y reemplaza su archivo por la copia con
+// la etiqueta nueva, que se registra en files.
+func editSongTags(j *journal, song Song, tag *songTagEdit, backup bool, files *fileChanges) error {
+    if err := updateSongRow(j, song, tag.edit, tag.year, tag.track, SourceTag); err != nil {
+        return err
+    }
+    for id, value := range tag.frames {
+        if err := updateTagFrame(j, song.IDRola, id, value); err != nil {
+            return err
+        }
+    }
+    if err := j.tag(song.IDRola, tag.before, tag.after); err != nil {
+        return err
+    }
+
+    if err := tag.prepared.replace(backup); err != nil {
+        return err
+    }
+    files.wroteTag(song.Path, tag.previous)
+    return nil
+}
+
+// editSongRow guarda los datos editados de una rola sólo en la base de datos, sin tocar su archivo. Los datos que
+// cambian quedan como editados a mano.
+func editSongRow(j *journal, song Song, edit SongEdit) error {
+    edit, err := edit.normalize(j.tx)
+    if err != nil {
+        return err
+    }
+    year, track, err := edit.numbers()
+    if err != nil {
+        return err
+    }
+    return updateSongRow(j, song, edit, year, track, SourceUser)
+}
+
+// updateSongRow guarda los datos editados en la fila de la rola y la relaciona con sus géneros. El intérprete, el
+// álbum y los géneros se crean si no existen; el género debe estar normalizado (ver SongEdit.normalize).
+// Con SourceTag todos los datos quedan con la etiqueta como origen, porque se acaban de escribir en ella; con otro
+// origen sólo se cambia el de los datos que cambiaron.
+func updateSongRow(j *journal, song Song, edit SongEdit, year, track int, source string) error {
+    var idPerformer, idAlbum interface{}
+    if edit.Artist != "" {
+        id, err := performerID(j, edit.Artist)
+        if err != nil {
+            return err
+        }
+        idPerformer = id
+    }
+    if edit.Album != "" {
+        id, err := albumID(j, edit.Album, year, filepath.Dir(song.Path))
+        if err != nil {
+            return err
+        }
+        idAlbum = id
+    }
+
+    err := j.update("rolas", int64(song.IDRola), []string{"title", "id_performer", "id_album", "year", "genre", "track"},
+        nullableString(edit.Title), idPerformer, idAlbum, nullableInt(year), nullableString(edit.Genre), nullableInt(track))
+    if err != nil {
+        return err
+    }
+    var genres []string
+    if edit.Genre != "" {
+        genres = strings.Split(edit.Genre, GenreSeparator)
+    }
+    if err := setRolaGenres(j, song.IDRola, genres); err != nil {
+        return err
+    }
+
+    previous := EditOf(song)
+    for _, field := range []string{FieldTitle, FieldArtist, FieldAlbum, FieldYear, FieldGenre, FieldTrack} {
+        var rowID int64
+        err := j.tx.QueryRow("SELECT rowid FROM field_sources WHERE id_rola = ? AND field = ?", song.IDRola, field).Scan(&rowID)
+        if err != nil && err != sql.ErrNoRows {
+            return fmt.Errorf("error al leer el origen de los datos: %v", err)
+        }
+        exists := err == nil
+
+        value := *edit.field(field)
+        switch {
+        case value == "" && exists:
+            err = j.delete("field_sources", rowID)
+        case value == "":
+            err = nil
+        case source != SourceTag && value == *previous.field(field):
+            err = nil
+        case exists:
+            err = j.update("field_sources", rowID, []string{"source"}, source)
+        default:
+            _, err = j.insert("field_sources", []string{"id_rola", "field", "source"}, song.IDRola, field, source)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// updateTagFrame reemplaza una trama en la lista de tramas guardada de la rola, o la elimina si el valor está vacío.
+func updateTagFrame(j *journal, idRola int, name, value string) error {
+    rows, err := j.tx.Query("SELECT rowid FROM tag_frames WHERE id_rola = ? AND name = ?", idRola, name)
+    if err != nil {
+        return fmt.Errorf("error al leer las tramas de las etiquetas: %v", err)
+    }
+    var rowIDs []int64
+    for rows.Next() {
+        var rowID int64
+        if err := rows.Scan(&rowID); err != nil {
+            rows.Close()
+            return fmt.Errorf("error al leer las tramas de las etiquetas: %v", err)
+        }
+        rowIDs = append(rowIDs, rowID)
+    }
+    rows.Close()
+
+    // Si la trama ya estaba una sola vez basta con cambiar su valor.
+    if len(rowIDs) == 1 && value != "" {
+        return j.update("tag_frames", rowIDs[0], []string{"value"}, value)
+    }
+    for _, rowID := range rowIDs {
+        if err := j.delete("tag_frames", rowID); err != nil {
+            return err
+        }
+    }
+    if value == "" {
+        return nil
+    }
+    _, err = j.insert("tag_frames", []string{"id_rola", "name", "value"}, idRola, name, value)
+    return err
+}
+
+// performerID regresa el ID del intérprete con el nombre indicado, creándolo si no existe.
+func performerID(j *journal, name string) (int, error) {
+    var id int
+    err := j.tx.QueryRow("SELECT id_performer FROM performers WHERE name = ?", name).Scan(&id)
+    if err == sql.ErrNoRows {
+        id64, insertErr := j.insert("performers", []string{"name", "id_type"}, name, 2)
+        if insertErr != nil {
+            return 0, fmt.Errorf("error al insertar el intérprete: %v", insertErr)
+        }
+        return int(id64), nil
+    }
+    if err != nil {
+        return 0, fmt.Errorf("error al obtener el ID del intérprete: %v", err)
+    }
+    return id, nil
+}
+
+// albumID regresa el ID del álbum con el nombre y el directorio indicados, creándolo si no existe.
+func albumID(j *journal, name string, year int, path string) (int, error) {
+    var id int
+    err := j.tx.QueryRow("SELECT id_album FROM albums WHERE name = ? AND path = ?", name, path).Scan(&id)
+    if err == sql.ErrNoRows {
+        id64, insertErr := j.insert("albums", []string{"name", "year", "path"}, name, nullableInt(year), path)
+        if insertErr != nil {
+            return 0, fmt.Errorf("error al insertar el álbum: %v", insertErr)
+        }
+        return int(id64), nil
+    }
+    if err != nil {
+        return 0, fmt.Errorf("error al obtener el ID del álbum: %v", err)
+    }
+    return id, nil
+}
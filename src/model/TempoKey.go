@@ -0,0 +1,351 @@
+package model
+
+import (
+    "database/sql"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "math/cmplx"
+    "strconv"
+    "strings"
+
+    "fyne.io/fyne/v2/widget" // Para manejar la barra de progreso
+)
+
+// Parámetros de la estimación de tempo y tonalidad.
+const (
+    tempoKeySeconds = 120   // Segundos del inicio de la canción que se analizan.
+    onsetFrameSize  = 1024  // Muestras de cada ventana para la envolvente de ataques (~93 ms a 11025 Hz).
+    onsetHop        = 128   // Avance entre ventanas de la envolvente (~86 ventanas por segundo).
+    tempoMinBPM     = 60.0  // Tempo más lento que se considera.
+    tempoMaxBPM     = 200.0 // Tempo más rápido que se considera.
+    tempoMultiples  = 4     // Múltiplos del periodo del pulso que se suman al evaluar un tempo.
+    keyFrameSize    = 8192  // Muestras de cada ventana del cromagrama de la tonalidad (resolución de 1.35 Hz).
+    keyMinFrequency = 55.0  // Frecuencias (Hz) que se toman en cuenta para la tonalidad.
+    keyMaxFrequency = 2000.0
+)
+
+// keyNames son los nombres de las 12 notas a partir de Do, como se guardan en la base de datos.
+var keyNames = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+// noteNumbers asocia el nombre de cada nota (con sostenido o bemol) con su número a partir de Do.
+var noteNumbers = map[string]int{
+    "c": 0, "c#": 1, "db": 1, "d": 2, "d#": 3, "eb": 3, "e": 4, "fb": 4, "e#": 5, "f": 5, "f#": 6, "gb": 6,
+    "g": 7, "g#": 8, "ab": 8, "a": 9, "a#": 10, "bb": 10, "b": 11, "cb": 11, "b#": 0,
+}
+
+// Perfiles de Krumhansl y Kessler: qué tanto pesa cada grado de la escala en una tonalidad mayor y en una menor.
+var (
+    majorKeyProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+    minorKeyProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// KeyName regresa el nombre de una tonalidad a partir de su tónica (0 = Do) y su modo, e.g. "Am" o "Eb".
+func KeyName(tonic int, minor bool) string {
+    name := keyNames[((tonic%12)+12)%12]
+    if minor {
+        name += "m"
+    }
+    return name
+}
+
+// NormalizeKey interpreta una tonalidad escrita como en las etiquetas TKEY o como la usan los DJs
+// ("Am", "A minor", "Amin", "G#m", "Bbm", "C", "C major" o la notación Camelot "8A") y regresa su nombre
+// canónico ("Am", "Ab"...). Regresa una cadena vacía si no la reconoce (o si es "o", fuera de tonalidad).
+func NormalizeKey(value string) string {
+    value = strings.ToLower(strings.Join(strings.Fields(value), ""))
+    value = strings.NewReplacer("♯", "#", "♭", "b").Replace(value)
+    if value == "" {
+        return ""
+    }
+
+    // Notación Camelot: un número del 1 al 12 seguido de A (menor) o B (mayor).
+    if last := value[len(value)-1]; last == 'a' || last == 'b' {
+        if number, err := strconv.Atoi(value[:len(value)-1]); err == nil && number >= 1 && number <= 12 {
+            tonic := 11 + 7*(number-1)
+            if last == 'a' {
+                return KeyName(tonic-3, true)
+            }
+            return KeyName(tonic, false)
+        }
+    }
+
+    note := value[:1]
+    rest := value[1:]
+    if strings.HasPrefix(rest, "#") || strings.HasPrefix(rest, "b") {
+        note += rest[:1]
+        rest = rest[1:]
+    }
+    tonic, ok := noteNumbers[note]
+    if !ok {
+        return ""
+    }
+    switch rest {
+    case "", "maj", "major", "mayor", "dur":
+        return KeyName(tonic, false)
+    case "m", "min", "minor", "menor", "moll":
+        return KeyName(tonic, true)
+    }
+    return ""
+}
+
+// TempoKey es la estimación del tempo (en pulsos por minuto) y de la tonalidad de una rola.
+type TempoKey struct {
+    BPM float64
+    Key string
+}
+
+// EstimateTempoAndKey decodifica los primeros minutos de un MP3 y estima su tempo, a partir de la
+// periodicidad de los ataques, y su tonalidad, comparando el cromagrama con los perfiles de Krumhansl.
+func EstimateTempoAndKey(r io.ReadSeeker) (*TempoKey, error) {
+    pcm, sampleRate, err := DecodeMP3Mono(r, tempoKeySeconds)
+    if err != nil {
+        return nil, err
+    }
+    samples := resample(pcm, sampleRate, fingerprintSampleRate)
+    if len(samples) < keyFrameSize {
+        return nil, fmt.Errorf("el audio es demasiado corto para estimar el tempo")
+    }
+    return &TempoKey{BPM: estimateTempo(samples), Key: estimateKey(samples)}, nil
+}
+
+// hannWindow regresa una ventana de Hann del tamaño indicado.
+func hannWindow(size int) []float64 {
+    window := make([]float64, size)
+    for i := range window {
+        window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+    }
+    return window
+}
+
+// onsetEnvelope calcula el flujo espectral (cuánto aumenta la energía de cada frecuencia de una ventana a la
+// siguiente), que tiene picos en los ataques de las notas y de la percusión.
+func onsetEnvelope(samples []float64) []float64 {
+    window := hannWindow(onsetFrameSize)
+    buffer := make([]complex128, onsetFrameSize)
+    previous := make([]float64, onsetFrameSize/2)
+    var envelope []float64
+    for start := 0; start+onsetFrameSize <= len(samples); start += onsetHop {
+        for i := range buffer {
+            buffer[i] = complex(samples[start+i]*window[i], 0)
+        }
+        fft(buffer)
+        flux := 0.0
+        for k := range previous {
+            magnitude := math.Log1p(100 * cmplx.Abs(buffer[k]))
+            flux += math.Max(0, magnitude-previous[k])
+            previous[k] = magnitude
+        }
+        envelope = append(envelope, flux)
+    }
+    if len(envelope) > 0 {
+        envelope[0] = 0 // La primera ventana se compara contra silencio.
+    }
+
+    // Se resta el promedio local (~1 s) para quedarse sólo con los ataques.
+    const radius = 43
+    detrended := make([]float64, len(envelope))
+    for i := range envelope {
+        sum, count := 0.0, 0
+        for j := max(0, i-radius); j <= min(len(envelope)-1, i+radius); j++ {
+            sum += envelope[j]
+            count++
+        }
+        detrended[i] = math.Max(0, envelope[i]-sum/float64(count))
+    }
+    return detrended
+}
+
+// estimateTempo busca el tempo cuyos múltiplos del periodo coinciden mejor con la autocorrelación de la
+// envolvente de ataques. Una preferencia suave por tempos cercanos a 120 BPM evita confundir el tempo con su
+// mitad o su doble. Regresa 0 si no encuentra ningún pulso.
+func estimateTempo(samples []float64) float64 {
+    envelope := onsetEnvelope(samples)
+    framesPerSecond := float64(fingerprintSampleRate) / onsetHop
+
+    maxLag := int(math.Ceil(60*framesPerSecond/tempoMinBPM))*tempoMultiples + 1
+    if len(envelope) <= 2*maxLag {
+        return 0
+    }
+    autocorrelation := make([]float64, maxLag+1)
+    for lag := range autocorrelation {
+        sum := 0.0
+        for i := lag; i < len(envelope); i++ {
+            sum += envelope[i] * envelope[i-lag]
+        }
+        autocorrelation[lag] = sum / float64(len(envelope)-lag)
+    }
+    if autocorrelation[0] <= 0 {
+        return 0
+    }
+
+    // Autocorrelación interpolada en un retraso fraccionario.
+    at := func(lag float64) float64 {
+        i := int(lag)
+        fraction := lag - float64(i)
+        return autocorrelation[i]*(1-fraction) + autocorrelation[i+1]*fraction
+    }
+
+    bestBPM, bestScore := 0.0, 0.0
+    for bpm := tempoMinBPM; bpm <= tempoMaxBPM; bpm += 0.1 {
+        period := 60 * framesPerSecond / bpm
+        score := 0.0
+        for k := 1; k <= tempoMultiples; k++ {
+            score += at(period * float64(k))
+        }
+        octaves := math.Log2(bpm / 120)
+        score *= math.Exp(-0.5 * octaves * octaves)
+        if score > bestScore {
+            bestBPM, bestScore = bpm, score
+        }
+    }
+    return math.Round(bestBPM)
+}
+
+// estimateKey suma la energía de cada nota en todo el fragmento y regresa la tonalidad cuyo perfil tiene la
+// mayor correlación con ella.
+func estimateKey(samples []float64) string {
+    window := hannWindow(keyFrameSize)
+
+    // Nota (0 = Do) más cercana a cada coeficiente de la FFT dentro del rango de frecuencias, o -1 si está fuera.
+    notes := make([]int, keyFrameSize/2)
+    for k := range notes {
+        notes[k] = -1
+        frequency := float64(k) * fingerprintSampleRate / keyFrameSize
+        if frequency >= keyMinFrequency && frequency <= keyMaxFrequency {
+            semitones := int(math.Round(12 * math.Log2(frequency/440)))
+            notes[k] = ((semitones+9)%12 + 12) % 12
+        }
+    }
+
+    var chroma [12]float64
+    buffer := make([]complex128, keyFrameSize)
+    for start := 0; start+keyFrameSize <= len(samples); start += keyFrameSize / 2 {
+        for i := range buffer {
+            buffer[i] = complex(samples[start+i]*window[i], 0)
+        }
+        fft(buffer)
+        for k, note := range notes {
+            if note >= 0 {
+                chroma[note] += cmplx.Abs(buffer[k])
+            }
+        }
+    }
+
+    best, bestCorrelation := "", -1.0
+    for tonic := 0; tonic < 12; tonic++ {
+        for _, minor := range []bool{false, true} {
+            profile := majorKeyProfile
+            if minor {
+                profile = minorKeyProfile
+            }
+            var rotated [12]float64
+            for degree, weight := range profile {
+                rotated[(tonic+degree)%12] = weight
+            }
+            if correlation := pearson(chroma[:], rotated[:]); correlation > bestCorrelation {
+                best, bestCorrelation = KeyName(tonic, minor), correlation
+            }
+        }
+    }
+    return best
+}
+
+// pearson calcula el coeficiente de correlación de Pearson entre dos series del mismo tamaño.
+func pearson(a, b []float64) float64 {
+    meanA, meanB := 0.0, 0.0
+    for i := range a {
+        meanA += a[i]
+        meanB += b[i]
+    }
+    meanA /= float64(len(a))
+    meanB /= float64(len(b))
+
+    covariance, varianceA, varianceB := 0.0, 0.0, 0.0
+    for i := range a {
+        covariance += (a[i] - meanA) * (b[i] - meanB)
+        varianceA += (a[i] - meanA) * (a[i] - meanA)
+        varianceB += (b[i] - meanB) * (b[i] - meanB)
+    }
+    if varianceA == 0 || varianceB == 0 {
+        return 0
+    }
+    return covariance / math.Sqrt(varianceA*varianceB)
+}
+
+// parseBPM interpreta el valor de una etiqueta TBPM. Regresa 0 si no es un tempo válido.
+func parseBPM(value string) float64 {
+    bpm, err := strconv.ParseFloat(strings.TrimSpace(strings.Replace(value, ",", ".", 1)), 64)
+    if err != nil || bpm <= 0 || bpm > 999 {
+        return 0
+    }
+    return bpm
+}
+
+// updateRolaTempoKey guarda el tempo y la tonalidad leídos de las etiquetas. Los valores vacíos no se guardan,
+// para que los estime el análisis de tempo y tonalidad.
+func updateRolaTempoKey(tx *sql.Tx, filePath string, bpm float64, key string) error {
+    var bpmValue, keyValue interface{}
+    if bpm > 0 {
+        bpmValue = bpm
+    }
+    if key != "" {
+        keyValue = key
+    }
+    if _, err := tx.Exec("UPDATE rolas SET bpm = ?, musical_key = ? WHERE path = ?", bpmValue, keyValue, filePath); err != nil {
+        return fmt.Errorf("error al guardar el tempo y la tonalidad: %v", err)
+    }
+    return nil
+}
+
+// AnalyzeTempoKeyWithProgress estima el tempo y la tonalidad de las rolas MP3 a las que les falta alguno de los
+// dos (porque sus etiquetas no los tenían), actualizando una barra de progreso. Los archivos se analizan en
+// paralelo y cada resultado se guarda en cuanto llega, sin reemplazar los valores de las etiquetas, por lo que
+// el análisis se puede interrumpir y continuar después. Regresa cuántas rolas se analizaron.
+func (m *MP3Miner) AnalyzeTempoKeyWithProgress(db *sql.DB, progressBar *widget.ProgressBar) (int, error) {
+    rows, err := db.Query("SELECT path FROM rolas WHERE codec = 'MP3' AND tempo_key_analyzed = 0 " +
+        "AND (bpm IS NULL OR musical_key IS NULL)")
+    if err != nil {
+        return 0, fmt.Errorf("error al obtener las rolas: %v", err)
+    }
+    var paths []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            rows.Close()
+            return 0, fmt.Errorf("error al leer las rolas: %v", err)
+        }
+        paths = append(paths, path)
+    }
+    rows.Close()
+
+    runAnalysisPipeline("Estimando tempo y tonalidad", paths, progressBar, func(r io.ReadSeeker) (interface{}, error) {
+        return EstimateTempoAndKey(r)
+    }, func(result analysisResult) {
+        storeEstimatedTempoKey(db, result)
+    })
+    return len(paths), nil
+}
+
+// storeEstimatedTempoKey guarda el tempo y la tonalidad estimados de una rola sólo donde faltan, y la marca
+// como analizada aunque no se haya podido estimar, para no volver a intentarlo en cada pasada.
+func storeEstimatedTempoKey(db *sql.DB, result analysisResult) {
+    var bpm, key interface{}
+    if result.err != nil {
+        log.Printf("Error al estimar el tempo y la tonalidad de %s: %v\n", result.path, result.err)
+    } else {
+        estimate := result.value.(*TempoKey)
+        if estimate.BPM > 0 {
+            bpm = estimate.BPM
+        }
+        if estimate.Key != "" {
+            key = estimate.Key
+        }
+    }
+    _, err := db.Exec("UPDATE rolas SET bpm = COALESCE(bpm, ?), musical_key = COALESCE(musical_key, ?), "+
+        "tempo_key_analyzed = 1 WHERE path = ?", bpm, key, result.path)
+    if err != nil {
+        log.Printf("Error al guardar el tempo y la tonalidad: %v\n", err)
+    }
+}
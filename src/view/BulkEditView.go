@@ -0,0 +1,218 @@
+package view
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// bulkEditFields asocia el nombre de cada campo editable, como se muestra en la tabla, con su campo en el modelo.
+var bulkEditFields = []struct {
+    label string
+    field string
+}{
+    {"Canción", model.FieldTitle},
+    {"Performer", model.FieldArtist},
+    {"Álbum", model.FieldAlbum},
+    {"Año", model.FieldYear},
+    {"Genero", model.FieldGenre},
+    {"No. de pista", model.FieldTrack},
+}
+
+// bulkEditOperations asocia el nombre de cada operación de la edición en lote con su operación en el modelo.
+var bulkEditOperations = []struct {
+    label string
+    kind  string
+}{
+    {"Asignar valor", model.BulkSet},
+    {"Buscar y reemplazar (expresión regular)", model.BulkReplace},
+    {"Mayúsculas y minúsculas", model.BulkCase},
+    {"Renumerar pistas", model.BulkRenumber},
+}
+
+// bulkEditCases asocia el nombre de cada conversión de mayúsculas y minúsculas con su conversión en el modelo.
+var bulkEditCases = []struct {
+    label      string
+    conversion string
+}{
+    {"Como Título", model.CaseTitle},
+    {"MAYÚSCULAS", model.CaseUpper},
+    {"minúsculas", model.CaseLower},
+}
+
+// fieldLabel regresa el nombre con que se muestra un campo.
+func fieldLabel(field string) string {
+    for _, f := range bulkEditFields {
+        if f.field == field {
+            return f.label
+        }
+    }
+    return field
+}
+
+// ShowBulkEditWindow abre una ventana para cambiar a la vez un campo de las canciones seleccionadas. Antes de guardar
+// se muestra la vista previa de los cambios (valor anterior y nuevo de cada campo que cambia). La función onApplied
+// se llama después de guardar, para refrescar la tabla principal.
+func ShowBulkEditWindow(myApp fyne.App, mc *controller.MusicController, songs []model.Song, onApplied func()) {
+    window := myApp.NewWindow(fmt.Sprintf("Editar %d canciones", len(songs)))
+
+    labels := func(n int, label func(int) string) []string {
+        options := make([]string, n)
+        for i := range options {
+            options[i] = label(i)
+        }
+        return options
+    }
+    operationSelect := widget.NewSelect(labels(len(bulkEditOperations), func(i int) string { return bulkEditOperations[i].label }), nil)
+    fieldSelect := widget.NewSelect(labels(len(bulkEditFields), func(i int) string { return bulkEditFields[i].label }), nil)
+    caseSelect := widget.NewSelect(labels(len(bulkEditCases), func(i int) string { return bulkEditCases[i].label }), nil)
+    patternEntry := widget.NewEntry()
+    patternEntry.SetPlaceHolder("e.g., (?i)beyonce")
+    valueEntry := widget.NewEntry()
+    valueEntry.SetPlaceHolder("Valor nuevo o reemplazo (${1}, ${2}... para los grupos)")
+    startEntry := widget.NewEntry()
+    startEntry.SetText("1")
+    writeFilesCheck := widget.NewCheck("Escribir también las etiquetas de los archivos MP3", nil)
+    writeFilesCheck.SetChecked(true)
+
+    // La vista previa tiene una fila por cada campo que cambia en cada canción.
+    type diffRow struct {
+        song model.Song
+        diff model.FieldDiff
+    }
+    var changes []model.BulkChange
+    var rows []diffRow
+    status := widget.NewLabel("")
+    headers := []string{"Archivo", "Campo", "Antes", "Después"}
+    previewTable := widget.NewTable(
+        func() (int, int) {
+            return len(rows) + 1, len(headers)
+        },
+        func() fyne.CanvasObject {
+            label := widget.NewLabel("")
+            label.Truncation = fyne.TextTruncateEllipsis
+            return label
+        },
+        func(id widget.TableCellID, cell fyne.CanvasObject) {
+            label := cell.(*widget.Label)
+            label.TextStyle = fyne.TextStyle{Bold: id.Row == 0}
+            label.Importance = widget.MediumImportance
+            if id.Row == 0 {
+                label.SetText(headers[id.Col])
+                return
+            }
+            row := rows[id.Row-1]
+            text := []string{row.song.Path, fieldLabel(row.diff.Field), row.diff.Before, row.diff.After}[id.Col]
+            if text == "" && id.Col >= 2 {
+                label.Importance = widget.LowImportance
+                text = missingValueText
+            }
+            label.SetText(text)
+        },
+    )
+    for i, width := range []float32{420, 110, 230, 230} {
+        previewTable.SetColumnWidth(i, width)
+    }
+
+    var applyButton *widget.Button
+    previewButton := widget.NewButton("Vista previa", func() {
+        start, err := strconv.Atoi(strings.TrimSpace(startEntry.Text))
+        if err != nil {
+            start = 1
+        }
+        op := model.BulkOperation{
+            Kind:    bulkEditOperations[operationSelect.SelectedIndex()].kind,
+            Field:   bulkEditFields[fieldSelect.SelectedIndex()].field,
+            Value:   valueEntry.Text,
+            Pattern: patternEntry.Text,
+            Case:    bulkEditCases[caseSelect.SelectedIndex()].conversion,
+            Start:   start,
+        }
+        changes, err = mc.PlanBulkEdit(songs, op)
+        rows = nil
+        if err != nil {
+            changes = nil
+            applyButton.Disable()
+            previewTable.Refresh()
+            dialog.ShowError(err, window)
+            return
+        }
+        for _, change := range changes {
+            for _, diff := range change.Diff() {
+                rows = append(rows, diffRow{song: change.Song, diff: diff})
+            }
+        }
+        status.SetText(fmt.Sprintf("Cambian %d de %d canciones.", len(changes), len(songs)))
+        if len(changes) > 0 {
+            applyButton.Enable()
+        } else {
+            applyButton.Disable()
+        }
+        previewTable.Refresh()
+    })
+
+    applyButton = widget.NewButton("Aplicar", func() {
+        // Los cambios se guardan todos o ninguno, y se pueden deshacer juntos con Ctrl+Z en la ventana principal.
+        if err := mc.ApplyBulkEdit(changes, writeFilesCheck.Checked); err != nil {
+            dialog.ShowError(fmt.Errorf("no se guardó ningún cambio: %v", err), window)
+            return
+        }
+        onApplied()
+        window.Close()
+    })
+    applyButton.Disable()
+
+    // Cualquier cambio en las opciones obliga a volver a ver la vista previa antes de aplicar.
+    invalidate := func() {
+        changes, rows = nil, nil
+        applyButton.Disable()
+        status.SetText("")
+        previewTable.Refresh()
+    }
+
+    // Sólo se habilitan los controles que usa la operación elegida.
+    operationSelect.OnChanged = func(string) {
+        kind := bulkEditOperations[operationSelect.SelectedIndex()].kind
+        setEnabled := func(w fyne.Disableable, enabled bool) {
+            if enabled {
+                w.Enable()
+            } else {
+                w.Disable()
+            }
+        }
+        setEnabled(fieldSelect, kind != model.BulkRenumber)
+        setEnabled(patternEntry, kind == model.BulkReplace)
+        setEnabled(valueEntry, kind == model.BulkSet || kind == model.BulkReplace)
+        setEnabled(caseSelect, kind == model.BulkCase)
+        setEnabled(startEntry, kind == model.BulkRenumber)
+        invalidate()
+    }
+    fieldSelect.OnChanged = func(string) { invalidate() }
+    caseSelect.OnChanged = func(string) { invalidate() }
+    patternEntry.OnChanged = func(string) { invalidate() }
+    valueEntry.OnChanged = func(string) { invalidate() }
+    startEntry.OnChanged = func(string) { invalidate() }
+    operationSelect.SetSelectedIndex(0)
+    fieldSelect.SetSelectedIndex(0)
+    caseSelect.SetSelectedIndex(0)
+
+    form := widget.NewForm(
+        widget.NewFormItem("Operación", operationSelect),
+        widget.NewFormItem("Campo", fieldSelect),
+        widget.NewFormItem("Buscar", patternEntry),
+        widget.NewFormItem("Valor", valueEntry),
+        widget.NewFormItem("Conversión", caseSelect),
+        widget.NewFormItem("Primera pista", startEntry),
+    )
+    top := container.NewVBox(form, writeFilesCheck, container.NewHBox(previewButton, applyButton, status))
+    window.SetContent(container.NewBorder(top, nil, nil, nil, previewTable))
+    window.Resize(fyne.NewSize(1050, 650))
+    window.Show()
+}
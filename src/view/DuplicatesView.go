@@ -0,0 +1,98 @@
+package view
+
+import (
+    "fmt"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// ShowDuplicatesWindow abre una ventana para buscar canciones duplicadas y elegir qué copia conservar.
+// La función onChange se llama cada vez que se oculta o se muestra una canción, para refrescar la tabla principal.
+func ShowDuplicatesWindow(myApp fyne.App, mc *controller.MusicController, onChange func()) {
+    window := myApp.NewWindow("Duplicados")
+
+    audioHashCheck := widget.NewCheck("Comparar también el audio (hash de las tramas MP3)", nil)
+    fingerprintCheck := widget.NewCheck("Comparar huellas acústicas (botón Huellas)", nil)
+    status := widget.NewLabel("")
+    groupsBox := container.NewVBox()
+
+    var search func()
+
+    // renderGroups muestra cada grupo como una tarjeta con una fila por copia.
+    renderGroups := func(groups []model.DuplicateGroup) {
+        groupsBox.Objects = nil
+        for _, group := range groups {
+            group := group
+            rows := container.NewVBox()
+            for _, song := range group.Songs {
+                song := song
+                description := fmt.Sprintf("%s — %s | %s | %s %s", song.Title, song.Album,
+                    controller.FormatDuration(song.Duration), song.Codec, song.Path)
+                if song.Bitrate > 0 {
+                    description += fmt.Sprintf(" | %d kbps", song.Bitrate)
+                }
+                label := widget.NewLabel(description)
+                label.Truncation = fyne.TextTruncateEllipsis
+
+                keepButton := widget.NewButton("Conservar", func() {
+                    if err := mc.KeepDuplicate(group, song.IDRola); err != nil {
+                        dialog.ShowError(err, window)
+                        return
+                    }
+                    onChange()
+                    search()
+                })
+                hideText := "Ocultar"
+                if song.Hidden {
+                    hideText = "Mostrar"
+                }
+                hideButton := widget.NewButton(hideText, func() {
+                    if err := mc.SetSongHidden(song.IDRola, !song.Hidden); err != nil {
+                        dialog.ShowError(err, window)
+                        return
+                    }
+                    onChange()
+                    search()
+                })
+                rows.Add(container.NewBorder(nil, nil, nil, container.NewHBox(keepButton, hideButton), label))
+            }
+            groupsBox.Add(widget.NewCard(group.Key, fmt.Sprintf("%d copias", len(group.Songs)), rows))
+        }
+        groupsBox.Refresh()
+        status.SetText(fmt.Sprintf("Grupos de duplicados: %d", len(groups)))
+    }
+
+    // search busca los duplicados en una gorutina, porque calcular los hashes de audio puede tardar.
+    search = func() {
+        status.SetText("Buscando duplicados...")
+        byAudioHash := audioHashCheck.Checked
+        byFingerprint := fingerprintCheck.Checked
+        go func() {
+            groups, err := mc.FindDuplicates(byAudioHash, byFingerprint)
+            if err != nil {
+                dialog.ShowError(err, window)
+                status.SetText("")
+                return
+            }
+            renderGroups(groups)
+        }()
+    }
+
+    searchButton := widget.NewButton("Buscar duplicados", search)
+
+    window.SetContent(container.NewBorder(
+        container.NewVBox(container.NewHBox(searchButton, audioHashCheck, fingerprintCheck), status), // Parte superior.
+        nil, // Parte inferior.
+        nil, // Parte izquierda.
+        nil, // Parte derecha.
+        container.NewVScroll(groupsBox), // Grupos de duplicados.
+    ))
+    window.Resize(fyne.NewSize(900, 600))
+    window.Show()
+    search()
+}
@@ -0,0 +1,221 @@
+package view
+
+import (
+    "fmt"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+const noParentGenre = "(ninguno)" // Opción para que un género no sea subgénero de otro.
+
+// ShowGenresWindow abre una ventana para revisar los géneros de la biblioteca: elegir el género principal de cada
+// uno (para buscar con "g+:" también sus subgéneros), agregar y quitar alias y unir géneros repetidos. La función
+// onChange se llama después de unir géneros, porque cambia el género de las canciones, para refrescar la tabla.
+func ShowGenresWindow(myApp fyne.App, mc *controller.MusicController, onChange func()) {
+    window := myApp.NewWindow("Géneros")
+
+    var genres []model.Genre
+    selected := -1
+    status := widget.NewLabel("")
+
+    genreList := widget.NewList(
+        func() int {
+            return len(genres)
+        },
+        func() fyne.CanvasObject {
+            label := widget.NewLabel("")
+            label.Truncation = fyne.TextTruncateEllipsis
+            return label
+        },
+        func(id widget.ListItemID, item fyne.CanvasObject) {
+            genre := genres[id]
+            text := fmt.Sprintf("%s (%d)", genre.Name, genre.Songs)
+            if genre.Parent != "" {
+                text += " — " + genre.Parent
+            }
+            item.(*widget.Label).SetText(text)
+        },
+    )
+
+    nameLabel := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+    parentSelect := widget.NewSelect(nil, nil)
+    aliasesLabel := widget.NewLabel("")
+    aliasesLabel.Wrapping = fyne.TextWrapWord
+    aliasEntry := widget.NewEntry()
+    aliasEntry.SetPlaceHolder("Otro nombre del género (e.g., Alternativo)")
+    mergeSelect := widget.NewSelect(nil, nil)
+    mergeSelect.PlaceHolder = "Unir con..."
+
+    // genreNamed busca un género de la lista por su nombre.
+    genreNamed := func(name string) (model.Genre, bool) {
+        for _, genre := range genres {
+            if genre.Name == name {
+                return genre, true
+            }
+        }
+        return model.Genre{}, false
+    }
+
+    // showGenre muestra los datos del género seleccionado. Las opciones de género principal y de unión son los
+    // demás géneros.
+    showGenre := func() {
+        if selected < 0 || selected >= len(genres) {
+            nameLabel.SetText("Selecciona un género.")
+            parentSelect.Options = nil
+            parentSelect.ClearSelected()
+            mergeSelect.Options = nil
+            mergeSelect.ClearSelected()
+            aliasesLabel.SetText("")
+            return
+        }
+        genre := genres[selected]
+        nameLabel.SetText(fmt.Sprintf("%s — %d canciones", genre.Name, genre.Songs))
+        others := []string{}
+        for _, other := range genres {
+            if other.ID != genre.ID {
+                others = append(others, other.Name)
+            }
+        }
+        parentSelect.Options = append([]string{noParentGenre}, others...)
+        if genre.Parent != "" {
+            parentSelect.SetSelected(genre.Parent)
+        } else {
+            parentSelect.SetSelected(noParentGenre)
+        }
+        mergeSelect.Options = others
+        mergeSelect.ClearSelected()
+        if len(genre.Aliases) > 0 {
+            aliasesLabel.SetText("Alias: " + strings.Join(genre.Aliases, ", "))
+        } else {
+            aliasesLabel.SetText("Sin alias.")
+        }
+    }
+
+    // reload vuelve a leer los géneros y conserva seleccionado el género con el nombre indicado.
+    reload := func(keep string) {
+        result, err := mc.GetGenres()
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        genres = result
+        selected = -1
+        for i, genre := range genres {
+            if genre.Name == keep {
+                selected = i
+            }
+        }
+        genreList.Refresh()
+        if selected >= 0 {
+            genreList.Select(selected)
+        } else {
+            genreList.UnselectAll()
+        }
+        showGenre()
+        status.SetText(fmt.Sprintf("Géneros: %d", len(genres)))
+    }
+
+    genreList.OnSelected = func(id widget.ListItemID) {
+        selected = id
+        showGenre()
+    }
+
+    saveParentButton := widget.NewButton("Guardar género principal", func() {
+        if selected < 0 {
+            return
+        }
+        genre := genres[selected]
+        parent := 0
+        if other, ok := genreNamed(parentSelect.Selected); ok {
+            parent = other.ID
+        }
+        if err := mc.SetGenreParent(genre, parent); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        reload(genre.Name)
+    })
+
+    addAliasButton := widget.NewButton("Agregar alias", func() {
+        if selected < 0 {
+            return
+        }
+        genre := genres[selected]
+        if err := mc.AddGenreAlias(aliasEntry.Text, genre); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        aliasEntry.SetText("")
+        reload(genre.Name)
+    })
+
+    removeAliasButton := widget.NewButton("Quitar alias", func() {
+        if selected < 0 || len(genres[selected].Aliases) == 0 {
+            return
+        }
+        genre := genres[selected]
+        aliasSelect := widget.NewSelect(genre.Aliases, nil)
+        aliasSelect.SetSelected(genre.Aliases[0])
+        dialog.ShowCustomConfirm("Quitar alias", "Quitar", "Cancelar", aliasSelect, func(confirmed bool) {
+            if !confirmed || aliasSelect.Selected == "" {
+                return
+            }
+            if err := mc.RemoveGenreAlias(aliasSelect.Selected); err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            reload(genre.Name)
+        }, window)
+    })
+
+    mergeButton := widget.NewButton("Unir", func() {
+        if selected < 0 {
+            return
+        }
+        genre := genres[selected]
+        into, ok := genreNamed(mergeSelect.Selected)
+        if !ok {
+            return
+        }
+        message := fmt.Sprintf("¿Cambiar \"%s\" por \"%s\" en %d canciones? \"%s\" quedará como alias de \"%s\". "+
+            "Las etiquetas de los archivos no se modifican.", genre.Name, into.Name, genre.Songs, genre.Name, into.Name)
+        dialog.ShowConfirm("Unir géneros", message, func(confirmed bool) {
+            if !confirmed {
+                return
+            }
+            if err := mc.MergeGenre(genre, into); err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            onChange()
+            reload(into.Name)
+        }, window)
+    })
+
+    help := widget.NewLabel("Los géneros se normalizan al minar y al editar: los números de ID3v1 se cambian por su " +
+        "nombre, los alias por su género y los géneros múltiples se separan. Busca con \"g: Rock\" sólo ese género y " +
+        "con \"g+: Rock\" también sus subgéneros.")
+    help.Wrapping = fyne.TextWrapWord
+
+    details := container.NewVBox(
+        nameLabel,
+        widget.NewLabel("Subgénero de:"),
+        container.NewBorder(nil, nil, nil, saveParentButton, parentSelect),
+        aliasesLabel,
+        container.NewBorder(nil, nil, nil, container.NewHBox(addAliasButton, removeAliasButton), aliasEntry),
+        container.NewBorder(nil, nil, nil, mergeButton, mergeSelect),
+    )
+    split := container.NewHSplit(genreList, container.NewVScroll(details))
+    split.Offset = 0.4
+
+    window.SetContent(container.NewBorder(container.NewVBox(help, status), nil, nil, nil, split))
+    window.Resize(fyne.NewSize(900, 550))
+    reload("")
+    window.Show()
+}
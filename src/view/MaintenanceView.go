@@ -0,0 +1,96 @@
+package view
+
+import (
+    "fmt"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// ShowMaintenanceWindow abre una ventana para revisar la integridad de la base de datos (esquema, archivo, referencias,
+// álbumes e intérpretes vacíos y archivos que ya no existen) y reparar lo que se pueda. La función onChange se llama
+// después de reparar, para refrescar la tabla principal.
+func ShowMaintenanceWindow(myApp fyne.App, mc *controller.MusicController, onChange func()) {
+    window := myApp.NewWindow("Mantenimiento")
+
+    var check model.DatabaseCheck
+    status := widget.NewLabel("")
+    problemsLabel := widget.NewLabel("")
+    problemsLabel.Wrapping = fyne.TextWrapWord
+    missingList := widget.NewList(
+        func() int {
+            return len(check.MissingFiles)
+        },
+        func() fyne.CanvasObject {
+            label := widget.NewLabel("")
+            label.Truncation = fyne.TextTruncateEllipsis
+            return label
+        },
+        func(id widget.ListItemID, item fyne.CanvasObject) {
+            item.(*widget.Label).SetText(check.MissingFiles[id])
+        },
+    )
+    removeMissingCheck := widget.NewCheck("Eliminar las canciones cuyos archivos ya no existen", nil)
+    var repairButton *widget.Button
+
+    runCheck := func() {
+        result, err := mc.CheckDatabase()
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        check = result
+        missingList.Refresh()
+        if check.OK() {
+            status.SetText("La base de datos no tiene problemas.")
+            problemsLabel.SetText("")
+            repairButton.Disable()
+            return
+        }
+        problems := check.Problems()
+        status.SetText(fmt.Sprintf("Problemas encontrados: %d", len(problems)))
+        problemsLabel.SetText("• " + strings.Join(problems, "\n• "))
+        repairButton.Enable()
+    }
+
+    repairButton = widget.NewButton("Reparar", func() {
+        message := "¿Reparar la base de datos? Los cambios no se pueden deshacer con Ctrl+Z."
+        if removeMissingCheck.Checked && len(check.MissingFiles) > 0 {
+            message = fmt.Sprintf("¿Reparar la base de datos y eliminar %d canciones cuyos archivos ya no existen? "+
+                "Los cambios no se pueden deshacer con Ctrl+Z.", len(check.MissingFiles))
+        }
+        dialog.ShowConfirm("Reparar", message, func(confirmed bool) {
+            if !confirmed {
+                return
+            }
+            repairs, err := mc.RepairDatabase(check, removeMissingCheck.Checked)
+            if len(repairs) > 0 {
+                onChange()
+            }
+            if err != nil {
+                dialog.ShowError(err, window)
+            } else if len(repairs) > 0 {
+                dialog.ShowInformation("Reparar", strings.Join(repairs, "\n"), window)
+            }
+            runCheck()
+        }, window)
+    })
+    repairButton.Disable()
+    checkButton := widget.NewButton("Revisar", runCheck)
+
+    top := container.NewVBox(
+        container.NewHBox(checkButton, repairButton, removeMissingCheck),
+        status,
+        problemsLabel,
+        widget.NewLabel("Archivos que ya no existen:"),
+    )
+    window.SetContent(container.NewBorder(top, nil, nil, nil, missingList))
+    window.Resize(fyne.NewSize(800, 550))
+    window.Show()
+    runCheck()
+}
@@ -2,16 +2,23 @@ package view
 
 import (
     "fmt"
+    "image/color"
+
     "fyne.io/fyne/v2"
     "fyne.io/fyne/v2/app"
+    "fyne.io/fyne/v2/canvas"
     "fyne.io/fyne/v2/container"
     "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/driver/desktop"
     "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/theme"
     "fyne.io/fyne/v2/widget"
     "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
 )
 
-const maxCharLength = 55 // Máximo número de caracteres para mostrar en cada celda de la tabla
+const maxCharLength = 55     // Máximo número de caracteres para mostrar en cada celda de la tabla
+const missingValueText = "—" // Texto que se muestra en lugar de un dato que no se conoce
 
 // truncateText es una función que trunca un texto si excede la longitud máxima permitida.
 func truncateText(text string, maxLength int) string {
@@ -22,7 +29,7 @@ func truncateText(text string, maxLength int) string {
 }
 
 // NewMusicView crea e inicializa la vista principal de la aplicación con una tabla de canciones, barra de búsqueda,
-// botones de control y funcionalidad de minería de archivos MP3.
+// botones de control y funcionalidad de minería de archivos de audio.
 func NewMusicView() {
     myApp := app.New()
     myWindow := myApp.NewWindow("Music Data Base")
@@ -36,6 +43,9 @@ func NewMusicView() {
         return
     }
 
+    // Respaldar la base de datos periódicamente mientras la aplicación está abierta.
+    mc.StartBackupSchedule()
+
     defer func() {
         if r := recover(); r != nil {
             fmt.Println("Se ha recuperado de un error inesperado:", r)
@@ -50,45 +60,162 @@ func NewMusicView() {
     var songData [][]string
     var songDataWithHeader [][]string
 
+    // Filas seleccionadas de la tabla (sin contar el encabezado) y la fila desde la que se extiende la selección con Shift.
+    selectedRows := map[int]bool{}
+    anchorRow := -1
+    clearSelection := func() {
+        selectedRows = map[int]bool{}
+        anchorRow = -1
+    }
+
     // Crear una tabla para mostrar los resultados de las canciones.
     songTable := widget.NewTable(
         func() (int, int) {
-            return len(songDataWithHeader), 6 // Número de filas y columnas (Canción, Performer, Álbum).
+            return len(songDataWithHeader), len(mc.VisibleColumns()) // Número de filas y columnas visibles (Canción, Performer, Álbum...).
         },
         func() fyne.CanvasObject {
-            return widget.NewLabel("") // Celda vacía inicial para la tabla.
+            // Celda vacía inicial para la tabla, con un fondo que marca las filas seleccionadas.
+            return container.NewStack(canvas.NewRectangle(color.Transparent), widget.NewLabel(""))
         },
         func(id widget.TableCellID, cell fyne.CanvasObject) {
-            label := cell.(*widget.Label)
+            background := cell.(*fyne.Container).Objects[0].(*canvas.Rectangle)
+            label := cell.(*fyne.Container).Objects[1].(*widget.Label)
+            background.FillColor = color.Transparent
+            if id.Row > 0 && selectedRows[id.Row-1] {
+                background.FillColor = theme.Color(theme.ColorNameSelection)
+            }
+            background.Refresh()
             if id.Row == 0 {
-                label.SetText(songDataWithHeader[0][id.Col]) // Establecer encabezados.
                 label.TextStyle = fyne.TextStyle{Bold: true}
+                label.Importance = widget.MediumImportance
+                label.SetText(songDataWithHeader[0][id.Col]) // Establecer encabezados.
             } else {
-                label.SetText(truncateText(songDataWithHeader[id.Row][id.Col], maxCharLength)) // Mostrar datos truncados.
+                // Los datos que faltan se muestran atenuados y los que no vienen de las etiquetas, en cursiva.
+                source, missing := mc.CellProvenance(id.Row-1, id.Col)
+                label.TextStyle = fyne.TextStyle{Italic: missing || (source != "" && source != model.SourceTag)}
+                label.Importance = widget.MediumImportance
+                text := truncateText(songDataWithHeader[id.Row][id.Col], maxCharLength) // Mostrar datos truncados.
+                if missing {
+                    label.Importance = widget.LowImportance
+                    text = missingValueText
+                }
+                label.SetText(text)
             }
         },
     )
     
-    // Configurar el ancho de las columnas para ajustarse a los datos.
-    songTable.SetColumnWidth(0, 500) // Ancho de la columna Canción.
-    songTable.SetColumnWidth(1, 400) // Ancho de la columna Performer.
-    songTable.SetColumnWidth(2, 400) // Ancho de la columna Álbum.
-    songTable.SetColumnWidth(3, 100) // Ancho de la columna Año.
-    songTable.SetColumnWidth(4, 200) // Ancho de la columna Genero.
-    songTable.SetColumnWidth(5, 100) // Ancho de la columna No. de pista.
+    // Configurar el ancho de las columnas visibles para ajustarse a los datos.
+    applyColumnWidths := func() {
+        for i, column := range mc.VisibleColumns() {
+            songTable.SetColumnWidth(i, column.Width)
+        }
+    }
+    applyColumnWidths()
+
+    // Panel de detalle con la portada y la información de la canción seleccionada en la tabla.
+    detailPane := NewSongDetailPane()
+    showSongDetail := func(song model.Song) {
+        lyrics, err := mc.GetSongLyrics(song.IDRola)
+        if err != nil {
+            dialog.ShowError(err, myWindow)
+        }
+        frames, err := mc.GetSongTagFrames(song.IDRola)
+        if err != nil {
+            dialog.ShowError(err, myWindow)
+        }
+        detailPane.ShowSong(song, mc.Columns, lyrics, frames)
+    }
+    // Un clic selecciona una fila; con Ctrl se agrega o se quita de la selección y con Shift se selecciona
+    // el rango desde la última fila elegida.
+    songTable.OnSelected = func(id widget.TableCellID) {
+        songTable.UnselectAll() // La selección se lleva en selectedRows, así un segundo clic en la misma celda también cuenta.
+        row := id.Row - 1
+        song, ok := mc.SongAt(row)
+        if !ok {
+            return
+        }
+
+        var modifiers fyne.KeyModifier
+        if driver, ok := fyne.CurrentApp().Driver().(desktop.Driver); ok {
+            modifiers = driver.CurrentKeyModifiers()
+        }
+        switch {
+        case modifiers&fyne.KeyModifierShift != 0 && anchorRow >= 0:
+            selectedRows = map[int]bool{}
+            for r := min(anchorRow, row); r <= max(anchorRow, row); r++ {
+                selectedRows[r] = true
+            }
+        case modifiers&(fyne.KeyModifierControl|fyne.KeyModifierSuper) != 0:
+            if selectedRows[row] {
+                delete(selectedRows, row)
+            } else {
+                selectedRows[row] = true
+            }
+            anchorRow = row
+        default:
+            selectedRows = map[int]bool{row: true}
+            anchorRow = row
+        }
+        songTable.Refresh()
+        showSongDetail(song)
+    }
+
+    // Al editar una canción en el panel de detalle se escriben sus etiquetas y se actualiza su fila en la tabla.
+    // Con el catálogo compartido las canciones no se pueden editar.
+    if mc.LocalCatalog() {
+        detailPane.OnEdit = func(song model.Song, edit model.SongEdit) error {
+            if err := mc.EditSong(song, edit); err != nil {
+                dialog.ShowError(err, myWindow)
+                return err
+            }
+            updated, err := mc.ReloadSong(song.IDRola)
+            if err != nil {
+                dialog.ShowError(err, myWindow)
+                return nil
+            }
+            songDataWithHeader = append([][]string{mc.TableHeader()}, mc.CurrentTableData()...)
+            songTable.Refresh()
+            showSongDetail(updated)
+            return nil
+        }
+    }
     
 
+    // ID del álbum cuyas canciones muestra la tabla, o 0 si muestra todas las canciones o una búsqueda.
+    shownAlbum := 0
+
     // Función para cargar y actualizar los datos de la tabla de canciones desde el controlador.
     loadTableData := func() {
+        shownAlbum = 0
         data, err := mc.CreateSongTableData()
         if err != nil {
             dialog.ShowError(err, myWindow)
             return
         }
         songData = data
-        songDataWithHeader = [][]string{{"Canción", "Performer", "Álbum", "Año", "Genero", "No. de pista"}}
+        songDataWithHeader = [][]string{mc.TableHeader()}
+        songDataWithHeader = append(songDataWithHeader, songData...)
+        clearSelection()
+        songTable.Refresh()
+    }
+
+    // Función para mostrar en la tabla las canciones de un álbum, ordenadas por disco y pista. El álbum se carga por
+    // su ID y no con una búsqueda "a: ", que encontraría también los álbumes cuyo nombre contiene el suyo.
+    loadAlbumSongs := func(idAlbum int) error {
+        data, err := mc.AlbumSongsTableData(idAlbum)
+        if err != nil {
+            return err
+        }
+        if len(data) == 0 {
+            return fmt.Errorf("el álbum ya no tiene canciones")
+        }
+        shownAlbum = idAlbum
+        songData = data
+        songDataWithHeader = [][]string{mc.TableHeader()}
         songDataWithHeader = append(songDataWithHeader, songData...)
+        clearSelection()
         songTable.Refresh()
+        return nil
     }
 
     // Cargar los datos de la tabla al inicio de la aplicación.
@@ -96,7 +223,7 @@ func NewMusicView() {
 
     // Crear un campo de entrada para buscar canciones usando filtros por performer, álbum, etc.
     searchEntry := widget.NewEntry()
-    searchEntry.SetPlaceHolder("Buscar canción: 'p: <performer>, a: <album>, c: <cancion>, g: <genero>, y: <año>'")
+    searchEntry.SetPlaceHolder("Buscar canción: 'p: <performer>, a: <album>, c: <cancion>, g: <genero>, y: <año>, f: <formato>'")
 
     // Función para realizar la búsqueda y actualizar la tabla con los resultados.
     performSearch := func() {
@@ -106,9 +233,11 @@ func NewMusicView() {
             dialog.ShowError(err, myWindow)
             return
         }
+        shownAlbum = 0
         songData = data
-        songDataWithHeader = [][]string{{"Canción", "Performer", "Álbum", "Año", "Genero", "No. de pista"}}
+        songDataWithHeader = [][]string{mc.TableHeader()}
         songDataWithHeader = append(songDataWithHeader, songData...)
+        clearSelection()
         songTable.Refresh()
     }
 
@@ -117,6 +246,21 @@ func NewMusicView() {
         performSearch()
     }
 
+    // Función para volver a cargar la tabla conservando el álbum o la búsqueda actual, después de cambiar la
+    // biblioteca. Si el álbum ya no existe se muestran todas las canciones.
+    reloadTable := func() {
+        switch {
+        case shownAlbum != 0:
+            if err := loadAlbumSongs(shownAlbum); err != nil {
+                loadTableData()
+            }
+        case searchEntry.Text != "":
+            performSearch()
+        default:
+            loadTableData()
+        }
+    }
+
     
 
     // Crear botones de control para minimizar, pantalla completa y cerrar la aplicación.
@@ -135,24 +279,234 @@ func NewMusicView() {
         mc.OpenHelp()
     })
     settingsButton := widget.NewButton("Settings", func() {
-        mc.ShowSettingsDialog(myWindow)
+        mc.ShowSettingsDialog(myWindow, reloadTable)
     })
     homeButton := widget.NewButton("Inicio", func() {
         loadTableData()
     })
 
+    // Botón "Columnas" para mostrar u ocultar las columnas opcionales (formato y propiedades de audio).
+    columnsButton := widget.NewButton("Columnas", func() {
+        var items []*widget.FormItem
+        checks := map[*controller.SongColumn]*widget.Check{}
+        for _, column := range mc.Columns {
+            if !column.Optional {
+                continue
+            }
+            check := widget.NewCheck("", nil)
+            check.SetChecked(column.Visible)
+            checks[column] = check
+            items = append(items, widget.NewFormItem(column.Header, check))
+        }
+        dialog.ShowForm("Columnas", "Aplicar", "Cancelar", items, func(response bool) {
+            if !response {
+                return
+            }
+            for column, check := range checks {
+                column.Visible = check.Checked
+            }
+            songDataWithHeader = [][]string{mc.TableHeader()}
+            songDataWithHeader = append(songDataWithHeader, mc.CurrentTableData()...)
+            applyColumnWidths()
+            songTable.Refresh()
+        }, myWindow)
+    })
+
+    // Botón "Verificar" para revisar todas las tramas de los MP3 y marcar los archivos dañados.
+    verifyButton := widget.NewButton("Verificar", func() {
+        mc.StartIntegrityCheckWithProgress(myWindow, progressBar, func() {
+            loadTableData()
+        })
+    })
+
+    // Botón "Huellas" para calcular las huellas acústicas que faltan y encontrar la misma grabación con otras etiquetas.
+    fingerprintButton := widget.NewButton("Huellas", func() {
+        mc.StartFingerprintingWithProgress(myWindow, progressBar, func() {})
+    })
+
+    // Botón "Sonoridad" para medir la sonoridad EBU R128 y el pico de las rolas que faltan.
+    loudnessButton := widget.NewButton("Sonoridad", func() {
+        mc.StartLoudnessAnalysisWithProgress(myWindow, progressBar, func() {
+            loadTableData()
+        })
+    })
+
+    // Botón "Tempo y tono" para estimar el tempo y la tonalidad de las rolas que no los tienen en sus etiquetas.
+    tempoKeyButton := widget.NewButton("Tempo y tono", func() {
+        mc.StartTempoKeyAnalysisWithProgress(myWindow, progressBar, func() {
+            loadTableData()
+        })
+    })
+
+    // Botón "Exportar dañadas" para guardar la lista de archivos dañados y volver a obtenerlos.
+    exportDamagedButton := widget.NewButton("Exportar dañadas", func() {
+        dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+            if err != nil {
+                dialog.ShowError(err, myWindow)
+                return
+            }
+            if writer == nil {
+                return // El usuario canceló el diálogo.
+            }
+            defer writer.Close()
+
+            count, err := mc.ExportDamagedSongs(writer)
+            if err != nil {
+                dialog.ShowError(err, myWindow)
+                return
+            }
+            dialog.ShowInformation("Exportar dañadas", fmt.Sprintf("Se exportaron %d canciones.", count), myWindow)
+        }, myWindow)
+    })
+
+    // Botón "Duplicados" para revisar las canciones repetidas y elegir qué copia conservar.
+    duplicatesButton := widget.NewButton("Duplicados", func() {
+        ShowDuplicatesWindow(myApp, mc, loadTableData)
+    })
+
+    // Botón "Editar selección" para cambiar a la vez un campo de todas las canciones seleccionadas en la tabla.
+    bulkEditButton := widget.NewButton("Editar selección", func() {
+        rows := make([]int, 0, len(selectedRows))
+        for row := range selectedRows {
+            rows = append(rows, row)
+        }
+        songs := mc.SongsAtRows(rows)
+        if len(songs) == 0 {
+            dialog.ShowInformation("Editar selección", "Selecciona canciones en la tabla (Ctrl o Shift para elegir varias).", myWindow)
+            return
+        }
+        ShowBulkEditWindow(myApp, mc, songs, func() {
+            songDataWithHeader = append([][]string{mc.TableHeader()}, mc.CurrentTableData()...)
+            songTable.Refresh()
+        })
+    })
+
+    // Botón "Plantillas" para configurar cómo se deducen los datos que faltan a partir de la ruta de los archivos.
+    pathTemplatesButton := widget.NewButton("Plantillas", func() {
+        ShowPathTemplatesWindow(myApp, mc)
+    })
+
+    // Botón "Organizar" para renombrar y mover los archivos de las canciones mostradas según una plantilla.
+    organizeButton := widget.NewButton("Organizar", func() {
+        ShowOrganizeWindow(myApp, mc, reloadTable)
+    })
+
+    // Botón "Géneros" para revisar la jerarquía de géneros, sus alias y unir géneros repetidos.
+    genresButton := widget.NewButton("Géneros", func() {
+        ShowGenresWindow(myApp, mc, reloadTable)
+    })
+
+    // Botón "Intérpretes" para unir los intérpretes repetidos con nombres escritos de distintas formas.
+    performersButton := widget.NewButton("Intérpretes", func() {
+        ShowPerformersWindow(myApp, mc, reloadTable)
+    })
+
+    // Botón "Mantenimiento" para revisar la integridad de la base de datos y repararla.
+    maintenanceButton := widget.NewButton("Mantenimiento", func() {
+        ShowMaintenanceWindow(myApp, mc, reloadTable)
+    })
+
+    // La edición, los análisis y el mantenimiento trabajan sobre la base de datos local; con el catálogo compartido
+    // sólo se puede minar, buscar, navegar y unir intérpretes.
+    if !mc.LocalCatalog() {
+        for _, button := range []*widget.Button{verifyButton, fingerprintButton, loudnessButton, tempoKeyButton,
+            exportDamagedButton, duplicatesButton, bulkEditButton, organizeButton, genresButton, maintenanceButton} {
+            button.Disable()
+        }
+    }
+
+    // Ctrl+Z deshace la última operación de la bitácora (ediciones, canciones ocultas...) y Ctrl+Shift+Z la rehace.
+    // Después se vuelven a cargar la tabla y la canción del panel de detalle para mostrar los datos restaurados.
+    journalLabel := widget.NewLabel("")
+    journalLabel.Importance = widget.LowImportance
+    replayJournal := func(replay func() (string, error), done string) {
+        description, err := replay()
+        if err != nil {
+            dialog.ShowError(err, myWindow)
+            return
+        }
+        journalLabel.SetText(done + ": " + description)
+        reloadTable()
+        if shown := detailPane.Song(); shown.IDRola != 0 {
+            if song, err := mc.ReloadSong(shown.IDRola); err == nil {
+                showSongDetail(song)
+            }
+        }
+    }
+    myWindow.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault}, func(fyne.Shortcut) {
+        replayJournal(mc.Undo, "Deshecho")
+    })
+    myWindow.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift}, func(fyne.Shortcut) {
+        replayJournal(mc.Redo, "Rehecho")
+    })
+
+    // Vista de canciones (tabla con panel de detalle) y vista de álbumes (cuadrícula de portadas).
+    songsView := container.NewHSplit(songTable, container.NewVScroll(detailPane.Container))
+    songsView.SetOffset(0.75)
+    mainArea := container.NewStack(songsView)
+
+    var albums []model.Album
+    var albumsButton *widget.Button
+    showSongsView := func() {
+        mainArea.Objects = []fyne.CanvasObject{songsView}
+        mainArea.Refresh()
+        albumsButton.SetText("Álbumes")
+    }
+    albumGrid := NewAlbumGrid(func() []model.Album {
+        return albums
+    }, func(album model.Album) {
+        // Al elegir un álbum se muestran sus canciones en la tabla; la búsqueda anterior ya no aplica.
+        if err := loadAlbumSongs(album.IDAlbum); err != nil {
+            dialog.ShowError(err, myWindow)
+            return
+        }
+        searchEntry.SetText("")
+        showSongsView()
+    })
+    albumsButton = widget.NewButton("Álbumes", func() {
+        if mainArea.Objects[0] == songsView {
+            data, err := mc.GetAllAlbums()
+            if err != nil {
+                dialog.ShowError(err, myWindow)
+                return
+            }
+            albums = data
+            albumGrid.Refresh()
+            mainArea.Objects = []fyne.CanvasObject{albumGrid}
+            mainArea.Refresh()
+            albumsButton.SetText("Canciones")
+        } else {
+            showSongsView()
+        }
+    })
+
     // Agrupar los botones en un contenedor horizontal.
     buttonsContainer := container.NewHBox(
         helpButton,
         settingsButton,
         homeButton,
+        albumsButton,
+        columnsButton,
+        verifyButton,
+        exportDamagedButton,
+        fingerprintButton,
+        loudnessButton,
+        tempoKeyButton,
+        duplicatesButton,
+        bulkEditButton,
+        pathTemplatesButton,
+        organizeButton,
+        genresButton,
+        performersButton,
+        maintenanceButton,
         layout.NewSpacer(),
+        journalLabel,
         minimizeButton,
         fullscreenButton,
         closeButton,
     )
 
-    // Botón "Miner" para iniciar el proceso de minería de archivos MP3, verificando archivos de configuración antes.
+    // Botón "Miner" para iniciar el proceso de minería de archivos de audio, verificando archivos de configuración antes.
 minerButton := widget.NewButton("Minero", func() {
     // Verificar los archivos de configuración y base de datos antes de comenzar la minería.
     if err := mc.CheckConfigAndDB(); err != nil {
@@ -172,7 +526,7 @@ minerButton := widget.NewButton("Minero", func() {
         nil, // Parte inferior.
         nil, // Parte izquierda.
         nil, // Parte derecha.
-        songTable, // Área principal con la tabla de canciones.
+        mainArea, // Área principal con la tabla de canciones o la cuadrícula de álbumes.
     )
 
     // Configurar el tamaño inicial de la ventana y mostrar la aplicación.
@@ -0,0 +1,116 @@
+package view
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// relativePath regresa la ruta relativa al directorio indicado, o la ruta completa si está fuera de él.
+func relativePath(dir, path string) string {
+    if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+        return rel
+    }
+    return path
+}
+
+// ShowOrganizeWindow abre una ventana para renombrar y mover los archivos de las canciones mostradas en la tabla
+// según una plantilla. Primero se muestra la simulación (ruta actual y nueva de cada archivo) y sólo después se
+// pueden mover los archivos. La función onApplied se llama después de moverlos, para refrescar la tabla principal.
+func ShowOrganizeWindow(myApp fyne.App, mc *controller.MusicController, onApplied func()) {
+    window := myApp.NewWindow("Organizar archivos")
+    musicDir := mc.ConfigFile.DefaultMusicDir
+
+    templateEntry := widget.NewEntry()
+    templateEntry.SetText(mc.OrganizeTemplateText())
+    templateEntry.SetPlaceHolder(model.DefaultOrganizeTemplate)
+
+    help := widget.NewLabel(fmt.Sprintf("Se organizan las %d canciones mostradas en la tabla, dentro de %s. "+
+        "Campos: {albumartist}, {artist}, {album}, {year}, {disc}, {track}, {title} y {genre}; los números admiten un "+
+        "ancho, como {track:02}, y {disc} sólo aparece en álbumes de varios discos (e.g., \"2-\"). Cada archivo conserva "+
+        "su extensión y los caracteres que FAT no admite se reemplazan.", len(mc.CurrentSongs), musicDir))
+    help.Wrapping = fyne.TextWrapWord
+
+    var moves []model.OrganizeMove
+    status := widget.NewLabel("")
+    headers := []string{"Archivo actual", "Ruta nueva", "Nota"}
+    previewTable := widget.NewTable(
+        func() (int, int) {
+            return len(moves) + 1, len(headers)
+        },
+        func() fyne.CanvasObject {
+            label := widget.NewLabel("")
+            label.Truncation = fyne.TextTruncateEllipsis
+            return label
+        },
+        func(id widget.TableCellID, cell fyne.CanvasObject) {
+            label := cell.(*widget.Label)
+            label.TextStyle = fyne.TextStyle{Bold: id.Row == 0}
+            if id.Row == 0 {
+                label.SetText(headers[id.Col])
+                return
+            }
+            move := moves[id.Row-1]
+            label.SetText([]string{relativePath(musicDir, move.From), relativePath(musicDir, move.To), move.Note}[id.Col])
+        },
+    )
+    for i, width := range []float32{420, 420, 200} {
+        previewTable.SetColumnWidth(i, width)
+    }
+
+    var organizeButton *widget.Button
+    previewButton := widget.NewButton("Vista previa", func() {
+        result, err := mc.PlanOrganize(templateEntry.Text)
+        if err != nil {
+            moves = nil
+            organizeButton.Disable()
+            previewTable.Refresh()
+            dialog.ShowError(err, window)
+            return
+        }
+        moves = result
+        status.SetText(fmt.Sprintf("Se moverán %d de %d archivos.", len(moves), len(mc.CurrentSongs)))
+        if len(moves) > 0 {
+            organizeButton.Enable()
+        } else {
+            organizeButton.Disable()
+        }
+        previewTable.Refresh()
+    })
+
+    organizeButton = widget.NewButton("Organizar", func() {
+        message := fmt.Sprintf("¿Mover %d archivos? Se puede deshacer con Ctrl+Z en la ventana principal.", len(moves))
+        dialog.ShowConfirm("Organizar archivos", message, func(confirmed bool) {
+            if !confirmed {
+                return
+            }
+            if err := mc.ApplyOrganize(templateEntry.Text, moves); err != nil {
+                dialog.ShowError(fmt.Errorf("no se movió ningún archivo: %v", err), window)
+                return
+            }
+            onApplied()
+            window.Close()
+        }, window)
+    })
+    organizeButton.Disable()
+
+    // Al cambiar la plantilla hay que volver a ver la vista previa antes de organizar.
+    templateEntry.OnChanged = func(string) {
+        moves = nil
+        organizeButton.Disable()
+        status.SetText("")
+        previewTable.Refresh()
+    }
+
+    top := container.NewVBox(help, templateEntry, container.NewHBox(previewButton, organizeButton, status))
+    window.SetContent(container.NewBorder(top, nil, nil, nil, previewTable))
+    window.Resize(fyne.NewSize(1100, 600))
+    window.Show()
+}
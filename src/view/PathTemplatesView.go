@@ -0,0 +1,113 @@
+package view
+
+import (
+    "fmt"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+const pathTemplateSampleSize = 50 // Número de archivos de ejemplo en la vista previa de las plantillas de rutas.
+
+// pathTemplateColumns son los campos que se muestran en la vista previa, con su encabezado.
+var pathTemplateColumns = []struct {
+    field  string
+    header string
+}{
+    {model.FieldArtist, "Performer"},
+    {model.FieldAlbum, "Álbum"},
+    {model.FieldYear, "Año"},
+    {model.FieldTrack, "Pista"},
+    {model.FieldTitle, "Canción"},
+    {model.FieldGenre, "Genero"},
+}
+
+// ShowPathTemplatesWindow abre una ventana para editar las plantillas de rutas con las que el minero deduce los datos
+// que faltan en las etiquetas. La vista previa muestra lo que se deduciría de una muestra de archivos del directorio
+// de música antes de guardar las plantillas.
+func ShowPathTemplatesWindow(myApp fyne.App, mc *controller.MusicController) {
+    window := myApp.NewWindow("Plantillas de rutas")
+
+    templatesEntry := widget.NewMultiLineEntry()
+    templatesEntry.SetText(strings.Join(mc.ConfigFile.PathTemplates, "\n"))
+    templatesEntry.SetPlaceHolder("{artist}/{year} - {album}/{track} - {title}")
+    templatesEntry.SetMinRowsVisible(4)
+
+    help := widget.NewLabel("Una plantilla por línea; se usa la primera que coincida con la ruta del archivo (relativa al " +
+        "directorio de música y sin extensión). Campos: {artist}, {album}, {year}, {track}, {title} y {genre}. " +
+        "Los datos de las etiquetas siempre tienen prioridad.")
+    help.Wrapping = fyne.TextWrapWord
+
+    var previews []controller.PathTemplatePreview
+    status := widget.NewLabel("")
+
+    // La tabla tiene una fila de encabezado y una columna con la ruta del archivo, seguida de los campos deducidos.
+    previewTable := widget.NewTable(
+        func() (int, int) {
+            return len(previews) + 1, len(pathTemplateColumns) + 1
+        },
+        func() fyne.CanvasObject {
+            label := widget.NewLabel("")
+            label.Truncation = fyne.TextTruncateEllipsis
+            return label
+        },
+        func(id widget.TableCellID, cell fyne.CanvasObject) {
+            label := cell.(*widget.Label)
+            label.TextStyle = fyne.TextStyle{}
+            label.Importance = widget.MediumImportance
+            switch {
+            case id.Row == 0:
+                label.TextStyle = fyne.TextStyle{Bold: true}
+                if id.Col == 0 {
+                    label.SetText("Archivo")
+                } else {
+                    label.SetText(pathTemplateColumns[id.Col-1].header)
+                }
+            case id.Col == 0:
+                label.SetText(previews[id.Row-1].Path)
+            default:
+                field, ok := previews[id.Row-1].Fields[pathTemplateColumns[id.Col-1].field]
+                if !ok {
+                    label.Importance = widget.LowImportance
+                    label.SetText(missingValueText)
+                    return
+                }
+                // Los datos que sólo se suponen se muestran en cursiva, igual que en la tabla principal.
+                label.TextStyle = fyne.TextStyle{Italic: field.Source == model.SourceGuessed}
+                label.SetText(field.Value)
+            }
+        },
+    )
+    previewTable.SetColumnWidth(0, 380)
+    for i := range pathTemplateColumns {
+        previewTable.SetColumnWidth(i+1, 160)
+    }
+
+    previewButton := widget.NewButton("Vista previa", func() {
+        result, err := mc.PreviewPathTemplates(strings.Split(templatesEntry.Text, "\n"), pathTemplateSampleSize)
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        previews = result
+        status.SetText(fmt.Sprintf("%d archivos de ejemplo de %s", len(previews), mc.ConfigFile.DefaultMusicDir))
+        previewTable.Refresh()
+    })
+    saveButton := widget.NewButton("Guardar", func() {
+        if err := mc.SetPathTemplates(strings.Split(templatesEntry.Text, "\n")); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        window.Close()
+    })
+
+    top := container.NewVBox(help, templatesEntry, container.NewHBox(previewButton, saveButton, status))
+    window.SetContent(container.NewBorder(top, nil, nil, nil, previewTable))
+    window.Resize(fyne.NewSize(1100, 600))
+    window.Show()
+}
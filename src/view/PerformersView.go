@@ -0,0 +1,146 @@
+package view
+
+import (
+    "fmt"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+// performerOption describe un intérprete en las opciones de un grupo. Incluye el ID porque puede haber varios
+// intérpretes con exactamente el mismo nombre.
+func performerOption(performer model.Performer) string {
+    option := fmt.Sprintf("%s — %d canciones (ID %d)", performer.Name, performer.Songs, performer.ID)
+    if len(performer.Aliases) > 0 {
+        option += " — alias: " + strings.Join(performer.Aliases, ", ")
+    }
+    return option
+}
+
+// ShowPerformersWindow abre una ventana para unir intérpretes repetidos (e.g., "Juan Gabriel" y "JUAN GABRIEL").
+// Sugiere los grupos de nombres parecidos y también permite buscar intérpretes por nombre. Al unir un grupo, las
+// canciones pasan al intérprete elegido y los demás nombres quedan como sus alias. La función onChange se llama
+// después de unir, para refrescar la tabla principal.
+func ShowPerformersWindow(myApp fyne.App, mc *controller.MusicController, onChange func()) {
+    window := myApp.NewWindow("Intérpretes")
+
+    status := widget.NewLabel("")
+    clustersBox := container.NewVBox()
+    var refresh func()
+
+    // renderClusters muestra cada grupo como una tarjeta: se marcan los intérpretes que se unen y se elige el nombre
+    // que se conserva.
+    renderClusters := func(clusters []model.PerformerCluster) {
+        clustersBox.Objects = nil
+        for _, cluster := range clusters {
+            byOption := map[string]model.Performer{}
+            options := make([]string, len(cluster.Performers))
+            for i, performer := range cluster.Performers {
+                options[i] = performerOption(performer)
+                byOption[options[i]] = performer
+            }
+
+            members := widget.NewCheckGroup(options, nil)
+            members.SetSelected(options)
+            canonical := widget.NewSelect(options, nil)
+            canonical.SetSelected(options[cluster.Suggested])
+
+            mergeButton := widget.NewButton("Unir", func() {
+                into, ok := byOption[canonical.Selected]
+                if !ok {
+                    return
+                }
+                var performers []model.Performer
+                songs := 0
+                for _, option := range members.Selected {
+                    if performer := byOption[option]; performer.ID != into.ID {
+                        performers = append(performers, performer)
+                        songs += performer.Songs
+                    }
+                }
+                if len(performers) == 0 {
+                    dialog.ShowInformation("Unir intérpretes", "Marca al menos otro intérprete para unirlo.", window)
+                    return
+                }
+                message := fmt.Sprintf("¿Pasar %d canciones de %d intérpretes a \"%s\"? Sus nombres quedarán como alias "+
+                    "de \"%s\". Las etiquetas de los archivos no se modifican.", songs, len(performers), into.Name, into.Name)
+                if !mc.LocalCatalog() {
+                    message += " En el catálogo compartido la unión no se puede deshacer."
+                }
+                dialog.ShowConfirm("Unir intérpretes", message, func(confirmed bool) {
+                    if !confirmed {
+                        return
+                    }
+                    if err := mc.MergePerformers(performers, into); err != nil {
+                        dialog.ShowError(err, window)
+                        return
+                    }
+                    onChange()
+                    refresh()
+                }, window)
+            })
+
+            content := container.NewVBox(members, container.NewBorder(nil, nil, widget.NewLabel("Conservar:"), mergeButton, canonical))
+            clustersBox.Add(widget.NewCard(cluster.Performers[cluster.Suggested].Name, fmt.Sprintf("%d intérpretes", len(cluster.Performers)), content))
+        }
+        clustersBox.Refresh()
+    }
+
+    suggest := func() {
+        clusters, err := mc.SuggestPerformerMerges()
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        renderClusters(clusters)
+        status.SetText(fmt.Sprintf("Grupos de nombres parecidos: %d", len(clusters)))
+    }
+
+    searchEntry := widget.NewEntry()
+    searchEntry.SetPlaceHolder("Buscar intérpretes por nombre para unirlos")
+    search := func() {
+        cluster, err := mc.FindPerformers(searchEntry.Text)
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if len(cluster.Performers) == 0 {
+            renderClusters(nil)
+            status.SetText("Ningún intérprete coincide con la búsqueda.")
+            return
+        }
+        renderClusters([]model.PerformerCluster{cluster})
+        status.SetText(fmt.Sprintf("Intérpretes encontrados: %d", len(cluster.Performers)))
+    }
+    searchEntry.OnSubmitted = func(string) { search() }
+
+    // refresh vuelve a mostrar la búsqueda actual o, si no hay, las sugerencias.
+    refresh = func() {
+        if strings.TrimSpace(searchEntry.Text) != "" {
+            search()
+        } else {
+            suggest()
+        }
+    }
+
+    suggestButton := widget.NewButton("Sugerir", func() {
+        searchEntry.SetText("")
+        suggest()
+    })
+
+    window.SetContent(container.NewBorder(
+        container.NewVBox(container.NewBorder(nil, nil, suggestButton, nil, searchEntry), status), // Parte superior.
+        nil,                               // Parte inferior.
+        nil,                               // Parte izquierda.
+        nil,                               // Parte derecha.
+        container.NewVScroll(clustersBox), // Grupos de intérpretes.
+    ))
+    window.Resize(fyne.NewSize(900, 600))
+    window.Show()
+    suggest()
+}
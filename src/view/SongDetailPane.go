@@ -0,0 +1,201 @@
+package view
+
+import (
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/canvas"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/theme"
+    "fyne.io/fyne/v2/widget"
+    "github.com/IsaacEscobar09/MusicDataBase/src/controller"
+    "github.com/IsaacEscobar09/MusicDataBase/src/model"
+)
+
+const coverSize = 220     // Tamaño (en pixeles) de la portada en el panel de detalle.
+const thumbnailSize = 140 // Tamaño (en pixeles) de las miniaturas en la cuadrícula de álbumes.
+
+// SongDetailPane es el panel lateral que muestra la portada y la información de la canción seleccionada.
+type SongDetailPane struct {
+    Container  *fyne.Container   // Contenedor que se coloca en la ventana.
+    cover      *canvas.Image     // Imagen de la portada del álbum.
+    info       *widget.Form      // Campos con la información de la canción.
+    infoArea   *fyne.Container   // Contiene la información o, en modo de edición, el formulario para editarla.
+    editButton *widget.Button    // Botón que activa el modo de edición.
+    lyrics     *fyne.Container   // Letras de la canción, una tarjeta por cada letra.
+    frames     *widget.Accordion // Tramas de las etiquetas tal como se leyeron, plegadas por defecto.
+    song       model.Song        // Canción que se muestra.
+
+    // OnEdit guarda los datos editados de la canción; si regresa un error, el panel sigue en modo de edición.
+    OnEdit func(song model.Song, edit model.SongEdit) error
+}
+
+// NewSongDetailPane crea el panel de detalle vacío, mostrando un ícono genérico en lugar de la portada.
+func NewSongDetailPane() *SongDetailPane {
+    cover := canvas.NewImageFromResource(theme.MediaMusicIcon())
+    cover.FillMode = canvas.ImageFillContain
+    cover.SetMinSize(fyne.NewSize(coverSize, coverSize))
+
+    info := widget.NewForm()
+    pane := &SongDetailPane{cover: cover, info: info, infoArea: container.NewStack(info), lyrics: container.NewVBox(), frames: widget.NewAccordion()}
+    pane.editButton = widget.NewButtonWithIcon("Editar", theme.DocumentCreateIcon(), pane.startEditing)
+    pane.editButton.Disable()
+    pane.Container = container.NewVBox(cover, pane.editButton, pane.infoArea, pane.lyrics, pane.frames)
+    return pane
+}
+
+// startEditing cambia la información de la canción por un formulario con sus datos principales. Al guardar se llama
+// a OnEdit; al cancelar, o si OnEdit termina sin errores, se vuelve a mostrar la información.
+func (p *SongDetailPane) startEditing() {
+    song := p.song
+    current := model.EditOf(song)
+    entries := []struct {
+        label string
+        value *string
+    }{
+        {"Canción", &current.Title},
+        {"Performer", &current.Artist},
+        {"Álbum", &current.Album},
+        {"Año", &current.Year},
+        {"Genero", &current.Genre},
+        {"No. de pista", &current.Track},
+    }
+
+    form := &widget.Form{SubmitText: "Guardar", CancelText: "Cancelar"}
+    values := make([]*widget.Entry, len(entries))
+    for i, entry := range entries {
+        values[i] = widget.NewEntry()
+        values[i].SetText(*entry.value)
+        form.Append(entry.label, values[i])
+    }
+
+    stopEditing := func() {
+        p.infoArea.Objects = []fyne.CanvasObject{p.info}
+        p.infoArea.Refresh()
+        p.editButton.Enable()
+    }
+    form.OnCancel = stopEditing
+    form.OnSubmit = func() {
+        for i, entry := range entries {
+            *entry.value = values[i].Text
+        }
+        if p.OnEdit != nil && p.OnEdit(song, current) != nil {
+            return
+        }
+        stopEditing()
+    }
+
+    p.editButton.Disable()
+    p.infoArea.Objects = []fyne.CanvasObject{form}
+    p.infoArea.Refresh()
+}
+
+// Song regresa la canción que se muestra en el panel, con IDRola 0 si todavía no se muestra ninguna.
+func (p *SongDetailPane) Song() model.Song {
+    return p.song
+}
+
+// ShowSong actualiza el panel con la portada, los datos, las letras y las tramas de las etiquetas de la canción.
+// Se muestran todas las columnas con valor, incluso las que están ocultas en la tabla, indicando de dónde se obtuvieron
+// los datos que no vienen de las etiquetas y cuáles datos principales se desconocen.
+func (p *SongDetailPane) ShowSong(song model.Song, columns []*controller.SongColumn, lyrics []model.Lyrics, frames []model.TagFrame) {
+    setCoverImage(p.cover, song.CoverPath)
+    p.song = song
+    p.infoArea.Objects = []fyne.CanvasObject{p.info}
+    p.infoArea.Refresh()
+    if p.OnEdit != nil {
+        p.editButton.Enable()
+    }
+
+    p.info.Items = nil
+    for _, column := range columns {
+        value := column.Value(song)
+        switch {
+        case value == "" && column.Field != "":
+            // Los datos que faltan se muestran atenuados para distinguirlos de los que sí se conocen.
+            label := wrappedLabel("Desconocido")
+            label.TextStyle = fyne.TextStyle{Italic: true}
+            label.Importance = widget.LowImportance
+            p.info.Append(column.Header, label)
+        case value != "":
+            source := song.Source(column.Field)
+            if source != "" && source != model.SourceTag {
+                label := wrappedLabel(value + " (" + model.SourceLabel(source) + ")")
+                label.TextStyle = fyne.TextStyle{Italic: true}
+                p.info.Append(column.Header, label)
+            } else {
+                p.info.Append(column.Header, wrappedLabel(value))
+            }
+        }
+    }
+    p.info.Refresh()
+
+    p.lyrics.Objects = nil
+    for _, l := range lyrics {
+        subtitle := l.Description
+        if l.Language != "" {
+            subtitle = strings.TrimSpace("[" + l.Language + "] " + subtitle)
+        }
+        p.lyrics.Add(widget.NewCard("Letra", subtitle, wrappedLabel(l.Text)))
+    }
+    p.lyrics.Refresh()
+
+    p.frames.Items = nil
+    if len(frames) > 0 {
+        form := widget.NewForm()
+        for _, frame := range frames {
+            form.Append(frame.Name, wrappedLabel(frame.Value))
+        }
+        p.frames.Append(widget.NewAccordionItem("Tramas de las etiquetas", form))
+    }
+    p.frames.Refresh()
+}
+
+// wrappedLabel crea una etiqueta que ajusta su texto al ancho disponible.
+func wrappedLabel(text string) *widget.Label {
+    label := widget.NewLabel(text)
+    label.Wrapping = fyne.TextWrapWord
+    return label
+}
+
+// setCoverImage carga la portada desde la caché o, si no hay portada, el ícono genérico.
+func setCoverImage(image *canvas.Image, coverPath string) {
+    if coverPath == "" {
+        image.File = ""
+        image.Resource = theme.MediaMusicIcon()
+    } else {
+        image.Resource = nil
+        image.File = coverPath
+    }
+    image.Refresh()
+}
+
+// NewAlbumGrid crea una cuadrícula de miniaturas con las portadas de los álbumes.
+// La función albums se consulta cada vez que la cuadrícula se refresca y onSelected se llama al elegir un álbum.
+func NewAlbumGrid(albums func() []model.Album, onSelected func(model.Album)) *widget.GridWrap {
+    grid := widget.NewGridWrap(
+        func() int {
+            return len(albums())
+        },
+        func() fyne.CanvasObject {
+            thumbnail := canvas.NewImageFromResource(theme.MediaMusicIcon())
+            thumbnail.FillMode = canvas.ImageFillContain
+            thumbnail.SetMinSize(fyne.NewSize(thumbnailSize, thumbnailSize))
+            label := widget.NewLabel("")
+            label.Alignment = fyne.TextAlignCenter
+            label.Truncation = fyne.TextTruncateEllipsis
+            return container.NewBorder(nil, label, nil, nil, thumbnail)
+        },
+        func(id widget.GridWrapItemID, item fyne.CanvasObject) {
+            album := albums()[id]
+            cell := item.(*fyne.Container)
+            setCoverImage(cell.Objects[0].(*canvas.Image), album.CoverPath)
+            cell.Objects[1].(*widget.Label).SetText(album.Name)
+        },
+    )
+    grid.OnSelected = func(id widget.GridWrapItemID) {
+        onSelected(albums()[id])
+        grid.UnselectAll()
+    }
+    return grid
+}